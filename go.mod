@@ -6,6 +6,8 @@ require github.com/BurntSushi/toml v1.5.0
 
 require github.com/klauspost/compress v1.18.0
 
+require github.com/andybalholm/brotli v1.2.0
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
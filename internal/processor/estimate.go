@@ -0,0 +1,231 @@
+package processor
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultFeedrate is used for moves before the first F word, in mm/min
+const defaultFeedrate = 3000.0
+
+// slicerEstimateRegexes match print time estimates written by common slicers
+var slicerEstimateRegexes = []*regexp.Regexp{
+	regexp.MustCompile(`^;\s*model printing time:\s*([^;]+)`),                      // Bambu Studio, OrcaSlicer
+	regexp.MustCompile(`^;\s*estimated printing time \(normal mode\)\s*=\s*(.+)$`), // PrusaSlicer
+	regexp.MustCompile(`^;\s*total estimated time:\s*([^;]+)`),                     // Bambu Studio, OrcaSlicer
+	regexp.MustCompile(`^;TIME:(\d+)$`),                                            // Cura, seconds
+}
+
+var durationPartRegex = regexp.MustCompile(`(\d+)\s*([dhms])`)
+
+// estimateIterationDuration estimates how long one iteration prints. The slicer's estimate from
+// the file comments is preferred; without it the body moves are timed at their feedrates.
+func (p *StreamingProcessor) estimateIterationDuration(filePath string) (time.Duration, error) {
+	estimate, found, err := findSlicerEstimate(filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	if found {
+		return estimate, nil
+	}
+
+	return p.estimateMovesDuration(filePath, p.positions.EndInitSectionLastLine+1, p.bodyLastLine())
+}
+
+// findSlicerEstimate scans the file comments for a slicer print time estimate
+func findSlicerEstimate(filePath string) (time.Duration, bool, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, false, err
+	}
+	defer file.Close()
+
+	var (
+		best     time.Duration
+		bestRank = len(slicerEstimateRegexes)
+	)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		// Earlier regexes are more specific, keep the best ranked match
+		for rank, re := range slicerEstimateRegexes[:bestRank] {
+			match := re.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+
+			duration, ok := parseSlicerDuration(match[1])
+			if ok {
+				best = duration
+				bestRank = rank
+
+				break
+			}
+		}
+	}
+
+	return best, bestRank < len(slicerEstimateRegexes), scanner.Err()
+}
+
+// parseSlicerDuration parses "1d 2h 3m 4s" style durations or a plain number of seconds
+func parseSlicerDuration(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+
+	seconds, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	parts := durationPartRegex.FindAllStringSubmatch(s, -1)
+	if parts == nil {
+		return 0, false
+	}
+
+	units := map[string]time.Duration{"d": 24 * time.Hour, "h": time.Hour, "m": time.Minute, "s": time.Second}
+
+	var total time.Duration
+
+	for _, part := range parts {
+		value, err := strconv.ParseInt(part[1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+
+		total += time.Duration(value) * units[part[2]]
+	}
+
+	return total, true
+}
+
+// estimateMovesDuration sums the time of G1 moves from startLine to endLine (inclusive)
+// assuming absolute positioning and the last seen feedrate
+func (p *StreamingProcessor) estimateMovesDuration(filePath string, startLine, endLine int64) (time.Duration, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var (
+		x, y, z  float64
+		feedrate = defaultFeedrate
+		seconds  float64
+	)
+
+	scanner := bufio.NewScanner(file)
+	lineNum := int64(0)
+
+	for scanner.Scan() {
+		if lineNum > endLine {
+			break
+		}
+
+		coords := p.parseGCodeLine(scanner.Text())
+		if coords != nil {
+			if coords.F != nil && *coords.F > 0 {
+				feedrate = *coords.F
+			}
+
+			nx, ny, nz := x, y, z
+			if coords.X != nil {
+				nx = *coords.X
+			}
+
+			if coords.Y != nil {
+				ny = *coords.Y
+			}
+
+			if coords.Z != nil {
+				nz = *coords.Z
+			}
+
+			if lineNum >= startLine {
+				distance := math.Sqrt((nx-x)*(nx-x) + (ny-y)*(ny-y) + (nz-z)*(nz-z))
+				seconds += distance / (feedrate / 60)
+			}
+
+			x, y, z = nx, ny, nz
+		}
+
+		lineNum++
+	}
+
+	return time.Duration(seconds * float64(time.Second)), scanner.Err()
+}
+
+// estimatedMoveSeconds is the rough average duration of a body move used by EstimateLoopTime, slicers
+// split curves into many short moves
+const estimatedMoveSeconds = 0.05
+
+// LoopEstimate is a rough projection of the time looping adds to a print. Moves are counted, not
+// simulated, and heating or waiting on temperatures is not modeled.
+type LoopEstimate struct {
+	BodySeconds      float64 `json:"body_seconds"`      // One print of the body, its dwells and moves
+	GeneratedSeconds float64 `json:"generated_seconds"` // Dwells of the generated content of one iteration
+	AddedSeconds     float64 `json:"added_seconds"`     // The repeated bodies and all generated content
+}
+
+// EstimateLoopTime estimates how much longer the looped print takes than the original one: the body
+// prints Iterations-1 more times and every iteration adds its generated content
+func EstimateLoopTime(positions MarkerPositions, config ProcessingRequest) (LoopEstimate, error) {
+	block, err := RenderGeneratedBlock(config, positions)
+	if err != nil {
+		return LoopEstimate{}, err
+	}
+
+	var generated float64
+	for line := range strings.SplitSeq(block, "\n") {
+		generated += dwellSeconds(line)
+	}
+
+	body := positions.BodyDwellSeconds + float64(positions.BodyMoves)*estimatedMoveSeconds
+
+	return LoopEstimate{
+		BodySeconds:      body,
+		GeneratedSeconds: generated,
+		AddedSeconds:     float64(config.Iterations-1)*body + float64(config.Iterations)*generated,
+	}, nil
+}
+
+// dwellSeconds returns the duration of a G4 dwell, P in milliseconds or S in seconds, and 0 for other
+// lines. Like Marlin, S wins when both are given.
+func dwellSeconds(line string) float64 {
+	fields := strings.Fields(strings.ToUpper(stripComment(line, ";")))
+	if len(fields) == 0 || (fields[0] != "G4" && fields[0] != "G04") {
+		return 0
+	}
+
+	var seconds float64
+
+	for _, unit := range []string{"P", "S"} {
+		for _, field := range fields[1:] {
+			value, found := strings.CutPrefix(field, unit)
+			if !found {
+				continue
+			}
+
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed < 0 {
+				continue
+			}
+
+			seconds = parsed
+			if unit == "P" {
+				seconds /= 1000
+			}
+		}
+	}
+
+	return seconds
+}
@@ -0,0 +1,225 @@
+package processor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSlicerDuration(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input    string
+		expected time.Duration
+		ok       bool
+	}{
+		{input: "1h 30m 0s", expected: 90 * time.Minute, ok: true},
+		{input: "1d 2h 3m 4s", expected: 26*time.Hour + 3*time.Minute + 4*time.Second, ok: true},
+		{input: "45m 10s", expected: 45*time.Minute + 10*time.Second, ok: true},
+		{input: "3723", expected: 3723 * time.Second, ok: true},
+		{input: "unknown", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			result, ok := parseSlicerDuration(tt.input)
+			if ok != tt.ok {
+				t.Fatalf("Expected ok=%v, got %v", tt.ok, ok)
+			}
+
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestProcessFile_IterationEta(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "M117 Copy {{.Iteration}} each {{.IterationEta}} total {{.TotalEta}} left {{.RemainingEta}}")
+
+	tests := []struct {
+		name     string
+		input    []string
+		expected []string
+	}{
+		{
+			name: "Bambu Studio header estimate",
+			input: []string{
+				"; model printing time: 1h 30m 0s; total estimated time: 1h 35m 0s",
+				"START_PRINT",
+				"G1 X10 Y10 E1",
+				"END_PRINT",
+			},
+			expected: []string{
+				"M117 Copy 1 each 1h30m0s total 4h30m0s left 3h0m0s",
+				"M117 Copy 2 each 1h30m0s total 4h30m0s left 1h30m0s",
+				"M117 Copy 3 each 1h30m0s total 4h30m0s left 0s",
+			},
+		},
+		{
+			name: "PrusaSlicer footer estimate",
+			input: []string{
+				"START_PRINT",
+				"G1 X10 Y10 E1",
+				"END_PRINT",
+				"; estimated printing time (normal mode) = 20m 5s",
+			},
+			expected: []string{
+				"M117 Copy 1 each 20m5s total 1h0m15s left 40m10s",
+				"M117 Copy 2 each 20m5s total 1h0m15s left 20m5s",
+				"M117 Copy 3 each 20m5s total 1h0m15s left 0s",
+			},
+		},
+		{
+			name: "move heuristic without slicer estimate",
+			input: []string{
+				"G1 X0 Y0 F6000",
+				"START_PRINT",
+				"G1 X100 Y0 E1",
+				"G1 X100 Y50 E1 F3000",
+				"END_PRINT",
+			},
+			expected: []string{
+				"M117 Copy 1 each 2s total 6s left 4s",
+				"M117 Copy 2 each 2s total 6s left 2s",
+				"M117 Copy 3 each 2s total 6s left 0s",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, tt.input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     3,
+				Printer:        "unit-tests",
+				CustomTemplate: customTemplate,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			output, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			var messages []string
+
+			for _, line := range output {
+				if strings.HasPrefix(line, "M117") {
+					messages = append(messages, line)
+				}
+			}
+
+			if !equalStringSlices(messages, tt.expected) {
+				t.Errorf("Output mismatch\nExpected:\n%s\nActual:\n%s",
+					strings.Join(tt.expected, "\n"),
+					strings.Join(messages, "\n"))
+			}
+		})
+	}
+}
+
+func TestDwellSeconds(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		line     string
+		expected float64
+	}{
+		{line: "G4 P500", expected: 0.5},
+		{line: "G4 S2", expected: 2},
+		{line: "g4 s1.5 ; wait", expected: 1.5},
+		{line: "G04 P250", expected: 0.25},
+		{line: "G4 P500 S3", expected: 3},
+		{line: "G4", expected: 0},
+		{line: "G4 P-100", expected: 0},
+		{line: "; G4 S10", expected: 0},
+		{line: "G1 X10 S5", expected: 0},
+		{line: "G40 S5", expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			t.Parallel()
+
+			result := dwellSeconds(tt.line)
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestScanPositions_BodyTiming(t *testing.T) {
+	t.Parallel()
+
+	inputPath := filepath.Join(t.TempDir(), "input.gcode")
+
+	err := writeLinesToFile(inputPath, []string{
+		"G4 S60",
+		"START_PRINT",
+		"G1 X10 Y10 E1",
+		"G4 P1500",
+		"G0 X20 Y20",
+		"M400",
+		"G4 S2 ; settle",
+		"END_PRINT",
+		"G4 S30",
+	})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	positions, err := scanTestPositions(inputPath, 1, 7, 7)
+	if err != nil {
+		t.Fatalf("scanPositions failed: %v", err)
+	}
+
+	if positions.BodyMoves != 2 || positions.BodyDwellSeconds != 3.5 {
+		t.Errorf("Expected 2 moves and 3.5s of dwells, got %d moves and %vs", positions.BodyMoves, positions.BodyDwellSeconds)
+	}
+}
+
+func TestEstimateLoopTime(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "G4 S{{.Request.WaitMin}}\nG1 Y200\nG4 P500")
+
+	estimate, err := EstimateLoopTime(MarkerPositions{BodyMoves: 1000, BodyDwellSeconds: 10}, ProcessingRequest{
+		Iterations:     3,
+		WaitMin:        120,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	})
+	if err != nil {
+		t.Fatalf("EstimateLoopTime failed: %v", err)
+	}
+
+	expected := LoopEstimate{BodySeconds: 60, GeneratedSeconds: 120.5, AddedSeconds: 2*60 + 3*120.5}
+	if estimate != expected {
+		t.Errorf("Expected %+v, got %+v", expected, estimate)
+	}
+}
@@ -0,0 +1,260 @@
+package processor
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Fragments shipped with printloop, available to every template as {{template "<file name>" .}}
+//
+//go:embed fragments/*.tmpl
+var embeddedFragments embed.FS
+
+// Snippets shared by the printer definitions, one TOML key per {{template "<key>" .}} name. The
+// leading underscore keeps the file out of ListPrinters.
+const sharedPartialsFile = "printers/_partials.toml"
+
+// parseTemplate parses code together with the embedded fragments, the shared partials and the printer
+// definition's own Fragments, later ones taking precedence for the same name. Every {{template "name"}}
+// reference must resolve to a fragment or a {{define}} block.
+func parseTemplate(funcs template.FuncMap, code string, fragments map[string]string) (*template.Template, error) {
+	tmpl := template.New("printer").Funcs(funcs)
+
+	entries, err := embeddedFragments.ReadDir("fragments")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		data, err := embeddedFragments.ReadFile(path.Join("fragments", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSuffix(entry.Name(), ".tmpl")
+
+		_, err = tmpl.New(name).Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse embedded fragment %q: %w", name, err)
+		}
+	}
+
+	partials, err := loadSharedPartials()
+	if err != nil {
+		return nil, err
+	}
+
+	for name, partial := range partials {
+		_, err = tmpl.New(name).Parse(partial)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse shared partial %q: %w", name, err)
+		}
+	}
+
+	for name, fragment := range fragments {
+		_, err = tmpl.New(name).Parse(fragment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse fragment %q: %w", name, err)
+		}
+	}
+
+	_, err = tmpl.Parse(code)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateTemplateReferences(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	err = countLoopSteps(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// loopStepFunc is the function every range iteration calls first, see countLoopSteps
+const loopStepFunc = "loopStep"
+
+// maxTemplateLoopSteps bounds the range iterations of one template execution. A loop that writes
+// nothing never reaches maxTemplateOutput and would keep running after executeLimited gave up on it.
+const maxTemplateLoopSteps = 1_000_000
+
+var errTemplateLoopLimit = fmt.Errorf("template loops exceed %d iterations", maxTemplateLoopSteps)
+
+// countLoopSteps makes the body of every {{range}} in tmpl start with a call of loopStepFunc, which
+// executeLimited replaces with a counter that fails the execution after maxTemplateLoopSteps. The
+// function tmpl gets here doesn't count, for executions without limits.
+func countLoopSteps(tmpl *template.Template) error {
+	noLimit := template.FuncMap{loopStepFunc: func() string { return "" }}
+
+	step, err := template.New(loopStepFunc).Funcs(noLimit).Parse("{{" + loopStepFunc + "}}")
+	if err != nil {
+		return err
+	}
+
+	stepNode := step.Root.Nodes[0]
+
+	tmpl.Funcs(noLimit)
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+
+		_ = walkNodes(t.Root, func(node parse.Node) error {
+			if n, ok := node.(*parse.RangeNode); ok {
+				if n.List == nil {
+					n.List = &parse.ListNode{NodeType: parse.NodeList, Pos: n.Pos}
+				}
+
+				n.List.Nodes = append([]parse.Node{stepNode.Copy()}, n.List.Nodes...)
+			}
+
+			return nil
+		})
+	}
+
+	return nil
+}
+
+// loopStepCounter returns a loopStepFunc that fails after maxTemplateLoopSteps calls
+func loopStepCounter() template.FuncMap {
+	var steps int
+
+	return template.FuncMap{loopStepFunc: func() (string, error) {
+		steps++
+		if steps > maxTemplateLoopSteps {
+			return "", errTemplateLoopLimit
+		}
+
+		return "", nil
+	}}
+}
+
+// loadSharedPartials reads the snippets of sharedPartialsFile
+func loadSharedPartials() (map[string]string, error) {
+	data, err := printerConfigs.ReadFile(sharedPartialsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var partials map[string]string
+
+	err = toml.Unmarshal(data, &partials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load shared partials: %w", err)
+	}
+
+	return partials, nil
+}
+
+// validateTemplateReferences checks that every {{template}} action names a defined template
+func validateTemplateReferences(tmpl *template.Template) error {
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+
+		err := walkTemplateNodes(t.Root, func(node *parse.TemplateNode) error {
+			if tmpl.Lookup(node.Name) == nil {
+				return fmt.Errorf("template references unknown fragment %q", node.Name)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// templateMentions reports whether the template code or a fragment or partial it includes contains s
+func (p *StreamingProcessor) templateMentions(s string) bool {
+	if strings.Contains(p.printerDef.Template.Code, s) {
+		return true
+	}
+
+	visited := make(map[string]bool)
+
+	var mentions func(t *template.Template) bool
+
+	mentions = func(t *template.Template) bool {
+		if t == nil || t.Tree == nil || visited[t.Name()] {
+			return false
+		}
+
+		visited[t.Name()] = true
+
+		if strings.Contains(t.Root.String(), s) {
+			return true
+		}
+
+		found := false
+
+		_ = walkTemplateNodes(t.Root, func(node *parse.TemplateNode) error {
+			found = found || mentions(p.template.Lookup(node.Name))
+			return nil
+		})
+
+		return found
+	}
+
+	return mentions(p.template)
+}
+
+// walkTemplateNodes calls fn for each {{template}} action below node
+func walkTemplateNodes(node parse.Node, fn func(*parse.TemplateNode) error) error {
+	return walkNodes(node, func(node parse.Node) error {
+		if n, ok := node.(*parse.TemplateNode); ok {
+			return fn(n)
+		}
+
+		return nil
+	})
+}
+
+// walkNodes calls fn for node and every action and control structure below it
+func walkNodes(node parse.Node, fn func(parse.Node) error) error {
+	if n, ok := node.(*parse.ListNode); !ok || n != nil {
+		err := fn(node)
+		if err != nil {
+			return err
+		}
+	}
+
+	var children []parse.Node
+
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n != nil {
+			children = n.Nodes
+		}
+	case *parse.IfNode:
+		children = []parse.Node{n.List, n.ElseList}
+	case *parse.RangeNode:
+		children = []parse.Node{n.List, n.ElseList}
+	case *parse.WithNode:
+		children = []parse.Node{n.List, n.ElseList}
+	}
+
+	for _, child := range children {
+		err := walkNodes(child, fn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
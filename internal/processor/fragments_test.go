@@ -0,0 +1,277 @@
+package processor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func fragmentsTemplate(code, fragments string) string {
+	return `
+Name = "test-fragments"
+[Markers]
+EndInitSection = ["START_PRINT"]
+EndPrintSection = ["END_PRINT"]
+[SearchStrategy]
+EndInitSectionStrategy = "after_first_appear"
+EndPrintSectionStrategy = "after_last_appear"
+[Template]
+Code = """` + code + `"""
+[Fragments]
+` + fragments
+}
+
+func TestProcessFile_Fragments(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"HEADER", "START_PRINT", "G1 X10 Y10 E1", "END_PRINT", "FOOTER"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	customTemplate := fragmentsTemplate(`{{template "cooldown" .}}
+{{template "eject" .}}`, `cooldown = "; cooldown {{.Iteration}}"
+eject = "; eject {{.Iteration}}"
+`)
+
+	processor, err := NewStreamingProcessor(ProcessingRequest{
+		Iterations:     2,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	err = processor.ProcessFile(inputPath, outputPath)
+	if err != nil {
+		t.Fatalf("ProcessFile failed: %v", err)
+	}
+
+	output, err := readLinesFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	expected := []string{
+		"HEADER",
+		"START_PRINT",
+		"G1 X10 Y10 E1",
+		"END_PRINT",
+		"; cooldown 1",
+		"; eject 1",
+		"G1 X10 Y10 E1",
+		"END_PRINT",
+		"; cooldown 2",
+		"; eject 2",
+		"FOOTER",
+	}
+
+	if !equalStringSlices(output, expected) {
+		t.Errorf("Output mismatch:\nExpected: %v\nGot: %v", expected, output)
+	}
+}
+
+func TestParseTemplate_Fragments(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		code        string
+		fragments   string
+		expectError string
+		expected    string
+	}{
+		{
+			name:        "unknown fragment",
+			code:        `{{template "missing" .}}`,
+			expectError: `unknown fragment "missing"`,
+		},
+		{
+			name:        "unknown fragment inside conditional",
+			code:        `{{if .}}{{template "missing" .}}{{end}}`,
+			expectError: `unknown fragment "missing"`,
+		},
+		{
+			name:        "unknown fragment referenced by a fragment",
+			code:        `{{template "outer" .}}`,
+			fragments:   `outer = '{{template "inner" .}}'`,
+			expectError: `unknown fragment "inner"`,
+		},
+		{
+			name:        "invalid fragment",
+			code:        `{{template "broken" .}}`,
+			fragments:   `broken = "{{if}}"`,
+			expectError: `failed to parse fragment "broken"`,
+		},
+		{
+			name:     "define block in code",
+			code:     `{{define "local"}}local{{end}}{{template "local"}}`,
+			expected: "local",
+		},
+		{
+			name:     "embedded fragment",
+			code:     `{{template "bambu-pause" .}}`,
+			expected: ";music",
+		},
+		{
+			name:      "provided fragment overrides shared partial",
+			code:      `{{template "bed-cooldown" .}}`,
+			fragments: `bed-cooldown = "M190 R35"`,
+			expected:  "M190 R35",
+		},
+		{
+			name:      "provided fragment overrides embedded one",
+			code:      `{{template "bambu-pause" .}}`,
+			fragments: `bambu-pause = "M400 U1"`,
+			expected:  "M400 U1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     1,
+				Printer:        "unit-tests",
+				CustomTemplate: fragmentsTemplate(tt.code, tt.fragments),
+			})
+
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Fatalf("Expected error containing %q, got: %v", tt.expectError, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			var output strings.Builder
+
+			err = processor.template.Execute(&output, struct{}{})
+			if err != nil {
+				t.Fatalf("Failed to execute template: %v", err)
+			}
+
+			if !strings.Contains(output.String(), tt.expected) {
+				t.Errorf("Expected output containing %q, got %q", tt.expected, output.String())
+			}
+		})
+	}
+}
+
+func TestProcessFile_SharedPartials(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"M190 S60", "START_PRINT", "G1 X10 Y10 E1", "G1 X30 Y10 E1", "END_PRINT", "FOOTER"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	// The cooldown comes from the partial, the wait is still inserted as the template does not place it
+	customTemplate := fragmentsTemplate(`{{template "bed-cooldown" .}}
+{{template "bed-reheat" .}}`, "")
+
+	err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+		Iterations:          1,
+		WaitBedCooldownTemp: 40,
+		WaitMin:             2,
+		Printer:             "unit-tests",
+		CustomTemplate:      customTemplate,
+	})
+	if err != nil {
+		t.Fatalf("ProcessFile failed: %v", err)
+	}
+
+	output, err := readLinesFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	expected := []string{
+		"M190 S60",
+		"START_PRINT",
+		"G1 X10 Y10 E1",
+		"G1 X30 Y10 E1",
+		"END_PRINT",
+		"G4 S120",
+		"M190 S40 ; Set bed target temperature",
+		"M190 R40 ; Wait for bed to reach temperature ",
+		"M190 S60  ; Re-heat bed to original temperature",
+		"FOOTER",
+	}
+
+	if !equalStringSlices(output, expected) {
+		t.Errorf("Output mismatch:\nExpected: %q\nGot: %q", expected, output)
+	}
+}
+
+func TestNewStreamingProcessor_UndefinedParameter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		code      string
+		fragments string
+		expected  string
+	}{
+		{name: "defined parameter", code: `; speed {{.Config.Speed}}`},
+		{name: "defined in a branch not taken", code: `{{if gt .Iteration 1}}{{.Config.Nonexistent}}{{end}}`},
+		{name: "missing parameter", code: `; speed {{.Config.Nonexistent}}`, expected: `map has no entry for key "Nonexistent"`},
+		{name: "missing in fragment", code: `{{template "park" .}}`, fragments: `park = "G1 X{{.Config.ParkX}}"`, expected: `map has no entry for key "ParkX"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			customTemplate := strings.Replace(fragmentsTemplate(tt.code, tt.fragments), "[Fragments]", "[Parameters]\nSpeed = 100\n[Fragments]", 1)
+
+			_, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     1,
+				Printer:        "unit-tests",
+				CustomTemplate: customTemplate,
+			})
+
+			if tt.expected == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), "undefined parameter") || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error naming %s, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestCheckTemplateParameters_Printers(t *testing.T) {
+	t.Parallel()
+
+	for _, printer := range ListPrinters() {
+		processor, err := NewStreamingProcessor(ProcessingRequest{Iterations: 1, Printer: printer.Key})
+		if err != nil {
+			t.Fatalf("Failed to create processor for %s: %v", printer.Key, err)
+		}
+
+		err = processor.checkTemplateParameters()
+		if err != nil {
+			t.Errorf("Printer %s references an undefined parameter: %v", printer.Key, err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Klipper macro names slicer profiles commonly call to start a print
+var klipperStartMacros = []string{"PRINT_START", "START_PRINT"}
+
+// ImportConfig converts an existing firmware configuration into a printer definition, ready to be
+// tweaked and used as a custom template. Only klipper (printer.cfg) is supported so far.
+func ImportConfig(format string, data []byte) (*PrinterDefinition, error) {
+	switch strings.ToLower(format) {
+	case "klipper":
+		return importKlipperConfig(data)
+	default:
+		return nil, fmt.Errorf("invalid format value %q: must be klipper", format)
+	}
+}
+
+// importKlipperConfig builds on the Klipper printer profile, taking the bed size from the stepper
+// travel limits and the init section marker from the start macro. The end macro can't mark the print
+// section, end markers are repeated by every iteration, so the profile's EXCLUDE_OBJECT_END marker is
+// kept and the config must enable [exclude_object].
+func importKlipperConfig(data []byte) (*PrinterDefinition, error) {
+	sections, err := parseKlipperConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	printer, found := sections["printer"]
+	if !found {
+		return nil, errors.New("klipper config missing [printer] section")
+	}
+
+	if _, found := sections["exclude_object"]; !found {
+		return nil, errors.New("klipper config missing [exclude_object] section: the print section ends with the last EXCLUDE_OBJECT_END")
+	}
+
+	def, err := loadPrinterDefinition("klipper")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load printer definition: %w", err)
+	}
+
+	def.Name = "Klipper"
+	if kinematics := printer["kinematics"]; kinematics != "" {
+		def.Name += " " + kinematics
+	}
+
+	profileBed := def.Bed
+
+	for _, axis := range []struct {
+		section string
+		size    *float64
+	}{{"stepper_x", &def.Bed.X}, {"stepper_y", &def.Bed.Y}, {"stepper_z", &def.Bed.Z}} {
+		value, found := sections[axis.section]["position_max"]
+		if !found {
+			continue
+		}
+
+		size, err := strconv.ParseFloat(value, 64)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid [%s] position_max value %q: must be a positive number", axis.section, value)
+		}
+
+		*axis.size = size
+	}
+
+	shiftBedLimits(def, def.Bed.X-profileBed.X, def.Bed.Y-profileBed.Y)
+
+	if macro := findKlipperMacro(sections, klipperStartMacros); macro != "" {
+		def.Markers.EndInitSection = []string{`(?i)^` + regexp.QuoteMeta(macro) + `\b`}
+	}
+
+	return def, nil
+}
+
+// parseKlipperConfig reads the options of each section of a Klipper config, keyed by the lower case
+// section name. Indented continuation lines, like macro G-code, are skipped.
+func parseKlipperConfig(data []byte) (map[string]map[string]string, error) {
+	sections := make(map[string]map[string]string)
+
+	var current map[string]string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+
+		line = strings.TrimSpace(stripKlipperComment(line))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.ToLower(strings.Join(strings.Fields(line[1:len(line)-1]), " "))
+
+			current = sections[name]
+			if current == nil {
+				current = make(map[string]string)
+				sections[name] = current
+			}
+
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if equalsKey, equalsValue, equals := strings.Cut(line, "="); equals && (!found || len(equalsKey) < len(key)) {
+			key, value, found = equalsKey, equalsValue, true
+		}
+
+		if !found || current == nil {
+			continue
+		}
+
+		current[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+
+	return sections, scanner.Err()
+}
+
+// stripKlipperComment removes a # or ; comment from a config line
+func stripKlipperComment(line string) string {
+	if i := strings.IndexAny(line, "#;"); i >= 0 {
+		return line[:i]
+	}
+
+	return line
+}
+
+// findKlipperMacro returns the first of names defined as a [gcode_macro]
+func findKlipperMacro(sections map[string]map[string]string, names []string) string {
+	for _, name := range names {
+		if _, found := sections["gcode_macro "+strings.ToLower(name)]; found {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// shiftBedLimits moves the upper bounds of the X and Y assertions and the BackY parameter of a
+// definition written for another bed size
+func shiftBedLimits(def *PrinterDefinition, dx, dy float64) {
+	if backY, ok := def.Parameters["BackY"].(float64); ok {
+		def.Parameters["BackY"] = backY + dy
+	}
+
+	for name, bounds := range def.Assertions {
+		if len(bounds) != 2 {
+			continue
+		}
+
+		upper, ok := bounds[1].(float64)
+		if !ok {
+			if value, isInt := bounds[1].(int64); isInt {
+				upper, ok = float64(value), true
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		switch {
+		case strings.HasSuffix(name, "X"):
+			def.Assertions[name] = []any{bounds[0], upper + dx}
+		case strings.HasSuffix(name, "Y"):
+			def.Assertions[name] = []any{bounds[0], upper + dy}
+		}
+	}
+}
+
+// MarshalPrinterDefinition encodes a printer definition as TOML, the template code as a multiline
+// string so it stays editable
+func MarshalPrinterDefinition(def *PrinterDefinition) ([]byte, error) {
+	code := def.Template.Code
+
+	encoded := *def
+	encoded.Template.Code = ""
+
+	var buf bytes.Buffer
+
+	encoder := toml.NewEncoder(&buf)
+	encoder.Indent = ""
+
+	err := encoder.Encode(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode printer definition: %w", err)
+	}
+
+	// Literal strings keep backslashes as written, they only can't contain their own delimiter
+	if strings.Contains(code, "'''") {
+		return buf.Bytes(), nil
+	}
+
+	template := strings.Replace(buf.String(), "[Template]\nCode = \"\"\n", "[Template]\nCode = '''"+code+"'''\n", 1)
+
+	return []byte(template), nil
+}
@@ -0,0 +1,165 @@
+package processor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const klipperConfig = `# This file contains common pin mappings for a corexy printer
+[include mainsail.cfg]
+
+[printer]
+kinematics: corexy
+max_velocity: 300
+max_accel: 3000
+
+[stepper_x]
+step_pin: PB13
+position_endstop: 0
+position_max = 300 # full travel
+
+[stepper_y]
+position_endstop: 0
+position_max: 305.5
+
+[stepper_z]
+position_min: -5
+position_max: 340
+
+[exclude_object]
+
+[gcode_macro start_print]
+gcode:
+    G28
+    BED_MESH_CALIBRATE
+
+[gcode_macro END_PRINT]
+gcode:
+    TURN_OFF_HEATERS
+
+#*# <---------------------- SAVE_CONFIG ---------------------->
+#*# [stepper_z]
+#*# position_endstop = 1.2
+`
+
+func TestImportConfig_Klipper(t *testing.T) {
+	t.Parallel()
+
+	def, err := ImportConfig("Klipper", []byte(klipperConfig))
+	if err != nil {
+		t.Fatalf("ImportConfig failed: %v", err)
+	}
+
+	if def.Name != "Klipper corexy" {
+		t.Errorf("Expected name Klipper corexy, got %q", def.Name)
+	}
+
+	if def.Bed != (BedSize{X: 300, Y: 305.5, Z: 340}) {
+		t.Errorf("Unexpected bed %+v", def.Bed)
+	}
+
+	if !equalStringSlices(def.Markers.EndInitSection, []string{`(?i)^START_PRINT\b`}) {
+		t.Errorf("Unexpected init markers %q", def.Markers.EndInitSection)
+	}
+
+	if !equalStringSlices(def.Markers.EndPrintSection, []string{`^EXCLUDE_OBJECT_END\b`}) {
+		t.Errorf("Unexpected print markers %q", def.Markers.EndPrintSection)
+	}
+
+	// Limits written for the profile's 235x235 bed follow the imported bed
+	if def.Parameters["BackY"] != 304.5 {
+		t.Errorf("Expected BackY 304.5, got %v", def.Parameters["BackY"])
+	}
+
+	if bounds := def.Assertions["MaxPrintX"]; len(bounds) != 2 || bounds[1] != 300.0 {
+		t.Errorf("Expected MaxPrintX up to 300, got %v", bounds)
+	}
+
+	if bounds := def.Assertions["MinPrintY"]; len(bounds) != 2 || bounds[1] != 293.5 {
+		t.Errorf("Expected MinPrintY up to 293.5, got %v", bounds)
+	}
+}
+
+func TestImportConfig_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		format   string
+		config   string
+		expected string
+	}{
+		{name: "unknown format", format: "marlin", config: klipperConfig, expected: `invalid format value "marlin": must be klipper`},
+		{name: "no printer section", format: "klipper", config: "[stepper_x]\nposition_max: 200\n", expected: "missing [printer] section"},
+		{name: "no exclude_object", format: "klipper", config: strings.Replace(klipperConfig, "[exclude_object]", "", 1), expected: "missing [exclude_object] section"},
+		{name: "invalid bed size", format: "klipper", config: strings.Replace(klipperConfig, "position_max: 340", "position_max: tall", 1), expected: `invalid [stepper_z] position_max value "tall"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ImportConfig(tt.format, []byte(tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestMarshalPrinterDefinition_CustomTemplate(t *testing.T) {
+	t.Parallel()
+
+	def, err := ImportConfig("klipper", []byte(klipperConfig))
+	if err != nil {
+		t.Fatalf("ImportConfig failed: %v", err)
+	}
+
+	data, err := MarshalPrinterDefinition(def)
+	if err != nil {
+		t.Fatalf("MarshalPrinterDefinition failed: %v", err)
+	}
+
+	if !strings.Contains(string(data), "Code = '''") {
+		t.Errorf("Expected the template as a multiline string, got:\n%s", data)
+	}
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err = writeLinesToFile(inputPath, []string{
+		"start_print BED=60",
+		"EXCLUDE_OBJECT_START NAME=part",
+		"G1 X150 Y150 Z0.2 E1",
+		"EXCLUDE_OBJECT_END NAME=part",
+		"END_PRINT",
+	})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	processor, err := NewStreamingProcessor(ProcessingRequest{
+		Iterations:     2,
+		Printer:        "unit-tests",
+		CustomTemplate: string(data),
+	})
+	if err != nil {
+		t.Fatalf("Generated TOML is not a valid custom template: %v\n%s", err, data)
+	}
+
+	err = processor.ProcessFile(inputPath, outputPath)
+	if err != nil {
+		t.Fatalf("ProcessFile failed: %v", err)
+	}
+
+	output, err := readLinesFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	if !equalStringSlices(output[len(output)-1:], []string{"END_PRINT"}) || !strings.Contains(strings.Join(output, "\n"), "G1 Y304.5 ; Move back") {
+		t.Errorf("Unexpected output:\n%s", strings.Join(output, "\n"))
+	}
+}
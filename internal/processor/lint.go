@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Temperature limits used by the generated code lint when the printer definition does not set
+// Parameters.LintMaxHotendTemp or Parameters.LintMaxBedTemp
+const (
+	defaultLintMaxHotendTemp = 300.0
+	defaultLintMaxBedTemp    = 120.0
+)
+
+// codeLinter flags G-code that firmware accepts but that is most likely a template mistake
+type codeLinter struct {
+	commentPrefix     string
+	relativeExtrusion bool    // Extrusion mode the print is in when the generated code starts
+	maxHotendTemp     float64 // Highest plausible M104/M109 target
+	maxBedTemp        float64 // Highest plausible M140/M190 target
+}
+
+// lint returns one message per problem found in the generated code
+func (l codeLinter) lint(code string) []string {
+	var problems []string
+
+	relative := l.relativeExtrusion
+
+	for i, line := range strings.Split(code, "\n") {
+		fields := strings.Fields(stripComment(line, l.commentPrefix))
+		if len(fields) == 0 {
+			continue
+		}
+
+		command := strings.ToUpper(fields[0])
+
+		switch command {
+		case "G0", "G1":
+			if len(fields) == 1 {
+				problems = append(problems, fmt.Sprintf("line %d: %s without axes or feedrate does nothing", i+1, command))
+			}
+		case "M82":
+			relative = false
+		case "M83":
+			relative = true
+		case "M104", "M109":
+			problems = l.checkTemp(problems, i+1, command, fields[1:], l.maxHotendTemp)
+		case "M140", "M190":
+			problems = l.checkTemp(problems, i+1, command, fields[1:], l.maxBedTemp)
+		}
+	}
+
+	if relative != l.relativeExtrusion {
+		problems = append(problems, fmt.Sprintf("extrusion mode left %s, the print continues expecting %s",
+			extrusionModeName(relative), extrusionModeName(l.relativeExtrusion)))
+	}
+
+	return problems
+}
+
+// checkTemp appends a problem when the S word of a temperature command exceeds limit
+func (l codeLinter) checkTemp(problems []string, lineNum int, command string, words []string, limit float64) []string {
+	for _, word := range words {
+		value, found := strings.CutPrefix(strings.ToUpper(word), "S")
+		if !found {
+			continue
+		}
+
+		temp, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return append(problems, fmt.Sprintf("line %d: %s has an unparsable temperature %q", lineNum, command, word))
+		}
+
+		if temp < 0 || temp > limit {
+			return append(problems, fmt.Sprintf("line %d: %s temperature %g is outside 0-%g", lineNum, command, temp, limit))
+		}
+	}
+
+	return problems
+}
+
+// extrusionModeName names an extrusion mode by its selecting command
+func extrusionModeName(relative bool) string {
+	if relative {
+		return "relative (M83)"
+	}
+
+	return "absolute (M82)"
+}
+
+// lintGenerated reports the lint problems of one iteration's generated code as warnings when
+// Parameters.LintGeneratedCode is set. A problem repeated by later iterations is reported once.
+func (p *StreamingProcessor) lintGenerated(iteration int64, code string) {
+	if !p.boolParameter("LintGeneratedCode", false) {
+		return
+	}
+
+	linter := codeLinter{
+		commentPrefix:     p.commentPrefix,
+		relativeExtrusion: p.positions.RelativeExtrusion,
+		maxHotendTemp:     p.floatParameter("LintMaxHotendTemp", defaultLintMaxHotendTemp),
+		maxBedTemp:        p.floatParameter("LintMaxBedTemp", defaultLintMaxBedTemp),
+	}
+
+	for _, problem := range linter.lint(code) {
+		if p.linted[problem] {
+			continue
+		}
+
+		if p.linted == nil {
+			p.linted = make(map[string]bool)
+		}
+
+		p.linted[problem] = true
+		p.warn("generated code for iteration %d, %s", iteration, problem)
+	}
+}
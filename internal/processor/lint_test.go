@@ -0,0 +1,137 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCodeLinter_lint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name              string
+		code              string
+		relativeExtrusion bool
+		expected          []string
+	}{
+		{
+			name:     "plausible block",
+			code:     "G1 X10 Y20 F3000\nG1 F600\nM104 S210\nM140 S60 ; bed\n; G1\n",
+			expected: nil,
+		},
+		{
+			name:     "bare moves",
+			code:     "G1 X10\nG1\ng0 ; travel\n",
+			expected: []string{"line 2: G1 without axes or feedrate does nothing", "line 3: G0 without axes or feedrate does nothing"},
+		},
+		{
+			name:     "hotend temperature out of range",
+			code:     "M109 S2100\nM104 S-5",
+			expected: []string{"line 1: M109 temperature 2100 is outside 0-300", "line 2: M104 temperature -5 is outside 0-300"},
+		},
+		{
+			name:     "bed temperature out of range",
+			code:     "M190 S210",
+			expected: []string{"line 1: M190 temperature 210 is outside 0-120"},
+		},
+		{
+			name:     "unparsable temperature",
+			code:     "M104 S{{temp}}",
+			expected: []string{`line 1: M104 has an unparsable temperature "S{{temp}}"`},
+		},
+		{
+			name:     "relative extrusion not restored",
+			code:     "M83\nG1 E-0.8\nG1 X10 Y10",
+			expected: []string{"extrusion mode left relative (M83), the print continues expecting absolute (M82)"},
+		},
+		{
+			name:              "relative extrusion restored",
+			code:              "M82\nG92 E0\nG1 E5\nM83",
+			relativeExtrusion: true,
+		},
+		{
+			name:              "absolute extrusion left in relative print",
+			code:              "M82\nG1 E5",
+			relativeExtrusion: true,
+			expected:          []string{"extrusion mode left absolute (M82), the print continues expecting relative (M83)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			linter := codeLinter{
+				commentPrefix:     ";",
+				relativeExtrusion: tt.relativeExtrusion,
+				maxHotendTemp:     defaultLintMaxHotendTemp,
+				maxBedTemp:        defaultLintMaxBedTemp,
+			}
+
+			problems := linter.lint(tt.code)
+			if !equalStringSlices(problems, tt.expected) {
+				t.Errorf("Expected problems %q, got %q", tt.expected, problems)
+			}
+		})
+	}
+}
+
+func TestProcessFile_LintGeneratedCode(t *testing.T) {
+	t.Parallel()
+
+	const code = "M83\nG1\nM140 S{{if gt .Iteration 1}}150{{else}}60{{end}}"
+
+	tests := []struct {
+		name     string
+		enabled  string
+		expected []string
+	}{
+		{
+			name:    "enabled",
+			enabled: "true",
+			expected: []string{
+				"generated code for iteration 1, line 2: G1 without axes or feedrate does nothing",
+				"generated code for iteration 1, extrusion mode left relative (M83), the print continues expecting absolute (M82)",
+				"generated code for iteration 2, line 3: M140 temperature 150 is outside 0-100",
+			},
+		},
+		{
+			name:    "disabled",
+			enabled: "false",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := os.WriteFile(inputPath, []byte("M82\nSTART_PRINT\nG1 X1 Y1 E1\nEND_PRINT\n"), 0644)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     3,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate("LintGeneratedCode = "+tt.enabled+"\nLintMaxBedTemp = 100", code),
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+			if err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+
+			if !equalStringSlices(processor.Warnings(), tt.expected) {
+				t.Errorf("Expected warnings %q, got %q", tt.expected, processor.Warnings())
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ManifestSuffix is appended to the output path to name the manifest sidecar file
+const ManifestSuffix = ".manifest.json"
+
+// Manifest is a machine-readable record of a processing run
+type Manifest struct {
+	Printer                  string    `json:"printer"`
+	Iterations               int64     `json:"iterations"`
+	WaitBedCooldownTemp      int64     `json:"wait_bed_cooldown_temp"`
+	WaitMin                  int64     `json:"wait_min"`
+	ExtraExtrude             float64   `json:"extra_extrude"`
+	EndInitSectionFirstLine  int64     `json:"end_init_section_first_line"`
+	EndInitSectionLastLine   int64     `json:"end_init_section_last_line"`
+	EndPrintSectionFirstLine int64     `json:"end_print_section_first_line"`
+	EndPrintSectionLastLine  int64     `json:"end_print_section_last_line"`
+	FirstPrintX              float64   `json:"first_print_x"`
+	FirstPrintY              float64   `json:"first_print_y"`
+	FirstPrintZ              float64   `json:"first_print_z"`
+	LastPrintX               float64   `json:"last_print_x"`
+	LastPrintY               float64   `json:"last_print_y"`
+	LastPrintZ               float64   `json:"last_print_z"`
+	InputSize                int64     `json:"input_size"`
+	OutputSize               int64     `json:"output_size"`
+	OriginalLines            int64     `json:"original_lines"`
+	BodyLines                int64     `json:"body_lines"`
+	GeneratedLines           int64     `json:"generated_lines"`
+	ProjectedOutputLines     int64     `json:"projected_output_lines"`
+	Timestamp                time.Time `json:"timestamp"`
+}
+
+// LineStats compares the line count of the input with the projected output, for a sanity check
+// before printing
+type LineStats struct {
+	OriginalLines  int64 `json:"original_lines"`         // Lines of the input file
+	BodyLines      int64 `json:"body_lines"`             // Lines between the markers repeated by every iteration, of all regions
+	GeneratedLines int64 `json:"generated_lines"`        // Lines written after the body by every iteration, template output and injected commands of all regions
+	ProjectedLines int64 `json:"projected_output_lines"` // Lines the output is expected to have, without stamps and iteration comments
+}
+
+// regionLines are the line counts of one looped region for newLineStats
+type regionLines struct {
+	positions      MarkerPositions
+	bodyLastLine   int64 // Last line of the body an iteration repeats, see bodyLastLine
+	generatedLines int64 // Lines generated after the body by every iteration
+}
+
+// newLineStats projects the output line count: the lines outside the regions are written once, the
+// body, end marker and generated lines of every region once per iteration
+func newLineStats(originalLines, iterations int64, regions []regionLines) LineStats {
+	stats := LineStats{
+		OriginalLines:  originalLines,
+		ProjectedLines: originalLines,
+	}
+
+	for _, region := range regions {
+		bodyLines := region.bodyLastLine - region.positions.EndInitSectionLastLine
+		markerLines := region.positions.EndPrintSectionLastLine - region.positions.EndPrintSectionFirstLine + 1
+
+		// The lines from the body to the end marker are replaced by the iterations
+		replacedLines := region.positions.EndPrintSectionLastLine - region.positions.EndInitSectionLastLine
+
+		stats.BodyLines += bodyLines
+		stats.GeneratedLines += region.generatedLines
+		stats.ProjectedLines += iterations*(bodyLines+markerLines+region.generatedLines) - replacedLines
+	}
+
+	return stats
+}
+
+// lineStats renders the template for the first iteration of every region to count the lines it
+// generates, the input lines are counted by scanPositions
+func (p *StreamingProcessor) lineStats() (LineStats, error) {
+	number := int64(1)
+	if p.config.ReverseIterationNumbering {
+		number = p.config.Iterations
+	}
+
+	defer func() { p.positions = p.regions[0] }()
+
+	regions := make([]regionLines, 0, len(p.regions))
+
+	for _, region := range p.regions {
+		p.positions = region
+
+		output, err := p.executeTemplate(1, number)
+		if err != nil {
+			return LineStats{}, err
+		}
+
+		regions = append(regions, regionLines{
+			positions:      region,
+			bodyLastLine:   p.bodyLastLine(),
+			generatedLines: int64(len(p.injectedLines()) + len(generatedLines(output))),
+		})
+	}
+
+	return newLineStats(p.regions[0].TotalLines, p.config.Iterations, regions), nil
+}
+
+// GenerateManifest returns the JSON manifest for the given positions and request, without file sizes
+func GenerateManifest(positions MarkerPositions, config ProcessingRequest) ([]byte, error) {
+	return json.MarshalIndent(newManifest(positions, config), "", "  ")
+}
+
+func newManifest(positions MarkerPositions, config ProcessingRequest) Manifest {
+	return Manifest{
+		Printer:                  config.Printer,
+		Iterations:               config.Iterations,
+		WaitBedCooldownTemp:      config.WaitBedCooldownTemp,
+		WaitMin:                  config.WaitMin,
+		ExtraExtrude:             config.ExtraExtrude,
+		EndInitSectionFirstLine:  positions.EndInitSectionFirstLine,
+		EndInitSectionLastLine:   positions.EndInitSectionLastLine,
+		EndPrintSectionFirstLine: positions.EndPrintSectionFirstLine,
+		EndPrintSectionLastLine:  positions.EndPrintSectionLastLine,
+		FirstPrintX:              positions.FirstPrintX,
+		FirstPrintY:              positions.FirstPrintY,
+		FirstPrintZ:              positions.FirstPrintZ,
+		LastPrintX:               positions.LastPrintX,
+		LastPrintY:               positions.LastPrintY,
+		LastPrintZ:               positions.LastPrintZ,
+		Timestamp:                time.Now().UTC(),
+	}
+}
+
+// writeManifest writes the manifest sidecar next to the output file including input and output sizes
+// and line counts
+func writeManifest(inputPath, outputPath string, positions MarkerPositions, lines LineStats, config ProcessingRequest) error {
+	manifest := newManifest(positions, config)
+	manifest.OriginalLines = lines.OriginalLines
+	manifest.BodyLines = lines.BodyLines
+	manifest.GeneratedLines = lines.GeneratedLines
+	manifest.ProjectedOutputLines = lines.ProjectedLines
+
+	inputInfo, err := os.Stat(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat input file for manifest: %w", err)
+	}
+
+	outputInfo, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat output file for manifest: %w", err)
+	}
+
+	manifest.InputSize = inputInfo.Size()
+	manifest.OutputSize = outputInfo.Size()
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	err = os.WriteFile(outputPath+ManifestSuffix, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest file: %w", err)
+	}
+
+	return nil
+}
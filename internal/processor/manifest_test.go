@@ -0,0 +1,248 @@
+package processor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGenerateManifest(t *testing.T) {
+	t.Parallel()
+
+	positions := MarkerPositions{
+		EndInitSectionFirstLine:  1,
+		EndInitSectionLastLine:   2,
+		EndPrintSectionFirstLine: 10,
+		EndPrintSectionLastLine:  11,
+		FirstPrintX:              10.5,
+		FirstPrintY:              20.5,
+		FirstPrintZ:              0.2,
+		LastPrintX:               30.5,
+		LastPrintY:               40.5,
+		LastPrintZ:               5.0,
+	}
+	config := ProcessingRequest{
+		Printer:             "A1 mini",
+		Iterations:          5,
+		WaitBedCooldownTemp: 40,
+		WaitMin:             2,
+		ExtraExtrude:        0.2,
+	}
+
+	data, err := GenerateManifest(positions, config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var fields map[string]any
+
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		t.Fatalf("Manifest is not valid JSON: %v", err)
+	}
+
+	expected := map[string]any{
+		"printer":                      "A1 mini",
+		"iterations":                   5.0,
+		"wait_bed_cooldown_temp":       40.0,
+		"wait_min":                     2.0,
+		"extra_extrude":                0.2,
+		"end_init_section_first_line":  1.0,
+		"end_init_section_last_line":   2.0,
+		"end_print_section_first_line": 10.0,
+		"end_print_section_last_line":  11.0,
+		"first_print_x":                10.5,
+		"first_print_y":                20.5,
+		"first_print_z":                0.2,
+		"last_print_x":                 30.5,
+		"last_print_y":                 40.5,
+		"last_print_z":                 5.0,
+		"input_size":                   0.0,
+		"output_size":                  0.0,
+		"original_lines":               0.0,
+		"body_lines":                   0.0,
+		"generated_lines":              0.0,
+		"projected_output_lines":       0.0,
+	}
+
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Errorf("Field %s: expected %v, got %v", key, value, fields[key])
+		}
+	}
+
+	timestamp, ok := fields["timestamp"].(string)
+	if !ok {
+		t.Fatalf("Expected timestamp string, got %v", fields["timestamp"])
+	}
+
+	_, err = time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		t.Errorf("Timestamp is not RFC3339: %v", err)
+	}
+
+	if len(fields) != len(expected)+1 {
+		t.Errorf("Expected %d fields, got %d", len(expected)+1, len(fields))
+	}
+}
+
+func TestProcessFile_WriteManifest(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "FOOTER"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+		Iterations:    2,
+		Printer:       "unit-tests",
+		WriteManifest: true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath + ManifestSuffix)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+
+	var manifest Manifest
+
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		t.Fatalf("Manifest is not valid JSON: %v", err)
+	}
+
+	inputInfo, _ := os.Stat(inputPath)
+	outputInfo, _ := os.Stat(outputPath)
+
+	if manifest.InputSize != inputInfo.Size() {
+		t.Errorf("InputSize: expected %d, got %d", inputInfo.Size(), manifest.InputSize)
+	}
+
+	if manifest.OutputSize != outputInfo.Size() {
+		t.Errorf("OutputSize: expected %d, got %d", outputInfo.Size(), manifest.OutputSize)
+	}
+
+	if manifest.EndInitSectionLastLine != 1 || manifest.EndPrintSectionFirstLine != 3 {
+		t.Errorf("Unexpected marker lines: %+v", manifest)
+	}
+
+	output, err := readLinesFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+
+	if manifest.OriginalLines != 5 || manifest.BodyLines != 1 || manifest.GeneratedLines != 2 {
+		t.Errorf("Unexpected line counts: %+v", manifest)
+	}
+
+	if manifest.ProjectedOutputLines != int64(len(output)) {
+		t.Errorf("ProjectedOutputLines: expected %d, got %d", len(output), manifest.ProjectedOutputLines)
+	}
+}
+
+func TestNewLineStats(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		originalLines int64
+		iterations    int64
+		regions       []regionLines
+		expected      LineStats
+	}{
+		{
+			name:          "single line markers",
+			originalLines: 5,
+			iterations:    2,
+			regions: []regionLines{
+				{positions: MarkerPositions{EndInitSectionLastLine: 1, EndPrintSectionFirstLine: 3, EndPrintSectionLastLine: 3}, bodyLastLine: 2, generatedLines: 2},
+			},
+			// 2 header lines + 2 * (1 body + 1 marker + 2 generated) + 1 footer line
+			expected: LineStats{OriginalLines: 5, BodyLines: 1, GeneratedLines: 2, ProjectedLines: 11},
+		},
+		{
+			name:          "multiline end marker without footer",
+			originalLines: 103,
+			iterations:    3,
+			regions: []regionLines{
+				{positions: MarkerPositions{EndInitSectionLastLine: 9, EndPrintSectionFirstLine: 100, EndPrintSectionLastLine: 102}, bodyLastLine: 99, generatedLines: 10},
+			},
+			// 10 header lines + 3 * (90 body + 3 marker + 10 generated)
+			expected: LineStats{OriginalLines: 103, BodyLines: 90, GeneratedLines: 10, ProjectedLines: 319},
+		},
+		{
+			name:          "first layer only",
+			originalLines: 120,
+			iterations:    4,
+			regions: []regionLines{
+				{positions: MarkerPositions{EndInitSectionLastLine: 9, EndPrintSectionFirstLine: 100, EndPrintSectionLastLine: 100}, bodyLastLine: 39},
+			},
+			// 10 header lines + 4 * (30 body + 1 marker) + 19 footer lines, the rest of the body is dropped
+			expected: LineStats{OriginalLines: 120, BodyLines: 30, GeneratedLines: 0, ProjectedLines: 153},
+		},
+		{
+			name:          "two regions",
+			originalLines: 20,
+			iterations:    3,
+			regions: []regionLines{
+				{positions: MarkerPositions{EndInitSectionLastLine: 1, EndPrintSectionFirstLine: 4, EndPrintSectionLastLine: 4}, bodyLastLine: 3, generatedLines: 1},
+				{positions: MarkerPositions{EndInitSectionLastLine: 9, EndPrintSectionFirstLine: 13, EndPrintSectionLastLine: 14}, bodyLastLine: 12, generatedLines: 1},
+			},
+			// 2 header lines + 3 * (2 body + 1 marker + 1 generated) + 5 lines between the regions
+			// + 3 * (3 body + 2 marker + 1 generated) + 5 footer lines
+			expected: LineStats{OriginalLines: 20, BodyLines: 5, GeneratedLines: 2, ProjectedLines: 42},
+		},
+	}
+
+	for _, tt := range tests {
+		got := newLineStats(tt.originalLines, tt.iterations, tt.regions)
+		if got != tt.expected {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestProcessFileWithStats_Lines(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{
+		"HEADER", "START_PRINT", "G1 X1 Y1 E1", "END_PRINT",
+		"BETWEEN", "START_PRINT", "G1 X2 Y2 E1", "G1 X3 Y3 E1", "END_PRINT", "FOOTER",
+	})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	stats, err := ProcessFileWithStats(inputPath, outputPath, ProcessingRequest{
+		Iterations:     3,
+		Printer:        "unit-tests",
+		CustomTemplate: testPrinterTemplate("MultiRegion = true", "; next\nG4 S1"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	output, err := readLinesFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+
+	expected := LineStats{OriginalLines: 10, BodyLines: 3, GeneratedLines: 4, ProjectedLines: int64(len(output))}
+	if stats.Lines != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats.Lines)
+	}
+}
@@ -0,0 +1,45 @@
+; HEADER_BLOCK_START
+; BambuStudio sample for printloop
+; printer: a1-mini
+; total layer number: 2
+; HEADER_BLOCK_END
+
+; EXECUTABLE_BLOCK_START
+M73 P0 R1
+G90
+M83
+M140 S65
+M104 S220
+M190 S65
+M109 S220
+G28
+G1 Z5 F3000
+G1 X5 Y1 F6000
+G1 Z0.3 F600
+G1 X60 E4 F1500 ; prime line
+G1 Z1 F600
+M624 AQAAAAAAAAA=
+; layer num/total_layer_count: 1/2
+G1 Z0.2 F600
+G1 X80 Y80 F6000
+G1 X100 Y80 E0.8 F1500
+G1 X100 Y100 E0.8
+G1 X80 Y100 E0.8
+G1 X80 Y80 E0.8
+M625
+M624 AQAAAAAAAAA=
+; layer num/total_layer_count: 2/2
+G1 Z0.4 F600
+G1 X80 Y80 F6000
+G1 X100 Y80 E0.8 F1500
+G1 X100 Y100 E0.8
+G1 X80 Y100 E0.8
+G1 X80 Y80 E0.8
+M625
+G1 E-0.8 F1800
+G1 Z10 F600
+M140 S0
+M104 S0
+M106 S0
+M73 P100 R0
+; EXECUTABLE_BLOCK_END
@@ -2,15 +2,28 @@ package processor
 
 import (
 	"bufio"
+	"context"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
 	"os"
+	"path"
+	"path/filepath"
 	"printloop/internal/processor/strategy"
 	"regexp"
+	"regexp/syntax"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 	"text/template"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
@@ -21,6 +34,9 @@ type PrinterDefinition struct {
 	Markers struct {
 		EndInitSection  []string
 		EndPrintSection []string
+		MatchMode       string // How marker lines are compared with G-code lines, contains (default), regex or unordered
+		// Marker sets tried in order after EndInitSection, e.g. for slicer versions writing another start macro
+		EndInitSectionAlternatives [][]string
 	}
 	SearchStrategy struct {
 		EndInitSectionStrategy  string
@@ -30,7 +46,28 @@ type PrinterDefinition struct {
 	Template   struct {
 		Code string
 	}
+	Fragments  map[string]string // Named template snippets included with {{template "name" .}}
 	Assertions map[string][]any
+	Bed        BedSize // Build volume, available to templates as {{.Bed.X}}
+}
+
+// BedSize is the build volume of a printer in mm. A zero dimension is not declared by the printer definition.
+type BedSize struct {
+	X, Y, Z float64
+}
+
+// validateBedSize checks that no bed dimension is negative, zero ones are not declared
+func validateBedSize(bed BedSize) error {
+	for _, dimension := range []struct {
+		name  string
+		value float64
+	}{{"X", bed.X}, {"Y", bed.Y}, {"Z", bed.Z}} {
+		if dimension.value < 0 {
+			return fmt.Errorf("invalid Bed.%s value %v: must not be negative", dimension.name, dimension.value)
+		}
+	}
+
+	return nil
 }
 
 // PositionMarkers struct for backward compatibility
@@ -39,38 +76,82 @@ type PositionMarkers struct {
 	EndPrintSection string
 }
 
-// SearchStrategy interface for different marker search strategies
+// SearchStrategy interface for different marker search strategies. Scans stop with ctx's error once
+// ctx is done.
 type SearchStrategy interface {
-	FindInitSectionPosition(filePath string, markers []string) (int64, int64, error)
-	FindPrintSectionPosition(filePath string, markers []string, searchFromLine int64) (int64, int64, error)
+	FindInitSectionPosition(ctx context.Context, filePath string, markers []string) (int64, int64, error)
+	FindPrintSectionPosition(ctx context.Context, filePath string, markers []string, searchFromLine int64) (int64, int64, error)
 }
 
 // ProcessingRequest represents a file processing request
 type ProcessingRequest struct {
-	FileName            string
-	Iterations          int64
-	WaitBedCooldownTemp int64
-	WaitMin             int64
-	ExtraExtrude        float64
-	Printer             string
-	CustomTemplate      string
-	TestPrintWithPause  bool
+	FileName                  string
+	Iterations                int64
+	WaitBedCooldownTemp       int64
+	WaitMin                   int64
+	ExtraExtrude              float64
+	Printer                   string
+	CustomTemplate            string
+	TestPrintWithPause        bool
+	WriteManifest             bool   // Write a <output>.manifest.json sidecar after processing
+	ChunkIterations           int64  // Split output into files of at most this many iterations (0 = no limit)
+	ChunkSizeMB               int64  // Split output into files of at most this many megabytes (0 = no limit)
+	StripSlicerConfig         bool   // Drop slicer settings blocks (e.g. "; prusaslicer_config = begin") from the footer
+	LineEnding                string // Output line terminator: "lf", "crlf" or empty to keep the input's
+	MeshReloadEvery           int64  // Emit Parameters.MeshReloadCommand before every Kth iteration body (0 = never)
+	ReverseIterationNumbering bool   // Number generated iterations from Iterations down to 1, for debugging templates
+	CommentStyle              string // "semicolon" or "parentheses" to wrap iterations in comments of that style, empty for none
+	InitStrategy              string // Overrides SearchStrategy.EndInitSectionStrategy of the printer when set
+	PrintStrategy             string // Overrides SearchStrategy.EndPrintSectionStrategy of the printer when set
+	Force                     bool   // Process files that look like printloop output anyway
+	BodyStartLine             int64  // First line of the looped body, 1-based; with BodyEndLine replaces marker detection (0 = find markers)
+	BodyEndLine               int64  // Last line of the looped body, 1-based and inclusive (0 = find markers)
+
+	Progress func(iteration, total int64) // Called after each streamed iteration, may be nil
 }
 
+// defaultMeshReloadCommand re-enables the stored bed mesh on Marlin firmwares
+const defaultMeshReloadCommand = "M420 S1"
+
+// defaultWaitCommand dwells for Request.WaitMin minutes when Parameters.WaitCommand is not set
+const defaultWaitCommand = "G4 S{seconds}"
+
+// defaultBedCooldownCommand waits for the bed to cool down to Request.WaitBedCooldownTemp when
+// Parameters.BedCooldownCommand is not set
+const defaultBedCooldownCommand = "M190 R{temp}"
+
+// OutputRetries is how often writing an output file is retried after a transient I/O error
+var OutputRetries = 3
+
+// OutputRetryBackoff is the wait before the first retry of an output file, doubled for each further retry
+var OutputRetryBackoff = 100 * time.Millisecond
+
+// MaxOutputSize is the upper bound in bytes for the projected size of a processed file
+var MaxOutputSize int64 = 2 << 30
+
 // CreateSearchStrategy is factory function to create search strategies
 func CreateSearchStrategy(strategyName string) (SearchStrategy, error) {
+	return createSearchStrategy(strategyName, strategy.MatchContains, ";")
+}
+
+// createSearchStrategy creates a search strategy comparing marker lines in mode and skipping lines
+// starting with commentPrefix between them
+func createSearchStrategy(strategyName string, mode strategy.MatchMode, commentPrefix string) (SearchStrategy, error) {
 	switch strategyName {
 	case "after_first_appear":
-		return &strategy.AfterFirstAppearStrategy{}, nil
+		return &strategy.AfterFirstAppearStrategy{Mode: mode, CommentPrefix: commentPrefix}, nil
 	case "after_last_appear":
-		return &strategy.AfterLastAppearStrategy{}, nil
+		return &strategy.AfterLastAppearStrategy{Mode: mode, CommentPrefix: commentPrefix}, nil
 	case "before_first_appear":
-		return &strategy.BeforeCommandStrategy{}, nil
+		return &strategy.BeforeCommandStrategy{Mode: mode, CommentPrefix: commentPrefix}, nil
 	default:
 		return nil, fmt.Errorf("unknown search strategy: %s", strategyName)
 	}
 }
 
+// outputCreator opens an output file for writing
+type outputCreator func(name string) (io.WriteCloser, error)
+
 type StreamingProcessor struct {
 	config        ProcessingRequest
 	printerDef    PrinterDefinition
@@ -78,28 +159,82 @@ type StreamingProcessor struct {
 	printStrategy SearchStrategy
 	template      *template.Template
 	positions     MarkerPositions
+	regions       []MarkerPositions // Loop regions, a single one unless Parameters.MultiRegion is set
+	initMarkers   []string          // The init section marker set found in the current file
+	numberLines   bool              // Prefix output lines with N<line> and checksum
+	lineNumber    int64             // Last N<line> number written to output
+	commentPrefix string            // Comment start, Parameters.CommentPrefix or ";"
+	lineEnding    string            // Output line terminator, "\n" when empty
+	iterationEta  time.Duration     // Estimated duration of one iteration
+	warnings      []string          // Non-fatal problems found while processing
+	ctx           context.Context   // Aborts processing once done, set by the *Context methods
+	createOutput  outputCreator     // Opens output files, os.Create outside of tests
+	streamed      int64             // Iterations streamed so far, across regions and chunks
+	generated     bool              // Whether the template rendered anything besides whitespace
+	linted        map[string]bool   // Lint problems already reported, see lintGenerated
+	lines         LineStats         // Line counts of the run
 }
 
 // MarkerPositions represents the found positions of start and end markers
 // Updated MarkerPositions struct
 type MarkerPositions struct {
-	EndInitSectionFirstLine  int64   // First line of start marker (0-based)
-	EndInitSectionLastLine   int64   // Last line of start marker (0-based)
-	EndPrintSectionFirstLine int64   // First line of end marker (0-based) - NEW
-	EndPrintSectionLastLine  int64   // Last line of end marker (0-based) - UPDATED
-	FirstPrintX              float64 // X coordinate from first print command (G1 with positive E) after marker
-	FirstPrintY              float64 // Y coordinate from first print command (G1 with positive E) after marker
-	FirstPrintZ              float64 // Z coordinate that was active during first print command after marker
-	LastPrintX               float64 // X coordinate from last print command (G1 with positive E)
-	LastPrintY               float64 // Y coordinate from last print command (G1 with positive E)
-	LastPrintZ               float64 // Z coordinate that was active during last print command
-	AveragePrintX            float64 // Average X coordinate across all print commands (G1 with positive E)
-	AveragePrintY            float64 // Average Y coordinate across all print commands (G1 with positive E)
-	MinPrintX                float64 // Min X coordinate across all print commands (G1 with positive E)
-	MinPrintY                float64 // Min Y coordinate across all print commands (G1 with positive E)
-	MaxPrintX                float64 // Max X coordinate across all print commands (G1 with positive E)
-	MaxPrintY                float64 // Max Y coordinate across all print commands (G1 with positive E)
-	BedTemp                  int64   // Bed temperature from last M190 command in init section (0 = not detected)
+	EndInitSectionFirstLine  int64       // First line of start marker (0-based)
+	EndInitSectionLastLine   int64       // Last line of start marker (0-based)
+	EndPrintSectionFirstLine int64       // First line of end marker (0-based) - NEW
+	EndPrintSectionLastLine  int64       // Last line of end marker (0-based) - UPDATED
+	FirstPrintX              float64     // X coordinate from first print command (G1 with positive E) after marker
+	FirstPrintY              float64     // Y coordinate from first print command (G1 with positive E) after marker
+	FirstPrintZ              float64     // Z coordinate that was active during first print command after marker
+	LastPrintX               float64     // X coordinate from last print command (G1 with positive E)
+	LastPrintY               float64     // Y coordinate from last print command (G1 with positive E)
+	LastPrintZ               float64     // Z coordinate that was active during last print command
+	AveragePrintX            float64     // Average X coordinate across all print commands (G1 with positive E)
+	AveragePrintY            float64     // Average Y coordinate across all print commands (G1 with positive E)
+	MinPrintX                float64     // Min X coordinate across all print commands (G1 with positive E)
+	MinPrintY                float64     // Min Y coordinate across all print commands (G1 with positive E)
+	MaxPrintX                float64     // Max X coordinate across all print commands (G1 with positive E)
+	MaxPrintY                float64     // Max Y coordinate across all print commands (G1 with positive E)
+	BedTemp                  int64       // Bed temperature from last M190 command in init section (0 = not detected)
+	LastHotendTemp           int64       // Hotend target from last M104/M109 command before end marker (0 = not detected)
+	LastBedTemp              int64       // Bed target from last M140/M190 command before end marker (0 = not detected)
+	UnitsInches              bool        // G20 (inches) is in effect at the end of the init section
+	RelativeExtrusion        bool        // M83 (relative E) is in effect before the end marker
+	ModelBBox                BoundingBox // XY extent of all print commands, from MinPrint/MaxPrint
+	BodyOffset               int64       // Byte offset of the line after the start marker
+	EndPrintSectionOffset    int64       // Byte offset of the first line of the end marker
+	FooterOffset             int64       // Byte offset of the line after the end marker
+	TotalLines               int64       // Lines in the file
+	FirstLayerLastLine       int64       // Last body line of the first layer, the line before the end marker when no layer change is found
+	BodyExtrusionLength      float64     // Filament length pushed by the body, the sum of positive E moves
+	BodyMoves                int64       // G0/G1 moves of the body
+	BodyDwellSeconds         float64     // Sum of the G4 dwells of the body
+}
+
+// BoundingBox is an axis-aligned XY rectangle
+type BoundingBox struct {
+	MinX, MinY float64
+	MaxX, MaxY float64
+}
+
+// Width returns the X extent of the box
+func (b BoundingBox) Width() float64 {
+	return b.MaxX - b.MinX
+}
+
+// Height returns the Y extent of the box
+func (b BoundingBox) Height() float64 {
+	return b.MaxY - b.MinY
+}
+
+// StepX returns the X distance between copies of the box placed side by side gap apart, for
+// templates laying out a grid without a configured shift
+func (b BoundingBox) StepX(gap float64) float64 {
+	return b.Width() + gap
+}
+
+// StepY returns the Y distance between copies of the box placed gap apart
+func (b BoundingBox) StepY(gap float64) float64 {
+	return b.Height() + gap
 }
 
 // GCodeCoordinates holds parsed G-code coordinates
@@ -108,6 +243,7 @@ type GCodeCoordinates struct {
 	Y *float64
 	Z *float64
 	E *float64
+	F *float64
 }
 
 func isValidPrinterName(name string) bool {
@@ -154,6 +290,10 @@ func NewStreamingProcessor(config ProcessingRequest) (*StreamingProcessor, error
 
 		// Load printer definition from TOML file
 		printerDef, err = loadPrinterDefinition(printerName)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, unknownPrinterError(printerName)
+		}
+
 		if err != nil {
 			return nil, fmt.Errorf("failed to load printer definition: %w", err)
 		}
@@ -161,22 +301,59 @@ func NewStreamingProcessor(config ProcessingRequest) (*StreamingProcessor, error
 		templateCode = printerDef.Template.Code
 	}
 
+	err = validateBedSize(printerDef.Bed)
+	if err != nil {
+		return nil, err
+	}
+
+	// Strategies chosen for the request take precedence over the printer's
+	if config.InitStrategy != "" {
+		_, err = CreateSearchStrategy(config.InitStrategy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid init strategy value %q: %w", config.InitStrategy, err)
+		}
+
+		printerDef.SearchStrategy.EndInitSectionStrategy = config.InitStrategy
+	}
+
+	if config.PrintStrategy != "" {
+		_, err = CreateSearchStrategy(config.PrintStrategy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid print strategy value %q: %w", config.PrintStrategy, err)
+		}
+
+		printerDef.SearchStrategy.EndPrintSectionStrategy = config.PrintStrategy
+	}
+
 	// Create search strategies
-	initStrategy, err := CreateSearchStrategy(printerDef.SearchStrategy.EndInitSectionStrategy)
+	matchMode := strategy.MatchMode(printerDef.Markers.MatchMode)
+	commentPrefix := parameterString(printerDef.Parameters, "CommentPrefix", ";")
+
+	initStrategy, err := createSearchStrategy(printerDef.SearchStrategy.EndInitSectionStrategy, matchMode, commentPrefix)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create init section strategy: %w", err)
 	}
 
-	printStrategy, err := CreateSearchStrategy(printerDef.SearchStrategy.EndPrintSectionStrategy)
+	printStrategy, err := createSearchStrategy(printerDef.SearchStrategy.EndPrintSectionStrategy, matchMode, commentPrefix)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create print section strategy: %w", err)
 	}
 
+	lineEnding, err := parseLineEnding(config.LineEnding)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.CommentStyle != "" && config.CommentStyle != "semicolon" && config.CommentStyle != "parentheses" {
+		return nil, fmt.Errorf("invalid comment style %q: must be semicolon or parentheses", config.CommentStyle)
+	}
+
 	// Parse template
-	tmpl, err := template.New("printer").Funcs(template.FuncMap{
-		"add": func(a, b float64) float64 { return a + b },
-		"sub": func(a, b float64) float64 { return a - b },
-		"mul": func(a, b int) int { return a * b },
+	tmpl, err := parseTemplate(template.FuncMap{
+		"add":  func(a, b float64) float64 { return a + b },
+		"sub":  func(a, b float64) float64 { return a - b },
+		"mul":  func(a, b int) int { return a * b },
+		"mulf": func(a, b float64) float64 { return a * b },
 		"max": func(a, b float64) float64 {
 			if a > b {
 				return a
@@ -184,18 +361,123 @@ func NewStreamingProcessor(config ProcessingRequest) (*StreamingProcessor, error
 
 			return b
 		},
-	}).Parse(templateCode)
+		"min": func(a, b float64) float64 {
+			if a < b {
+				return a
+			}
+
+			return b
+		},
+		// clamp bounds v to lo..hi, e.g. a park position to the bed
+		"clamp": func(v, lo, hi float64) float64 {
+			if v < lo {
+				return lo
+			}
+
+			if v > hi {
+				return hi
+			}
+
+			return v
+		},
+		// fixed formats v with places decimals, avoiding long fractions and exponents in G-code
+		"fixed": func(v float64, places int) string {
+			return strconv.FormatFloat(v, 'f', places, 64)
+		},
+		"bedCooldown": func(temp int64) string {
+			return formatBedCooldownCommand(parameterString(printerDef.Parameters, "BedCooldownCommand", defaultBedCooldownCommand), temp)
+		},
+		"wait": func(minutes int64) string {
+			return formatWaitCommand(parameterString(printerDef.Parameters, "WaitCommand", defaultWaitCommand), minutes)
+		},
+	}, templateCode, printerDef.Fragments)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse template: %w", err)
 	}
 
-	return &StreamingProcessor{
+	processor := &StreamingProcessor{
 		config:        config,
 		printerDef:    *printerDef,
 		initStrategy:  initStrategy,
 		printStrategy: printStrategy,
 		template:      tmpl,
-	}, nil
+		lineEnding:    lineEnding,
+		commentPrefix: commentPrefix,
+		ctx:           context.Background(),
+		createOutput: func(name string) (io.WriteCloser, error) {
+			return os.Create(name)
+		},
+	}
+	processor.numberLines = processor.boolParameter("LineNumbers", false)
+
+	if config.CustomTemplate != "" {
+		err = processor.checkTemplateParameters()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse custom template: %w", err)
+		}
+	}
+
+	return processor, nil
+}
+
+// CommentPrefix returns the start of G-code comments for the printer, Parameters.CommentPrefix or ";"
+func (p *StreamingProcessor) CommentPrefix() string {
+	return p.commentPrefix
+}
+
+// Warnings returns the non-fatal problems found while processing
+func (p *StreamingProcessor) Warnings() []string {
+	return p.warnings
+}
+
+// warn records a non-fatal problem found while processing
+func (p *StreamingProcessor) warn(format string, args ...any) {
+	p.warnings = append(p.warnings, fmt.Sprintf(format, args...))
+}
+
+// floatParameter returns a numeric printer parameter, or fallback when it is absent or not a number
+func (p *StreamingProcessor) floatParameter(name string, fallback float64) float64 {
+	if value, ok := p.printerDef.Parameters[name].(float64); ok {
+		return value
+	}
+
+	return fallback
+}
+
+// boolParameter returns a boolean printer parameter, or fallback when it is absent or not a bool
+func (p *StreamingProcessor) boolParameter(name string, fallback bool) bool {
+	if value, ok := p.printerDef.Parameters[name].(bool); ok {
+		return value
+	}
+
+	return fallback
+}
+
+// stringParameter returns a non-empty string printer parameter, or fallback when it is absent, empty or not a string
+func (p *StreamingProcessor) stringParameter(name string, fallback string) string {
+	return parameterString(p.printerDef.Parameters, name, fallback)
+}
+
+// parameterInt returns the numeric parameter as a whole number, or 0 when it is missing or not a number.
+// Parameters of a definition that wasn't normalized are int64 when written without a fraction.
+func parameterInt(parameters map[string]any, name string) int64 {
+	switch value := parameters[name].(type) {
+	case int64:
+		return value
+	case float64:
+		return int64(value)
+	}
+
+	return 0
+}
+
+// parameterString returns the string parameter or fallback when it is missing or empty
+func parameterString(parameters map[string]any, name string, fallback string) string {
+	if value, ok := parameters[name].(string); ok && value != "" {
+		return value
+	}
+
+	return fallback
 }
 
 // parseCustomTemplate parses a custom template in TOML format and extracts the template code
@@ -204,11 +486,15 @@ func parseCustomTemplate(customTemplate string, printerName string) (*PrinterDef
 
 	err := toml.Unmarshal([]byte(customTemplate), &def)
 	if err != nil {
+		if hint := customTemplateHint(customTemplate); hint != "" {
+			return nil, "", fmt.Errorf("failed to parse custom template TOML: %w; likely cause: %s", err, hint)
+		}
+
 		return nil, "", fmt.Errorf("failed to parse custom template TOML: %w", err)
 	}
 
 	// Validate required fields
-	if len(def.Markers.EndInitSection) == 0 {
+	if len(def.initMarkerSets()) == 0 {
 		return nil, "", errors.New("custom template missing EndInitSection markers")
 	}
 
@@ -239,13 +525,71 @@ func parseCustomTemplate(customTemplate string, printerName string) (*PrinterDef
 	return &def, def.Template.Code, nil
 }
 
-//go:embed printers/*.toml
+// customTemplateHint names a common mistake in a custom template that failed to parse: a """ string
+// that is never closed or indentation mixing tabs and spaces, which usually comes from pasting. Returns
+// "" when neither is found.
+func customTemplateHint(customTemplate string) string {
+	lines := strings.Split(customTemplate, "\n")
+
+	openLine := -1
+
+	for i, line := range lines {
+		for range strings.Count(line, `"""`) {
+			if openLine < 0 {
+				openLine = i
+			} else {
+				openLine = -1
+			}
+		}
+	}
+
+	if openLine >= 0 {
+		return fmt.Sprintf(`the """ string opened on line %d is never closed`, openLine+1)
+	}
+
+	for i, line := range lines {
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if strings.Contains(indent, " ") && strings.Contains(indent, "\t") {
+			return fmt.Sprintf("line %d mixes tabs and spaces in its indentation", i+1)
+		}
+	}
+
+	return ""
+}
+
+//go:embed printers/*.toml printers/*.gcode
 var printerConfigs embed.FS
 
-func loadPrinterDefinition(printerName string) (*PrinterDefinition, error) {
-	filename := "printers/" + printerName + ".toml"
+// ProfilesDir is an optional directory of printer definitions and samples, read before the embedded
+// ones so a file there adds a printer or replaces the embedded file with the same name without rebuilding
+var ProfilesDir = ""
+
+// readPrinterFile returns the file of a printer with the given extension, e.g. ".toml" for its
+// definition, from ProfilesDir when it has one, otherwise the embedded one
+func readPrinterFile(printerName, extension string) ([]byte, error) {
+	filename := printerName + extension
+
+	if ProfilesDir != "" {
+		// The name becomes a path below ProfilesDir, it must not leave the directory
+		if !isValidPrinterName(printerName) || !filepath.IsLocal(filename) {
+			return nil, fmt.Errorf("invalid printer name %q", printerName)
+		}
+
+		data, err := os.ReadFile(filepath.Join(ProfilesDir, filename))
+		if err == nil {
+			return data, nil
+		}
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
 
-	data, err := printerConfigs.ReadFile(filename)
+	return printerConfigs.ReadFile("printers/" + filename)
+}
+
+func loadPrinterDefinition(printerName string) (*PrinterDefinition, error) {
+	data, err := readPrinterFile(printerName, ".toml")
 	if err != nil {
 		return nil, err
 	}
@@ -263,7 +607,9 @@ func loadPrinterDefinition(printerName string) (*PrinterDefinition, error) {
 	return &def, err
 }
 
-// normalizeParameters converts all numeric values in Parameters to float64 for template compatibility
+// normalizeParameters converts all numeric values in Parameters to float64 for template compatibility.
+// Templates print whole floats without a fraction, so an integer parameter renders as written; the
+// TOML served to editors is the raw file and keeps its own formatting.
 func normalizeParameters(def *PrinterDefinition) {
 	if def.Parameters == nil {
 		return
@@ -287,492 +633,2281 @@ func normalizeParameters(def *PrinterDefinition) {
 
 // ProcessFile processes a file using true streaming with multiple passes
 func (p *StreamingProcessor) ProcessFile(inputPath, outputPath string) error {
-	// Validate input first
-	err := p.validateInput()
-	if err != nil {
-		return err
-	}
+	return p.ProcessFileContext(context.Background(), inputPath, outputPath)
+}
 
-	// Pass 1: Find marker positions and extract G-code coordinates
-	pos, err := p.findMarkerPositions(inputPath)
-	if err != nil {
-		return err
-	}
+// ProcessFileContext is ProcessFile aborting with an error wrapping ctx.Err() once ctx is done
+func (p *StreamingProcessor) ProcessFileContext(ctx context.Context, inputPath, outputPath string) error {
+	p.ctx = ctx
 
-	p.positions = *pos
+	strippedPath := outputPath + ".stripped"
+	defer os.Remove(strippedPath)
 
-	// Validate bed temperature is available when the template actually uses it
-	templateUsesBedTemp := strings.Contains(p.printerDef.Template.Code, ".Positions.BedTemp")
-	if templateUsesBedTemp && p.config.WaitBedCooldownTemp > 0 && p.positions.BedTemp == 0 {
-		return errors.New("bed cooldown enabled but no M190 (set bed temperature) command found in init section")
+	inputPath, err := p.prepare(inputPath, strippedPath)
+	if err != nil {
+		return p.abortError(err)
 	}
 
-	// Validate assertions against found positions
-	err = validateAssertions(p.positions, p.printerDef.Assertions)
+	p.lines, err = p.lineStats()
 	if err != nil {
-		return err
+		return p.abortError(err)
 	}
 
-	// Open output file
-	outputFile, err := os.Create(outputPath)
+	err = p.writeOutputWithRetry(inputPath, outputPath, 1, p.config.Iterations)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return p.abortError(err)
 	}
-	defer outputFile.Close()
 
-	writer := bufio.NewWriter(outputFile)
-	defer writer.Flush()
+	p.warnIfNothingGenerated()
 
-	// Pass 2: Stream header (lines 0 to EndInitSectionLastLine inclusive)
-	err = p.streamLinesRange(inputPath, writer, 0, p.positions.EndInitSectionLastLine, true)
+	return nil
+}
+
+// ProcessStreamContext is ProcessFileContext writing the output to w instead of a file, for consumers
+// forwarding the output while it is produced. Failed writes are not retried.
+func (p *StreamingProcessor) ProcessStreamContext(ctx context.Context, inputPath string, w io.Writer) error {
+	p.ctx = ctx
+
+	strippedPath := inputPath + ".stripped"
+	defer os.Remove(strippedPath)
+
+	inputPath, err := p.prepare(inputPath, strippedPath)
 	if err != nil {
-		return fmt.Errorf("failed to stream header: %w", err)
+		return p.abortError(err)
 	}
 
-	// Pass 3: For each iteration, stream body + end marker + generated content
-	for i := range p.config.Iterations {
-		// Stream body (lines after EndInitSectionLastLine to before EndPrintSectionFirstLine)
-		if p.positions.EndInitSectionLastLine+1 < p.positions.EndPrintSectionFirstLine {
-			err = p.streamLinesRange(inputPath, writer, p.positions.EndInitSectionLastLine+1, p.positions.EndPrintSectionFirstLine-1, false)
-			if err != nil {
-				return fmt.Errorf("failed to stream body for iteration %d: %w", i+1, err)
-			}
-		}
+	writer := bufio.NewWriter(w)
 
-		// Stream end marker lines (can be multiline now)
-		err = p.streamLinesRange(inputPath, writer, p.positions.EndPrintSectionFirstLine, p.positions.EndPrintSectionLastLine, false)
-		if err != nil {
-			return fmt.Errorf("failed to stream end marker for iteration %d: %w", i+1, err)
-		}
+	err = p.streamOutput(inputPath, writer, 1, p.config.Iterations)
+	if err != nil {
+		_ = writer.Flush()
 
-		// Stream generated content
-		err = p.streamGeneratedContent(writer, i+1)
-		if err != nil {
-			return fmt.Errorf("failed to stream generated content for iteration %d: %w", i+1, err)
-		}
+		return p.abortError(err)
 	}
 
-	// Pass 4: Stream footer (lines after EndPrintSectionLastLine to EOF)
-	err = p.streamLinesFromPosition(inputPath, writer, p.positions.EndPrintSectionLastLine+1)
+	err = writer.Flush()
 	if err != nil {
-		return fmt.Errorf("failed to stream footer: %w", err)
+		return fmt.Errorf("failed to write output: %w", err)
 	}
 
+	p.warnIfNothingGenerated()
+
 	return nil
 }
 
-// findMarkerPositions uses strategies to find marker positions and extract G-code coordinates
-func (p *StreamingProcessor) findMarkerPositions(filePath string) (*MarkerPositions, error) {
-	// Find init section positions using strategy
-	initFirst, initLast, err := p.initStrategy.FindInitSectionPosition(filePath, p.printerDef.Markers.EndInitSection)
-	if err != nil {
-		return nil, err
+// warnIfNothingGenerated warns when the template rendered to whitespace for every iteration, which
+// leaves the iterations without the moves that clear the bed
+func (p *StreamingProcessor) warnIfNothingGenerated() {
+	if !p.generated {
+		p.warn("template produced no generated code for any iteration, check the template")
 	}
+}
 
-	// Find print section position using strategy - now returns begin,end
-	printFirst, printLast, err := p.printStrategy.FindPrintSectionPosition(filePath, p.printerDef.Markers.EndPrintSection, initLast)
-	if err != nil {
-		return nil, err
-	}
+// ProcessFileWithProgress is ProcessFile calling progress with the number of iterations streamed so far
+// and their total after each iteration
+func (p *StreamingProcessor) ProcessFileWithProgress(inputPath, outputPath string, progress func(iteration, total int64)) error {
+	p.config.Progress = progress
 
-	if initLast >= printFirst {
-		return nil, errors.New("invalid marker positions: start marker ends after or at end marker")
+	return p.ProcessFile(inputPath, outputPath)
+}
+
+// abortError replaces err with the reason of the abort when the processing context is done
+func (p *StreamingProcessor) abortError(err error) error {
+	ctxErr := p.ctx.Err()
+	if ctxErr == nil {
+		return err
 	}
 
-	// Extract bed temperature from init section
-	bedTemp, err := extractBedTemp(filePath, initLast)
-	if err != nil {
-		return nil, err
+	return fmt.Errorf("processing aborted: %w", ctxErr)
+}
+
+// ProcessFileChunked splits the looped output into independently printable files, each with the
+// full header and footer and at most Request.ChunkIterations iterations or Request.ChunkSizeMB
+// megabytes (whichever is smaller, but at least one iteration). Files are named
+// <output base>.partNNN<output ext> and their paths are returned in order.
+func (p *StreamingProcessor) ProcessFileChunked(inputPath, outputPath string) ([]string, error) {
+	return p.ProcessFileChunkedContext(context.Background(), inputPath, outputPath)
+}
+
+// ProcessFileChunkedContext is ProcessFileChunked aborting with an error wrapping ctx.Err() once
+// ctx is done
+func (p *StreamingProcessor) ProcessFileChunkedContext(ctx context.Context, inputPath, outputPath string) ([]string, error) {
+	p.ctx = ctx
+
+	if p.config.ChunkIterations <= 0 && p.config.ChunkSizeMB <= 0 {
+		return nil, errors.New("chunk iterations or chunk size must be positive")
 	}
 
-	// Extract G-code coordinates
-	firstPrintX, firstPrintY, firstPrintZ, lastPrintX, lastPrintY, lastPrintZ, avgPrintX, avgPrintY, minPrintX, minPrintY, maxPrintX, maxPrintY, err := p.extractGCodeCoordinates(filePath, initLast)
+	strippedPath := outputPath + ".stripped"
+	defer os.Remove(strippedPath)
+
+	inputPath, err := p.prepare(inputPath, strippedPath)
 	if err != nil {
-		return nil, err
+		return nil, p.abortError(err)
 	}
 
-	positions := &MarkerPositions{
-		EndInitSectionFirstLine:  initFirst,
-		EndInitSectionLastLine:   initLast,
-		EndPrintSectionFirstLine: printFirst,
-		EndPrintSectionLastLine:  printLast,
-		FirstPrintX:              firstPrintX,
-		FirstPrintY:              firstPrintY,
-		FirstPrintZ:              firstPrintZ,
-		LastPrintX:               lastPrintX,
-		LastPrintY:               lastPrintY,
-		LastPrintZ:               lastPrintZ,
-		AveragePrintX:            avgPrintX,
-		AveragePrintY:            avgPrintY,
-		MinPrintX:                minPrintX,
-		MinPrintY:                minPrintY,
-		MaxPrintX:                maxPrintX,
-		MaxPrintY:                maxPrintY,
-		BedTemp:                  bedTemp,
+	iterationsPerChunk := p.config.Iterations
+	if p.config.ChunkIterations > 0 {
+		iterationsPerChunk = p.config.ChunkIterations
 	}
 
-	return positions, nil
-}
+	if p.config.ChunkSizeMB > 0 {
+		fitting, err := p.iterationsFittingInChunk(inputPath, p.config.ChunkSizeMB<<20)
+		if err != nil {
+			return nil, fmt.Errorf("failed to measure chunk size: %w", err)
+		}
 
-// extractGCodeCoordinates scans file and extracts first, last, average, min, and max print coordinates
-func (p *StreamingProcessor) extractGCodeCoordinates(filePath string, endInitSectionLastLine int64) (float64, float64, float64, float64, float64, float64, float64, float64, float64, float64, float64, float64, error) { //nolint:gocognit,gocyclo
-	file, err := os.Open(filePath)
-	if err != nil {
-		return 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, err
+		iterationsPerChunk = min(iterationsPerChunk, fitting)
 	}
-	defer file.Close()
 
-	var (
-		firstPrintX, firstPrintY, firstPrintZ *float64
-		lastPrintX, lastPrintY, lastPrintZ    *float64
-		currentZ                              *float64
-		firstPrintFound                       bool
-		sumX, sumY                            float64
-		countX, countY                        int
-		minX, minY, maxX, maxY                *float64
-	)
+	ext := filepath.Ext(outputPath)
+	base := strings.TrimSuffix(outputPath, ext)
 
-	scanner := bufio.NewScanner(file)
-	lineNum := int64(0)
+	var chunkPaths []string
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	for first := int64(1); first <= p.config.Iterations; first += iterationsPerChunk {
+		last := min(first+iterationsPerChunk-1, p.config.Iterations)
+		chunkPath := fmt.Sprintf("%s.part%03d%s", base, len(chunkPaths)+1, ext)
+		chunkPaths = append(chunkPaths, chunkPath)
 
-		// Parse G-code coordinates from this line
-		if coords := p.parseGCodeLine(line); coords != nil { //nolint:nestif
-			// Update current Z from any G1 command
-			if coords.Z != nil {
-				currentZ = coords.Z
+		err = p.writeOutputWithRetry(inputPath, chunkPath, first, last)
+		if err != nil {
+			for _, path := range chunkPaths {
+				_ = os.Remove(path)
 			}
 
-			// Update coordinates for print commands (G1 with positive E)
-			if coords.E != nil && *coords.E > 0 && (coords.X != nil || coords.Y != nil) {
-				// This is a print command
+			return nil, p.abortError(fmt.Errorf("failed to write chunk %d: %w", len(chunkPaths), err))
+		}
+	}
 
-				// Track first print coordinates after init section
-				if !firstPrintFound && lineNum > endInitSectionLastLine {
-					if coords.X != nil {
-						firstPrintX = coords.X
-					}
+	p.warnIfNothingGenerated()
 
-					if coords.Y != nil {
-						firstPrintY = coords.Y
-					}
+	return chunkPaths, nil
+}
 
-					// Remember the Z that was active during this first print command
-					if currentZ != nil {
-						firstPrintZ = currentZ
-					}
+// iterationsFittingInChunk returns how many iterations fit in maxChunkBytes next to the header and
+// footer, based on the file and body sizes of the found regions. At least one iteration always fits.
+func (p *StreamingProcessor) iterationsFittingInChunk(inputPath string, maxChunkBytes int64) (int64, error) {
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return 0, err
+	}
 
-					firstPrintFound = true
-				}
+	fileBytes := info.Size()
+	bodyBytes := p.regionsBodyBytes()
 
-				// Always update last print coordinates
-				if coords.X != nil {
-					lastPrintX = coords.X
-				}
+	if bodyBytes == 0 {
+		return p.config.Iterations, nil
+	}
 
-				if coords.Y != nil {
-					lastPrintY = coords.Y
-				}
+	// Header and footer are repeated in every chunk
+	overhead := fileBytes - bodyBytes
 
-				// Remember the Z that was active during this print command
-				if currentZ != nil {
-					lastPrintZ = currentZ
-				}
+	return max((maxChunkBytes-overhead)/bodyBytes, 1), nil
+}
 
-				if coords.X != nil {
-					sumX += *coords.X
-					countX++
+// regionsBodyBytes returns the size of the body and end marker of all regions, from the offsets found
+// by scanPositions
+func (p *StreamingProcessor) regionsBodyBytes() int64 {
+	var bodyBytes int64
 
-					if minX == nil || *coords.X < *minX {
-						minX = coords.X
-					}
+	for _, region := range p.regions {
+		bodyBytes += region.FooterOffset - region.BodyOffset
+	}
 
-					if maxX == nil || *coords.X > *maxX {
-						maxX = coords.X
-					}
-				}
+	return bodyBytes
+}
 
-				if coords.Y != nil {
-					sumY += *coords.Y
-					countY++
+// prepare validates the request, finds the loop regions and returns the path of the input to stream,
+// which is strippedPath when existing line numbers had to be removed
+func (p *StreamingProcessor) prepare(inputPath, strippedPath string) (string, error) {
+	// Validate input first
+	err := p.validateInput()
+	if err != nil {
+		return "", err
+	}
 
-					if minY == nil || *coords.Y < *minY {
-						minY = coords.Y
-					}
+	// Pass 0: Keep the input's line terminator unless one was requested
+	if p.lineEnding == "" {
+		sampleLines := int64(p.floatParameter("LineEndingSampleLines", defaultLineEndingSampleLines))
 
-					if maxY == nil || *coords.Y > *maxY {
-						maxY = coords.Y
-					}
-				}
-			}
+		p.lineEnding, err = detectLineEnding(inputPath, sampleLines)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Strip existing N<line> prefixes so markers match the bare commands
+	if p.boolParameter("StripLineNumbers", true) {
+		numbered, err := detectLineNumbers(inputPath, p.commentPrefix)
+		if err != nil {
+			return "", err
 		}
 
-		lineNum++
+		if numbered {
+			err = stripLineNumbers(inputPath, strippedPath)
+			if err != nil {
+				return "", err
+			}
+
+			inputPath = strippedPath
+		}
 	}
 
-	err = scanner.Err()
+	// Pass 1: Find marker positions and extract G-code coordinates
+	regions, err := p.findRegions(inputPath)
 	if err != nil {
-		return 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, err
+		return "", err
 	}
 
-	// Return coordinates with defaults if not found
-	var fx, fy, fz, lx, ly, lz float64
+	p.regions = regions
+	p.positions = regions[0]
+	p.streamed = 0
+	p.generated = false
+	p.linted = nil
 
-	if firstPrintX != nil {
-		fx = *firstPrintX
+	// Sanity check that the end of print isn't found in what is likely the header
+	if !p.hasBodyRange() {
+		err = p.validatePrintSectionPosition(regions[len(regions)-1])
+		if err != nil {
+			return "", err
+		}
 	}
 
-	if firstPrintY != nil {
-		fy = *firstPrintY
+	// Looping printloop output again would repeat every iteration
+	err = p.validateNotLooped(inputPath)
+	if err != nil {
+		return "", err
 	}
 
-	if firstPrintZ != nil {
-		fz = *firstPrintZ
+	// Validate bed temperature is available when the template actually uses it
+	templateUsesBedTemp := p.templateMentions(".Positions.BedTemp")
+	if templateUsesBedTemp && p.config.WaitBedCooldownTemp > 0 && p.positions.BedTemp == 0 {
+		return "", errors.New("bed cooldown enabled but no M190 (set bed temperature) command found in init section")
 	}
 
-	if lastPrintX != nil {
-		lx = *lastPrintX
-	}
+	for _, region := range regions {
+		p.positions = region
 
-	if lastPrintY != nil {
-		ly = *lastPrintY
-	}
+		// Validate assertions against found positions
+		err = validateAssertions(p.positions, p.printerDef.Assertions)
+		if err != nil {
+			return "", err
+		}
 
-	if lastPrintZ != nil {
-		lz = *lastPrintZ
-	}
+		// A body of just a couple of lines usually means the markers matched the wrong place
+		err = p.validateBodyLength()
+		if err != nil {
+			return "", err
+		}
 
-	if !strings.Contains(p.config.Printer, "unit-tests") {
-		// unit tests don't contain entire G-code, so we don't check for first print found
-		if !firstPrintFound {
-			return fx, fy, fz, lx, ly, lz, 0, 0, 0, 0, 0, 0, fmt.Errorf("no print commands found after end of init section at line %d", endInitSectionLastLine)
+		if p.stringParameter("LoopScope", loopScopeFull) == loopScopeFirstLayer && p.positions.FirstLayerLastLine == p.positions.EndPrintSectionFirstLine-1 {
+			p.warn("no layer change found in the body, LoopScope %s loops the whole body", loopScopeFirstLayer)
 		}
 	}
 
-	var avgX, avgY float64
-	if countX > 0 {
-		avgX = sumX / float64(countX)
-	}
+	p.positions = regions[0]
 
-	if countY > 0 {
-		avgY = sumY / float64(countY)
+	// Reject requests that would produce an unreasonably large file
+	err = p.validateOutputSize()
+	if err != nil {
+		return "", err
 	}
 
-	var mnX, mnY, mxX, mxY float64
+	// Estimate iteration duration for status messages in templates
+	p.iterationEta, err = p.estimateIterationDuration(inputPath)
+	if err != nil {
+		return "", err
+	}
+
+	return inputPath, nil
+}
+
+// writeOutput writes header, iterations firstIteration..lastIteration of every region and footer to outputPath
+func (p *StreamingProcessor) writeOutput(inputPath, outputPath string, firstIteration, lastIteration int64) error {
+	// Open output file
+	outputFile, err := p.createOutput(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outputFile.Close()
+
+	writer := bufio.NewWriter(outputFile)
+
+	err = p.streamOutput(inputPath, writer, firstIteration, lastIteration)
+	if err != nil {
+		// Keep what was written so far for inspection
+		_ = writer.Flush()
+
+		return err
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	err = outputFile.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close output file: %w", err)
+	}
+
+	return nil
+}
+
+// writeOutputWithRetry is writeOutput starting over after transient I/O errors, at most OutputRetries
+// times with a backoff doubling from OutputRetryBackoff
+func (p *StreamingProcessor) writeOutputWithRetry(inputPath, outputPath string, firstIteration, lastIteration int64) error {
+	streamed := p.streamed
+	backoff := OutputRetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		p.streamed = streamed
+
+		err := p.writeOutput(inputPath, outputPath, firstIteration, lastIteration)
+		if err == nil || attempt > OutputRetries || !isTransientIOError(err) {
+			return err
+		}
+
+		slog.Warn("Retrying output after transient I/O error", "output", outputPath, "attempt", attempt, "error", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-p.ctx.Done():
+			return err
+		}
+
+		backoff *= 2
+	}
+}
+
+// isTransientIOError reports whether err is an I/O error that may succeed when retried, as seen on
+// networked storage. Errors like ENOSPC or EACCES are permanent.
+func isTransientIOError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EAGAIN, syscall.EINTR, syscall.ETIMEDOUT, syscall.EBUSY, syscall.ESTALE} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// streamOutput writes the header, the iterations from firstIteration to lastIteration of every
+// region and the footer
+func (p *StreamingProcessor) streamOutput(inputPath string, writer *bufio.Writer, firstIteration, lastIteration int64) error {
+	var err error
+
+	p.positions = p.regions[0]
+	p.lineNumber = 0
+
+	// Pass 2: Stream header (lines 0 to EndInitSectionLastLine inclusive)
+	err = p.streamHeader(inputPath, writer, lastIteration-firstIteration+1)
+	if err != nil {
+		return fmt.Errorf("failed to stream header: %w", err)
+	}
+
+	// Record a hash of the looped body so operators can identify the model
+	if p.boolParameter("BodyHash", false) {
+		bodyHash, err := hashLinesRange(inputPath, p.positions.EndInitSectionLastLine+1, p.bodyLastLine())
+		if err != nil {
+			return fmt.Errorf("failed to hash body: %w", err)
+		}
+
+		err = p.writeLine(writer, p.comment("printloop body sha256: "+bodyHash))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Announce the job on the printer display
+	message := p.startMessage(lastIteration - firstIteration + 1)
+	if message != "" {
+		err = p.writeLine(writer, "M117 "+message)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Pass 3: For each region, stream the lines leading up to it and then its iterations
+	for k, region := range p.regions {
+		if k > 0 {
+			// Lines between the previous region's end marker and this region's start marker
+			err = p.streamLinesRange(inputPath, writer, p.positions.EndPrintSectionLastLine+1, region.EndInitSectionLastLine, true)
+			if err != nil {
+				return fmt.Errorf("failed to stream lines before region %d: %w", k+1, err)
+			}
+		}
+
+		p.positions = region
+
+		err = p.streamIterations(inputPath, writer, firstIteration, lastIteration)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.stringParameter("EjectAt", ejectAtIteration) == ejectAtEnd {
+		err = p.streamEject(writer)
+		if err != nil {
+			return fmt.Errorf("failed to write eject commands: %w", err)
+		}
+	}
+
+	// Pass 4: Stream footer (lines after EndPrintSectionLastLine to EOF)
+	err = p.streamLinesFromPosition(inputPath, writer, p.positions.EndPrintSectionLastLine+1)
+	if err != nil {
+		return fmt.Errorf("failed to stream footer: %w", err)
+	}
+
+	return nil
+}
+
+// streamIterations streams body + end marker + generated content of the current region for
+// iterations firstIteration to lastIteration (1-based, inclusive)
+func (p *StreamingProcessor) streamIterations(inputPath string, writer *bufio.Writer, firstIteration, lastIteration int64) error {
+	for i := firstIteration - 1; i < lastIteration; i++ {
+		err := p.ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		if i > firstIteration-1 {
+			err = p.streamIterationSeparator(writer)
+			if err != nil {
+				return fmt.Errorf("failed to write separator before iteration %d: %w", i+1, err)
+			}
+		}
+
+		if p.config.CommentStyle != "" {
+			err = p.writeLine(writer, p.comment(fmt.Sprintf("printloop iteration %d/%d start", i+1, p.config.Iterations)))
+			if err != nil {
+				return err
+			}
+		}
+
+		// Reload the bed mesh before the body of iterations 1, 1+K, 1+2K, ...
+		if p.config.MeshReloadEvery > 0 && i%p.config.MeshReloadEvery == 0 {
+			err = p.writeLine(writer, p.stringParameter("MeshReloadCommand", defaultMeshReloadCommand))
+			if err != nil {
+				return fmt.Errorf("failed to write mesh reload for iteration %d: %w", i+1, err)
+			}
+		}
+
+		// Stream body (lines after EndInitSectionLastLine to before EndPrintSectionFirstLine, or to the end
+		// of the first layer). Thumbnails in the body are only needed once.
+		if p.positions.EndInitSectionLastLine < p.bodyLastLine() {
+			if i > 0 && p.boolParameter("StripThumbnails", false) {
+				err = p.streamLinesRangeWithoutThumbnails(inputPath, writer, p.positions.EndInitSectionLastLine+1, p.bodyLastLine())
+			} else {
+				err = p.streamLinesRange(inputPath, writer, p.positions.EndInitSectionLastLine+1, p.bodyLastLine(), false)
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to stream body for iteration %d: %w", i+1, err)
+			}
+		}
+
+		// Stream end marker lines (can be multiline now), with last_only on the last iteration of every
+		// output file so that each chunk stays self-contained
+		if p.stringParameter("EndMarkerMode", endMarkerEveryIteration) == endMarkerEveryIteration || i+1 == lastIteration {
+			err = p.streamLinesRange(inputPath, writer, p.positions.EndPrintSectionFirstLine, p.positions.EndPrintSectionLastLine, false)
+			if err != nil {
+				return fmt.Errorf("failed to stream end marker for iteration %d: %w", i+1, err)
+			}
+		}
+
+		// Stream generated content
+		err = p.streamGeneratedContent(writer, i+1)
+		if err != nil {
+			return fmt.Errorf("failed to stream generated content for iteration %d: %w", i+1, err)
+		}
+
+		if p.stringParameter("EjectAt", ejectAtIteration) == ejectAtIteration {
+			err = p.streamEject(writer)
+			if err != nil {
+				return fmt.Errorf("failed to write eject commands for iteration %d: %w", i+1, err)
+			}
+		}
+
+		if p.config.CommentStyle != "" {
+			err = p.writeLine(writer, p.comment(fmt.Sprintf("printloop iteration %d/%d end", i+1, p.config.Iterations)))
+			if err != nil {
+				return err
+			}
+		}
+
+		p.streamed++
+		if p.config.Progress != nil {
+			p.config.Progress(p.streamed, p.config.Iterations*int64(len(p.regions)))
+		}
+	}
+
+	return nil
+}
+
+// streamIterationSeparator writes Parameters.IterationSeparator between two iterations. Every line of
+// it is written as is, a single "\n" separates the iterations by a blank line.
+func (p *StreamingProcessor) streamIterationSeparator(writer *bufio.Writer) error {
+	separator := p.stringParameter("IterationSeparator", "")
+	if separator == "" {
+		return nil
+	}
+
+	for line := range strings.SplitSeq(strings.TrimSuffix(separator, "\n"), "\n") {
+		err := p.writeLine(writer, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Values of Parameters.LoopScope
+const (
+	loopScopeFull       = "full"        // The whole body between the markers
+	loopScopeFirstLayer = "first_layer" // Only the first layer of the body, e.g. to dial in bed adhesion
+)
+
+// bodyLastLine returns the last line of the current region's body that every iteration prints
+func (p *StreamingProcessor) bodyLastLine() int64 {
+	if p.stringParameter("LoopScope", loopScopeFull) == loopScopeFirstLayer {
+		return p.positions.FirstLayerLastLine
+	}
+
+	return p.positions.EndPrintSectionFirstLine - 1
+}
+
+// Values of Parameters.EndMarkerMode
+const (
+	endMarkerEveryIteration = "every_iteration" // The end marker lines follow the body of every iteration
+	endMarkerLastOnly       = "last_only"       // Only the last iteration of each file keeps the end marker, e.g. when it resets the firmware
+)
+
+// Values of Parameters.EjectAt
+const (
+	ejectAtIteration = "iteration" // After the generated content of every iteration
+	ejectAtEnd       = "end"       // Once after the last iteration of the output file
+)
+
+// streamEject writes the lines of Parameters.EjectCommands, the firmware's plate eject sequence
+func (p *StreamingProcessor) streamEject(writer *bufio.Writer) error {
+	for line := range strings.SplitSeq(p.stringParameter("EjectCommands", ""), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		err := p.writeLine(writer, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findRegions returns the loop regions of the file. With Parameters.MultiRegion enabled every
+// init/print marker pair is located with after_first_appear, one after another; otherwise the
+// configured strategies find a single region.
+func (p *StreamingProcessor) findRegions(filePath string) ([]MarkerPositions, error) {
+	if p.hasBodyRange() {
+		pos, err := p.bodyRangePositions(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		return []MarkerPositions{*pos}, nil
+	}
+
+	if !p.boolParameter("MultiRegion", false) {
+		pos, err := p.findMarkerPositions(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		return []MarkerPositions{*pos}, nil
+	}
+
+	finder := &strategy.AfterFirstAppearStrategy{Mode: p.matchMode(), CommentPrefix: p.commentPrefix}
+
+	var regions []MarkerPositions
+
+	searchFromLine := int64(-1)
+
+	// The marker set found for the first region marks the following ones
+	initFirst, initLast, err := p.findInitSection(func(markers []string) (int64, int64, error) {
+		return finder.FindPrintSectionPosition(p.ctx, filePath, markers, searchFromLine)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("start marker not found: %v: %w", p.printerDef.initMarkerSets(), err)
+	}
+
+	for {
+		if len(regions) > 0 {
+			initFirst, initLast, err = finder.FindPrintSectionPosition(p.ctx, filePath, p.initMarkers, searchFromLine)
+			if err != nil {
+				if p.ctx.Err() == nil {
+					break
+				}
+
+				return nil, fmt.Errorf("start marker not found: %v: %w", p.initMarkers, err)
+			}
+		}
+
+		printFirst, printLast, err := finder.FindPrintSectionPosition(p.ctx, filePath, p.printerDef.Markers.EndPrintSection, initLast)
+		if err != nil {
+			return nil, fmt.Errorf("region %d: %w", len(regions)+1, err)
+		}
+
+		pos, err := p.buildPositions(filePath, initFirst, initLast, printFirst, printLast)
+		if err != nil {
+			return nil, err
+		}
+
+		regions = append(regions, *pos)
+		searchFromLine = printLast
+	}
+
+	return regions, nil
+}
+
+// hasBodyRange reports whether the request names the body lines instead of leaving them to the markers
+func (p *StreamingProcessor) hasBodyRange() bool {
+	return p.config.BodyStartLine > 0 && p.config.BodyEndLine > 0
+}
+
+// bodyRangePositions returns the positions of the body between Request.BodyStartLine and
+// Request.BodyEndLine. Everything before the body is the header and everything after it the footer,
+// the end marker section is empty.
+func (p *StreamingProcessor) bodyRangePositions(filePath string) (*MarkerPositions, error) {
+	totalLines, _, err := measureLinesRange(filePath, 0, math.MaxInt64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count lines: %w", err)
+	}
+
+	if p.config.BodyEndLine > totalLines {
+		return nil, fmt.Errorf("invalid body_end_line value %d: the file has only %d lines", p.config.BodyEndLine, totalLines)
+	}
+
+	initLast := p.config.BodyStartLine - 2
+	printFirst := p.config.BodyEndLine
+
+	return p.buildPositions(filePath, initLast, initLast, printFirst, printFirst-1)
+}
+
+// initMarkerSets returns EndInitSection followed by EndInitSectionAlternatives, the marker sets tried
+// in order for the init section
+func (def *PrinterDefinition) initMarkerSets() [][]string {
+	var sets [][]string
+
+	if len(def.Markers.EndInitSection) > 0 {
+		sets = append(sets, def.Markers.EndInitSection)
+	}
+
+	return append(sets, def.Markers.EndInitSectionAlternatives...)
+}
+
+// findInitSection returns the position find reports for the first init marker set that is found and
+// keeps that set as p.initMarkers. When no set is found, the error is the one of the first set.
+func (p *StreamingProcessor) findInitSection(find func(markers []string) (int64, int64, error)) (int64, int64, error) {
+	var firstErr error
+
+	for _, markers := range p.printerDef.initMarkerSets() {
+		begin, end, err := find(markers)
+		if err == nil {
+			p.initMarkers = markers
+			return begin, end, nil
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+
+		if p.ctx.Err() != nil {
+			break
+		}
+	}
+
+	return 0, 0, firstErr
+}
+
+// findMarkerPositions uses strategies to find marker positions and extract G-code coordinates
+func (p *StreamingProcessor) findMarkerPositions(filePath string) (*MarkerPositions, error) {
+	// Find init section positions using strategy
+	initFirst, initLast, err := p.findInitSection(func(markers []string) (int64, int64, error) {
+		return p.initStrategy.FindInitSectionPosition(p.ctx, filePath, markers)
+	})
+	if err != nil {
+		return nil, p.markerSearchError("init section", filePath, p.printerDef.initMarkerSets()[0], -1, err)
+	}
+
+	// Find print section position using strategy - now returns begin,end
+	printFirst, printLast, err := p.printStrategy.FindPrintSectionPosition(p.ctx, filePath, p.printerDef.Markers.EndPrintSection, initLast)
+	if err != nil {
+		if endLine, found := p.endMarkerBefore(filePath, initFirst); found {
+			return nil, fmt.Errorf("end marker found before init marker: end marker at line %d precedes the init marker at line %d and none follows it, check EndInitSectionStrategy %s and EndPrintSectionStrategy %s",
+				endLine+1, initFirst+1, p.printerDef.SearchStrategy.EndInitSectionStrategy, p.printerDef.SearchStrategy.EndPrintSectionStrategy)
+		}
+
+		return nil, p.markerSearchError("print section", filePath, p.printerDef.Markers.EndPrintSection, initLast, err)
+	}
+
+	if initLast >= printFirst {
+		return nil, fmt.Errorf("markers overlap: init marker ends at line %d, at or after the end marker at line %d, check EndInitSectionStrategy %s and EndPrintSectionStrategy %s",
+			initLast+1, printFirst+1, p.printerDef.SearchStrategy.EndInitSectionStrategy, p.printerDef.SearchStrategy.EndPrintSectionStrategy)
+	}
+
+	if initLast+1 >= printFirst {
+		return nil, errors.New("print body is empty between init and print markers")
+	}
+
+	return p.buildPositions(filePath, initFirst, initLast, printFirst, printLast)
+}
+
+// endMarkerBefore returns the first line of the first end marker when it starts before line, which
+// explains an end marker search after the init section that found nothing
+func (p *StreamingProcessor) endMarkerBefore(filePath string, line int64) (int64, bool) {
+	if p.ctx.Err() != nil {
+		return 0, false
+	}
+
+	finder := &strategy.AfterFirstAppearStrategy{Mode: p.matchMode(), CommentPrefix: p.commentPrefix}
+
+	endFirst, _, err := finder.FindPrintSectionPosition(p.ctx, filePath, p.printerDef.Markers.EndPrintSection, -1)
+	if err != nil || endFirst >= line {
+		return 0, false
+	}
+
+	return endFirst, true
+}
+
+// matchMode returns how the printer's marker lines are compared with G-code lines
+func (p *StreamingProcessor) matchMode() strategy.MatchMode {
+	return strategy.MatchMode(p.printerDef.Markers.MatchMode)
+}
+
+// markerSearchError names the section whose marker search failed and, for multiline markers, where
+// the leading marker lines matched furthest
+func (p *StreamingProcessor) markerSearchError(section, filePath string, markers []string, searchFromLine int64, err error) error {
+	if len(markers) < 2 || p.ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", section, err)
+	}
+
+	partial, partialErr := strategy.FindPartialMatch(p.ctx, filePath, markers, p.matchMode(), p.commentPrefix, searchFromLine)
+	if partialErr != nil || partial.Matched == 0 {
+		return fmt.Errorf("%s: %w", section, err)
+	}
+
+	return fmt.Errorf("%s: %w; matched first %d of %d marker lines at line %d", section, err, partial.Matched, len(markers), partial.Line+1)
+}
+
+// buildPositions extracts bed temperature and G-code coordinates for the given marker lines
+func (p *StreamingProcessor) buildPositions(filePath string, initFirst, initLast, printFirst, printLast int64) (*MarkerPositions, error) {
+	positions := &MarkerPositions{
+		EndInitSectionFirstLine:  initFirst,
+		EndInitSectionLastLine:   initLast,
+		EndPrintSectionFirstLine: printFirst,
+		EndPrintSectionLastLine:  printLast,
+	}
+
+	printFound, err := p.scanPositions(filePath, positions)
+	if err != nil {
+		return nil, err
+	}
+
+	// unit tests don't contain entire G-code, so we don't check for first print found
+	if !printFound && !strings.Contains(p.config.Printer, "unit-tests") {
+		return nil, fmt.Errorf("no print commands found after end of init section at line %d", initLast)
+	}
+
+	return positions, nil
+}
+
+// Temperature commands read by scanPositions
+var (
+	initBedTempRegex = regexp.MustCompile(`^M190\s*S(\d+)`)    // Bed temperature the init section waits for
+	hotendTempRegex  = regexp.MustCompile(`^M10[49]\s*S(\d+)`) // Hotend target, M104 or M109
+	bedTempRegex     = regexp.MustCompile(`^M1[49]0\s*S(\d+)`) // Bed target, M140 or M190
+)
+
+// scanPositions fills the values of positions that depend on the file content in a single pass, the
+// marker lines of positions must be set:
+//   - BedTemp, UnitsInches: the last M190 S and G20/G21 of the init section
+//   - LastHotendTemp, LastBedTemp, RelativeExtrusion: the last M104/M109, M140/M190 and M82/M83 before
+//     the end marker
+//   - BodyExtrusionLength, BodyMoves, BodyDwellSeconds, FirstLayerLastLine: from the body moves
+//   - BodyOffset, EndPrintSectionOffset, FooterOffset: byte offsets for seeking to the looped regions
+//   - TotalLines: the lines of the whole file
+//   - print coordinates and ModelBBox: from the print moves of the whole file
+//
+// It reports whether a print command follows the init section.
+func (p *StreamingProcessor) scanPositions(filePath string, positions *MarkerPositions) (bool, error) { //nolint:gocognit
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file for position scan: %w", err)
+	}
+	defer file.Close()
+
+	initLast, printFirst := positions.EndInitSectionLastLine, positions.EndPrintSectionFirstLine
+
+	var (
+		extrusion extrusionTracker // Extrusion of the G0/G1 moves, shared by the trackers below
+		layer     = firstLayerTracker{raisedAt: -1}
+		coords    = coordinateTracker{
+			// Off by default: templates move in the frame the file ends in, converted coordinates are opt-in
+			applyG92:      p.boolParameter("ApplyG92Offsets", false),
+			normalizeToMM: p.boolParameter("NormalizeToMM", false),
+			commentPrefix: p.commentPrefix,
+			initLast:      initLast,
+		}
+	)
+
+	// Byte offsets let the streaming passes seek to the looped regions instead of re-scanning
+	offsetLines := []int64{initLast + 1, printFirst, positions.EndPrintSectionLastLine + 1}
+	offsets := []*int64{&positions.BodyOffset, &positions.EndPrintSectionOffset, &positions.FooterOffset}
+	nextOffset := 0
+
+	// Count the bytes of the lines including their line endings, which the scanner strips
+	var consumed, lineStart int64
+
+	scanner := bufio.NewScanner(file)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		consumed += int64(advance)
+
+		return advance, token, err
+	})
+
+	lineNum := int64(0)
+
+	for scanner.Scan() {
+		for nextOffset < len(offsets) && offsetLines[nextOffset] <= lineNum {
+			*offsets[nextOffset] = lineStart
+			nextOffset++
+		}
+
+		trimmed := strings.TrimSpace(scanner.Text())
+
+		// Every line is parsed once, the trackers share its move and whether it extrudes
+		move := parseMoveLine(trimmed, p.commentPrefix)
+
+		if relative, ok := extrusionCommand(trimmed, p.commentPrefix); ok {
+			extrusion.absolute = !relative
+
+			if lineNum < printFirst {
+				positions.RelativeExtrusion = relative
+			}
+		}
+
+		if isG92(trimmed) {
+			extrusion.reset(parseCoordinateWords(trimmed))
+		}
+
+		// Filament the body extrudes, e.g. to size the purge before the next iteration. In absolute
+		// mode (M82) a move contributes the growth of E, in relative mode (M83) its positive E.
+		extruding := false
+
+		if move != nil && move.E != nil {
+			delta := *move.E
+			if extrusion.absolute {
+				delta -= extrusion.lastE
+			}
+
+			extruding = extrusion.extrudes(move.E)
+
+			if extruding && lineNum > initLast && lineNum < printFirst {
+				positions.BodyExtrusionLength += delta
+			}
+		}
+
+		if lineNum <= initLast {
+			if match := initBedTempRegex.FindStringSubmatch(trimmed); match != nil {
+				temp, err := strconv.ParseInt(match[1], 10, 64)
+				if err == nil {
+					positions.BedTemp = temp
+				}
+			}
+
+			if units, ok := unitsCommand(trimmed, p.commentPrefix); ok {
+				positions.UnitsInches = units
+			}
+		}
+
+		if lineNum < printFirst {
+			if match := hotendTempRegex.FindStringSubmatch(trimmed); match != nil {
+				temp, err := strconv.ParseInt(match[1], 10, 64)
+				if err == nil {
+					positions.LastHotendTemp = temp
+				}
+			} else if match := bedTempRegex.FindStringSubmatch(trimmed); match != nil {
+				temp, err := strconv.ParseInt(match[1], 10, 64)
+				if err == nil {
+					positions.LastBedTemp = temp
+				}
+			}
+
+			layer.line(lineNum, trimmed, move, extruding && lineNum > initLast)
+
+			if lineNum > initLast {
+				// Moves and dwells of the body for EstimateLoopTime
+				if move != nil {
+					positions.BodyMoves++
+				}
+
+				positions.BodyDwellSeconds += dwellSeconds(trimmed)
+			}
+		}
+
+		coords.line(lineNum, trimmed, move, extruding)
+
+		lineStart = consumed
+		lineNum++
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return false, fmt.Errorf("failed to scan file for positions: %w", err)
+	}
+
+	// Lines past the end of the file start at its end
+	for ; nextOffset < len(offsets); nextOffset++ {
+		*offsets[nextOffset] = consumed
+	}
+
+	positions.TotalLines = lineNum
+
+	// Boundary of the first layer for Parameters.LoopScope first_layer
+	positions.FirstLayerLastLine = printFirst - 1
+	if layer.found {
+		positions.FirstLayerLastLine = layer.lastLine
+	}
+
+	coords.fill(positions)
+
+	return coords.firstPrintFound, nil
+}
+
+// layerChangeComment matches the comments slicers put before each layer: Cura ";LAYER:1",
+// PrusaSlicer ";LAYER_CHANGE", OrcaSlicer and Bambu Studio "; CHANGE_LAYER"
+var layerChangeComment = regexp.MustCompile(`^;\s*(LAYER:\s*-?\d+|LAYER_CHANGE|CHANGE_LAYER)\b`)
+
+// firstLayerTracker finds the last body line of the first layer. The second layer starts at the first
+// layer change comment after the body printed something, or without comments at the Z move up from the
+// first layer Z that the next print command is made at. Z hops that come back down before printing do
+// not count.
+type firstLayerTracker struct {
+	currentZ, firstZ float64
+	printed          bool
+	raisedAt         int64 // Line of a pending Z move above the first layer, -1 without one
+	found            bool  // The second layer started, lastLine is set
+	lastLine         int64
+}
+
+// line follows a trimmed line before the end marker, move being its G0/G1 coordinates and printing
+// whether it pushes filament in the body
+func (t *firstLayerTracker) line(lineNum int64, trimmed string, move *GCodeCoordinates, printing bool) {
+	if t.found {
+		return
+	}
+
+	if t.printed && layerChangeComment.MatchString(trimmed) {
+		t.found, t.lastLine = true, lineNum-1
+		return
+	}
+
+	if move == nil {
+		return
+	}
+
+	if move.Z != nil {
+		t.currentZ = *move.Z
+
+		switch {
+		case !t.printed:
+		case t.currentZ <= t.firstZ:
+			t.raisedAt = -1
+		case t.raisedAt < 0:
+			t.raisedAt = lineNum
+		}
+	}
+
+	if printing && (move.X != nil || move.Y != nil) {
+		if t.raisedAt >= 0 {
+			t.found, t.lastLine = true, t.raisedAt-1
+			return
+		}
+
+		if !t.printed {
+			t.printed = true
+			t.firstZ = t.currentZ
+		}
+	}
+}
+
+// coordinateTracker follows the print commands of a file for the first, last, average, min and max
+// print coordinates
+type coordinateTracker struct {
+	applyG92, normalizeToMM bool   // Parameters.ApplyG92Offsets and Parameters.NormalizeToMM
+	commentPrefix           string // Start of comments, which hold no commands
+	initLast                int64  // Last line of the init section, the first print follows it
+
+	firstPrintX, firstPrintY, firstPrintZ *float64
+	lastPrintX, lastPrintY, lastPrintZ    *float64
+	currentZ                              *float64
+	firstPrintFound                       bool
+	sumX, sumY                            float64
+	countX, countY                        int
+	minX, minY, maxX, maxY                *float64
+	frame                                 g92Frame
+	inches                                bool
+}
+
+// line follows a trimmed line of the file, coords being its G0/G1 coordinates or nil and extruding
+// whether the move extrudes filament
+func (t *coordinateTracker) line(lineNum int64, trimmed string, coords *GCodeCoordinates, extruding bool) { //nolint:gocognit,gocyclo
+	if units, ok := unitsCommand(trimmed, t.commentPrefix); ok {
+		t.inches = units
+	}
+
+	scale := 1.0
+	if t.normalizeToMM && t.inches {
+		scale = mmPerInch
+	}
+
+	// Keep coordinates in one frame when G92 redefines the origin
+	if t.applyG92 && isG92(trimmed) {
+		t.frame.reset(scaleCoordinates(parseCoordinateWords(trimmed), scale))
+	}
+
+	coords = scaleCoordinates(coords, scale)
+	if coords == nil {
+		return
+	}
+
+	if t.applyG92 {
+		t.frame.apply(coords)
+	}
+
+	// Update current Z from any G1 command
+	if coords.Z != nil {
+		t.currentZ = coords.Z
+	}
+
+	// Only print commands (moves that extrude filament) count
+	if !extruding || (coords.X == nil && coords.Y == nil) {
+		return
+	}
+
+	// Track first print coordinates after init section
+	if !t.firstPrintFound && lineNum > t.initLast {
+		if coords.X != nil {
+			t.firstPrintX = coords.X
+		}
+
+		if coords.Y != nil {
+			t.firstPrintY = coords.Y
+		}
+
+		// Remember the Z that was active during this first print command
+		if t.currentZ != nil {
+			t.firstPrintZ = t.currentZ
+		}
+
+		t.firstPrintFound = true
+	}
+
+	// Always update last print coordinates
+	if coords.X != nil {
+		t.lastPrintX = coords.X
+	}
+
+	if coords.Y != nil {
+		t.lastPrintY = coords.Y
+	}
+
+	// Remember the Z that was active during this print command
+	if t.currentZ != nil {
+		t.lastPrintZ = t.currentZ
+	}
+
+	if coords.X != nil {
+		t.sumX += *coords.X
+		t.countX++
+
+		if t.minX == nil || *coords.X < *t.minX {
+			t.minX = coords.X
+		}
+
+		if t.maxX == nil || *coords.X > *t.maxX {
+			t.maxX = coords.X
+		}
+	}
+
+	if coords.Y != nil {
+		t.sumY += *coords.Y
+		t.countY++
+
+		if t.minY == nil || *coords.Y < *t.minY {
+			t.minY = coords.Y
+		}
+
+		if t.maxY == nil || *coords.Y > *t.maxY {
+			t.maxY = coords.Y
+		}
+	}
+}
+
+// fill sets the print coordinates of positions, 0 for those not found
+func (t *coordinateTracker) fill(positions *MarkerPositions) {
+	value := func(v *float64) float64 {
+		if v == nil {
+			return 0
+		}
+
+		return *v
+	}
+
+	positions.FirstPrintX = value(t.firstPrintX)
+	positions.FirstPrintY = value(t.firstPrintY)
+	positions.FirstPrintZ = value(t.firstPrintZ)
+	positions.LastPrintX = value(t.lastPrintX)
+	positions.LastPrintY = value(t.lastPrintY)
+	positions.LastPrintZ = value(t.lastPrintZ)
+
+	if t.countX > 0 {
+		positions.AveragePrintX = t.sumX / float64(t.countX)
+	}
+
+	if t.countY > 0 {
+		positions.AveragePrintY = t.sumY / float64(t.countY)
+	}
+
+	positions.MinPrintX = value(t.minX)
+	positions.MinPrintY = value(t.minY)
+	positions.MaxPrintX = value(t.maxX)
+	positions.MaxPrintY = value(t.maxY)
+	positions.ModelBBox = BoundingBox{MinX: positions.MinPrintX, MinY: positions.MinPrintY, MaxX: positions.MaxPrintX, MaxY: positions.MaxPrintY}
+}
+
+// parseGCodeLine parses a G-code line and extracts coordinates
+func (p *StreamingProcessor) parseGCodeLine(line string) *GCodeCoordinates {
+	// Trim and check if it's a G1 command
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "G1") {
+		return nil
+	}
+
+	return parseCoordinateWords(trimmed)
+}
+
+// Regular expressions for the words of parseCoordinateWords, compiled once as it runs for every line
+var (
+	xRegex = regexp.MustCompile(`X([-+]?\d*\.?\d+)`)
+	yRegex = regexp.MustCompile(`Y([-+]?\d*\.?\d+)`)
+	zRegex = regexp.MustCompile(`Z([-+]?\d*\.?\d+)`)
+	eRegex = regexp.MustCompile(`E([-+]?\d*\.?\d+)`)
+	fRegex = regexp.MustCompile(`F(\d*\.?\d+)`)
+)
+
+// parseCoordinateWords extracts the X, Y, Z, E and F words of a trimmed G-code line
+func parseCoordinateWords(trimmed string) *GCodeCoordinates {
+	coords := &GCodeCoordinates{}
+
+	// Extract X coordinate
+	if match := xRegex.FindStringSubmatch(trimmed); match != nil {
+		val, err := strconv.ParseFloat(match[1], 64)
+		if err == nil {
+			coords.X = &val
+		}
+	}
+
+	// Extract Y coordinate
+	if match := yRegex.FindStringSubmatch(trimmed); match != nil {
+		val, err := strconv.ParseFloat(match[1], 64)
+		if err == nil {
+			coords.Y = &val
+		}
+	}
+
+	// Extract Z coordinate
+	if match := zRegex.FindStringSubmatch(trimmed); match != nil {
+		val, err := strconv.ParseFloat(match[1], 64)
+		if err == nil {
+			coords.Z = &val
+		}
+	}
+
+	// Extract E coordinate
+	if match := eRegex.FindStringSubmatch(trimmed); match != nil {
+		val, err := strconv.ParseFloat(match[1], 64)
+		if err == nil {
+			coords.E = &val
+		}
+	}
+
+	// Extract feedrate
+	if match := fRegex.FindStringSubmatch(trimmed); match != nil {
+		val, err := strconv.ParseFloat(match[1], 64)
+		if err == nil {
+			coords.F = &val
+		}
+	}
+
+	// Return coordinates if we found any
+	if coords.X != nil || coords.Y != nil || coords.Z != nil || coords.E != nil || coords.F != nil {
+		return coords
+	}
+
+	return nil
+}
+
+// g92Frame converts coordinates to the frame in effect before the first G92 so positions recorded
+// across a G92 X/Y/Z reset stay comparable. Offsets are added to the G-code coordinates.
+type g92Frame struct {
+	offsetX, offsetY, offsetZ float64
+	lastX, lastY, lastZ       *float64
+}
+
+// isG92 reports whether the line sets the current position
+func isG92(line string) bool {
+	fields := strings.Fields(line)
+	return len(fields) > 0 && fields[0] == "G92"
+}
+
+// reset updates the offsets for the coordinates of a G92 line. Axes without a known previous position
+// keep their offset.
+func (f *g92Frame) reset(coords *GCodeCoordinates) {
+	if coords == nil {
+		return
+	}
+
+	resetAxis := func(value, last, offset *float64) {
+		if value != nil && last != nil {
+			*offset = *last - *value
+		}
+	}
+
+	resetAxis(coords.X, f.lastX, &f.offsetX)
+	resetAxis(coords.Y, f.lastY, &f.offsetY)
+	resetAxis(coords.Z, f.lastZ, &f.offsetZ)
+}
+
+// apply replaces the X, Y and Z of coords with their values in the original frame
+func (f *g92Frame) apply(coords *GCodeCoordinates) {
+	applyAxis := func(value, last **float64, offset float64) {
+		if *value == nil {
+			return
+		}
+
+		converted := **value + offset
+		*value = &converted
+		*last = &converted
+	}
+
+	applyAxis(&coords.X, &f.lastX, f.offsetX)
+	applyAxis(&coords.Y, &f.lastY, f.offsetY)
+	applyAxis(&coords.Z, &f.lastZ, f.offsetZ)
+}
+
+// extrusionTracker detects extruding moves. In absolute mode (M82) a move extrudes when E grows past the
+// previous value, otherwise any positive E counts as extrusion.
+type extrusionTracker struct {
+	absolute bool
+	lastE    float64
+}
+
+// extrudes reports whether a move to e extrudes filament and records e as the current position
+func (t *extrusionTracker) extrudes(e *float64) bool {
+	if e == nil {
+		return false
+	}
+
+	if !t.absolute {
+		return *e > 0
+	}
+
+	extruding := *e > t.lastE
+	t.lastE = *e
+
+	return extruding
+}
+
+// reset applies the E word of a G92 line to the current extruder position
+func (t *extrusionTracker) reset(coords *GCodeCoordinates) {
+	if coords != nil && coords.E != nil {
+		t.lastE = *coords.E
+	}
+}
+
+// extrusionCommand reports whether the line selects relative (M83) or absolute (M82) extrusion
+func extrusionCommand(line, commentPrefix string) (bool, bool) {
+	fields := strings.Fields(stripComment(line, commentPrefix))
+	if len(fields) == 0 {
+		return false, false
+	}
+
+	switch fields[0] {
+	case "M83":
+		return true, true
+	case "M82":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// streamHeader streams lines 0 to EndInitSectionLastLine. With Parameters.StampHeader a line recording
+// the processing is inserted after the leading comment block written by the slicer.
+func (p *StreamingProcessor) streamHeader(filePath string, writer *bufio.Writer, iterations int64) error {
+	if !p.boolParameter("StampHeader", false) {
+		return p.streamLinesRange(filePath, writer, 0, p.positions.EndInitSectionLastLine, true)
+	}
+
+	commentLines, err := countLeadingComments(filePath, p.commentPrefix)
+	if err != nil {
+		return err
+	}
+
+	stampLine := min(commentLines, p.positions.EndInitSectionLastLine+1)
+
+	err = p.streamLinesRange(filePath, writer, 0, stampLine-1, true)
+	if err != nil {
+		return err
+	}
+
+	err = p.writeLine(writer, p.comment(fmt.Sprintf("processed by printloop: %d iterations, printer %s, %s",
+		iterations, p.printerDef.Name, time.Now().UTC().Format(time.RFC3339))))
+	if err != nil {
+		return err
+	}
+
+	return p.streamLinesRange(filePath, writer, stampLine, p.positions.EndInitSectionLastLine, true)
+}
+
+// formatWaitCommand replaces {minutes} and {seconds} in format. No command is produced for a wait of
+// zero minutes.
+func formatWaitCommand(format string, minutes int64) string {
+	if minutes <= 0 {
+		return ""
+	}
+
+	return strings.NewReplacer(
+		"{minutes}", strconv.FormatInt(minutes, 10),
+		"{seconds}", strconv.FormatInt(minutes*60, 10),
+	).Replace(format)
+}
+
+// formatBedCooldownCommand replaces {temp} in format. No command is produced for a temperature of zero.
+func formatBedCooldownCommand(format string, temp int64) string {
+	if temp <= 0 {
+		return ""
+	}
+
+	return strings.ReplaceAll(format, "{temp}", strconv.FormatInt(temp, 10))
+}
+
+// startMessage formats Parameters.StartMessage, replacing {iterations} and {printer}. Characters the
+// firmware could misread (anything but printable ASCII, and the comment prefix) are dropped and the
+// result is cut to Parameters.StartMessageMaxLength. An empty result disables the M117.
+func (p *StreamingProcessor) startMessage(iterations int64) string {
+	format := p.stringParameter("StartMessage", "")
+	if format == "" {
+		return ""
+	}
+
+	message := strings.NewReplacer(
+		"{iterations}", strconv.FormatInt(iterations, 10),
+		"{printer}", p.printerDef.Name,
+	).Replace(format)
+
+	message = strings.ReplaceAll(message, p.commentPrefix, "")
+	message = strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return -1
+		}
+
+		return r
+	}, message)
+
+	maxLength := int(p.floatParameter("StartMessageMaxLength", 20))
+	if maxLength > 0 && len(message) > maxLength {
+		message = message[:maxLength]
+	}
+
+	return strings.TrimSpace(message)
+}
+
+// comment formats text as a comment in Request.CommentStyle, falling back to the printer's comment prefix
+func (p *StreamingProcessor) comment(text string) string {
+	switch p.config.CommentStyle {
+	case "parentheses":
+		// Parenthesized comments can't nest
+		return "(" + strings.NewReplacer("(", "[", ")", "]").Replace(text) + ")"
+	case "semicolon":
+		return "; " + text
+	default:
+		return p.commentPrefix + " " + text
+	}
+}
+
+// ErrAlreadyLooped is returned for inputs that look like printloop output. ProcessingRequest.Force
+// skips the check.
+var ErrAlreadyLooped = errors.New("file appears to already be looped")
+
+// loopedSignature matches the lines printloop writes itself: the header stamp, iteration comments and
+// the body hash
+var loopedSignature = regexp.MustCompile(`processed by printloop|printloop iteration \d+/\d+|printloop body sha256`)
+
+// validateNotLooped rejects inputs that carry a line written by printloop, or whose body repeats right
+// before a second end marker the way iterations do
+func (p *StreamingProcessor) validateNotLooped(filePath string) error {
+	if p.config.Force {
+		return nil
+	}
+
+	signatureLine, err := findLoopedSignature(filePath)
+	if err != nil {
+		return err
+	}
+
+	if signatureLine >= 0 {
+		return fmt.Errorf("%w: line %d was written by printloop, upload the original file or set force", ErrAlreadyLooped, signatureLine+1)
+	}
+
+	// A body given by line numbers isn't bounded by the end markers bodyRepeats compares, and the
+	// regions of a multi-region file may legitimately repeat each other, only the stamp tells those apart
+	if p.hasBodyRange() || p.boolParameter("MultiRegion", false) {
+		return nil
+	}
+
+	repeated, err := p.bodyRepeats(filePath)
+	if err != nil {
+		return err
+	}
+
+	if repeated {
+		return fmt.Errorf("%w: the body is repeated before a second end marker, upload the original file or set force", ErrAlreadyLooped)
+	}
+
+	return nil
+}
+
+// findLoopedSignature returns the first line matching loopedSignature, or -1
+func findLoopedSignature(filePath string) (int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := int64(0)
+
+	for scanner.Scan() {
+		if loopedSignature.MatchString(scanner.Text()) {
+			return lineNum, nil
+		}
+
+		lineNum++
+	}
+
+	return -1, scanner.Err()
+}
+
+// bodyRepeats reports whether the lines between the start marker and the first end marker appear
+// again directly before the next end marker with other lines in between, as in a file looped without
+// stamps
+func (p *StreamingProcessor) bodyRepeats(filePath string) (bool, error) {
+	finder := &strategy.AfterFirstAppearStrategy{Mode: p.matchMode(), CommentPrefix: p.commentPrefix}
+	markers := p.printerDef.Markers.EndPrintSection
+	bodyStart := p.positions.EndInitSectionLastLine + 1
+
+	firstBegin, firstEnd, err := finder.FindPrintSectionPosition(p.ctx, filePath, markers, p.positions.EndInitSectionLastLine)
+	if err != nil {
+		return false, p.ctx.Err()
+	}
+
+	secondBegin, _, err := finder.FindPrintSectionPosition(p.ctx, filePath, markers, firstEnd)
+	if err != nil {
+		return false, p.ctx.Err()
+	}
+
+	// Iterations are separated by the generated code, a body directly after the end marker is not a copy
+	bodyLines := firstBegin - bodyStart
+	if bodyLines <= 0 || secondBegin-bodyLines <= firstEnd+1 {
+		return false, nil
+	}
+
+	firstHash, err := hashLinesRange(filePath, bodyStart, firstBegin-1)
+	if err != nil {
+		return false, err
+	}
+
+	secondHash, err := hashLinesRange(filePath, secondBegin-bodyLines, secondBegin-1)
+	if err != nil {
+		return false, err
+	}
+
+	return firstHash == secondHash, nil
+}
+
+// countLeadingComments returns the number of comment lines at the start of the file
+func countLeadingComments(filePath, commentPrefix string) (int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var count int64
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if !strings.HasPrefix(strings.TrimSpace(scanner.Text()), commentPrefix) {
+			break
+		}
+
+		count++
+	}
+
+	return count, scanner.Err()
+}
+
+// openAtLine opens filePath for scanning from startLine. Lines whose byte offset findMarkerPositions
+// recorded for the current region are reached with a seek, others by skipping the lines before them.
+func (p *StreamingProcessor) openAtLine(filePath string, startLine int64) (*os.File, *bufio.Scanner, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	offset := p.lineOffset(startLine)
+	if offset > 0 {
+		_, err = file.Seek(offset, io.SeekStart)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+
+		return file, bufio.NewScanner(file), nil
+	}
+
+	scanner := bufio.NewScanner(file)
+	lineNum := int64(0)
+
+	// Skip to start position
+	for lineNum < startLine && scanner.Scan() {
+		lineNum++
+	}
+
+	return file, scanner, nil
+}
+
+// lineOffset returns the recorded byte offset of line in the current region, or 0 when it is unknown
+func (p *StreamingProcessor) lineOffset(line int64) int64 {
+	switch line {
+	case p.positions.EndInitSectionLastLine + 1:
+		return p.positions.BodyOffset
+	case p.positions.EndPrintSectionFirstLine:
+		return p.positions.EndPrintSectionOffset
+	case p.positions.EndPrintSectionLastLine + 1:
+		return p.positions.FooterOffset
+	}
+
+	return 0
+}
+
+// streamLinesRange streams lines from startLine to endLine (inclusive) with marker splitting
+func (p *StreamingProcessor) streamLinesRange(filePath string, writer *bufio.Writer, startLine, endLine int64, processMarkerSplit bool) error {
+	file, scanner, err := p.openAtLine(filePath, startLine)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	lineNum := startLine
+
+	// Stream the range
+	for lineNum <= endLine && scanner.Scan() {
+		line := scanner.Text()
+
+		if processMarkerSplit {
+			splitLines := p.processLineWithMarkerSplit(line, p.initMarkers)
+			for _, splitLine := range splitLines {
+				err = p.writeLine(writer, splitLine)
+				if err != nil {
+					return err
+				}
+			}
+		} else {
+			err = p.writeLine(writer, line)
+			if err != nil {
+				return err
+			}
+		}
+
+		lineNum++
+	}
+
+	return scanner.Err()
+}
+
+// thumbnailBlocks lists the first and last line patterns of embedded preview images
+var thumbnailBlocks = []struct {
+	begin, end *regexp.Regexp
+}{
+	// Bambu Studio wraps the PNG thumbnails in "; THUMBNAIL_BLOCK_START" ... "; THUMBNAIL_BLOCK_END"
+	{regexp.MustCompile(`^;\s*THUMBNAIL_BLOCK_START$`), regexp.MustCompile(`^;\s*THUMBNAIL_BLOCK_END$`)},
+	// PrusaSlicer, OrcaSlicer: "; thumbnail begin 300x300 12345" ... "; thumbnail end", also thumbnail_JPG/_QOI
+	{regexp.MustCompile(`^;\s*thumbnail(_\w+)?\s+begin\b`), regexp.MustCompile(`^;\s*thumbnail(_\w+)?\s+end$`)},
+}
+
+// thumbnailBlockEnd returns the end pattern of the thumbnail block started by line, or nil
+func thumbnailBlockEnd(line string) *regexp.Regexp {
+	trimmed := strings.TrimSpace(line)
+	for _, block := range thumbnailBlocks {
+		if block.begin.MatchString(trimmed) {
+			return block.end
+		}
+	}
+
+	return nil
+}
+
+// streamLinesRangeWithoutThumbnails is streamLinesRange without marker splitting, dropping thumbnail
+// blocks that start in the range
+func (p *StreamingProcessor) streamLinesRangeWithoutThumbnails(filePath string, writer *bufio.Writer, startLine, endLine int64) error {
+	file, scanner, err := p.openAtLine(filePath, startLine)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	lineNum := startLine
+
+	var blockEnd *regexp.Regexp
+
+	for lineNum <= endLine && scanner.Scan() {
+		line := scanner.Text()
+		lineNum++
+
+		if blockEnd != nil {
+			if blockEnd.MatchString(strings.TrimSpace(line)) {
+				blockEnd = nil
+			}
+
+			continue
+		}
+
+		blockEnd = thumbnailBlockEnd(line)
+		if blockEnd != nil {
+			continue
+		}
+
+		err = p.writeLine(writer, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// slicerConfigBlocks lists the first and last line patterns of slicer settings blocks
+var slicerConfigBlocks = []struct {
+	begin, end *regexp.Regexp
+}{
+	// PrusaSlicer, SuperSlicer: "; prusaslicer_config = begin" ... "; prusaslicer_config = end"
+	{regexp.MustCompile(`^;\s*\w+_config\s*=\s*begin$`), regexp.MustCompile(`^;\s*\w+_config\s*=\s*end$`)},
+	// OrcaSlicer, Bambu Studio
+	{regexp.MustCompile(`^;\s*CONFIG_BLOCK_START$`), regexp.MustCompile(`^;\s*CONFIG_BLOCK_END$`)},
+}
+
+// slicerConfigBlockEnd returns the end pattern of the slicer settings block started by line, or nil
+func slicerConfigBlockEnd(line string) *regexp.Regexp {
+	trimmed := strings.TrimSpace(line)
+	for _, block := range slicerConfigBlocks {
+		if block.begin.MatchString(trimmed) {
+			return block.end
+		}
+	}
+
+	return nil
+}
+
+// streamLinesFromPosition streams all lines from the given position to EOF
+func (p *StreamingProcessor) streamLinesFromPosition(filePath string, writer *bufio.Writer, startLine int64) error {
+	file, scanner, err := p.openAtLine(filePath, startLine)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Stream from position to EOF, skipping slicer settings blocks when requested
+	var blockEnd *regexp.Regexp
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if blockEnd != nil {
+			if blockEnd.MatchString(strings.TrimSpace(line)) {
+				blockEnd = nil
+			}
+
+			continue
+		}
+
+		if p.config.StripSlicerConfig {
+			blockEnd = slicerConfigBlockEnd(line)
+			if blockEnd != nil {
+				continue
+			}
+		}
+
+		err = p.writeLine(writer, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// streamGeneratedContent writes generated content for an iteration using template
+func (p *StreamingProcessor) streamGeneratedContent(writer *bufio.Writer, iteration int64) error {
+	// Physical order is kept, only the number seen by the template is reversed
+	number := iteration
+	if p.config.ReverseIterationNumbering {
+		number = p.config.Iterations - iteration + 1
+	}
 
-	if minX != nil {
-		mnX = *minX
+	for _, line := range p.injectedLines() {
+		err := p.writeLine(writer, line)
+		if err != nil {
+			return err
+		}
 	}
 
-	if minY != nil {
-		mnY = *minY
+	output, err := p.executeTemplate(iteration, number)
+	if err != nil {
+		return err
 	}
 
-	if maxX != nil {
-		mxX = *maxX
+	if strings.TrimSpace(output) != "" {
+		p.generated = true
 	}
 
-	if maxY != nil {
-		mxY = *maxY
+	p.lintGenerated(number, output)
+
+	// Write generated content
+	for _, line := range generatedLines(output) {
+		err = p.writeLine(writer, line)
+		if err != nil {
+			return err
+		}
 	}
 
-	return fx, fy, fz, lx, ly, lz, avgX, avgY, mnX, mnY, mxX, mxY, nil
+	return nil
 }
 
-// parseGCodeLine parses a G-code line and extracts coordinates
-func (p *StreamingProcessor) parseGCodeLine(line string) *GCodeCoordinates {
-	// Trim and check if it's a G1 command
-	trimmed := strings.TrimSpace(line)
-	if !strings.HasPrefix(trimmed, "G1") {
-		return nil
+// injectedLines returns the bed cooldown and wait commands written before the generated content of
+// every iteration when the template doesn't place them itself
+func (p *StreamingProcessor) injectedLines() []string {
+	var lines []string
+
+	// Let the bed cool down so the print releases, unless the template handles the cooldown itself
+	if p.config.WaitBedCooldownTemp > 0 && !p.templateMentions("WaitBedCooldownTemp") {
+		lines = append(lines, formatBedCooldownCommand(p.stringParameter("BedCooldownCommand", defaultBedCooldownCommand), p.config.WaitBedCooldownTemp))
 	}
 
-	// Regular expressions for extracting coordinates
-	xRegex := regexp.MustCompile(`X([-+]?\d*\.?\d+)`)
-	yRegex := regexp.MustCompile(`Y([-+]?\d*\.?\d+)`)
-	zRegex := regexp.MustCompile(`Z([-+]?\d*\.?\d+)`)
-	eRegex := regexp.MustCompile(`E([-+]?\d*\.?\d+)`)
+	// Dwell before the generated moves unless the template places the wait itself
+	if p.config.WaitMin > 0 && !p.templateMentions("WaitMin") {
+		lines = append(lines, formatWaitCommand(p.stringParameter("WaitCommand", defaultWaitCommand), p.config.WaitMin))
+	}
 
-	coords := &GCodeCoordinates{}
+	return lines
+}
 
-	// Extract X coordinate
-	if match := xRegex.FindStringSubmatch(trimmed); match != nil {
-		val, err := strconv.ParseFloat(match[1], 64)
-		if err == nil {
-			coords.X = &val
-		}
+// generatedLines splits template output into the lines written, dropping empty lines unless the output
+// is a single line
+func generatedLines(output string) []string {
+	lines := strings.Split(output, "\n")
+	if len(lines) == 1 {
+		return lines
 	}
 
-	// Extract Y coordinate
-	if match := yRegex.FindStringSubmatch(trimmed); match != nil {
-		val, err := strconv.ParseFloat(match[1], 64)
-		if err == nil {
-			coords.Y = &val
+	nonEmpty := lines[:0]
+
+	for _, line := range lines {
+		if line != "" {
+			nonEmpty = append(nonEmpty, line)
 		}
 	}
 
-	// Extract Z coordinate
-	if match := zRegex.FindStringSubmatch(trimmed); match != nil {
-		val, err := strconv.ParseFloat(match[1], 64)
-		if err == nil {
-			coords.Z = &val
-		}
+	return nonEmpty
+}
+
+// executeTemplate renders the template for the 1-based iteration, shown to the template as number
+func (p *StreamingProcessor) executeTemplate(iteration, number int64) (string, error) {
+	output, err := p.executeLimited(p.template, p.templateData(iteration, number))
+	if err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
 	}
 
-	// Extract E coordinate
-	if match := eRegex.FindStringSubmatch(trimmed); match != nil {
-		val, err := strconv.ParseFloat(match[1], 64)
-		if err == nil {
-			coords.E = &val
+	return output, nil
+}
+
+// executeLimited renders tmpl within maxTemplateLoopSteps, templateTimeout and maxTemplateOutput.
+// Templates can loop, a custom one must not hang processing.
+func (p *StreamingProcessor) executeLimited(tmpl *template.Template, data any) (string, error) {
+	// Each execution counts its own loop steps
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+
+	tmpl.Funcs(loopStepCounter())
+
+	abandoned := make(chan struct{})
+	output := &cappedWriter{abandoned: abandoned}
+	result := make(chan error, 1)
+
+	go func() {
+		result <- tmpl.Execute(output, data)
+	}()
+
+	timer := time.NewTimer(templateTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			return "", err
 		}
+
+		return output.String(), nil
+	case <-timer.C:
+		// The execution stops at its next write
+		close(abandoned)
+		return "", fmt.Errorf("template execution exceeded %v", templateTimeout)
+	case <-p.ctx.Done():
+		close(abandoned)
+		return "", p.ctx.Err()
 	}
+}
 
-	// Return coordinates if we found any
-	if coords.X != nil || coords.Y != nil || coords.Z != nil || coords.E != nil {
-		return coords
+// Limits of a single template execution
+const maxTemplateOutput = 1 << 20 // Bytes of generated content of one iteration
+
+var templateTimeout = 5 * time.Second
+
+var (
+	errTemplateOutputTooLarge = fmt.Errorf("template output exceeds %d bytes", maxTemplateOutput)
+	errTemplateAbandoned      = errors.New("template execution abandoned")
+)
+
+// cappedWriter collects template output and fails writes beyond maxTemplateOutput bytes or after the
+// execution was abandoned
+type cappedWriter struct {
+	output    strings.Builder
+	abandoned <-chan struct{}
+}
+
+func (w *cappedWriter) Write(b []byte) (int, error) {
+	select {
+	case <-w.abandoned:
+		return 0, errTemplateAbandoned
+	default:
+	}
+
+	if w.output.Len()+len(b) > maxTemplateOutput {
+		return 0, errTemplateOutputTooLarge
+	}
+
+	return w.output.Write(b)
+}
+
+func (w *cappedWriter) String() string {
+	return w.output.String()
+}
+
+// checkTemplateParameters renders the first iteration once with missing map keys reported as errors,
+// so a template referencing an undefined parameter fails instead of writing "<no value>" into the G-code.
+// Other errors depend on the input file and are left to processing.
+func (p *StreamingProcessor) checkTemplateParameters() error {
+	tmpl, err := p.template.Clone()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.executeLimited(tmpl.Option("missingkey=error"), p.templateData(1, 1))
+	if err != nil && strings.Contains(err.Error(), "map has no entry for key") {
+		return fmt.Errorf("template references an undefined parameter: %w", err)
 	}
 
 	return nil
 }
 
-// streamLinesRange streams lines from startLine to endLine (inclusive) with marker splitting
-func (p *StreamingProcessor) streamLinesRange(filePath string, writer *bufio.Writer, startLine, endLine int64, processMarkerSplit bool) error {
+// templateData returns the data the template is rendered with for the 1-based iteration, shown to the
+// template as number
+func (p *StreamingProcessor) templateData(iteration, number int64) any {
+	offsetX, offsetY := p.iterationOffset(iteration)
+
+	return struct {
+		PrinterName     string
+		Iteration       int64
+		TotalIterations int64 // Iterations in the output, for "loop N of M" comments
+		Request         ProcessingRequest
+		Config          map[string]any
+		Bed             BedSize // Build volume from the printer definition, zero when not declared
+		Positions       MarkerPositions
+		IterationEta    time.Duration // Estimated duration of one iteration
+		TotalEta        time.Duration // Estimated duration of all iterations
+		RemainingEta    time.Duration // Estimated duration of the iterations after this one
+		// Shift of the body printed after this block, e.g. for SET_GCODE_OFFSET, to spread bed wear
+		IterationOffsetX float64
+		IterationOffsetY float64
+		IterationZ       float64 // Reference height of this iteration, see iterationZ
+	}{
+		PrinterName:      p.printerDef.Name,
+		Iteration:        number,
+		TotalIterations:  p.config.Iterations,
+		Request:          p.config,
+		Config:           p.printerDef.Parameters,
+		Bed:              p.printerDef.Bed,
+		Positions:        p.positions,
+		IterationEta:     p.iterationEta,
+		TotalEta:         p.iterationEta * time.Duration(p.config.Iterations),
+		RemainingEta:     p.iterationEta * time.Duration(p.config.Iterations-iteration),
+		IterationOffsetX: offsetX,
+		IterationOffsetY: offsetY,
+		IterationZ:       p.iterationZ(iteration),
+	}
+}
+
+// Values of Parameters.ZDirection
+const (
+	zDirectionUp   = "up"   // IterationZ rises by Parameters.ZStepPerIteration every iteration
+	zDirectionDown = "down" // IterationZ falls by Parameters.ZStepPerIteration every iteration, e.g. for downward test towers
+)
+
+// iterationZ returns Parameters.ZReference, or the last print Z without it, moved by
+// Parameters.ZStepPerIteration for every iteration after the first in Parameters.ZDirection. The
+// height never goes below Parameters.ZFloor.
+func (p *StreamingProcessor) iterationZ(iteration int64) float64 {
+	step := p.floatParameter("ZStepPerIteration", 0) * float64(iteration-1)
+	if p.stringParameter("ZDirection", zDirectionUp) == zDirectionDown {
+		step = -step
+	}
+
+	return max(p.floatParameter("ZReference", p.positions.LastPrintZ)+step, p.floatParameter("ZFloor", 0))
+}
+
+// iterationOffset returns Parameters.PerIterationOffsetX/Y times the 1-based iteration, the shift of
+// the body printed after the generated content of that iteration. With a declared bed size the shift
+// is limited so the model stays on the bed.
+func (p *StreamingProcessor) iterationOffset(iteration int64) (float64, float64) {
+	offsetX := p.floatParameter("PerIterationOffsetX", 0) * float64(iteration)
+	offsetY := p.floatParameter("PerIterationOffsetY", 0) * float64(iteration)
+
+	bbox := p.positions.ModelBBox
+
+	return limitOffset(offsetX, bbox.MinX, bbox.MaxX, p.printerDef.Bed.X), limitOffset(offsetY, bbox.MinY, bbox.MaxY, p.printerDef.Bed.Y)
+}
+
+// limitOffset limits offset so the model from lo to hi stays within 0..size, size 0 means unknown.
+// A model that doesn't fit the bed isn't shifted.
+func limitOffset(offset, lo, hi, size float64) float64 {
+	if size <= 0 || offset == 0 {
+		return offset
+	}
+
+	if hi-lo > size {
+		return 0
+	}
+
+	return max(-lo, min(offset, size-hi))
+}
+
+// writeLine writes a single output line terminated by the output line ending, numbering it when
+// line numbering is enabled
+func (p *StreamingProcessor) writeLine(writer *bufio.Writer, line string) error {
+	// bufio.Scanner keeps the '\r' of CRLF terminated lines
+	line = strings.TrimSuffix(line, "\r")
+
+	if p.numberLines {
+		command := stripComment(line, p.commentPrefix)
+		if command != "" {
+			p.lineNumber++
+			line = numberLine(p.lineNumber, command)
+		}
+	}
+
+	lineEnding := p.lineEnding
+	if lineEnding == "" {
+		lineEnding = "\n"
+	}
+
+	_, err := writer.WriteString(line + lineEnding)
+
+	return err
+}
+
+// parseLineEnding converts a ProcessingRequest.LineEnding value to the terminator it forces,
+// empty when the input's terminator should be kept
+func parseLineEnding(lineEnding string) (string, error) {
+	switch strings.ToLower(lineEnding) {
+	case "":
+		return "", nil
+	case "lf":
+		return "\n", nil
+	case "crlf":
+		return "\r\n", nil
+	default:
+		return "", fmt.Errorf("invalid line ending %q: must be lf or crlf", lineEnding)
+	}
+}
+
+// defaultLineEndingSampleLines is the number of leading lines inspected when Parameters.LineEndingSampleLines
+// is not set
+const defaultLineEndingSampleLines = 1000
+
+// detectLineEnding returns the terminator used by most of the first sampleLines lines of the file,
+// "\r\n" or "\n". Ties and files without terminated lines give "\n". A sampleLines below 1 samples one line.
+func detectLineEnding(filePath string, sampleLines int64) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to open file for line ending detection: %w", err)
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	lineNum := int64(0)
+	sampleLines = max(sampleLines, 1)
+	reader := bufio.NewReader(file)
 
-	// Skip to start position
-	for lineNum < startLine && scanner.Scan() {
-		lineNum++
-	}
+	var crlf, lf int64
 
-	// Stream the range
-	for lineNum <= endLine && scanner.Scan() {
-		line := scanner.Text()
+	for crlf+lf < sampleLines {
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read file for line ending detection: %w", err)
+		}
 
-		if processMarkerSplit {
-			splitLines := p.processLineWithMarkerSplit(line, p.printerDef.Markers.EndInitSection)
-			for _, splitLine := range splitLines {
-				_, err = fmt.Fprintln(writer, splitLine)
-				if err != nil {
-					return err
-				}
-			}
-		} else {
-			_, err = fmt.Fprintln(writer, line)
-			if err != nil {
-				return err
-			}
+		switch {
+		case strings.HasSuffix(line, "\r\n"):
+			crlf++
+		case strings.HasSuffix(line, "\n"):
+			lf++
 		}
 
-		lineNum++
+		if err != nil {
+			break
+		}
 	}
 
-	return scanner.Err()
+	if crlf > lf {
+		return "\r\n", nil
+	}
+
+	return "\n", nil
 }
 
-// streamLinesFromPosition streams all lines from the given position to EOF
-func (p *StreamingProcessor) streamLinesFromPosition(filePath string, writer *bufio.Writer, startLine int64) error {
+// lineNumberRegex matches an "N<line>" prefix and an optional "*<checksum>" suffix
+var lineNumberRegex = regexp.MustCompile(`^\s*N\d+\s+(.*?)(?:\*\d+)?\s*$`)
+
+// detectLineNumbers reports whether the first command line of the file carries an N<line> prefix
+func detectLineNumbers(filePath, commentPrefix string) (bool, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return err
+		return false, fmt.Errorf("failed to open file for line number detection: %w", err)
 	}
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
-	lineNum := int64(0)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if stripComment(line, commentPrefix) == "" {
+			continue
+		}
 
-	// Skip to start position
-	for lineNum < startLine && scanner.Scan() {
-		lineNum++
+		return lineNumberRegex.MatchString(line), nil
+	}
+
+	return false, scanner.Err()
+}
+
+// stripLineNumbers copies the file removing N<line> prefixes and *<checksum> suffixes
+func stripLineNumbers(inputPath, outputPath string) error {
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file for line number stripping: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create stripped file: %w", err)
 	}
+	defer out.Close()
+
+	writer := bufio.NewWriter(out)
+	scanner := bufio.NewScanner(in)
 
-	// Stream from position to EOF
 	for scanner.Scan() {
 		line := scanner.Text()
+		if match := lineNumberRegex.FindStringSubmatch(line); match != nil {
+			line = match[1]
+		}
 
 		_, err = fmt.Fprintln(writer, line)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to write stripped file: %w", err)
 		}
 	}
 
-	return scanner.Err()
+	err = scanner.Err()
+	if err != nil {
+		return err
+	}
+
+	return writer.Flush()
 }
 
-// streamGeneratedContent writes generated content for an iteration using template
-func (p *StreamingProcessor) streamGeneratedContent(writer *bufio.Writer, iteration int64) error {
-	// Prepare template data
-	templateData := struct {
-		PrinterName string
-		Iteration   int64
-		Request     ProcessingRequest
-		Config      map[string]any
-		Positions   MarkerPositions
-	}{
-		PrinterName: p.printerDef.Name,
-		Iteration:   iteration,
-		Request:     p.config,
-		Config:      p.printerDef.Parameters,
-		Positions:   p.positions,
+// stripComment returns the command part of a G-code line without comment and surrounding spaces
+func stripComment(line, commentPrefix string) string {
+	if idx := strings.Index(line, commentPrefix); idx != -1 {
+		line = line[:idx]
 	}
 
-	// Execute template
-	var output strings.Builder
+	return strings.TrimSpace(line)
+}
 
-	err := p.template.Execute(&output, templateData)
-	if err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+// numberLine formats a command as "N<line> <command>*<checksum>" using the Marlin/RepRap XOR checksum
+func numberLine(lineNumber int64, command string) string {
+	numbered := fmt.Sprintf("N%d %s", lineNumber, command)
+
+	checksum := byte(0)
+	for i := range len(numbered) {
+		checksum ^= numbered[i]
 	}
 
-	// Write generated content
-	lines := strings.Split(output.String(), "\n")
-	for _, line := range lines {
-		if line != "" || len(lines) == 1 { // Don't write empty lines unless it's the only line
-			_, err = fmt.Fprintln(writer, line)
-			if err != nil {
-				return err
-			}
-		}
+	return fmt.Sprintf("%s*%d", numbered, checksum)
+}
+
+// validatePrintSectionPosition checks that the end marker appears after Parameters.MinPrintSectionFraction
+// of the file. Early matches are rejected when Parameters.StrictPrintSectionPosition is set and reported
+// as warnings otherwise.
+func (p *StreamingProcessor) validatePrintSectionPosition(positions MarkerPositions) error {
+	minFraction := p.floatParameter("MinPrintSectionFraction", 0)
+	if minFraction <= 0 {
+		return nil
+	}
+
+	totalLines := positions.TotalLines
+	fraction := float64(positions.EndPrintSectionFirstLine) / float64(max(totalLines, 1))
+	if fraction >= minFraction {
+		return nil
+	}
+
+	msg := fmt.Sprintf("end marker found suspiciously early at line %d of %d (%.0f%% of the file, expected at least %.0f%%), the file may be partial or corrupt",
+		positions.EndPrintSectionFirstLine+1, totalLines, fraction*100, minFraction*100)
+	if p.boolParameter("StrictPrintSectionPosition", false) {
+		return errors.New(msg)
+	}
+
+	p.warn("%s", msg)
+
+	return nil
+}
+
+// validateBodyLength checks that the iteration body has at least Parameters.MinBodyLines lines. Shorter
+// bodies are rejected when Parameters.StrictBodyLines is set and reported as warnings otherwise.
+func (p *StreamingProcessor) validateBodyLength() error {
+	minLines := int64(p.floatParameter("MinBodyLines", 0))
+	if minLines <= 0 {
+		return nil
+	}
+
+	bodyLines := max(p.bodyLastLine()-p.positions.EndInitSectionLastLine, 0)
+	if bodyLines >= minLines {
+		return nil
+	}
+
+	msg := fmt.Sprintf("iteration body has only %d lines (expected at least %d), check that the start and end markers match the print section",
+		bodyLines, minLines)
+	if p.boolParameter("StrictBodyLines", false) {
+		return errors.New(msg)
+	}
+
+	p.warn("%s", msg)
+
+	return nil
+}
+
+// validateOutputSize estimates the looped output size as the body size of all regions times iterations and checks it
+// against MaxOutputSize
+func (p *StreamingProcessor) validateOutputSize() error {
+	// Every region is looped Iterations times
+	bodyBytes := p.regionsBodyBytes()
+
+	bodyBytes = max(bodyBytes, 1)
+	if p.config.Iterations > MaxOutputSize/bodyBytes {
+		return fmt.Errorf("too many iterations: %d iterations of a %d byte body exceed the output limit of %d bytes",
+			p.config.Iterations, bodyBytes, MaxOutputSize)
 	}
 
 	return nil
 }
 
-// extractBedTemp scans the init section (lines 0 to endInitSectionLastLine) for M190 S<temp> commands.
-// Returns the temperature from the last M190 found, or 0 if none found.
-func extractBedTemp(filePath string, endInitSectionLastLine int64) (int64, error) {
+// measureLinesRange returns the number of lines and bytes (including line terminators) from startLine to endLine inclusive
+func measureLinesRange(filePath string, startLine, endLine int64) (int64, int64, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return 0, fmt.Errorf("failed to open file for bed temp extraction: %w", err)
+		return 0, 0, err
 	}
 	defer file.Close()
 
-	m190Regex := regexp.MustCompile(`^M190\s*S(\d+)`)
+	var lines, size int64
+
+	scanner := bufio.NewScanner(file)
+	lineNum := int64(0)
+
+	for scanner.Scan() {
+		if lineNum > endLine {
+			break
+		}
+
+		if lineNum >= startLine {
+			lines++
+			size += int64(len(scanner.Bytes())) + 1
+		}
 
-	var bedTemp int64
+		lineNum++
+	}
+
+	return lines, size, scanner.Err()
+}
+
+// hashLinesRange returns the hex SHA-256 of lines startLine to endLine (inclusive), each terminated by "\n"
+func hashLinesRange(filePath string, startLine, endLine int64) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
 
+	hash := sha256.New()
 	scanner := bufio.NewScanner(file)
 	lineNum := int64(0)
 
 	for scanner.Scan() {
-		if lineNum > endInitSectionLastLine {
+		if lineNum > endLine {
 			break
 		}
 
-		trimmed := strings.TrimSpace(scanner.Text())
-		if match := m190Regex.FindStringSubmatch(trimmed); match != nil {
-			temp, err := strconv.ParseInt(match[1], 10, 64)
-			if err == nil {
-				bedTemp = temp
-			}
+		if lineNum >= startLine {
+			_, _ = hash.Write([]byte(scanner.Text() + "\n"))
 		}
 
 		lineNum++
@@ -780,10 +2915,61 @@ func extractBedTemp(filePath string, endInitSectionLastLine int64) (int64, error
 
 	err = scanner.Err()
 	if err != nil {
-		return 0, fmt.Errorf("failed to scan file for bed temp: %w", err)
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// mmPerInch converts G20 coordinates to millimeters
+const mmPerInch = 25.4
+
+// unitsCommand reports whether the line selects inches (G20) or millimeters (G21)
+func unitsCommand(line, commentPrefix string) (bool, bool) {
+	fields := strings.Fields(stripComment(line, commentPrefix))
+	if len(fields) == 0 {
+		return false, false
+	}
+
+	switch fields[0] {
+	case "G20":
+		return true, true
+	case "G21":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// scaleCoordinates multiplies the X, Y and Z of coords by scale
+func scaleCoordinates(coords *GCodeCoordinates, scale float64) *GCodeCoordinates {
+	if coords == nil || scale == 1 {
+		return coords
+	}
+
+	for _, axis := range []**float64{&coords.X, &coords.Y, &coords.Z} {
+		if *axis != nil {
+			scaled := **axis * scale
+			*axis = &scaled
+		}
+	}
+
+	return coords
+}
+
+// parseMoveLine returns the coordinates of a trimmed G0/G1 line, or nil for other commands
+func parseMoveLine(trimmed, commentPrefix string) *GCodeCoordinates {
+	fields := strings.Fields(stripComment(trimmed, commentPrefix))
+	if len(fields) == 0 {
+		return nil
+	}
+
+	switch fields[0] {
+	case "G0", "G1", "G00", "G01":
+		return parseCoordinateWords(strings.Join(fields, " "))
 	}
 
-	return bedTemp, nil
+	return nil
 }
 
 // processLineWithMarkerSplit splits a line if it contains a marker followed by a comment
@@ -791,10 +2977,10 @@ func (p *StreamingProcessor) processLineWithMarkerSplit(line string, markers []s
 	for _, marker := range markers {
 		cleanMarker := strings.TrimSpace(marker)
 		if strings.Contains(line, cleanMarker) {
-			semicolonPos := strings.Index(line, ";")
-			if semicolonPos != -1 {
-				before := strings.TrimSpace(line[:semicolonPos])
-				after := strings.TrimSpace(line[semicolonPos:])
+			commentPos := strings.Index(line, p.commentPrefix)
+			if commentPos != -1 {
+				before := strings.TrimSpace(line[:commentPos])
+				after := strings.TrimSpace(line[commentPos:])
 
 				if before != "" && after != "" {
 					return []string{before, after}
@@ -807,10 +2993,17 @@ func (p *StreamingProcessor) processLineWithMarkerSplit(line string, markers []s
 }
 
 func (p *StreamingProcessor) validateInput() error {
-	if len(p.printerDef.Markers.EndInitSection) == 0 {
+	initMarkerSets := p.printerDef.initMarkerSets()
+	if len(initMarkerSets) == 0 {
 		return errors.New("EndInitSection marker cannot be empty")
 	}
 
+	for i, markers := range p.printerDef.Markers.EndInitSectionAlternatives {
+		if len(markers) == 0 {
+			return fmt.Errorf("EndInitSectionAlternatives set %d cannot be empty", i+1)
+		}
+	}
+
 	if len(p.printerDef.Markers.EndPrintSection) == 0 {
 		return errors.New("EndPrintSection marker cannot be empty")
 	}
@@ -819,12 +3012,64 @@ func (p *StreamingProcessor) validateInput() error {
 		return errors.New("iterations must be positive")
 	}
 
+	// Printers may cap the iterations they can loop reliably
+	if maxIterations := int64(p.floatParameter("MaxIterations", 0)); maxIterations > 0 && p.config.Iterations > maxIterations {
+		return fmt.Errorf("too many iterations: %d exceeds the limit of %d for printer %s",
+			p.config.Iterations, maxIterations, p.printerDef.Name)
+	}
+
+	if p.config.MeshReloadEvery < 0 {
+		return errors.New("mesh reload interval must be positive or zero")
+	}
+
+	if p.config.BodyStartLine < 0 || (p.config.BodyStartLine == 0 && p.config.BodyEndLine != 0) {
+		return fmt.Errorf("invalid body_start_line value %d: must be a positive line number set together with body_end_line", p.config.BodyStartLine)
+	}
+
+	if p.config.BodyEndLine < 0 || (p.config.BodyEndLine == 0 && p.config.BodyStartLine != 0) {
+		return fmt.Errorf("invalid body_end_line value %d: must be a positive line number set together with body_start_line", p.config.BodyEndLine)
+	}
+
+	if p.config.BodyEndLine < p.config.BodyStartLine {
+		return fmt.Errorf("invalid body_end_line value %d: must not be before body_start_line %d", p.config.BodyEndLine, p.config.BodyStartLine)
+	}
+
+	if ejectAt := p.stringParameter("EjectAt", ejectAtIteration); ejectAt != ejectAtIteration && ejectAt != ejectAtEnd {
+		return fmt.Errorf("invalid EjectAt value %q: must be %s or %s", ejectAt, ejectAtIteration, ejectAtEnd)
+	}
+
+	if endMarkerMode := p.stringParameter("EndMarkerMode", endMarkerEveryIteration); endMarkerMode != endMarkerEveryIteration && endMarkerMode != endMarkerLastOnly {
+		return fmt.Errorf("invalid EndMarkerMode value %q: must be %s or %s", endMarkerMode, endMarkerEveryIteration, endMarkerLastOnly)
+	}
+
+	if zDirection := p.stringParameter("ZDirection", zDirectionUp); zDirection != zDirectionUp && zDirection != zDirectionDown {
+		return fmt.Errorf("invalid ZDirection value %q: must be %s or %s", zDirection, zDirectionUp, zDirectionDown)
+	}
+
+	if loopScope := p.stringParameter("LoopScope", loopScopeFull); loopScope != loopScopeFull && loopScope != loopScopeFirstLayer {
+		return fmt.Errorf("invalid LoopScope value %q: must be %s or %s", loopScope, loopScopeFull, loopScopeFirstLayer)
+	}
+
+	for _, markers := range append(initMarkerSets, p.printerDef.Markers.EndPrintSection) {
+		_, err := strategy.NewMatcher(p.matchMode(), p.commentPrefix, markers)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Patterns can't be compared as text, regex markers are only checked for compiling
+	if p.matchMode() == strategy.MatchRegex {
+		return nil
+	}
+
 	// Check for marker conflicts
-	for _, startLine := range p.printerDef.Markers.EndInitSection {
-		for _, endLine := range p.printerDef.Markers.EndPrintSection {
-			if strings.Contains(startLine, endLine) {
-				return fmt.Errorf("EndInitSection marker line '%s' contains EndPrintSection marker '%s'",
-					startLine, endLine)
+	for _, markers := range initMarkerSets {
+		for _, startLine := range markers {
+			for _, endLine := range p.printerDef.Markers.EndPrintSection {
+				if strings.Contains(startLine, endLine) {
+					return fmt.Errorf("EndInitSection marker line '%s' contains EndPrintSection marker '%s'",
+						startLine, endLine)
+				}
 			}
 		}
 	}
@@ -913,15 +3158,493 @@ func toFloat64(v any) (float64, bool) {
 
 // ProcessFile processes a file using the true streaming processor with printer configuration
 func ProcessFile(inputPath, outputPath string, config ProcessingRequest) error {
+	return ProcessFileContext(context.Background(), inputPath, outputPath, config)
+}
+
+// ProcessFileContext is ProcessFile aborting once ctx is done
+func ProcessFileContext(ctx context.Context, inputPath, outputPath string, config ProcessingRequest) error {
+	_, err := ProcessFileWithStatsContext(ctx, inputPath, outputPath, config)
+	return err
+}
+
+// ProcessingStats describes a completed processing run
+type ProcessingStats struct {
+	InputBytes               int64         // Size of the input file
+	OutputBytes              int64         // Size of the written output file
+	Iterations               int64         // Iterations streamed, across all regions
+	EndInitSectionLastLine   int64         // Last line of the init section marker of the first region (0-based)
+	EndPrintSectionFirstLine int64         // First line of the print section marker of the first region (0-based)
+	Duration                 time.Duration // Time spent processing, including writing the output
+	Warnings                 []string      // Problems found that did not stop processing
+	Lines                    LineStats     // Input and projected output line counts, across all regions
+}
+
+// ProcessFileWithStats is ProcessFile also returning statistics about the run
+func ProcessFileWithStats(inputPath, outputPath string, config ProcessingRequest) (ProcessingStats, error) {
+	return ProcessFileWithStatsContext(context.Background(), inputPath, outputPath, config)
+}
+
+// ProcessFileWithStatsContext is ProcessFileWithStats aborting once ctx is done
+func ProcessFileWithStatsContext(ctx context.Context, inputPath, outputPath string, config ProcessingRequest) (ProcessingStats, error) {
+	start := time.Now()
+
 	processor, err := NewStreamingProcessor(config)
 	if err != nil {
-		return err
+		return ProcessingStats{}, err
+	}
+
+	err = processor.ProcessFileContext(ctx, inputPath, outputPath)
+
+	for _, warning := range processor.Warnings() {
+		slog.Warn("Processing warning", "filename", config.FileName, "warning", warning)
+	}
+
+	if err != nil {
+		return ProcessingStats{}, err
+	}
+
+	if config.WriteManifest {
+		err = writeManifest(inputPath, outputPath, processor.positions, processor.lines, config)
+		if err != nil {
+			return ProcessingStats{}, err
+		}
+	}
+
+	return processor.stats(inputPath, outputPath, time.Since(start))
+}
+
+// stats collects the statistics of a completed run from the input and output files
+func (p *StreamingProcessor) stats(inputPath, outputPath string, duration time.Duration) (ProcessingStats, error) {
+	input, err := os.Stat(inputPath)
+	if err != nil {
+		return ProcessingStats{}, fmt.Errorf("failed to stat input file: %w", err)
+	}
+
+	output, err := os.Stat(outputPath)
+	if err != nil {
+		return ProcessingStats{}, fmt.Errorf("failed to stat output file: %w", err)
+	}
+
+	return ProcessingStats{
+		InputBytes:               input.Size(),
+		OutputBytes:              output.Size(),
+		Iterations:               p.streamed,
+		EndInitSectionLastLine:   p.positions.EndInitSectionLastLine,
+		EndPrintSectionFirstLine: p.positions.EndPrintSectionFirstLine,
+		Duration:                 duration,
+		Warnings:                 p.Warnings(),
+		Lines:                    p.lines,
+	}, nil
+}
+
+// ProcessStreamContext processes a file writing the output to w, see StreamingProcessor.ProcessStreamContext,
+// and returns the warnings of the run
+func ProcessStreamContext(ctx context.Context, inputPath string, w io.Writer, config ProcessingRequest) ([]string, error) {
+	processor, err := NewStreamingProcessor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = processor.ProcessStreamContext(ctx, inputPath, w)
+
+	for _, warning := range processor.Warnings() {
+		slog.Warn("Processing warning", "filename", config.FileName, "warning", warning)
+	}
+
+	return processor.Warnings(), err
+}
+
+// ProcessFileChunked processes a file into several independently printable chunk files, see
+// StreamingProcessor.ProcessFileChunked, and returns the chunk paths and the warnings of the run
+func ProcessFileChunked(inputPath, outputPath string, config ProcessingRequest) ([]string, []string, error) {
+	return ProcessFileChunkedContext(context.Background(), inputPath, outputPath, config)
+}
+
+// ProcessFileChunkedContext is ProcessFileChunked aborting once ctx is done
+func ProcessFileChunkedContext(ctx context.Context, inputPath, outputPath string, config ProcessingRequest) ([]string, []string, error) {
+	processor, err := NewStreamingProcessor(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chunkPaths, err := processor.ProcessFileChunkedContext(ctx, inputPath, outputPath)
+
+	for _, warning := range processor.Warnings() {
+		slog.Warn("Processing warning", "filename", config.FileName, "warning", warning)
+	}
+
+	return chunkPaths, processor.Warnings(), err
+}
+
+// RenderGeneratedBlock returns only the code generated after iteration 1 for the given positions,
+// without the input's body and markers, to help authoring templates
+func RenderGeneratedBlock(config ProcessingRequest, positions MarkerPositions) (string, error) {
+	processor, err := NewStreamingProcessor(config)
+	if err != nil {
+		return "", err
+	}
+
+	processor.positions = positions
+
+	var output strings.Builder
+
+	writer := bufio.NewWriter(&output)
+
+	err = processor.streamGeneratedContent(writer, 1)
+	if err != nil {
+		return "", err
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return "", err
+	}
+
+	return output.String(), nil
+}
+
+// PrinterInfo identifies a printer definition: Key is the value accepted in
+// ProcessingRequest.Printer, Name the human-readable name from the TOML file. The defaults come from
+// Parameters.DefaultIterations, DefaultWaitMin and DefaultWaitBedCooldownTemp for the UI to prefill,
+// 0 when the definition sets none; requests still have to send their values.
+type PrinterInfo struct {
+	Key                        string `json:"key"`
+	Name                       string `json:"name"`
+	DefaultIterations          int64  `json:"default_iterations,omitempty"`
+	DefaultWaitMin             int64  `json:"default_wait_min,omitempty"`
+	DefaultWaitBedCooldownTemp int64  `json:"default_wait_bed_cooldown_temp,omitempty"`
+}
+
+// ListPrinters returns the embedded printer definitions and those of ProfilesDir sorted by key, a
+// definition of ProfilesDir replacing the embedded one with the same key. Definitions that fail to
+// parse are skipped with a warning.
+func ListPrinters() []PrinterInfo {
+	printers := listPrinters(printerConfigs, "printers")
+	if ProfilesDir == "" {
+		return printers
+	}
+
+	for _, external := range listPrinters(os.DirFS(ProfilesDir), ".") {
+		index := slices.IndexFunc(printers, func(printer PrinterInfo) bool { return printer.Key == external.Key })
+		if index >= 0 {
+			printers[index] = external
+		} else {
+			printers = append(printers, external)
+		}
+	}
+
+	slices.SortFunc(printers, func(a, b PrinterInfo) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return printers
+}
+
+func listPrinters(fsys fs.FS, dir string) []PrinterInfo {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		slog.Warn("Failed to read printer definitions", "error", err)
+		return nil
+	}
+
+	printers := make([]PrinterInfo, 0, len(entries))
+
+	for _, entry := range entries {
+		key, found := strings.CutSuffix(entry.Name(), ".toml")
+		if !found || entry.IsDir() || !isValidPrinterName(key) {
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			slog.Warn("Skipping unreadable printer definition", "printer", key, "error", err)
+			continue
+		}
+
+		var def PrinterDefinition
+
+		err = toml.Unmarshal(data, &def)
+		if err != nil {
+			slog.Warn("Skipping unparsable printer definition", "printer", key, "error", err)
+			continue
+		}
+
+		printers = append(printers, PrinterInfo{
+			Key:                        key,
+			Name:                       def.Name,
+			DefaultIterations:          parameterInt(def.Parameters, "DefaultIterations"),
+			DefaultWaitMin:             parameterInt(def.Parameters, "DefaultWaitMin"),
+			DefaultWaitBedCooldownTemp: parameterInt(def.Parameters, "DefaultWaitBedCooldownTemp"),
+		})
+	}
+
+	slices.SortFunc(printers, func(a, b PrinterInfo) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return printers
+}
+
+// MaxPrinterSuggestions limits the similar printer names offered when a requested printer does not
+// exist, 0 disables suggestions
+var MaxPrinterSuggestions = 3
+
+// unknownPrinterError reports a missing printer definition, suggesting similarly named ones
+func unknownPrinterError(printerName string) error {
+	suggestions := suggestPrinters(printerName, MaxPrinterSuggestions)
+	if len(suggestions) == 0 {
+		return fmt.Errorf("failed to load printer definition: printer %q not found", printerName)
+	}
+
+	return fmt.Errorf("failed to load printer definition: printer %q not found, did you mean %s?",
+		printerName, strings.Join(suggestions, " or "))
+}
+
+// suggestPrinters returns up to limit embedded printer keys within a small edit distance of name,
+// closest first
+func suggestPrinters(name string, limit int) []string {
+	if limit <= 0 {
+		return nil
 	}
 
-	return processor.ProcessFile(inputPath, outputPath)
+	// Allow roughly one typo per three characters
+	maxDistance := max(2, len(name)/3)
+
+	type candidate struct {
+		key      string
+		distance int
+	}
+
+	var candidates []candidate
+
+	for _, printer := range ListPrinters() {
+		distance := levenshtein(name, printer.Key)
+		if distance <= maxDistance {
+			candidates = append(candidates, candidate{key: printer.Key, distance: distance})
+		}
+	}
+
+	// Stable keeps the key order of ListPrinters for equal distances
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		return a.distance - b.distance
+	})
+
+	suggestions := make([]string, 0, min(limit, len(candidates)))
+	for _, c := range candidates[:min(limit, len(candidates))] {
+		suggestions = append(suggestions, c.key)
+	}
+
+	return suggestions
+}
+
+// levenshtein returns the number of single character insertions, deletions and substitutions
+// turning a into b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
 }
 
 func LoadPrinterDefinitionRaw(printerName string) ([]byte, error) {
-	filename := "printers/" + printerName + ".toml"
-	return printerConfigs.ReadFile(filename)
+	return readPrinterFile(printerName, ".toml")
+}
+
+// LoadPrinterDefinition returns the parsed printer definition, with numeric parameters
+// converted to float64 as templates see them
+func LoadPrinterDefinition(printerName string) (*PrinterDefinition, error) {
+	if !isValidPrinterName(printerName) {
+		return nil, fmt.Errorf("invalid printer name %q", printerName)
+	}
+
+	return loadPrinterDefinition(printerName)
+}
+
+// PrinterParameter is a Parameters entry of a printer definition together with the TOML type it is
+// written with: "integer", "float", "string", "boolean" or "other" for arrays and tables
+type PrinterParameter struct {
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+// LoadPrinterParameters returns the Parameters of an embedded printer definition with the types from
+// the TOML file, before numbers are converted to float64 for templates
+func LoadPrinterParameters(printerName string) (map[string]PrinterParameter, error) {
+	if !isValidPrinterName(printerName) {
+		return nil, fmt.Errorf("invalid printer name %q", printerName)
+	}
+
+	data, err := LoadPrinterDefinitionRaw(printerName)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePrinterParameters(data)
+}
+
+// parsePrinterParameters decodes the Parameters table of a printer definition keeping the TOML types
+func parsePrinterParameters(data []byte) (map[string]PrinterParameter, error) {
+	var def struct {
+		Parameters map[string]any
+	}
+
+	err := toml.Unmarshal(data, &def)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse printer definition: %w", err)
+	}
+
+	parameters := make(map[string]PrinterParameter, len(def.Parameters))
+
+	for name, value := range def.Parameters {
+		var kind string
+
+		switch value.(type) {
+		case int64:
+			kind = "integer"
+		case float64:
+			kind = "float"
+		case string:
+			kind = "string"
+		case bool:
+			kind = "boolean"
+		default:
+			kind = "other"
+		}
+
+		parameters[name] = PrinterParameter{Type: kind, Value: value}
+	}
+
+	return parameters, nil
+}
+
+// LoadPrinterSample returns the small sample G-code next to the printer definition, from ProfilesDir
+// like the definition
+func LoadPrinterSample(printerName string) ([]byte, error) {
+	if !isValidPrinterName(printerName) {
+		return nil, fmt.Errorf("invalid printer name %q", printerName)
+	}
+
+	return readPrinterFile(printerName, ".gcode")
+}
+
+// GenerateSample builds a minimal synthetic G-code file for an embedded printer: a short init section
+// ending with the printer's init markers, a two-layer 20 mm square and the end markers. The square sits
+// at X/Y 40-60 so it stays inside the print area assertions of the embedded printers.
+func GenerateSample(printerName string) ([]byte, error) {
+	if !isValidPrinterName(printerName) {
+		return nil, fmt.Errorf("invalid printer name %q", printerName)
+	}
+
+	def, err := loadPrinterDefinition(printerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load printer definition %q: %w", printerName, err)
+	}
+
+	var sample strings.Builder
+
+	fmt.Fprintf(&sample, "; printloop sample for %s\n", def.Name)
+	sample.WriteString("G21\nG90\nM83\nM140 S60\nM104 S200\nG28\nM190 S60\nM109 S200\n")
+
+	initMarkers, err := sampleMarkerLines(def.initMarkerSets()[0], def.Markers.MatchMode)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, marker := range initMarkers {
+		sample.WriteString(marker + "\n")
+	}
+
+	for _, z := range []float64{0.3, 0.6} {
+		fmt.Fprintf(&sample, "G1 Z%.1f F600\n", z)
+		sample.WriteString("G1 X40 Y40 F6000\n")
+		sample.WriteString("G1 X60 Y40 E0.8 F1500\n")
+		sample.WriteString("G1 X60 Y60 E0.8\n")
+		sample.WriteString("G1 X40 Y60 E0.8\n")
+		sample.WriteString("G1 X40 Y40 E0.8\n")
+	}
+
+	printMarkers, err := sampleMarkerLines(def.Markers.EndPrintSection, def.Markers.MatchMode)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, marker := range printMarkers {
+		sample.WriteString(marker + "\n")
+	}
+
+	sample.WriteString("M104 S0\nM140 S0\n")
+
+	return []byte(sample.String()), nil
+}
+
+// sampleMarkerLines returns lines matching markers, the markers themselves unless they are regular
+// expressions
+func sampleMarkerLines(markers []string, mode string) ([]string, error) {
+	if strategy.MatchMode(mode) != strategy.MatchRegex {
+		return markers, nil
+	}
+
+	lines := make([]string, len(markers))
+
+	for i, marker := range markers {
+		re, err := syntax.Parse(strings.TrimSpace(marker), syntax.Perl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid marker regex %q: %w", marker, err)
+		}
+
+		var line strings.Builder
+
+		writeRegexpSample(&line, re.Simplify())
+		lines[i] = line.String()
+	}
+
+	return lines, nil
+}
+
+// writeRegexpSample writes a short string matched by re: the first alternative of alternations, the
+// minimum count of repeats and the lowest printable character of classes
+func writeRegexpSample(sb *strings.Builder, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		sb.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		if len(re.Rune) > 0 {
+			sb.WriteRune(max(re.Rune[0], ' '))
+		}
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		sb.WriteRune('x')
+	case syntax.OpCapture, syntax.OpPlus:
+		writeRegexpSample(sb, re.Sub[0])
+	case syntax.OpRepeat:
+		for range re.Min {
+			writeRegexpSample(sb, re.Sub[0])
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			writeRegexpSample(sb, sub)
+		}
+	case syntax.OpAlternate:
+		writeRegexpSample(sb, re.Sub[0])
+	}
 }
@@ -0,0 +1,244 @@
+// file: internal/processor/processor_ListPrinters_test.go
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestListPrinters(t *testing.T) {
+	t.Parallel()
+
+	printers := ListPrinters()
+
+	byKey := make(map[string]string)
+	for _, printer := range printers {
+		byKey[printer.Key] = printer.Name
+	}
+
+	expected := map[string]string{
+		"a1":         "A1",
+		"a1-mini":    "A1 mini",
+		"unit-tests": "unit tests",
+	}
+
+	for key, name := range expected {
+		got, found := byKey[key]
+		if !found {
+			t.Errorf("Printer %q not listed in %v", key, printers)
+			continue
+		}
+
+		if got != name {
+			t.Errorf("Printer %q name = %q, want %q", key, got, name)
+		}
+	}
+
+	for i := 1; i < len(printers); i++ {
+		if printers[i-1].Key >= printers[i].Key {
+			t.Errorf("Printers not sorted by key: %v", printers)
+		}
+	}
+}
+
+func TestListPrinters_SkipsUnparsable(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"printers/good.toml":    {Data: []byte(`Name = "Good printer"`)},
+		"printers/broken.toml":  {Data: []byte(`Name = "unterminated`)},
+		"printers/readme.md":    {Data: []byte(`not a printer`)},
+		"printers/_shared.toml": {Data: []byte(`snippet = "M400"`)},
+	}
+
+	printers := listPrinters(fsys, "printers")
+
+	if len(printers) != 1 {
+		t.Fatalf("Expected 1 printer, got %d: %v", len(printers), printers)
+	}
+
+	if printers[0] != (PrinterInfo{Key: "good", Name: "Good printer"}) {
+		t.Errorf("Unexpected printer %v", printers[0])
+	}
+}
+
+func TestListPrinters_Defaults(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"printers/defaults.toml": {Data: []byte(`Name = "With defaults"
+[Parameters]
+DefaultIterations = 20
+DefaultWaitMin = 5
+DefaultWaitBedCooldownTemp = 30.0
+`)},
+		"printers/plain.toml": {Data: []byte(`Name = "Without defaults"`)},
+	}
+
+	printers := listPrinters(fsys, "printers")
+
+	expected := []PrinterInfo{
+		{Key: "defaults", Name: "With defaults", DefaultIterations: 20, DefaultWaitMin: 5, DefaultWaitBedCooldownTemp: 30},
+		{Key: "plain", Name: "Without defaults"},
+	}
+
+	if len(printers) != len(expected) {
+		t.Fatalf("Expected %d printers, got %d: %v", len(expected), len(printers), printers)
+	}
+
+	for i := range expected {
+		if printers[i] != expected[i] {
+			t.Errorf("Printer %d = %+v, want %+v", i, printers[i], expected[i])
+		}
+	}
+}
+
+// TestProfilesDir changes ProfilesDir and therefore doesn't run in parallel
+func TestProfilesDir(t *testing.T) {
+	dir := t.TempDir()
+
+	override := `Name = "A1 mini external"
+[Markers]
+EndInitSection = ["START_PRINT"]
+EndPrintSection = ["END_PRINT"]
+[SearchStrategy]
+EndInitSectionStrategy = "after_first_appear"
+EndPrintSectionStrategy = "after_last_appear"
+[Template]
+Code = "; external"
+`
+
+	err := os.WriteFile(filepath.Join(dir, "a1-mini.toml"), []byte(override), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "workshop.toml"), []byte(strings.Replace(override, "A1 mini external", "Workshop", 1)), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	ProfilesDir = dir
+
+	t.Cleanup(func() { ProfilesDir = "" })
+
+	def, err := loadPrinterDefinition("a1-mini")
+	if err != nil {
+		t.Fatalf("Failed to load overridden printer: %v", err)
+	}
+
+	if def.Name != "A1 mini external" || def.Template.Code != "; external" {
+		t.Errorf("Expected the external a1-mini definition, got %q with template %q", def.Name, def.Template.Code)
+	}
+
+	raw, err := LoadPrinterDefinitionRaw("a1-mini")
+	if err != nil || string(raw) != override {
+		t.Errorf("Expected the external a1-mini TOML, got %q, %v", raw, err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "workshop.gcode"), []byte("G28\n"), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write sample: %v", err)
+	}
+
+	sample, err := LoadPrinterSample("workshop")
+	if err != nil || string(sample) != "G28\n" {
+		t.Errorf("Expected the external workshop sample, got %q, %v", sample, err)
+	}
+
+	// Samples missing from the directory still come from the embedded files
+	sample, err = LoadPrinterSample("a1-mini")
+	if err != nil || len(sample) == 0 {
+		t.Errorf("Expected the embedded a1-mini sample, got %d bytes, %v", len(sample), err)
+	}
+
+	// Printers missing from the directory still come from the embedded definitions
+	def, err = loadPrinterDefinition("a1")
+	if err != nil || def.Name != "A1" {
+		t.Errorf("Expected the embedded a1 definition, got %v, %v", def, err)
+	}
+
+	byKey := make(map[string]string)
+	for _, printer := range ListPrinters() {
+		byKey[printer.Key] = printer.Name
+	}
+
+	if byKey["a1-mini"] != "A1 mini external" || byKey["workshop"] != "Workshop" || byKey["a1"] != "A1" {
+		t.Errorf("Unexpected printers with external profiles: %v", byKey)
+	}
+
+	for _, name := range []string{"../a1-mini", "a1/../../secret", "", "a1 mini"} {
+		_, err = LoadPrinterDefinitionRaw(name)
+		if err == nil || !strings.Contains(err.Error(), "invalid printer name") {
+			t.Errorf("Expected invalid printer name error for %q, got %v", name, err)
+		}
+
+		_, err = LoadPrinterSample(name)
+		if err == nil || !strings.Contains(err.Error(), "invalid printer name") {
+			t.Errorf("Expected invalid printer name error for sample %q, got %v", name, err)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"a1", "", 2},
+		{"", "a1", 2},
+		{"a1-mini", "a1-mini", 0},
+		{"a1-mni", "a1-mini", 1},
+		{"a1mini", "a1-mini", 1},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.expected {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestSuggestPrinters(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		limit    int
+		expected []string
+	}{
+		{name: "a1-mni", limit: 3, expected: []string{"a1-mini"}},
+		{name: "a1mini", limit: 3, expected: []string{"a1-mini"}},
+		{name: "a2", limit: 3, expected: []string{"a1"}},
+		{name: "a1-mni", limit: 0, expected: nil},
+		{name: "prusa-mk4", limit: 3, expected: nil},
+	}
+
+	for _, tt := range tests {
+		got := suggestPrinters(tt.name, tt.limit)
+		if !equalStringSlices(got, tt.expected) {
+			t.Errorf("suggestPrinters(%q, %d) = %v, want %v", tt.name, tt.limit, got, tt.expected)
+		}
+	}
+}
+
+func TestNewStreamingProcessor_UnknownPrinter(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewStreamingProcessor(ProcessingRequest{Iterations: 1, Printer: "A1 Mni"})
+	if err == nil || !strings.Contains(err.Error(), `printer "a1-mni" not found, did you mean a1-mini?`) {
+		t.Errorf("Expected suggestion for a1-mini, got %v", err)
+	}
+
+	_, err = NewStreamingProcessor(ProcessingRequest{Iterations: 1, Printer: "prusa-mk4"})
+	if err == nil || strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("Expected not found error without suggestions, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePrinterParameters(t *testing.T) {
+	t.Parallel()
+
+	definition := `
+Name = "mixed"
+[Parameters]
+PushY = 0
+BackY = 179.99
+CommentPrefix = "#"
+StampHeader = true
+Offsets = [1, 2]
+[Template]
+Code = ""
+`
+
+	parameters, err := parsePrinterParameters([]byte(definition))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]PrinterParameter{
+		"PushY":         {Type: "integer", Value: int64(0)},
+		"BackY":         {Type: "float", Value: 179.99},
+		"CommentPrefix": {Type: "string", Value: "#"},
+		"StampHeader":   {Type: "boolean", Value: true},
+		"Offsets":       {Type: "other", Value: []any{int64(1), int64(2)}},
+	}
+
+	if !reflect.DeepEqual(parameters, expected) {
+		t.Errorf("Expected %v, got %v", expected, parameters)
+	}
+
+	parameters, err = parsePrinterParameters([]byte(`Name = "none"`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(parameters) != 0 {
+		t.Errorf("Expected no parameters, got %v", parameters)
+	}
+
+	_, err = parsePrinterParameters([]byte(`Name = "broken`))
+	if err == nil {
+		t.Error("Expected error for invalid TOML")
+	}
+}
+
+func TestLoadPrinterParameters(t *testing.T) {
+	t.Parallel()
+
+	parameters, err := LoadPrinterParameters("a1-mini")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if parameters["PushY"].Type != "integer" || parameters["BackY"].Type != "float" {
+		t.Errorf("Expected PushY integer and BackY float, got %v", parameters)
+	}
+
+	for _, printer := range []string{"nonexistent", "../a1"} {
+		_, err = LoadPrinterParameters(printer)
+		if err == nil {
+			t.Errorf("Expected error for printer %q", printer)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadPrinterSample(t *testing.T) {
+	t.Parallel()
+
+	for _, printer := range []string{"a1", "a1-mini"} {
+		t.Run(printer, func(t *testing.T) {
+			t.Parallel()
+
+			sample, err := LoadPrinterSample(printer)
+			if err != nil {
+				t.Fatalf("Failed to load sample: %v", err)
+			}
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "sample.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err = os.WriteFile(inputPath, sample, 0644)
+			if err != nil {
+				t.Fatalf("Failed to write sample: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:          3,
+				Printer:             printer,
+				WaitBedCooldownTemp: 30,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+			if err != nil {
+				t.Fatalf("Sample failed to process: %v", err)
+			}
+
+			if len(processor.Warnings()) != 0 {
+				t.Errorf("Unexpected warnings: %v", processor.Warnings())
+			}
+
+			output, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+
+			if got := strings.Count(string(output), "Generated code for"); got != 3 {
+				t.Errorf("Expected 3 generated blocks, got %d", got)
+			}
+		})
+	}
+}
+
+func TestLoadPrinterSample_Missing(t *testing.T) {
+	t.Parallel()
+
+	_, err := LoadPrinterSample("unit-tests")
+	if err == nil {
+		t.Error("Expected error for printer without sample")
+	}
+
+	_, err = LoadPrinterSample("../printers/a1")
+	if err == nil || !strings.Contains(err.Error(), "invalid printer name") {
+		t.Errorf("Expected invalid printer name error, got %v", err)
+	}
+}
+
+func TestGenerateSample(t *testing.T) {
+	t.Parallel()
+
+	for _, printer := range ListPrinters() {
+		t.Run(printer.Key, func(t *testing.T) {
+			t.Parallel()
+
+			sample, err := GenerateSample(printer.Key)
+			if err != nil {
+				t.Fatalf("Failed to generate sample: %v", err)
+			}
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "sample.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err = os.WriteFile(inputPath, sample, 0644)
+			if err != nil {
+				t.Fatalf("Failed to write sample: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations: 2,
+				Printer:    printer.Key,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+			if err != nil {
+				t.Fatalf("Sample failed to process: %v", err)
+			}
+
+			output, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+
+			if got := strings.Count(string(output), "G1 X60 Y60 E0.8"); got != 4 {
+				t.Errorf("Expected the two-layer body to be looped twice, got %d square corners", got)
+			}
+
+			if processor.positions.FirstPrintX != 60 || processor.positions.FirstPrintY != 40 {
+				t.Errorf("Expected first print at (60, 40), got (%v, %v)",
+					processor.positions.FirstPrintX, processor.positions.FirstPrintY)
+			}
+		})
+	}
+}
+
+func TestGenerateSample_UnknownPrinter(t *testing.T) {
+	t.Parallel()
+
+	for _, printer := range []string{"nonexistent", "../printers/a1"} {
+		_, err := GenerateSample(printer)
+		if err == nil {
+			t.Errorf("Expected error for printer %q", printer)
+		}
+	}
+}
@@ -3,10 +3,23 @@ package processor
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 )
 
 // Test core logic with simple string slices (no I/O) using the new streaming processor
@@ -511,6 +524,23 @@ func readLinesFromFile(filePath string) ([]string, error) {
 	return lines, scanner.Err()
 }
 
+// Helper function to build a custom template looping between the START_PRINT and END_PRINT lines
+func testPrinterTemplate(parameters, code string) string {
+	return `
+Name = "test-printer"
+[Markers]
+EndInitSection = ["START_PRINT"]
+EndPrintSection = ["END_PRINT"]
+[SearchStrategy]
+EndInitSectionStrategy = "after_first_appear"
+EndPrintSectionStrategy = "after_last_appear"
+[Parameters]
+` + parameters + `
+[Template]
+Code = """` + code + `"""
+`
+}
+
 // Helper function to compare string slices
 func equalStringSlices(a, b []string) bool {
 	if len(a) != len(b) {
@@ -986,6 +1016,445 @@ M625`,
 	}
 }
 
+func TestStreamingProcessor_findMarkerPositions_G92Offsets(t *testing.T) {
+	t.Parallel()
+
+	midBodyG92 := `G1 Z0.2
+START_PRINT
+G1 X100 Y100 E0.1
+G1 X110 Y120 E0.1
+G92 X0 Y0
+G1 X-5 Y10 E0.1
+END_PRINT`
+
+	tests := []struct {
+		name       string
+		gcode      string
+		parameters string
+		expectedX  float64
+		expectedY  float64
+		expectedZ  float64
+		expectedMx float64
+	}{
+		{
+			name:       "mid-body G92 offset applied",
+			gcode:      midBodyG92,
+			parameters: "ApplyG92Offsets = true",
+			expectedX:  105,
+			expectedY:  130,
+			expectedZ:  0.2,
+			expectedMx: 110,
+		},
+		{
+			name:       "offsets ignored by default",
+			gcode:      midBodyG92,
+			expectedX:  -5,
+			expectedY:  10,
+			expectedZ:  0.2,
+			expectedMx: 110,
+		},
+		{
+			name: "G92 E0 leaves coordinates unchanged",
+			gcode: `G1 Z0.2
+START_PRINT
+G1 X100 Y100 E0.1
+G92 E0
+G1 X110 Y120 E0.1
+END_PRINT`,
+			expectedX:  110,
+			expectedY:  120,
+			expectedZ:  0.2,
+			expectedMx: 110,
+		},
+		{
+			name: "G92 Z offset applied to layer height",
+			gcode: `G1 Z5
+START_PRINT
+G92 Z0
+G1 Z0.4
+G1 X10 Y20 E0.1
+END_PRINT`,
+			parameters: "ApplyG92Offsets = true",
+			expectedX:  10,
+			expectedY:  20,
+			expectedZ:  5.4,
+			expectedMx: 10,
+		},
+		{
+			name: "G92 before any move keeps the file frame",
+			gcode: `G92 X50 Y50
+START_PRINT
+G1 X60 Y70 E0.1
+END_PRINT`,
+			expectedX:  60,
+			expectedY:  70,
+			expectedMx: 60,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			inputPath := filepath.Join(t.TempDir(), "input.gcode")
+
+			err := os.WriteFile(inputPath, []byte(tt.gcode), 0644)
+			if err != nil {
+				t.Fatalf("Failed to write test content: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     1,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate(tt.parameters, "; Iteration {{.Iteration}}"),
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			positions, err := processor.findMarkerPositions(inputPath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if positions.LastPrintX != tt.expectedX || positions.LastPrintY != tt.expectedY || positions.LastPrintZ != tt.expectedZ {
+				t.Errorf("LastPrint: expected (%v, %v, %v), got (%v, %v, %v)",
+					tt.expectedX, tt.expectedY, tt.expectedZ, positions.LastPrintX, positions.LastPrintY, positions.LastPrintZ)
+			}
+
+			if positions.MaxPrintX != tt.expectedMx {
+				t.Errorf("MaxPrintX: expected %v, got %v", tt.expectedMx, positions.MaxPrintX)
+			}
+		})
+	}
+}
+
+func TestStreamingProcessor_findMarkerPositions_InchUnits(t *testing.T) {
+	t.Parallel()
+
+	inchFile := `G20 ; inches
+G1 Z0.01
+START_PRINT
+G1 X1 Y2 E0.01
+G1 X3 Y4 E0.01
+END_PRINT`
+
+	tests := []struct {
+		name           string
+		gcode          string
+		parameters     string
+		expectedInches bool
+		expectedLastX  float64
+		expectedLastY  float64
+		expectedLastZ  float64
+		expectedMaxX   float64
+	}{
+		{
+			name:           "inches detected without conversion",
+			gcode:          inchFile,
+			expectedInches: true,
+			expectedLastX:  3,
+			expectedLastY:  4,
+			expectedLastZ:  0.01,
+			expectedMaxX:   3,
+		},
+		{
+			name:           "inches converted to millimeters",
+			gcode:          inchFile,
+			parameters:     "NormalizeToMM = true",
+			expectedInches: true,
+			expectedLastX:  3 * 25.4,
+			expectedLastY:  4 * 25.4,
+			expectedLastZ:  0.01 * 25.4,
+			expectedMaxX:   3 * 25.4,
+		},
+		{
+			name: "G21 after G20 selects millimeters",
+			gcode: `G20
+G21
+G1 Z0.2
+START_PRINT
+G1 X10 Y20 E0.1
+END_PRINT`,
+			parameters:    "NormalizeToMM = true",
+			expectedLastX: 10,
+			expectedLastY: 20,
+			expectedLastZ: 0.2,
+			expectedMaxX:  10,
+		},
+		{
+			name: "G20 after the init section only converts later moves",
+			gcode: `G1 Z0.2
+START_PRINT
+G1 X100 Y100 E0.1
+G20
+G1 X1 Y1 E0.01
+END_PRINT`,
+			parameters:    "NormalizeToMM = true",
+			expectedLastX: 25.4,
+			expectedLastY: 25.4,
+			expectedLastZ: 0.2,
+			expectedMaxX:  100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			inputPath := filepath.Join(t.TempDir(), "input.gcode")
+
+			err := os.WriteFile(inputPath, []byte(tt.gcode), 0644)
+			if err != nil {
+				t.Fatalf("Failed to write test content: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     1,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate(tt.parameters, "; Iteration {{.Iteration}} inches={{.Positions.UnitsInches}}"),
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			positions, err := processor.findMarkerPositions(inputPath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if positions.UnitsInches != tt.expectedInches {
+				t.Errorf("UnitsInches: expected %v, got %v", tt.expectedInches, positions.UnitsInches)
+			}
+
+			const epsilon = 1e-9
+			if math.Abs(positions.LastPrintX-tt.expectedLastX) > epsilon ||
+				math.Abs(positions.LastPrintY-tt.expectedLastY) > epsilon ||
+				math.Abs(positions.LastPrintZ-tt.expectedLastZ) > epsilon {
+				t.Errorf("LastPrint: expected (%v, %v, %v), got (%v, %v, %v)",
+					tt.expectedLastX, tt.expectedLastY, tt.expectedLastZ, positions.LastPrintX, positions.LastPrintY, positions.LastPrintZ)
+			}
+
+			if math.Abs(positions.MaxPrintX-tt.expectedMaxX) > epsilon {
+				t.Errorf("MaxPrintX: expected %v, got %v", tt.expectedMaxX, positions.MaxPrintX)
+			}
+		})
+	}
+
+	t.Run("exposed to templates", func(t *testing.T) {
+		t.Parallel()
+
+		tempDir := t.TempDir()
+		inputPath := filepath.Join(tempDir, "input.gcode")
+		outputPath := filepath.Join(tempDir, "output.gcode")
+
+		err := os.WriteFile(inputPath, []byte(inchFile), 0644)
+		if err != nil {
+			t.Fatalf("Failed to write test content: %v", err)
+		}
+
+		processor, err := NewStreamingProcessor(ProcessingRequest{
+			Iterations:     1,
+			Printer:        "unit-tests",
+			CustomTemplate: testPrinterTemplate("", "; Iteration {{.Iteration}} inches={{.Positions.UnitsInches}}"),
+		})
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+
+		err = processor.ProcessFile(inputPath, outputPath)
+		if err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+
+		output, err := readLinesFromFile(outputPath)
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+
+		if !slices.Contains(output, "; Iteration 1 inches=true") {
+			t.Errorf("Expected template to see UnitsInches, got %v", output)
+		}
+	})
+}
+
+func TestStreamingProcessor_findMarkerPositions_ExtrusionMode(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "; Iteration {{.Iteration}} relative={{.Positions.RelativeExtrusion}}")
+
+	tests := []struct {
+		name             string
+		gcode            string
+		expectedRelative bool
+		expectedLastX    float64
+		expectedLastY    float64
+		expectedMaxX     float64
+	}{
+		{
+			name: "absolute extrusion ignores moves that do not advance E",
+			gcode: `M82
+G1 Z0.2
+START_PRINT
+G1 X10 Y10 E1
+G1 X20 Y10 E2
+G1 E1.2
+G1 X50 Y50 E1.2
+G1 E2
+G1 X30 Y30 E3
+END_PRINT`,
+			expectedLastX: 30,
+			expectedLastY: 30,
+			expectedMaxX:  30,
+		},
+		{
+			name: "absolute extrusion after G92 E0",
+			gcode: `M82
+G1 Z0.2
+START_PRINT
+G1 X10 Y10 E5
+G92 E0
+G1 X15 Y15 E0.5
+END_PRINT`,
+			expectedLastX: 15,
+			expectedLastY: 15,
+			expectedMaxX:  15,
+		},
+		{
+			name: "relative extrusion counts positive E",
+			gcode: `M83
+G1 Z0.2
+START_PRINT
+G1 X10 Y10 E0.5
+G1 X20 Y20 E0.5
+G1 X50 Y50 E-0.8
+G1 X60 Y60 E0.8
+END_PRINT`,
+			expectedRelative: true,
+			expectedLastX:    60,
+			expectedLastY:    60,
+			expectedMaxX:     60,
+		},
+		{
+			name: "last mode before end marker wins",
+			gcode: `M83
+G1 Z0.2
+START_PRINT
+G1 X10 Y10 E0.5
+M82
+G92 E0
+G1 X20 Y20 E1
+G1 X30 Y30 E1
+END_PRINT`,
+			expectedLastX: 20,
+			expectedLastY: 20,
+			expectedMaxX:  20,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			inputPath := filepath.Join(t.TempDir(), "input.gcode")
+
+			err := os.WriteFile(inputPath, []byte(tt.gcode), 0644)
+			if err != nil {
+				t.Fatalf("Failed to write test content: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     1,
+				Printer:        "unit-tests",
+				CustomTemplate: customTemplate,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			positions, err := processor.findMarkerPositions(inputPath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if positions.RelativeExtrusion != tt.expectedRelative {
+				t.Errorf("RelativeExtrusion: expected %v, got %v", tt.expectedRelative, positions.RelativeExtrusion)
+			}
+
+			if positions.LastPrintX != tt.expectedLastX || positions.LastPrintY != tt.expectedLastY {
+				t.Errorf("LastPrint: expected (%v, %v), got (%v, %v)",
+					tt.expectedLastX, tt.expectedLastY, positions.LastPrintX, positions.LastPrintY)
+			}
+
+			if positions.MaxPrintX != tt.expectedMaxX {
+				t.Errorf("MaxPrintX: expected %v, got %v", tt.expectedMaxX, positions.MaxPrintX)
+			}
+		})
+	}
+}
+
+func TestStreamingProcessor_findMarkerPositions_ModelBBox(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "; step {{.Positions.ModelBBox.StepX 5}} x {{.Positions.ModelBBox.StepY 5}}")
+
+	gcode := `G1 Z0.2
+START_PRINT
+G1 X100 Y80 F3000
+G1 X120 Y80 E1
+G1 X120 Y95 E1
+G1 X150 Y150
+G1 X100 Y95 E1
+G1 X100 Y80 E1
+END_PRINT`
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := os.WriteFile(inputPath, []byte(gcode), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test content: %v", err)
+	}
+
+	processor, err := NewStreamingProcessor(ProcessingRequest{
+		Iterations:     1,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	positions, err := processor.findMarkerPositions(inputPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := BoundingBox{MinX: 100, MinY: 80, MaxX: 120, MaxY: 95}
+	if positions.ModelBBox != expected {
+		t.Errorf("ModelBBox: expected %+v, got %+v", expected, positions.ModelBBox)
+	}
+
+	if positions.ModelBBox.Width() != 20 || positions.ModelBBox.Height() != 15 {
+		t.Errorf("Expected 20x15 box, got %vx%v", positions.ModelBBox.Width(), positions.ModelBBox.Height())
+	}
+
+	err = processor.ProcessFile(inputPath, outputPath)
+	if err != nil {
+		t.Fatalf("ProcessFile failed: %v", err)
+	}
+
+	output, err := readLinesFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	if !slices.Contains(output, "; step 25 x 20") {
+		t.Errorf("Expected grid step derived from the bounding box, got %v", output)
+	}
+}
+
 func TestStreamingProcessor_findMarkerPositions_MinMaxPrintCoordinates(t *testing.T) {
 	t.Parallel()
 
@@ -1433,7 +1902,15 @@ M625`,
 	}
 }
 
-func TestExtractBedTemp(t *testing.T) {
+// scanTestPositions runs scanPositions over filePath for the given marker lines, with ";" comments
+func scanTestPositions(filePath string, initLast, printFirst, printLast int64) (MarkerPositions, error) {
+	positions := MarkerPositions{EndInitSectionLastLine: initLast, EndPrintSectionFirstLine: printFirst, EndPrintSectionLastLine: printLast}
+	_, err := (&StreamingProcessor{commentPrefix: ";"}).scanPositions(filePath, &positions)
+
+	return positions, err
+}
+
+func TestScanPositions_BedTemp(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
@@ -1516,69 +1993,272 @@ func TestExtractBedTemp(t *testing.T) {
 				t.Fatalf("Failed to write test file: %v", err)
 			}
 
-			result, err := extractBedTemp(filePath, tt.initLastLine)
+			positions, err := scanTestPositions(filePath, tt.initLastLine, int64(len(tt.lines)), int64(len(tt.lines)))
 			if err != nil {
 				t.Fatalf("Unexpected error: %v", err)
 			}
 
-			if result != tt.expected {
-				t.Errorf("Expected bed temp %d, got %d", tt.expected, result)
+			if positions.BedTemp != tt.expected {
+				t.Errorf("Expected bed temp %d, got %d", tt.expected, positions.BedTemp)
 			}
 		})
 	}
 }
 
-func TestProcessFile_BedCooldownWithoutM190_TemplateDoesNotUseBedTemp(t *testing.T) {
+func TestScanPositions_LastTemps(t *testing.T) {
 	t.Parallel()
 
-	tempDir := t.TempDir()
-	inputPath := filepath.Join(tempDir, "input.gcode")
-	outputPath := filepath.Join(tempDir, "output.gcode")
-
-	// G-code without M190 in init section
-	input := []string{
-		"M211 X0 Y0 Z0 ;turn off soft endstop",
-		"M1007 S1",
-		"G1 X50.0 Y50.0 E0.1",
-		"M625",
+	tests := []struct {
+		name           string
+		lines          []string
+		printFirstLine int64
+		expectedHotend int64
+		expectedBed    int64
+	}{
+		{
+			name:           "M104 and M140",
+			lines:          []string{"M140 S60", "M104 S210", "G1 X1 E1", "END"},
+			printFirstLine: 3,
+			expectedHotend: 210,
+			expectedBed:    60,
+		},
+		{
+			name:           "M109 and M190 with comments",
+			lines:          []string{"M190 S65 ; wait bed", "M109 S220;wait hotend", "END"},
+			printFirstLine: 2,
+			expectedHotend: 220,
+			expectedBed:    65,
+		},
+		{
+			name:           "last command before end marker wins",
+			lines:          []string{"M104 S200", "M190 S60", "G1 X1 E1", "M104 S215", "M140 S55", "END"},
+			printFirstLine: 5,
+			expectedHotend: 215,
+			expectedBed:    55,
+		},
+		{
+			name:           "commands at and after end marker ignored",
+			lines:          []string{"M104 S210", "M140 S60", "M104 S0", "M140 S0"},
+			printFirstLine: 2,
+			expectedHotend: 210,
+			expectedBed:    60,
+		},
+		{
+			name:           "no S parameter",
+			lines:          []string{"M109 R210", "M190", "END"},
+			printFirstLine: 2,
+		},
+		{
+			name:           "leading whitespace and no space before S",
+			lines:          []string{"  M104S205", "\tM140S50", "END"},
+			printFirstLine: 2,
+			expectedHotend: 205,
+			expectedBed:    50,
+		},
+		{
+			name:           "other M commands ignored",
+			lines:          []string{"M1040 S99", "M106 S255", "M141 S40", "END"},
+			printFirstLine: 3,
+		},
 	}
 
-	err := writeLinesToFile(inputPath, input)
-	if err != nil {
-		t.Fatalf("Failed to write input file: %v", err)
-	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
 
-	// unit-tests-gcode2 template does not reference .Positions.BedTemp,
-	// so validation should be skipped even with cooldown enabled
-	config := ProcessingRequest{
-		Iterations:          2,
-		Printer:             "unit-tests-gcode2",
-		WaitBedCooldownTemp: 40,
-	}
+			tempDir := t.TempDir()
+			filePath := filepath.Join(tempDir, "test.gcode")
 
-	processor, err := NewStreamingProcessor(config)
-	if err != nil {
-		t.Fatalf("Failed to create processor: %v", err)
-	}
+			err := writeLinesToFile(filePath, tt.lines)
+			if err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
 
-	err = processor.ProcessFile(inputPath, outputPath)
-	if err != nil {
-		t.Fatalf("Expected no error for template without BedTemp reference, got: %v", err)
+			positions, err := scanTestPositions(filePath, 0, tt.printFirstLine, tt.printFirstLine)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if positions.LastHotendTemp != tt.expectedHotend {
+				t.Errorf("Expected hotend temp %d, got %d", tt.expectedHotend, positions.LastHotendTemp)
+			}
+
+			if positions.LastBedTemp != tt.expectedBed {
+				t.Errorf("Expected bed temp %d, got %d", tt.expectedBed, positions.LastBedTemp)
+			}
+		})
 	}
 }
 
-func TestProcessFile_BedCooldownWithoutM190_TemplateUsesBedTemp(t *testing.T) {
+func TestScanPositions_LineOffsets(t *testing.T) {
 	t.Parallel()
 
-	tempDir := t.TempDir()
-	inputPath := filepath.Join(tempDir, "input.gcode")
-	outputPath := filepath.Join(tempDir, "output.gcode")
-
-	// G-code without M190 in init section
-	input := []string{
-		"M211 X0 Y0 Z0 ;turn off soft endstop",
-		"M1007 S1",
-		"G1 X50.0 Y50.0 E0.1",
+	tests := []struct {
+		name       string
+		content    string
+		lines      []int64 // Body, end marker and footer lines
+		expected   []int64
+		totalLines int64
+	}{
+		{
+			name:       "LF",
+			content:    "G28\nG1 X1\nM84\n",
+			lines:      []int64{0, 1, 2},
+			expected:   []int64{0, 4, 10},
+			totalLines: 3,
+		},
+		{
+			name:       "CRLF",
+			content:    "G28\r\nG1 X1\r\nM84\r\n",
+			lines:      []int64{1, 2, 3},
+			expected:   []int64{5, 12, 17},
+			totalLines: 3,
+		},
+		{
+			name:       "repeated line",
+			content:    "G28\nG1 X1\nM84\n",
+			lines:      []int64{1, 1, 2},
+			expected:   []int64{4, 4, 10},
+			totalLines: 3,
+		},
+		{
+			name:       "past end of file",
+			content:    "G28\nM84",
+			lines:      []int64{1, 2, 5},
+			expected:   []int64{4, 7, 7},
+			totalLines: 2,
+		},
+		{
+			name:       "long line",
+			content:    "; " + strings.Repeat("x", 10000) + "\nM84\n",
+			lines:      []int64{1, 1, 2},
+			expected:   []int64{10003, 10003, 10007},
+			totalLines: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			filePath := filepath.Join(t.TempDir(), "test.gcode")
+
+			err := os.WriteFile(filePath, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			positions, err := scanTestPositions(filePath, tt.lines[0]-1, tt.lines[1], tt.lines[2]-1)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			offsets := []int64{positions.BodyOffset, positions.EndPrintSectionOffset, positions.FooterOffset}
+			if !slices.Equal(offsets, tt.expected) {
+				t.Errorf("Expected offsets %v, got %v", tt.expected, offsets)
+			}
+
+			if positions.TotalLines != tt.totalLines {
+				t.Errorf("Expected %d lines, got %d", tt.totalLines, positions.TotalLines)
+			}
+		})
+	}
+}
+
+func TestStreamingProcessor_findMarkerPositions_Offsets(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "; next")
+
+	gcode := "G28\r\nSTART_PRINT\r\nG1 X1 Y1 E1\r\nEND_PRINT\r\nM84\r\n"
+
+	inputPath := filepath.Join(t.TempDir(), "input.gcode")
+
+	err := os.WriteFile(inputPath, []byte(gcode), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test content: %v", err)
+	}
+
+	processor, err := NewStreamingProcessor(ProcessingRequest{
+		Iterations:     1,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	positions, err := processor.findMarkerPositions(inputPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		offset int64
+		line   string
+	}{
+		{"BodyOffset", positions.BodyOffset, "G1 X1 Y1 E1\r\n"},
+		{"EndPrintSectionOffset", positions.EndPrintSectionOffset, "END_PRINT\r\n"},
+		{"FooterOffset", positions.FooterOffset, "M84\r\n"},
+	} {
+		if !strings.HasPrefix(gcode[tt.offset:], tt.line) {
+			t.Errorf("%s %d does not point at %q, found %q", tt.name, tt.offset, tt.line, gcode[tt.offset:])
+		}
+	}
+}
+
+func TestProcessFile_BedCooldownWithoutM190_TemplateDoesNotUseBedTemp(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	// G-code without M190 in init section
+	input := []string{
+		"M211 X0 Y0 Z0 ;turn off soft endstop",
+		"M1007 S1",
+		"G1 X50.0 Y50.0 E0.1",
+		"M625",
+	}
+
+	err := writeLinesToFile(inputPath, input)
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	// unit-tests-gcode2 template does not reference .Positions.BedTemp,
+	// so validation should be skipped even with cooldown enabled
+	config := ProcessingRequest{
+		Iterations:          2,
+		Printer:             "unit-tests-gcode2",
+		WaitBedCooldownTemp: 40,
+	}
+
+	processor, err := NewStreamingProcessor(config)
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	err = processor.ProcessFile(inputPath, outputPath)
+	if err != nil {
+		t.Fatalf("Expected no error for template without BedTemp reference, got: %v", err)
+	}
+}
+
+func TestProcessFile_BedCooldownWithoutM190_TemplateUsesBedTemp(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	// G-code without M190 in init section
+	input := []string{
+		"M211 X0 Y0 Z0 ;turn off soft endstop",
+		"M1007 S1",
+		"G1 X50.0 Y50.0 E0.1",
 		"M625",
 	}
 
@@ -1622,3 +2302,4554 @@ Code = """M190 S{{.Positions.BedTemp}}
 		t.Errorf("Expected error about M190 not found, got: %v", err)
 	}
 }
+
+func TestProcessFile_LineNumbers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		input      []string
+		parameters string
+		expected   []string
+	}{
+		{
+			name: "existing line numbers are stripped before matching",
+			input: []string{
+				"N1 HEADER*45",
+				"N2 START_PRINT*12",
+				"N3 BODY*95",
+				"N4 END_PRINT*33",
+				"N5 FOOTER*77",
+			},
+			expected: []string{
+				"HEADER",
+				"START_PRINT",
+				"BODY",
+				"END_PRINT",
+				"; Iteration 1",
+				"G4 S1",
+				"BODY",
+				"END_PRINT",
+				"; Iteration 2",
+				"G4 S1",
+				"FOOTER",
+			},
+		},
+		{
+			name: "comment header before numbered lines",
+			input: []string{
+				"; generated by slicer",
+				"N10 START_PRINT",
+				"N11 BODY",
+				"N12 END_PRINT",
+			},
+			expected: []string{
+				"; generated by slicer",
+				"START_PRINT",
+				"BODY",
+				"END_PRINT",
+				"; Iteration 1",
+				"G4 S1",
+				"BODY",
+				"END_PRINT",
+				"; Iteration 2",
+				"G4 S1",
+			},
+		},
+		{
+			name: "stripping disabled keeps prefixes",
+			input: []string{
+				"N1 START_PRINT",
+				"N2 BODY",
+				"N3 END_PRINT",
+			},
+			parameters: "StripLineNumbers = false",
+			expected: []string{
+				"N1 START_PRINT",
+				"N2 BODY",
+				"N3 END_PRINT",
+				"; Iteration 1",
+				"G4 S1",
+				"N2 BODY",
+				"N3 END_PRINT",
+				"; Iteration 2",
+				"G4 S1",
+			},
+		},
+		{
+			name: "output is renumbered sequentially when numbering is enabled",
+			input: []string{
+				"N7 START_PRINT*1",
+				"N8 BODY ; comment*2",
+				"N9 END_PRINT*3",
+			},
+			parameters: "LineNumbers = true",
+			expected: []string{
+				numberLine(1, "START_PRINT"),
+				numberLine(2, "BODY"),
+				numberLine(3, "END_PRINT"),
+				"; Iteration 1",
+				numberLine(4, "G4 S1"),
+				numberLine(5, "BODY"),
+				numberLine(6, "END_PRINT"),
+				"; Iteration 2",
+				numberLine(7, "G4 S1"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, tt.input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			config := ProcessingRequest{
+				Iterations:     2,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate(tt.parameters, "; Iteration {{.Iteration}}\nG4 S1"),
+			}
+
+			processor, err := NewStreamingProcessor(config)
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			actualOutput, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			if !equalStringSlices(actualOutput, tt.expected) {
+				t.Errorf("Output mismatch\nExpected:\n%s\nActual:\n%s",
+					strings.Join(tt.expected, "\n"),
+					strings.Join(actualOutput, "\n"))
+			}
+
+			_, statErr := os.Stat(outputPath + ".stripped")
+			if statErr == nil {
+				t.Errorf("Temporary stripped file should be removed")
+			}
+		})
+	}
+}
+
+func TestNumberLine(t *testing.T) {
+	t.Parallel()
+
+	// Checksum of "N1 G28" is 'N'^'1'^' '^'G'^'2'^'8' = 18
+	if got := numberLine(1, "G28"); got != "N1 G28*18" {
+		t.Errorf("Expected %q, got %q", "N1 G28*18", got)
+	}
+}
+
+func TestProcessFile_BodyHash(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	input := []string{"HEADER", "START_PRINT", "BODY1", "BODY2", "END_PRINT", "FOOTER"}
+
+	err := writeLinesToFile(inputPath, input)
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	customTemplate := testPrinterTemplate("BodyHash = true", "; Iteration {{.Iteration}}")
+
+	processor, err := NewStreamingProcessor(ProcessingRequest{
+		Iterations:     2,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	err = processor.ProcessFile(inputPath, outputPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	actualOutput, err := readLinesFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte("BODY1\nBODY2\n"))
+	expected := []string{
+		"HEADER",
+		"START_PRINT",
+		"; printloop body sha256: " + hex.EncodeToString(sum[:]),
+		"BODY1",
+		"BODY2",
+		"END_PRINT",
+		"; Iteration 1",
+		"BODY1",
+		"BODY2",
+		"END_PRINT",
+		"; Iteration 2",
+		"FOOTER",
+	}
+
+	if !equalStringSlices(actualOutput, expected) {
+		t.Errorf("Output mismatch\nExpected:\n%s\nActual:\n%s",
+			strings.Join(expected, "\n"),
+			strings.Join(actualOutput, "\n"))
+	}
+}
+
+func TestProcessFile_OutputSizeLimit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		iterations  int64
+		expectError bool
+	}{
+		{
+			name:       "small iteration count is accepted",
+			iterations: 3,
+		},
+		{
+			name:        "absurd iteration count is rejected",
+			iterations:  9223372036854775807,
+			expectError: true,
+		},
+		{
+			name:        "iteration count just above the limit is rejected",
+			iterations:  MaxOutputSize/int64(len("BODY\nEND_PRINT\n")) + 1,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "FOOTER"})
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations: tt.iterations,
+				Printer:    "unit-tests",
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+
+				if !strings.Contains(err.Error(), "iterations") {
+					t.Errorf("Expected iterations error, got: %v", err)
+				}
+
+				_, statErr := os.Stat(outputPath)
+				if statErr == nil {
+					t.Errorf("Output file should not exist when the size limit is exceeded")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestProcessFile_MultiRegion(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("MultiRegion = true", "; Iteration {{.Iteration}}")
+
+	tests := []struct {
+		name        string
+		input       []string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name: "two marker pairs are looped independently",
+			input: []string{
+				"HEADER",
+				"START_PRINT",
+				"BODY_A",
+				"END_PRINT",
+				"MIDDLE",
+				"START_PRINT",
+				"BODY_B",
+				"END_PRINT",
+				"FOOTER",
+			},
+			expected: []string{
+				"HEADER",
+				"START_PRINT",
+				"BODY_A",
+				"END_PRINT",
+				"; Iteration 1",
+				"BODY_A",
+				"END_PRINT",
+				"; Iteration 2",
+				"MIDDLE",
+				"START_PRINT",
+				"BODY_B",
+				"END_PRINT",
+				"; Iteration 1",
+				"BODY_B",
+				"END_PRINT",
+				"; Iteration 2",
+				"FOOTER",
+			},
+		},
+		{
+			name: "identical regions are not taken for a looped file",
+			input: []string{
+				"HEADER",
+				"START_PRINT",
+				"BODY",
+				"END_PRINT",
+				"MIDDLE",
+				"START_PRINT",
+				"BODY",
+				"END_PRINT",
+				"FOOTER",
+			},
+			expected: []string{
+				"HEADER",
+				"START_PRINT",
+				"BODY",
+				"END_PRINT",
+				"; Iteration 1",
+				"BODY",
+				"END_PRINT",
+				"; Iteration 2",
+				"MIDDLE",
+				"START_PRINT",
+				"BODY",
+				"END_PRINT",
+				"; Iteration 1",
+				"BODY",
+				"END_PRINT",
+				"; Iteration 2",
+				"FOOTER",
+			},
+		},
+		{
+			name: "single marker pair behaves like default mode",
+			input: []string{
+				"HEADER",
+				"START_PRINT",
+				"BODY",
+				"END_PRINT",
+				"FOOTER",
+			},
+			expected: []string{
+				"HEADER",
+				"START_PRINT",
+				"BODY",
+				"END_PRINT",
+				"; Iteration 1",
+				"BODY",
+				"END_PRINT",
+				"; Iteration 2",
+				"FOOTER",
+			},
+		},
+		{
+			name: "second region without end marker",
+			input: []string{
+				"START_PRINT",
+				"BODY_A",
+				"END_PRINT",
+				"START_PRINT",
+				"BODY_B",
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, tt.input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     2,
+				Printer:        "unit-tests",
+				CustomTemplate: customTemplate,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			actualOutput, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			if !equalStringSlices(actualOutput, tt.expected) {
+				t.Errorf("Output mismatch\nExpected:\n%s\nActual:\n%s",
+					strings.Join(tt.expected, "\n"),
+					strings.Join(actualOutput, "\n"))
+			}
+		})
+	}
+}
+
+func TestProcessFile_PrintSectionPosition(t *testing.T) {
+	t.Parallel()
+
+	earlyEndInput := []string{
+		"HEADER",
+		"START_PRINT",
+		"G1 X10 Y10 E1",
+		"END_PRINT",
+		"BODY1",
+		"BODY2",
+		"BODY3",
+		"BODY4",
+		"BODY5",
+		"BODY6",
+		"BODY7",
+	}
+
+	tests := []struct {
+		name           string
+		input          []string
+		parameters     string
+		expectError    bool
+		expectWarnings int
+	}{
+		{
+			name:       "check disabled by default",
+			input:      earlyEndInput,
+			parameters: "",
+		},
+		{
+			name:           "early end marker is reported as warning",
+			input:          earlyEndInput,
+			parameters:     "MinPrintSectionFraction = 0.5",
+			expectWarnings: 1,
+		},
+		{
+			name:        "early end marker is rejected in strict mode",
+			input:       earlyEndInput,
+			parameters:  "MinPrintSectionFraction = 0.5\nStrictPrintSectionPosition = true",
+			expectError: true,
+		},
+		{
+			name: "end marker late enough passes",
+			input: []string{
+				"HEADER",
+				"START_PRINT",
+				"BODY1",
+				"BODY2",
+				"BODY3",
+				"END_PRINT",
+				"FOOTER",
+			},
+			parameters: "MinPrintSectionFraction = 0.5\nStrictPrintSectionPosition = true",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, tt.input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     2,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate(tt.parameters, "; Iteration {{.Iteration}}"),
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+
+				if !strings.Contains(err.Error(), "suspiciously early") {
+					t.Errorf("Expected early marker error, got: %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(processor.Warnings()) != tt.expectWarnings {
+				t.Errorf("Expected %d warnings, got %v", tt.expectWarnings, processor.Warnings())
+			}
+		})
+	}
+}
+
+func TestProcessFile_EjectCommands(t *testing.T) {
+	t.Parallel()
+
+	const ejectCommands = `EjectCommands = """
+M400
+  EJECT_PLATE SPEED=50
+"""
+`
+
+	input := []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "FOOTER"}
+
+	tests := []struct {
+		name        string
+		parameters  string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name: "every iteration by default",
+			expected: []string{
+				"HEADER", "START_PRINT",
+				"BODY", "END_PRINT", "; Iteration 1", "M400", "EJECT_PLATE SPEED=50",
+				"BODY", "END_PRINT", "; Iteration 2", "M400", "EJECT_PLATE SPEED=50",
+				"FOOTER",
+			},
+		},
+		{
+			name:       "only at the end",
+			parameters: `EjectAt = "end"`,
+			expected: []string{
+				"HEADER", "START_PRINT",
+				"BODY", "END_PRINT", "; Iteration 1",
+				"BODY", "END_PRINT", "; Iteration 2",
+				"M400", "EJECT_PLATE SPEED=50",
+				"FOOTER",
+			},
+		},
+		{
+			name:        "invalid placement",
+			parameters:  `EjectAt = "layer"`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+				Iterations:     2,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate(ejectCommands+tt.parameters, "; Iteration {{.Iteration}}"),
+			})
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			lines, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			if !equalStringSlices(lines, tt.expected) {
+				t.Errorf("Output mismatch.\nExpected: %v\nGot: %v", tt.expected, lines)
+			}
+		})
+	}
+
+	t.Run("end of every chunk", func(t *testing.T) {
+		t.Parallel()
+
+		tempDir := t.TempDir()
+		inputPath := filepath.Join(tempDir, "input.gcode")
+		outputPath := filepath.Join(tempDir, "output.gcode")
+
+		err := writeLinesToFile(inputPath, input)
+		if err != nil {
+			t.Fatalf("Failed to write input file: %v", err)
+		}
+
+		chunkPaths, _, err := ProcessFileChunked(inputPath, outputPath, ProcessingRequest{
+			Iterations:      4,
+			ChunkIterations: 2,
+			Printer:         "unit-tests",
+			CustomTemplate:  testPrinterTemplate(ejectCommands+`EjectAt = "end"`, "; Iteration {{.Iteration}}"),
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		for _, chunkPath := range chunkPaths {
+			lines, err := readLinesFromFile(chunkPath)
+			if err != nil {
+				t.Fatalf("Failed to read chunk: %v", err)
+			}
+
+			tail := lines[len(lines)-3:]
+			if !equalStringSlices(tail, []string{"M400", "EJECT_PLATE SPEED=50", "FOOTER"}) || slices.Index(lines, "M400") != len(lines)-3 {
+				t.Errorf("Expected a single eject sequence before the footer of %s, got %v", chunkPath, lines)
+			}
+		}
+	})
+}
+
+func TestScanPositions_FirstLayerLastLine(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		lines    []string
+		expected int64
+	}{
+		{
+			name: "Cura layer comments",
+			lines: []string{
+				"M83", "START", ";LAYER:0", "G0 X10 Y10 Z0.2", "G1 X20 Y10 E1", "G1 X20 Y20 E1",
+				";LAYER:1", "G0 X10 Y10 Z0.4", "G1 X20 Y10 E1", "END",
+			},
+			expected: 5,
+		},
+		{
+			name: "PrusaSlicer layer comments",
+			lines: []string{
+				"M83", "START", ";LAYER_CHANGE", ";Z:0.2", "G1 Z0.2", "G1 X20 Y10 E1",
+				";LAYER_CHANGE", ";Z:0.4", "G1 Z0.4", "G1 X20 Y20 E1", "END",
+			},
+			expected: 5,
+		},
+		{
+			name: "Z increase without comments",
+			lines: []string{
+				"M82", "START", "G1 Z0.2", "G1 X20 Y10 E1", "G1 X20 Y20 E2", "G1 E1.5",
+				"G0 Z0.4", "G1 E2", "G1 X10 Y20 E3", "END",
+			},
+			expected: 5,
+		},
+		{
+			name: "Z hop is not a layer change",
+			lines: []string{
+				"M83", "START", "G1 Z0.2", "G1 X20 Y10 E1", "G0 Z0.6", "G0 X50 Y50", "G0 Z0.2",
+				"G1 X60 Y50 E1", "G0 Z0.4", "G1 X60 Y60 E1", "END",
+			},
+			expected: 7,
+		},
+		{
+			name: "Z increase in the header is ignored",
+			lines: []string{
+				"M83", "G1 Z5", "START", "G1 Z0.2", "G1 X20 Y10 E1", "G1 Z0.4", "G1 X20 Y20 E1", "END",
+			},
+			expected: 4,
+		},
+		{
+			name:     "single layer",
+			lines:    []string{"M83", "START", "G1 Z0.2", "G1 X20 Y10 E1", "G1 X20 Y20 E1", "END"},
+			expected: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			filePath := filepath.Join(t.TempDir(), "test.gcode")
+
+			err := writeLinesToFile(filePath, tt.lines)
+			if err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			end := int64(slices.Index(tt.lines, "END"))
+
+			positions, err := scanTestPositions(filePath, int64(slices.Index(tt.lines, "START")), end, end)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if positions.FirstLayerLastLine != tt.expected {
+				t.Errorf("Expected first layer to end at line %d (%q), got %d", tt.expected, tt.lines[tt.expected], positions.FirstLayerLastLine)
+			}
+		})
+	}
+}
+
+func TestProcessFile_EmptyBody(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "; next")
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"G28", "START_PRINT", "END_PRINT", "M84"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	err = ProcessFile(inputPath, outputPath, ProcessingRequest{Iterations: 2, Printer: "unit-tests", CustomTemplate: customTemplate})
+	if err == nil || !strings.Contains(err.Error(), "print body is empty between init and print markers") {
+		t.Errorf("Expected empty body error, got %v", err)
+	}
+}
+
+func TestProcessFile_EndMarkerBeforeInitMarker(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := `
+Name = "test-marker-order"
+[Markers]
+EndInitSection = ["START_PRINT"]
+EndPrintSection = ["END_PRINT"]
+[SearchStrategy]
+EndInitSectionStrategy = "after_last_appear"
+EndPrintSectionStrategy = "after_last_appear"
+[Template]
+Code = "; next"
+`
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"G28", "END_PRINT", "G1 X10 Y10 E1", "START_PRINT", "G1 X20 Y20 E1"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	err = ProcessFile(inputPath, outputPath, ProcessingRequest{Iterations: 2, Printer: "unit-tests", CustomTemplate: customTemplate})
+
+	expected := "end marker found before init marker: end marker at line 2 precedes the init marker at line 4"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error containing %q, got %v", expected, err)
+	}
+}
+
+// fixedStrategy reports fixed marker positions regardless of the file
+type fixedStrategy struct {
+	initFirst, initLast, printFirst, printLast int64
+}
+
+func (s fixedStrategy) FindInitSectionPosition(_ context.Context, _ string, _ []string) (int64, int64, error) {
+	return s.initFirst, s.initLast, nil
+}
+
+func (s fixedStrategy) FindPrintSectionPosition(_ context.Context, _ string, _ []string, _ int64) (int64, int64, error) {
+	return s.printFirst, s.printLast, nil
+}
+
+func TestFindMarkerPositions_Overlap(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"G28", "START_PRINT", "G1 X10 Y10 E1", "END_PRINT", "M84"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	processor, err := NewStreamingProcessor(ProcessingRequest{Iterations: 2, Printer: "unit-tests"})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	strategy := fixedStrategy{initFirst: 1, initLast: 3, printFirst: 3, printLast: 3}
+	processor.initStrategy = strategy
+	processor.printStrategy = strategy
+
+	_, err = processor.findMarkerPositions(inputPath)
+
+	expected := "markers overlap: init marker ends at line 4, at or after the end marker at line 4"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error containing %q, got %v", expected, err)
+	}
+}
+
+func TestProcessFile_LoopScope(t *testing.T) {
+	t.Parallel()
+
+	input := []string{
+		"M83", "START_PRINT",
+		";LAYER:0", "G1 Z0.2", "G1 X20 Y10 E1",
+		";LAYER:1", "G1 Z0.4", "G1 X20 Y20 E1",
+		";LAYER:2", "G1 Z0.6", "G1 X10 Y20 E1",
+		"END_PRINT", "M84",
+	}
+
+	tests := []struct {
+		name             string
+		loopScope        string
+		input            []string
+		expected         []string
+		expectedWarnings []string
+		expectError      bool
+	}{
+		{
+			name:      "full body",
+			loopScope: "full",
+			input:     input,
+			expected: []string{
+				"M83", "START_PRINT",
+				";LAYER:0", "G1 Z0.2", "G1 X20 Y10 E1", ";LAYER:1", "G1 Z0.4", "G1 X20 Y20 E1", ";LAYER:2", "G1 Z0.6", "G1 X10 Y20 E1",
+				"END_PRINT", "; Iteration 1",
+				";LAYER:0", "G1 Z0.2", "G1 X20 Y10 E1", ";LAYER:1", "G1 Z0.4", "G1 X20 Y20 E1", ";LAYER:2", "G1 Z0.6", "G1 X10 Y20 E1",
+				"END_PRINT", "; Iteration 2",
+				"M84",
+			},
+		},
+		{
+			name:      "first layer",
+			loopScope: "first_layer",
+			input:     input,
+			expected: []string{
+				"M83", "START_PRINT",
+				";LAYER:0", "G1 Z0.2", "G1 X20 Y10 E1",
+				"END_PRINT", "; Iteration 1",
+				";LAYER:0", "G1 Z0.2", "G1 X20 Y10 E1",
+				"END_PRINT", "; Iteration 2",
+				"M84",
+			},
+		},
+		{
+			name:      "first layer of a single layer print",
+			loopScope: "first_layer",
+			input:     []string{"M83", "START_PRINT", "G1 Z0.2", "G1 X20 Y10 E1", "END_PRINT"},
+			expected: []string{
+				"M83", "START_PRINT",
+				"G1 Z0.2", "G1 X20 Y10 E1", "END_PRINT", "; Iteration 1",
+				"G1 Z0.2", "G1 X20 Y10 E1", "END_PRINT", "; Iteration 2",
+			},
+			expectedWarnings: []string{"no layer change found in the body, LoopScope first_layer loops the whole body"},
+		},
+		{
+			name:        "invalid scope",
+			loopScope:   "last_layer",
+			input:       input,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, tt.input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     2,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate(fmt.Sprintf("LoopScope = %q", tt.loopScope), "; Iteration {{.Iteration}}"),
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			lines, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			if !equalStringSlices(lines, tt.expected) {
+				t.Errorf("Output mismatch.\nExpected: %v\nGot: %v", tt.expected, lines)
+			}
+
+			if !equalStringSlices(processor.Warnings(), tt.expectedWarnings) {
+				t.Errorf("Expected warnings %q, got %q", tt.expectedWarnings, processor.Warnings())
+			}
+		})
+	}
+}
+
+func TestProcessFile_EndMarkerMode(t *testing.T) {
+	t.Parallel()
+
+	input := []string{"M83", "START_PRINT", "G1 X20 Y10 E1", "END_PRINT", "M84"}
+
+	tests := []struct {
+		name          string
+		endMarkerMode string
+		expected      []string
+		expectError   bool
+	}{
+		{
+			name:          "every iteration",
+			endMarkerMode: "every_iteration",
+			expected: []string{
+				"M83", "START_PRINT",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 1",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 2",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 3",
+				"M84",
+			},
+		},
+		{
+			name:          "last only",
+			endMarkerMode: "last_only",
+			expected: []string{
+				"M83", "START_PRINT",
+				"G1 X20 Y10 E1", "; Iteration 1",
+				"G1 X20 Y10 E1", "; Iteration 2",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 3",
+				"M84",
+			},
+		},
+		{
+			name:          "invalid mode",
+			endMarkerMode: "first_only",
+			expectError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+				Iterations:     3,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate(fmt.Sprintf("EndMarkerMode = %q", tt.endMarkerMode), "; Iteration {{.Iteration}}"),
+			})
+
+			if tt.expectError {
+				if err == nil || !strings.Contains(err.Error(), "invalid EndMarkerMode value") {
+					t.Errorf("Expected EndMarkerMode error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			lines, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			if !equalStringSlices(lines, tt.expected) {
+				t.Errorf("Output mismatch.\nExpected: %v\nGot: %v", tt.expected, lines)
+			}
+		})
+	}
+
+	t.Run("last only per chunk", func(t *testing.T) {
+		t.Parallel()
+
+		tempDir := t.TempDir()
+		inputPath := filepath.Join(tempDir, "input.gcode")
+		outputPath := filepath.Join(tempDir, "output.gcode")
+
+		err := writeLinesToFile(inputPath, input)
+		if err != nil {
+			t.Fatalf("Failed to write input file: %v", err)
+		}
+
+		chunkPaths, _, err := ProcessFileChunked(inputPath, outputPath, ProcessingRequest{
+			Iterations:      4,
+			ChunkIterations: 2,
+			Printer:         "unit-tests",
+			CustomTemplate:  testPrinterTemplate(`EndMarkerMode = "last_only"`, "; Iteration {{.Iteration}}"),
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(chunkPaths) != 2 {
+			t.Fatalf("Expected 2 chunks, got %v", chunkPaths)
+		}
+
+		expected := [][]string{
+			{
+				"M83", "START_PRINT",
+				"G1 X20 Y10 E1", "; Iteration 1",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 2",
+				"M84",
+			},
+			{
+				"M83", "START_PRINT",
+				"G1 X20 Y10 E1", "; Iteration 3",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 4",
+				"M84",
+			},
+		}
+
+		for i, chunkPath := range chunkPaths {
+			lines, err := readLinesFromFile(chunkPath)
+			if err != nil {
+				t.Fatalf("Failed to read chunk: %v", err)
+			}
+
+			if !equalStringSlices(lines, expected[i]) {
+				t.Errorf("Chunk %d mismatch.\nExpected: %v\nGot: %v", i+1, expected[i], lines)
+			}
+		}
+	})
+}
+
+func TestProcessFile_IterationOffset(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		bed      string
+		expected []string
+	}{
+		{
+			name:     "scales with iteration",
+			expected: []string{"SET_GCODE_OFFSET X=20 Y=-5", "SET_GCODE_OFFSET X=40 Y=-10", "SET_GCODE_OFFSET X=60 Y=-15"},
+		},
+		{
+			name:     "kept on the bed",
+			bed:      "[Bed]\nX = 100\nY = 100",
+			expected: []string{"SET_GCODE_OFFSET X=20 Y=-5", "SET_GCODE_OFFSET X=40 Y=-10", "SET_GCODE_OFFSET X=50 Y=-10"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, []string{"START_PRINT", "G1 X10 Y10 E1", "G1 X50 Y50 E1", "END_PRINT"})
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+				Iterations:     3,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate("PerIterationOffsetX = 20\nPerIterationOffsetY = -5\n"+tt.bed, "SET_GCODE_OFFSET X={{.IterationOffsetX}} Y={{.IterationOffsetY}}"),
+			})
+			if err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+
+			lines, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			var offsets []string
+
+			for _, line := range lines {
+				if strings.HasPrefix(line, "SET_GCODE_OFFSET") {
+					offsets = append(offsets, line)
+				}
+			}
+
+			if !equalStringSlices(offsets, tt.expected) {
+				t.Errorf("Expected offsets %v, got %v", tt.expected, offsets)
+			}
+		})
+	}
+}
+
+func TestLimitOffset(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name                       string
+		offset, lo, hi, size, want float64
+	}{
+		{name: "unknown bed", offset: 500, lo: 10, hi: 50, size: 0, want: 500},
+		{name: "within bed", offset: 30, lo: 10, hi: 50, size: 100, want: 30},
+		{name: "past the far edge", offset: 80, lo: 10, hi: 50, size: 100, want: 50},
+		{name: "past the near edge", offset: -30, lo: 10, hi: 50, size: 100, want: -10},
+		{name: "model larger than bed", offset: 10, lo: 0, hi: 120, size: 100, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := limitOffset(tt.offset, tt.lo, tt.hi, tt.size)
+			if got != tt.want {
+				t.Errorf("limitOffset(%v, %v, %v, %v) = %v, want %v", tt.offset, tt.lo, tt.hi, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessFile_IterationSeparator(t *testing.T) {
+	t.Parallel()
+
+	input := []string{"M83", "START_PRINT", "G1 X20 Y10 E1", "END_PRINT", "M84"}
+
+	tests := []struct {
+		name       string
+		parameters string
+		expected   []string
+	}{
+		{
+			name: "no separator by default",
+			expected: []string{
+				"M83", "START_PRINT",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 1",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 2",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 3",
+				"M84",
+			},
+		},
+		{
+			name:       "comment line",
+			parameters: `IterationSeparator = "; ----"`,
+			expected: []string{
+				"M83", "START_PRINT",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 1",
+				"; ----",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 2",
+				"; ----",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 3",
+				"M84",
+			},
+		},
+		{
+			name:       "blank line",
+			parameters: `IterationSeparator = "\n"`,
+			expected: []string{
+				"M83", "START_PRINT",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 1",
+				"",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 2",
+				"",
+				"G1 X20 Y10 E1", "END_PRINT", "; Iteration 3",
+				"M84",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+				Iterations:     3,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate(tt.parameters, "; Iteration {{.Iteration}}"),
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			lines, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			if !equalStringSlices(lines, tt.expected) {
+				t.Errorf("Output mismatch.\nExpected: %v\nGot: %v", tt.expected, lines)
+			}
+		})
+	}
+}
+
+func TestNewStreamingProcessor_StrategyOverride(t *testing.T) {
+	t.Parallel()
+
+	processor, err := NewStreamingProcessor(ProcessingRequest{Iterations: 1, Printer: "unit-tests", PrintStrategy: "after_first_appear"})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	if processor.printerDef.SearchStrategy.EndPrintSectionStrategy != "after_first_appear" {
+		t.Errorf("Expected print strategy override, got %q", processor.printerDef.SearchStrategy.EndPrintSectionStrategy)
+	}
+
+	if processor.printerDef.SearchStrategy.EndInitSectionStrategy != "after_first_appear" {
+		t.Errorf("Expected printer's init strategy, got %q", processor.printerDef.SearchStrategy.EndInitSectionStrategy)
+	}
+
+	_, err = NewStreamingProcessor(ProcessingRequest{Iterations: 1, Printer: "unit-tests", InitStrategy: "middle"})
+	if err == nil || !strings.HasPrefix(err.Error(), `invalid init strategy value "middle"`) {
+		t.Errorf("Expected invalid init strategy error, got %v", err)
+	}
+}
+
+func TestProcessFile_AlreadyLooped(t *testing.T) {
+	t.Parallel()
+
+	stampTemplate := testPrinterTemplate("StampHeader = true", "; Iteration {{.Iteration}}")
+
+	input := []string{"; generated by slicer", "G28", "START_PRINT", "G1 X10 Y10 E1", "G1 X20 Y10 E1", "END_PRINT", "M84"}
+
+	tests := []struct {
+		name           string
+		customTemplate string
+		expectedReason string
+	}{
+		{
+			name:           "stamped",
+			customTemplate: stampTemplate,
+			expectedReason: "line 2 was written by printloop",
+		},
+		{
+			name:           "unstamped",
+			expectedReason: "the body is repeated before a second end marker",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			loopedPath := filepath.Join(tempDir, "looped.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			request := ProcessingRequest{Iterations: 2, Printer: "unit-tests", CustomTemplate: tt.customTemplate}
+
+			err = ProcessFile(inputPath, loopedPath, request)
+			if err != nil {
+				t.Fatalf("Processing the original failed: %v", err)
+			}
+
+			err = ProcessFile(loopedPath, outputPath, request)
+			if !errors.Is(err, ErrAlreadyLooped) || !strings.Contains(err.Error(), tt.expectedReason) {
+				t.Errorf("Expected already looped error with %q, got %v", tt.expectedReason, err)
+			}
+
+			request.Force = true
+
+			err = ProcessFile(loopedPath, outputPath, request)
+			if err != nil {
+				t.Errorf("Expected forced processing to succeed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProcessFile_MarkerNotFoundError(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := `
+Name = "test-marker-error"
+[Markers]
+EndInitSection = ["START_PRINT"]
+EndPrintSection = ["M400", "M1002 END", "M625"]
+[SearchStrategy]
+EndInitSectionStrategy = "after_first_appear"
+EndPrintSectionStrategy = "after_last_appear"
+[Template]
+Code = "; next"
+`
+
+	tests := []struct {
+		name     string
+		input    []string
+		expected string
+	}{
+		{
+			name:     "partial multiline match",
+			input:    []string{"HEADER", "START_PRINT", "G1 X10 Y10 E1", "M400", "; finishing", "M1002 END", "G1 X0 Y0", "M84"},
+			expected: `print section: end marker not found in lines 3-8: ["M400" "M1002 END" "M625"]; matched first 2 of 3 marker lines at line 4`,
+		},
+		{
+			name:     "no marker line at all",
+			input:    []string{"HEADER", "START_PRINT", "G1 X10 Y10 E1", "M84"},
+			expected: `print section: end marker not found in lines 3-4: ["M400" "M1002 END" "M625"]`,
+		},
+		{
+			name:     "missing start marker",
+			input:    []string{"HEADER", "G1 X10 Y10 E1", "M84"},
+			expected: `init section: start marker not found in lines 1-3: ["START_PRINT"]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+
+			err := writeLinesToFile(inputPath, tt.input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, filepath.Join(tempDir, "output.gcode"), ProcessingRequest{
+				Iterations:     2,
+				Printer:        "unit-tests",
+				CustomTemplate: customTemplate,
+			})
+			if err == nil || !strings.HasSuffix(err.Error(), tt.expected) {
+				t.Errorf("Expected error ending with %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestScanPositions_BodyExtrusionLength(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		lines    []string
+		expected float64
+	}{
+		{
+			name:     "relative extrusion skips retractions",
+			lines:    []string{"M83", "G1 E5", "START", "G1 X10 E1.5", "G1 E-0.8", "G0 X20", "G1 E0.8", "G1 X30 E2.25", "END"},
+			expected: 4.55,
+		},
+		{
+			name:     "absolute extrusion sums growth",
+			lines:    []string{"M82", "G92 E0", "G1 E3", "START", "G1 X10 E4", "G1 X20 E6.5", "G1 E5.7", "G1 E6.5", "G1 X30 E7", "END"},
+			expected: 4.8,
+		},
+		{
+			name:     "absolute extrusion with reset",
+			lines:    []string{"M82", "START", "G1 X10 E2", "G92 E0", "G1 X20 E1.5", "END", "G1 E9"},
+			expected: 3.5,
+		},
+		{
+			name:     "mode switch in body",
+			lines:    []string{"M82", "START", "G1 X10 E2", "M83", "G1 X20 E1", "END"},
+			expected: 3,
+		},
+		{
+			name:  "no extrusion",
+			lines: []string{"START", "G0 X10", "END"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			filePath := filepath.Join(t.TempDir(), "test.gcode")
+
+			err := writeLinesToFile(filePath, tt.lines)
+			if err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			end := int64(slices.Index(tt.lines, "END"))
+
+			positions, err := scanTestPositions(filePath, int64(slices.Index(tt.lines, "START")), end, end)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if math.Abs(positions.BodyExtrusionLength-tt.expected) > 1e-9 {
+				t.Errorf("Expected extrusion length %v, got %v", tt.expected, positions.BodyExtrusionLength)
+			}
+		})
+	}
+}
+
+func TestScanPositions_MoveParsing(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name                string
+		lines               []string
+		lastX, lastY, lastZ float64
+	}{
+		{
+			name:  "comment words are not coordinates",
+			lines: []string{"M83", "START", "G1 Z0.2", "G1 X10 Y20 E1", "END", "G1 E0.5 ; wipe to X99 Y99 Z9"},
+			lastX: 10,
+			lastY: 20,
+			lastZ: 0.2,
+		},
+		{
+			name:  "G10 is not a move",
+			lines: []string{"M83", "START", "G1 Z0.2", "G1 X10 Y20 E1", "END", "G10 P0 Z5", "G11", "G1 X30 Y40 E1"},
+			lastX: 30,
+			lastY: 40,
+			lastZ: 0.2,
+		},
+		{
+			name:  "G0 moves extrude after the end marker",
+			lines: []string{"M82", "G92 E0", "START", "G1 Z0.2", "G1 X10 Y20 E1", "END", "G0 Z0.4", "G0 X30 Y40 E2"},
+			lastX: 30,
+			lastY: 40,
+			lastZ: 0.4,
+		},
+		{
+			name:  "extrusion mode carries over the end marker",
+			lines: []string{"M82", "G92 E0", "START", "G1 Z0.2", "G1 X10 Y20 E5", "END", "G1 X30 Y40 E4"},
+			lastX: 10,
+			lastY: 20,
+			lastZ: 0.2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			filePath := filepath.Join(t.TempDir(), "test.gcode")
+
+			err := writeLinesToFile(filePath, tt.lines)
+			if err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			end := int64(slices.Index(tt.lines, "END"))
+
+			positions, err := scanTestPositions(filePath, int64(slices.Index(tt.lines, "START")), end, end)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if positions.LastPrintX != tt.lastX || positions.LastPrintY != tt.lastY || positions.LastPrintZ != tt.lastZ {
+				t.Errorf("Expected last print at (%v, %v, %v), got (%v, %v, %v)", tt.lastX, tt.lastY, tt.lastZ,
+					positions.LastPrintX, positions.LastPrintY, positions.LastPrintZ)
+			}
+		})
+	}
+}
+
+func TestProcessFile_BodyExtrusionLength(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", `G1 E{{printf "%.2f" (mulf .Positions.BodyExtrusionLength 0.1)}} ; purge`)
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"M83", "START_PRINT", "G1 X10 Y10 E12", "G1 X20 Y10 E13", "END_PRINT"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	err = ProcessFile(inputPath, outputPath, ProcessingRequest{Iterations: 1, Printer: "unit-tests", CustomTemplate: customTemplate})
+	if err != nil {
+		t.Fatalf("ProcessFile failed: %v", err)
+	}
+
+	lines, err := readLinesFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	if !slices.Contains(lines, "G1 E2.50 ; purge") {
+		t.Errorf("Expected purge of 10%% of 25 mm, got %v", lines)
+	}
+}
+
+func TestProcessFile_IntegerParameters(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("HotendTemp = 200\nPushY = 0\nBackY = 179.99", "M104 S{{.Config.HotendTemp}}\nG1 Y{{.Config.PushY}}\nG1 Y{{.Config.BackY}}\nG1 Y{{add .Config.PushY 5}}")
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"START_PRINT", "BODY", "END_PRINT"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+		Iterations:     1,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	})
+	if err != nil {
+		t.Fatalf("ProcessFile failed: %v", err)
+	}
+
+	lines, err := readLinesFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	expected := []string{"START_PRINT", "BODY", "END_PRINT", "M104 S200", "G1 Y0", "G1 Y179.99", "G1 Y5"}
+	if !equalStringSlices(lines, expected) {
+		t.Errorf("Output mismatch.\nExpected: %v\nGot: %v", expected, lines)
+	}
+}
+
+func TestProcessFile_StripThumbnails(t *testing.T) {
+	t.Parallel()
+
+	input := []string{
+		"; thumbnail begin 16x16 20",
+		"; iVBORw0KGgo",
+		"; thumbnail end",
+		"START_PRINT",
+		"G1 X1 Y1 E1",
+		"; THUMBNAIL_BLOCK_START",
+		"; thumbnail begin 32x32 40",
+		"; AAAABBBB",
+		"; thumbnail end",
+		"; THUMBNAIL_BLOCK_END",
+		"; thumbnail_QOI begin 16x16 8",
+		"; cW9pZg==",
+		"; thumbnail_QOI end",
+		"G1 X2 Y2 E1",
+		"END_PRINT",
+		"FOOTER",
+	}
+
+	body := input[4:14]
+
+	tests := []struct {
+		name       string
+		parameters string
+		expected   []string
+	}{
+		{
+			name: "disabled by default",
+			expected: slices.Concat(input[:4],
+				body, []string{"END_PRINT", "; Iteration 1"},
+				body, []string{"END_PRINT", "; Iteration 2"},
+				body, []string{"END_PRINT", "; Iteration 3"},
+				[]string{"FOOTER"}),
+		},
+		{
+			name:       "body thumbnails emitted once",
+			parameters: "StripThumbnails = true",
+			expected: slices.Concat(input[:4],
+				body, []string{"END_PRINT", "; Iteration 1"},
+				[]string{"G1 X1 Y1 E1", "G1 X2 Y2 E1", "END_PRINT", "; Iteration 2"},
+				[]string{"G1 X1 Y1 E1", "G1 X2 Y2 E1", "END_PRINT", "; Iteration 3"},
+				[]string{"FOOTER"}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+				Iterations:     3,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate(tt.parameters, "; Iteration {{.Iteration}}"),
+			})
+			if err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+
+			lines, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			if !equalStringSlices(lines, tt.expected) {
+				t.Errorf("Output mismatch.\nExpected: %v\nGot: %v", tt.expected, lines)
+			}
+		})
+	}
+}
+
+func TestProcessFile_MaxIterations(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("MaxIterations = 100", "; Iteration {{.Iteration}}")
+
+	tests := []struct {
+		name        string
+		template    string
+		iterations  int64
+		expectError bool
+	}{
+		{name: "at limit", template: customTemplate, iterations: 100},
+		{name: "over limit", template: customTemplate, iterations: 101, expectError: true},
+		{name: "no limit", template: strings.Replace(customTemplate, "MaxIterations = 100", "", 1), iterations: 101},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "FOOTER"})
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+				Iterations:     tt.iterations,
+				Printer:        "unit-tests",
+				CustomTemplate: tt.template,
+			})
+
+			if tt.expectError {
+				if err == nil || !strings.Contains(err.Error(), "limit of 100") {
+					t.Errorf("Expected error naming the limit of 100, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestProcessFile_MinBodyLines(t *testing.T) {
+	t.Parallel()
+
+	tinyBodyInput := []string{
+		"HEADER",
+		"START_PRINT",
+		"BODY1",
+		"BODY2",
+		"END_PRINT",
+		"FOOTER",
+	}
+
+	tests := []struct {
+		name           string
+		input          []string
+		parameters     string
+		expectError    bool
+		expectWarnings int
+	}{
+		{
+			name:       "check disabled by default",
+			input:      tinyBodyInput,
+			parameters: "",
+		},
+		{
+			name:           "tiny body is reported as warning",
+			input:          tinyBodyInput,
+			parameters:     "MinBodyLines = 3",
+			expectWarnings: 1,
+		},
+		{
+			name:        "tiny body is rejected in strict mode",
+			input:       tinyBodyInput,
+			parameters:  "MinBodyLines = 3\nStrictBodyLines = true",
+			expectError: true,
+		},
+		{
+			name:       "body at threshold passes",
+			input:      tinyBodyInput,
+			parameters: "MinBodyLines = 2\nStrictBodyLines = true",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, tt.input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     1000,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate(tt.parameters, "; Iteration {{.Iteration}}"),
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+
+				if !strings.Contains(err.Error(), "check that the start and end markers") {
+					t.Errorf("Expected body length error, got: %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(processor.Warnings()) != tt.expectWarnings {
+				t.Errorf("Expected %d warnings, got %v", tt.expectWarnings, processor.Warnings())
+			}
+		})
+	}
+}
+
+func TestProcessFile_StampHeader(t *testing.T) {
+	t.Parallel()
+
+	input := []string{
+		"; generated by PrusaSlicer 2.8.0",
+		"; estimated printing time = 1m",
+		"G28",
+		"START_PRINT",
+		"G1 X10 Y10 E1",
+		"END_PRINT",
+		"FOOTER",
+	}
+
+	process := func(t *testing.T, parameters string) []string {
+		t.Helper()
+
+		tempDir := t.TempDir()
+		inputPath := filepath.Join(tempDir, "input.gcode")
+		outputPath := filepath.Join(tempDir, "output.gcode")
+
+		err := writeLinesToFile(inputPath, input)
+		if err != nil {
+			t.Fatalf("Failed to write input file: %v", err)
+		}
+
+		processor, err := NewStreamingProcessor(ProcessingRequest{
+			Iterations:     2,
+			Printer:        "unit-tests",
+			CustomTemplate: testPrinterTemplate(parameters, "; Iteration {{.Iteration}}"),
+		})
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+
+		err = processor.ProcessFile(inputPath, outputPath)
+		if err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+
+		output, err := readLinesFromFile(outputPath)
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+
+		return output
+	}
+
+	plain := process(t, "")
+	stamped := process(t, "StampHeader = true")
+
+	if len(stamped) != len(plain)+1 {
+		t.Fatalf("Expected exactly one extra line, got %d vs %d lines", len(stamped), len(plain))
+	}
+
+	if !strings.HasPrefix(stamped[2], "; processed by printloop: 2 iterations, printer test-printer, ") {
+		t.Errorf("Expected stamp after the slicer header, got line %q", stamped[2])
+	}
+
+	withoutStamp := append(slices.Clone(stamped[:2]), stamped[3:]...)
+	if !equalStringSlices(withoutStamp, plain) {
+		t.Errorf("Stamp changed the rest of the output:\nExpected: %v\nGot: %v", plain, withoutStamp)
+	}
+}
+
+func TestProcessFile_StartMessage(t *testing.T) {
+	t.Parallel()
+
+	input := []string{
+		"HEADER",
+		"START_PRINT",
+		"G1 X10 Y10 E1",
+		"END_PRINT",
+		"FOOTER",
+	}
+
+	tests := []struct {
+		name       string
+		parameters string
+		expected   string
+	}{
+		{
+			name:       "disabled by default",
+			parameters: "",
+		},
+		{
+			name:       "iterations and printer",
+			parameters: `StartMessage = "x{iterations} {printer}"`,
+			expected:   "M117 x50 test-printer",
+		},
+		{
+			name:       "truncated to default length",
+			parameters: `StartMessage = "Looping {iterations} times on {printer}"`,
+			expected:   "M117 Looping 50 times on",
+		},
+		{
+			name:       "custom length",
+			parameters: "StartMessage = \"Loop x{iterations}\"\nStartMessageMaxLength = 6",
+			expected:   "M117 Loop x",
+		},
+		{
+			name:       "comment prefix and non-ASCII dropped",
+			parameters: `StartMessage = "Loop; x{iterations} ✓"`,
+			expected:   "M117 Loop x50",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     50,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate(tt.parameters, "; Iteration {{.Iteration}}"),
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+			if err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+
+			output, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			var messages []string
+
+			for _, line := range output {
+				if strings.HasPrefix(line, "M117") {
+					messages = append(messages, line)
+				}
+			}
+
+			if tt.expected == "" {
+				if len(messages) != 0 {
+					t.Errorf("Expected no M117, got %v", messages)
+				}
+
+				return
+			}
+
+			if len(messages) != 1 || messages[0] != tt.expected {
+				t.Errorf("Expected exactly one %q, got %v", tt.expected, messages)
+			}
+
+			if slices.Index(output, tt.expected) != slices.Index(output, "START_PRINT")+1 {
+				t.Errorf("Expected M117 right after the init section, got %v", output)
+			}
+		})
+	}
+}
+
+func TestProcessFile_WaitCommand(t *testing.T) {
+	t.Parallel()
+
+	input := []string{
+		"HEADER",
+		"START_PRINT",
+		"G1 X10 Y10 E1",
+		"END_PRINT",
+		"FOOTER",
+	}
+
+	tests := []struct {
+		name       string
+		waitMin    int64
+		parameters string
+		code       string
+		expected   string
+	}{
+		{
+			name:    "no wait when zero",
+			waitMin: 0,
+			code:    "; Iteration {{.Iteration}}",
+		},
+		{
+			name:     "default dwell",
+			waitMin:  2,
+			code:     "; Iteration {{.Iteration}}",
+			expected: "G4 S120",
+		},
+		{
+			name:       "custom wait command",
+			waitMin:    3,
+			parameters: `WaitCommand = "M0 S{seconds} ; wait {minutes} min"`,
+			code:       "; Iteration {{.Iteration}}",
+			expected:   "M0 S180 ; wait 3 min",
+		},
+		{
+			name:     "template helper places the wait",
+			waitMin:  1,
+			code:     "; Iteration {{.Iteration}}\n{{wait .Request.WaitMin}}",
+			expected: "G4 S60",
+		},
+		{
+			name:    "template helper without wait",
+			waitMin: 0,
+			code:    "; Iteration {{.Iteration}}\n{{wait .Request.WaitMin}}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     3,
+				WaitMin:        tt.waitMin,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate(tt.parameters, tt.code),
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+			if err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+
+			output, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			waits := 0
+
+			for _, line := range output {
+				if strings.HasPrefix(line, "G4") || strings.HasPrefix(line, "M0") {
+					waits++
+
+					if line != tt.expected {
+						t.Errorf("Expected wait %q, got %q", tt.expected, line)
+					}
+				}
+			}
+
+			expectedWaits := 0
+			if tt.expected != "" {
+				expectedWaits = 3
+			}
+
+			if waits != expectedWaits {
+				t.Errorf("Expected %d waits, got %d in %v", expectedWaits, waits, output)
+			}
+		})
+	}
+}
+
+func TestProcessFile_BedCooldownCommand(t *testing.T) {
+	t.Parallel()
+
+	input := []string{
+		"HEADER",
+		"START_PRINT",
+		"G1 X10 Y10 E1",
+		"END_PRINT",
+		"FOOTER",
+	}
+
+	tests := []struct {
+		name       string
+		bedTemp    int64
+		waitMin    int64
+		parameters string
+		code       string
+		expected   []string
+	}{
+		{
+			name:     "no cooldown when zero",
+			code:     "; Iteration {{.Iteration}}",
+			expected: []string{"; Iteration 1", "; Iteration 2"},
+		},
+		{
+			name:     "default cooldown command",
+			bedTemp:  35,
+			code:     "; Iteration {{.Iteration}}",
+			expected: []string{"M190 R35", "; Iteration 1", "M190 R35", "; Iteration 2"},
+		},
+		{
+			name:       "custom cooldown command",
+			bedTemp:    40,
+			parameters: `BedCooldownCommand = "M191 R{temp} ; cool to {temp}"`,
+			code:       "; Iteration {{.Iteration}}",
+			expected:   []string{"M191 R40 ; cool to 40", "; Iteration 1", "M191 R40 ; cool to 40", "; Iteration 2"},
+		},
+		{
+			name:     "cooldown before dwell",
+			bedTemp:  35,
+			waitMin:  1,
+			code:     "; Iteration {{.Iteration}}",
+			expected: []string{"M190 R35", "G4 S60", "; Iteration 1", "M190 R35", "G4 S60", "; Iteration 2"},
+		},
+		{
+			name:     "template helper places the cooldown",
+			bedTemp:  45,
+			code:     "; Iteration {{.Iteration}}\n{{bedCooldown .Request.WaitBedCooldownTemp}}",
+			expected: []string{"; Iteration 1", "M190 R45", "; Iteration 2", "M190 R45"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:          2,
+				WaitBedCooldownTemp: tt.bedTemp,
+				WaitMin:             tt.waitMin,
+				Printer:             "unit-tests",
+				CustomTemplate:      testPrinterTemplate(tt.parameters, tt.code),
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+			if err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+
+			output, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			var generated []string
+
+			for _, line := range output {
+				if strings.HasPrefix(line, "; Iteration") || strings.HasPrefix(line, "M19") || strings.HasPrefix(line, "G4") {
+					generated = append(generated, line)
+				}
+			}
+
+			if !equalStringSlices(generated, tt.expected) {
+				t.Errorf("Generated lines mismatch:\nExpected: %v\nGot: %v", tt.expected, generated)
+			}
+		})
+	}
+}
+
+func TestProcessFile_EmptyTemplateOutput(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		code           string
+		chunked        bool
+		expectWarnings int
+	}{
+		{name: "renders empty", code: "{{if false}}G1 Y200{{end}}", expectWarnings: 1},
+		{name: "renders whitespace", code: "  {{/* nothing */}}  ", expectWarnings: 1},
+		{name: "renders empty in chunks", code: "{{if false}}G1 Y200{{end}}", chunked: true, expectWarnings: 1},
+		{name: "renders only for first iteration", code: "{{if eq .Iteration 1}}G1 Y200{{end}}"},
+		{name: "renders every iteration", code: "G1 Y200"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "FOOTER"})
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			config := ProcessingRequest{
+				Iterations:     3,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate("", tt.code),
+			}
+			if tt.chunked {
+				config.ChunkIterations = 1
+			}
+
+			processor, err := NewStreamingProcessor(config)
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			if tt.chunked {
+				_, err = processor.ProcessFileChunked(inputPath, outputPath)
+			} else {
+				err = processor.ProcessFile(inputPath, outputPath)
+			}
+
+			if err != nil {
+				t.Fatalf("Processing failed: %v", err)
+			}
+
+			warnings := processor.Warnings()
+			if len(warnings) != tt.expectWarnings {
+				t.Fatalf("Expected %d warnings, got %v", tt.expectWarnings, warnings)
+			}
+
+			if tt.expectWarnings > 0 && !strings.Contains(warnings[0], "template produced no generated code") {
+				t.Errorf("Unexpected warning: %s", warnings[0])
+			}
+		})
+	}
+}
+
+func TestRenderGeneratedBlock(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("BackY = 200.5", `; {{.PrinterName}} iteration {{.Iteration}} of {{.Request.Iterations}}
+G1 Y{{.Config.BackY}}
+G1 X{{printf "%.1f" .Positions.AveragePrintX}} Z{{add .Positions.LastPrintZ 1}}
+{{if gt .Request.WaitMin 0}}; wait {{.Request.WaitMin}}{{end}}`)
+
+	block, err := RenderGeneratedBlock(ProcessingRequest{
+		Iterations:     4,
+		WaitMin:        2,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	}, MarkerPositions{AveragePrintX: 12.34, LastPrintZ: 5})
+	if err != nil {
+		t.Fatalf("RenderGeneratedBlock failed: %v", err)
+	}
+
+	expected := "; test-printer iteration 1 of 4\nG1 Y200.5\nG1 X12.3 Z6\n; wait 2\n"
+	if block != expected {
+		t.Errorf("Expected block %q, got %q", expected, block)
+	}
+
+	_, err = RenderGeneratedBlock(ProcessingRequest{
+		Iterations:     1,
+		Printer:        "unit-tests",
+		CustomTemplate: strings.Replace(customTemplate, ".Positions.AveragePrintX", ".Positions.Missing", 1),
+	}, MarkerPositions{})
+	if err == nil {
+		t.Error("Expected error for a template referencing an unknown field")
+	}
+}
+
+func TestTemplateFunctions_MinClamp(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("BedX = 256\nMaxZ = 250", "G1 Z{{min (add .Positions.LastPrintZ 10) .Config.MaxZ}}\nG1 X{{clamp (add .Positions.MaxPrintX 20) 0 .Config.BedX}} Y{{clamp (sub .Positions.MinPrintY 20) 0 .Config.BedX}}")
+
+	tests := []struct {
+		name      string
+		positions MarkerPositions
+		expected  string
+	}{
+		{
+			name:      "within bounds",
+			positions: MarkerPositions{LastPrintZ: 20, MaxPrintX: 100, MinPrintY: 50},
+			expected:  "G1 Z30\nG1 X120 Y30\n",
+		},
+		{
+			name:      "at bounds",
+			positions: MarkerPositions{LastPrintZ: 240, MaxPrintX: 236, MinPrintY: 20},
+			expected:  "G1 Z250\nG1 X256 Y0\n",
+		},
+		{
+			name:      "beyond bounds",
+			positions: MarkerPositions{LastPrintZ: 245.5, MaxPrintX: 250, MinPrintY: 5},
+			expected:  "G1 Z250\nG1 X256 Y0\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			block, err := RenderGeneratedBlock(ProcessingRequest{
+				Iterations:     1,
+				Printer:        "unit-tests",
+				CustomTemplate: customTemplate,
+			}, tt.positions)
+			if err != nil {
+				t.Fatalf("RenderGeneratedBlock failed: %v", err)
+			}
+
+			if block != tt.expected {
+				t.Errorf("Expected block %q, got %q", tt.expected, block)
+			}
+		})
+	}
+}
+
+func TestProcessFile_TemplateOutputLimit(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "{{range 1000000}}G1 X10 Y10 E0.1\n{{end}}")
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"START_PRINT", "G1 X10 Y10 E1", "END_PRINT"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	err = ProcessFile(inputPath, outputPath, ProcessingRequest{Iterations: 2, Printer: "unit-tests", CustomTemplate: customTemplate})
+	if !errors.Is(err, errTemplateOutputTooLarge) {
+		t.Errorf("Expected template output error, got %v", err)
+	}
+}
+
+// TestProcessFile_TemplateTimeout changes templateTimeout and therefore doesn't run in parallel
+func TestProcessFile_TemplateTimeout(t *testing.T) {
+	templateTimeout = time.Millisecond
+
+	t.Cleanup(func() { templateTimeout = 5 * time.Second })
+
+	// Empty writes never reach the output limit, the loop limit isn't reached within the timeout
+	customTemplate := testPrinterTemplate("", `{{range 1000000000000}}{{""}}{{end}}`)
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"START_PRINT", "G1 X10 Y10 E1", "END_PRINT"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	err = ProcessFile(inputPath, outputPath, ProcessingRequest{Iterations: 2, Printer: "unit-tests", CustomTemplate: customTemplate})
+	if err == nil || !strings.Contains(err.Error(), "template execution exceeded 1ms") {
+		t.Errorf("Expected template timeout error, got %v", err)
+	}
+}
+
+// TestProcessFile_TemplateLoopLimit counts goroutines and changes templateTimeout and therefore doesn't
+// run in parallel
+func TestProcessFile_TemplateLoopLimit(t *testing.T) {
+	// The loop limit must end the execution, also on slow runs like with the race detector
+	templateTimeout = time.Minute
+
+	t.Cleanup(func() { templateTimeout = 5 * time.Second })
+
+	customTemplate := testPrinterTemplate("", "{{range 1000000000}}{{end}}{{range $i := 3}}{{range 1000000000}}{{$x := 1}}{{end}}{{end}}")
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"START_PRINT", "G1 X10 Y10 E1", "END_PRINT"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	goroutines := runtime.NumGoroutine()
+
+	err = ProcessFile(inputPath, outputPath, ProcessingRequest{Iterations: 2, Printer: "unit-tests", CustomTemplate: customTemplate})
+	if err == nil || !strings.Contains(err.Error(), "template loops exceed 1000000 iterations") {
+		t.Errorf("Expected template loop limit error, got %v", err)
+	}
+
+	// The execution ended by itself instead of being abandoned, allow its goroutine to return
+	running := runtime.NumGoroutine()
+	for i := 0; i < 100 && running > goroutines; i++ {
+		time.Sleep(10 * time.Millisecond)
+
+		running = runtime.NumGoroutine()
+	}
+
+	if running > goroutines {
+		t.Errorf("Expected %d goroutines after the template failed, got %d", goroutines, running)
+	}
+}
+
+func TestTemplateFunctions_Fixed(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "G1 X{{fixed .Positions.LastPrintX 3}} Y{{fixed .Positions.LastPrintY 3}}")
+
+	tests := []struct {
+		name      string
+		positions MarkerPositions
+		expected  string
+	}{
+		{
+			name:      "small and long values",
+			positions: MarkerPositions{LastPrintX: 0.00026, LastPrintY: 159.285},
+			expected:  "G1 X0.000 Y159.285\n",
+		},
+		{
+			name:      "whole values are padded",
+			positions: MarkerPositions{LastPrintX: 10, LastPrintY: 0.0005},
+			expected:  "G1 X10.000 Y0.001\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			block, err := RenderGeneratedBlock(ProcessingRequest{
+				Iterations:     1,
+				Printer:        "unit-tests",
+				CustomTemplate: customTemplate,
+			}, tt.positions)
+			if err != nil {
+				t.Fatalf("RenderGeneratedBlock failed: %v", err)
+			}
+
+			if block != tt.expected {
+				t.Errorf("Expected block %q, got %q", tt.expected, block)
+			}
+		})
+	}
+}
+
+func TestRenderGeneratedBlock_Bed(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := `
+Name = "Bed Printer"
+[Markers]
+EndInitSection = ["START_PRINT"]
+EndPrintSection = ["END_PRINT"]
+[SearchStrategy]
+EndInitSectionStrategy = "after_first_appear"
+EndPrintSectionStrategy = "after_last_appear"
+[Bed]
+X = 256
+Y = 250.5
+Z = 300
+[Template]
+Code = """G1 X{{.Bed.X}} Y{{.Bed.Y}} ; park
+G1 Z{{min (add .Positions.LastPrintZ 10) .Bed.Z}}"""
+`
+
+	block, err := RenderGeneratedBlock(ProcessingRequest{
+		Iterations:     1,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	}, MarkerPositions{LastPrintZ: 295})
+	if err != nil {
+		t.Fatalf("RenderGeneratedBlock failed: %v", err)
+	}
+
+	expected := "G1 X256 Y250.5 ; park\nG1 Z300\n"
+	if block != expected {
+		t.Errorf("Expected block %q, got %q", expected, block)
+	}
+
+	_, err = NewStreamingProcessor(ProcessingRequest{
+		Iterations:     1,
+		Printer:        "unit-tests",
+		CustomTemplate: strings.Replace(customTemplate, "Y = 250.5", "Y = -1", 1),
+	})
+	if err == nil || !strings.Contains(err.Error(), `invalid Bed.Y value -1: must not be negative`) {
+		t.Errorf("Expected invalid bed error, got %v", err)
+	}
+
+	// A zero dimension is not declared, e.g. a printer without a known height
+	processor, err := NewStreamingProcessor(ProcessingRequest{
+		Iterations:     1,
+		Printer:        "unit-tests",
+		CustomTemplate: strings.Replace(customTemplate, "Z = 300", "Z = 0", 1),
+	})
+	if err != nil {
+		t.Fatalf("Expected zero bed dimension to be accepted, got %v", err)
+	}
+
+	if processor.printerDef.Bed != (BedSize{X: 256, Y: 250.5}) {
+		t.Errorf("Unexpected bed with undeclared height %+v", processor.printerDef.Bed)
+	}
+
+	processor, err = NewStreamingProcessor(ProcessingRequest{Iterations: 1, Printer: "a1-mini"})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	if processor.printerDef.Bed != (BedSize{X: 180, Y: 180, Z: 180}) {
+		t.Errorf("Unexpected a1-mini bed %+v", processor.printerDef.Bed)
+	}
+}
+
+func TestProcessFile_Chunked(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "; Iteration {{.Iteration}}")
+
+	input := []string{
+		"HEADER",
+		"START_PRINT",
+		"BODY",
+		"END_PRINT",
+		"FOOTER",
+	}
+
+	chunk := func(iterations ...int) []string {
+		lines := []string{"HEADER", "START_PRINT"}
+		for _, iteration := range iterations {
+			lines = append(lines, "BODY", "END_PRINT", fmt.Sprintf("; Iteration %d", iteration))
+		}
+
+		return append(lines, "FOOTER")
+	}
+
+	tests := []struct {
+		name            string
+		iterations      int64
+		chunkIterations int64
+		chunkSizeMB     int64
+		expected        [][]string
+		expectError     bool
+	}{
+		{
+			name:            "chunks split on iteration edges",
+			iterations:      5,
+			chunkIterations: 2,
+			expected:        [][]string{chunk(1, 2), chunk(3, 4), chunk(5)},
+		},
+		{
+			name:            "chunk larger than iterations gives single file",
+			iterations:      3,
+			chunkIterations: 10,
+			expected:        [][]string{chunk(1, 2, 3)},
+		},
+		{
+			name:        "size limit fitting everything gives single file",
+			iterations:  3,
+			chunkSizeMB: 1,
+			expected:    [][]string{chunk(1, 2, 3)},
+		},
+		{
+			name:        "chunking not requested",
+			iterations:  3,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:      tt.iterations,
+				Printer:         "unit-tests",
+				CustomTemplate:  customTemplate,
+				ChunkIterations: tt.chunkIterations,
+				ChunkSizeMB:     tt.chunkSizeMB,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			chunkPaths, err := processor.ProcessFileChunked(inputPath, outputPath)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(chunkPaths) != len(tt.expected) {
+				t.Fatalf("Expected %d chunks, got %d: %v", len(tt.expected), len(chunkPaths), chunkPaths)
+			}
+
+			for i, chunkPath := range chunkPaths {
+				expectedPath := filepath.Join(tempDir, fmt.Sprintf("output.part%03d.gcode", i+1))
+				if chunkPath != expectedPath {
+					t.Errorf("Chunk %d path = %q, want %q", i+1, chunkPath, expectedPath)
+				}
+
+				lines, err := readLinesFromFile(chunkPath)
+				if err != nil {
+					t.Fatalf("Failed to read chunk %d: %v", i+1, err)
+				}
+
+				if !equalStringSlices(lines, tt.expected[i]) {
+					t.Errorf("Chunk %d mismatch.\nExpected: %v\nGot: %v", i+1, tt.expected[i], lines)
+				}
+			}
+		})
+	}
+}
+
+func TestIterationsFittingInChunk(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+
+	// Header "H\nSTART\n" and footer "F\n" take 10 bytes, body "BODY\nEND\n" takes 9 bytes
+	err := writeLinesToFile(inputPath, []string{"H", "START", "BODY", "END", "F"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	processor := &StreamingProcessor{
+		config:  ProcessingRequest{Iterations: 100},
+		regions: []MarkerPositions{{EndInitSectionLastLine: 1, EndPrintSectionFirstLine: 3, EndPrintSectionLastLine: 3, BodyOffset: 8, FooterOffset: 17}},
+	}
+
+	tests := []struct {
+		maxBytes int64
+		expected int64
+	}{
+		{maxBytes: 10 + 9*4, expected: 4},
+		{maxBytes: 10 + 9*4 + 8, expected: 4},
+		{maxBytes: 5, expected: 1},
+	}
+
+	for _, tt := range tests {
+		got, err := processor.iterationsFittingInChunk(inputPath, tt.maxBytes)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if got != tt.expected {
+			t.Errorf("iterationsFittingInChunk(%d) = %d, want %d", tt.maxBytes, got, tt.expected)
+		}
+	}
+}
+
+func TestProcessFile_LastTempsInTemplate(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "M109 S{{.Positions.LastHotendTemp}}\nM190 S{{.Positions.LastBedTemp}}")
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"M140 S60", "M104 S200", "START_PRINT", "M104 S215", "BODY", "END_PRINT", "M104 S0"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+		Iterations:     1,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines, err := readLinesFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	expected := []string{"M140 S60", "M104 S200", "START_PRINT", "M104 S215", "BODY", "END_PRINT", "M109 S215", "M190 S60", "M104 S0"}
+	if !equalStringSlices(lines, expected) {
+		t.Errorf("Output mismatch.\nExpected: %v\nGot: %v", expected, lines)
+	}
+}
+
+func TestProcessLineWithMarkerSplit(t *testing.T) {
+	t.Parallel()
+
+	markers := []string{"START_PRINT"}
+
+	tests := []struct {
+		name          string
+		commentPrefix string
+		line          string
+		expected      []string
+	}{
+		{
+			name:          "semicolon comment",
+			commentPrefix: ";",
+			line:          "START_PRINT ; comment",
+			expected:      []string{"START_PRINT", "; comment"},
+		},
+		{
+			name:          "slash comment",
+			commentPrefix: "//",
+			line:          "START_PRINT // comment",
+			expected:      []string{"START_PRINT", "// comment"},
+		},
+		{
+			name:          "slash comment without space",
+			commentPrefix: "//",
+			line:          "START_PRINT//comment",
+			expected:      []string{"START_PRINT", "//comment"},
+		},
+		{
+			name:          "semicolon kept when prefix is slashes",
+			commentPrefix: "//",
+			line:          "START_PRINT ; not a comment",
+			expected:      []string{"START_PRINT ; not a comment"},
+		},
+		{
+			name:          "line without marker is kept",
+			commentPrefix: "//",
+			line:          "G1 X1 // comment",
+			expected:      []string{"G1 X1 // comment"},
+		},
+		{
+			name:          "comment only line is kept",
+			commentPrefix: "//",
+			line:          "// START_PRINT",
+			expected:      []string{"// START_PRINT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			processor := &StreamingProcessor{commentPrefix: tt.commentPrefix}
+
+			result := processor.processLineWithMarkerSplit(tt.line, markers)
+			if !equalStringSlices(result, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestProcessFile_CommentPrefix(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("CommentPrefix = \"//\"\nBodyHash = true\nLineNumbers = true", "// Iteration {{.Iteration}}")
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"HEADER", "START_PRINT // begin", "BODY", "END_PRINT", "FOOTER"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+		Iterations:     1,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines, err := readLinesFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	if len(lines) < 4 {
+		t.Fatalf("Output too short: %v", lines)
+	}
+
+	// Marker split on "//" and comment lines are not numbered
+	expectedStart := []string{numberLine(1, "HEADER"), numberLine(2, "START_PRINT"), "// begin"}
+	if !equalStringSlices(lines[:3], expectedStart) {
+		t.Errorf("Expected output to start with %q, got %q", expectedStart, lines[:3])
+	}
+
+	if !strings.HasPrefix(lines[3], "// printloop body sha256: ") {
+		t.Errorf("Expected body hash comment with // prefix, got %q", lines[3])
+	}
+
+	if !slices.Contains(lines, "// Iteration 1") {
+		t.Errorf("Expected generated comment to be left unnumbered, got %q", lines)
+	}
+}
+
+func TestProcessFile_CommentPrefixPositions(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := `
+Name = "test-comment-prefix-positions"
+[Markers]
+EndInitSection = ["M83", "START_PRINT"]
+EndPrintSection = ["END_PRINT"]
+[SearchStrategy]
+EndInitSectionStrategy = "after_first_appear"
+EndPrintSectionStrategy = "after_last_appear"
+[Parameters]
+CommentPrefix = "#"
+[Template]
+Code = """# length {{.Positions.BodyExtrusionLength}}"""
+`
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	// The comment line splits the multiline marker and the words after "#" are no coordinates
+	err := writeLinesToFile(inputPath, []string{"G21", "M83", "# wait for bed", "START_PRINT", "G1 X20 Y10 E1 # X99 E5", "G1 X30 Y10 E1", "END_PRINT", "M84"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+		Iterations:     1,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines, err := readLinesFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	if !slices.Contains(lines, "# length 2") {
+		t.Errorf("Expected body extrusion of 2 ignoring the comment, got %q", lines)
+	}
+}
+
+func TestProcessFile_StripSlicerConfig(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "; Iteration {{.Iteration}}")
+
+	body := []string{"HEADER", "START_PRINT", "BODY", "END_PRINT"}
+	looped := []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "; Iteration 1"}
+
+	tests := []struct {
+		name     string
+		footer   []string
+		strip    bool
+		expected []string
+	}{
+		{
+			name:     "prusaslicer block preserved",
+			footer:   []string{"FOOTER", "; prusaslicer_config = begin", "; layer_height = 0.2", "; prusaslicer_config = end"},
+			strip:    false,
+			expected: []string{"FOOTER", "; prusaslicer_config = begin", "; layer_height = 0.2", "; prusaslicer_config = end"},
+		},
+		{
+			name:     "prusaslicer block stripped",
+			footer:   []string{"FOOTER", "; prusaslicer_config = begin", "; layer_height = 0.2", "; prusaslicer_config = end", "; trailing"},
+			strip:    true,
+			expected: []string{"FOOTER", "; trailing"},
+		},
+		{
+			name:     "orca block stripped",
+			footer:   []string{"FOOTER", "; CONFIG_BLOCK_START", "; layer_height = 0.2", "; CONFIG_BLOCK_END"},
+			strip:    true,
+			expected: []string{"FOOTER"},
+		},
+		{
+			name:     "stripping without config block keeps footer",
+			footer:   []string{"FOOTER", "; filament used = 1.0"},
+			strip:    true,
+			expected: []string{"FOOTER", "; filament used = 1.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, append(slices.Clone(body), tt.footer...))
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+				Iterations:        1,
+				Printer:           "unit-tests",
+				CustomTemplate:    customTemplate,
+				StripSlicerConfig: tt.strip,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			lines, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			expected := append(slices.Clone(looped), tt.expected...)
+			if !equalStringSlices(lines, expected) {
+				t.Errorf("Output mismatch.\nExpected: %v\nGot: %v", expected, lines)
+			}
+		})
+	}
+}
+
+func TestProcessFile_LineEndings(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "; Iteration {{.Iteration}}")
+
+	input := []string{"HEADER", "START_PRINT ; begin", "BODY", "END_PRINT", "FOOTER", ""}
+	expectedLines := []string{"HEADER", "START_PRINT", "; begin", "BODY", "END_PRINT", "; Iteration 1", "FOOTER", ""}
+
+	tests := []struct {
+		name          string
+		inputEnding   string
+		lineEnding    string
+		expectedEnd   string
+		expectedError bool
+	}{
+		{name: "crlf input keeps crlf", inputEnding: "\r\n", expectedEnd: "\r\n"},
+		{name: "lf input keeps lf", inputEnding: "\n", expectedEnd: "\n"},
+		{name: "crlf input forced to lf", inputEnding: "\r\n", lineEnding: "lf", expectedEnd: "\n"},
+		{name: "lf input forced to crlf", inputEnding: "\n", lineEnding: "CRLF", expectedEnd: "\r\n"},
+		{name: "invalid line ending", inputEnding: "\n", lineEnding: "cr", expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := os.WriteFile(inputPath, []byte(strings.Join(input, tt.inputEnding)), 0o644)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+				Iterations:     1,
+				Printer:        "unit-tests",
+				CustomTemplate: customTemplate,
+				LineEnding:     tt.lineEnding,
+			})
+
+			if tt.expectedError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			output, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			expected := strings.Join(expectedLines, tt.expectedEnd)
+			if string(output) != expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, output)
+			}
+		})
+	}
+}
+
+func TestProcessStreamContext(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "FOOTER"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	config := ProcessingRequest{Iterations: 2, Printer: "unit-tests"}
+
+	err = ProcessFile(inputPath, outputPath, config)
+	if err != nil {
+		t.Fatalf("ProcessFile failed: %v", err)
+	}
+
+	expected, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	var streamed bytes.Buffer
+
+	_, err = ProcessStreamContext(context.Background(), inputPath, &streamed, config)
+	if err != nil {
+		t.Fatalf("ProcessStreamContext failed: %v", err)
+	}
+
+	if streamed.String() != string(expected) {
+		t.Errorf("Streamed output differs from file output.\nExpected: %q\nGot: %q", expected, streamed.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = ProcessStreamContext(ctx, inputPath, &streamed, config)
+	if err == nil || !strings.Contains(err.Error(), "processing aborted") {
+		t.Errorf("Expected abort error, got %v", err)
+	}
+}
+
+func TestProcessFileWithStats(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "; Iteration {{.Iteration}}")
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	input := "HEADER\nSTART_PRINT\nG1 X1 Y1 E1\nG1 X2 Y2 E1\nEND_PRINT\nFOOTER\n"
+
+	err := os.WriteFile(inputPath, []byte(input), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	stats, err := ProcessFileWithStats(inputPath, outputPath, ProcessingRequest{
+		Iterations:     3,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	})
+	if err != nil {
+		t.Fatalf("ProcessFileWithStats failed: %v", err)
+	}
+
+	output, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	if stats.InputBytes != int64(len(input)) {
+		t.Errorf("InputBytes: expected %d, got %d", len(input), stats.InputBytes)
+	}
+
+	if stats.OutputBytes != int64(len(output)) {
+		t.Errorf("OutputBytes: expected %d, got %d", len(output), stats.OutputBytes)
+	}
+
+	if stats.Iterations != 3 {
+		t.Errorf("Iterations: expected 3, got %d", stats.Iterations)
+	}
+
+	if stats.EndInitSectionLastLine != 1 || stats.EndPrintSectionFirstLine != 4 {
+		t.Errorf("Marker lines: expected (1, 4), got (%d, %d)", stats.EndInitSectionLastLine, stats.EndPrintSectionFirstLine)
+	}
+
+	if stats.Duration <= 0 {
+		t.Errorf("Expected a positive duration, got %v", stats.Duration)
+	}
+
+	_, err = ProcessFileWithStats(filepath.Join(tempDir, "missing.gcode"), outputPath, ProcessingRequest{
+		Iterations:     1,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	})
+	if err == nil {
+		t.Error("Expected error for missing input file")
+	}
+}
+
+func TestDetectLineEnding(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		content     string
+		sampleLines int64
+		expected    string
+	}{
+		{name: "lf", content: "A\nB\nC\n", sampleLines: 1000, expected: "\n"},
+		{name: "crlf", content: "A\r\nB\r\nC\r\n", sampleLines: 1000, expected: "\r\n"},
+		{name: "mostly crlf with stray lf", content: "A\r\nB\nC\r\nD\r\nE\nF\r\n", sampleLines: 1000, expected: "\r\n"},
+		{name: "mostly lf with stray crlf", content: "A\r\nB\nC\nD\n", sampleLines: 1000, expected: "\n"},
+		{name: "tie picks lf", content: "A\r\nB\n", sampleLines: 1000, expected: "\n"},
+		{name: "sample limited to prefix", content: "A\nB\r\nC\r\nD\r\n", sampleLines: 1, expected: "\n"},
+		{name: "zero sample reads first line", content: "A\r\nB\nC\n", sampleLines: 0, expected: "\r\n"},
+		{name: "unterminated last line ignored", content: "A\r\nB", sampleLines: 1000, expected: "\r\n"},
+		{name: "empty file", content: "", sampleLines: 1000, expected: "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			filePath := filepath.Join(t.TempDir(), "input.gcode")
+
+			err := os.WriteFile(filePath, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			ending, err := detectLineEnding(filePath, tt.sampleLines)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if ending != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, ending)
+			}
+		})
+	}
+}
+
+func TestProcessFile_MixedLineEndings(t *testing.T) {
+	t.Parallel()
+
+	input := "HEADER\nSTART_PRINT\r\nBODY\r\nBODY2\nEND_PRINT\r\nFOOTER\r\n"
+
+	tests := []struct {
+		name        string
+		sampleLines int
+		expectedEnd string
+	}{
+		{name: "majority of the file wins", sampleLines: 1000, expectedEnd: "\r\n"},
+		{name: "first line only", sampleLines: 1, expectedEnd: "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := os.WriteFile(inputPath, []byte(input), 0644)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+				Iterations:     1,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate(fmt.Sprintf("LineEndingSampleLines = %d", tt.sampleLines), "; Iteration {{.Iteration}}"),
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			output, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			expectedLines := []string{"HEADER", "START_PRINT", "BODY", "BODY2", "END_PRINT", "; Iteration 1", "FOOTER", ""}
+
+			expected := strings.Join(expectedLines, tt.expectedEnd)
+			if string(output) != expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, output)
+			}
+		})
+	}
+}
+
+func TestProcessFile_CommentStyle(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate(`CommentPrefix = "#"`, "; Iteration {{.Iteration}}")
+
+	input := []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "FOOTER"}
+
+	tests := []struct {
+		name          string
+		commentStyle  string
+		expected      []string
+		expectedError bool
+	}{
+		{
+			name:         "no iteration comments by default",
+			commentStyle: "",
+			expected: []string{
+				"HEADER", "START_PRINT",
+				"BODY", "END_PRINT", "; Iteration 1",
+				"BODY", "END_PRINT", "; Iteration 2",
+				"FOOTER",
+			},
+		},
+		{
+			name:         "semicolon",
+			commentStyle: "semicolon",
+			expected: []string{
+				"HEADER", "START_PRINT",
+				"; printloop iteration 1/2 start", "BODY", "END_PRINT", "; Iteration 1", "; printloop iteration 1/2 end",
+				"; printloop iteration 2/2 start", "BODY", "END_PRINT", "; Iteration 2", "; printloop iteration 2/2 end",
+				"FOOTER",
+			},
+		},
+		{
+			name:         "parentheses",
+			commentStyle: "parentheses",
+			expected: []string{
+				"HEADER", "START_PRINT",
+				"(printloop iteration 1/2 start)", "BODY", "END_PRINT", "; Iteration 1", "(printloop iteration 1/2 end)",
+				"(printloop iteration 2/2 start)", "BODY", "END_PRINT", "; Iteration 2", "(printloop iteration 2/2 end)",
+				"FOOTER",
+			},
+		},
+		{
+			name:          "invalid style",
+			commentStyle:  "hash",
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     2,
+				Printer:        "unit-tests",
+				CustomTemplate: customTemplate,
+				CommentStyle:   tt.commentStyle,
+			})
+			if tt.expectedError {
+				if err == nil {
+					t.Fatal("Expected error for invalid comment style")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+			if err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+
+			output, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			if !equalStringSlices(output, tt.expected) {
+				t.Errorf("Output mismatch:\nExpected: %v\nGot: %v", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestComment(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		style    string
+		expected string
+	}{
+		{style: "", expected: "# printer (A1) ok"},
+		{style: "semicolon", expected: "; printer (A1) ok"},
+		{style: "parentheses", expected: "(printer [A1] ok)"},
+	}
+
+	for _, tt := range tests {
+		p := &StreamingProcessor{config: ProcessingRequest{CommentStyle: tt.style}, commentPrefix: "#"}
+
+		got := p.comment("printer (A1) ok")
+		if got != tt.expected {
+			t.Errorf("Style %q: expected %q, got %q", tt.style, tt.expected, got)
+		}
+	}
+}
+
+func TestProcessFile_MeshReload(t *testing.T) {
+	t.Parallel()
+
+	templateWithCommand := testPrinterTemplate(`MeshReloadCommand = "G29 L1"`, "; Iteration {{.Iteration}}")
+	templateWithoutCommand := strings.Replace(templateWithCommand, `MeshReloadCommand = "G29 L1"`, "", 1)
+
+	iteration := func(n int, reload string) []string {
+		lines := []string{}
+		if reload != "" {
+			lines = append(lines, reload)
+		}
+
+		return append(lines, "BODY", "END_PRINT", fmt.Sprintf("; Iteration %d", n))
+	}
+
+	join := func(parts ...[]string) []string {
+		lines := []string{"HEADER", "START_PRINT"}
+		for _, part := range parts {
+			lines = append(lines, part...)
+		}
+
+		return append(lines, "FOOTER")
+	}
+
+	tests := []struct {
+		name        string
+		template    string
+		every       int64
+		expected    []string
+		expectError bool
+	}{
+		{
+			name:     "disabled",
+			template: templateWithCommand,
+			expected: join(iteration(1, ""), iteration(2, ""), iteration(3, "")),
+		},
+		{
+			name:     "every iteration",
+			template: templateWithCommand,
+			every:    1,
+			expected: join(iteration(1, "G29 L1"), iteration(2, "G29 L1"), iteration(3, "G29 L1")),
+		},
+		{
+			name:     "every second iteration",
+			template: templateWithCommand,
+			every:    2,
+			expected: join(iteration(1, "G29 L1"), iteration(2, ""), iteration(3, "G29 L1")),
+		},
+		{
+			name:     "default command",
+			template: templateWithoutCommand,
+			every:    3,
+			expected: join(iteration(1, "M420 S1"), iteration(2, ""), iteration(3, "")),
+		},
+		{
+			name:        "negative interval",
+			template:    templateWithCommand,
+			every:       -1,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "FOOTER"})
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+				Iterations:      3,
+				Printer:         "unit-tests",
+				CustomTemplate:  tt.template,
+				MeshReloadEvery: tt.every,
+			})
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			lines, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			if !equalStringSlices(lines, tt.expected) {
+				t.Errorf("Output mismatch.\nExpected: %v\nGot: %v", tt.expected, lines)
+			}
+		})
+	}
+}
+
+func TestProcessFile_ReverseIterationNumbering(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "; Iteration {{.Iteration}}{{if eq .Iteration 1}} last{{end}}")
+
+	tests := []struct {
+		name     string
+		reverse  bool
+		expected []string
+	}{
+		{
+			name:     "ascending by default",
+			expected: []string{"; Iteration 1 last", "; Iteration 2", "; Iteration 3"},
+		},
+		{
+			name:     "descending when reversed",
+			reverse:  true,
+			expected: []string{"; Iteration 3", "; Iteration 2", "; Iteration 1 last"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "FOOTER"})
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+				Iterations:                3,
+				Printer:                   "unit-tests",
+				CustomTemplate:            customTemplate,
+				ReverseIterationNumbering: tt.reverse,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			lines, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			var comments []string
+
+			for _, line := range lines {
+				if strings.HasPrefix(line, "; Iteration") {
+					comments = append(comments, line)
+				}
+			}
+
+			if !equalStringSlices(comments, tt.expected) {
+				t.Errorf("Iteration comments mismatch.\nExpected: %v\nGot: %v", tt.expected, comments)
+			}
+		})
+	}
+}
+
+func TestProcessFile_TotalIterations(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "; loop {{.Iteration}} of {{.TotalIterations}}")
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "FOOTER"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+		Iterations:     3,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines, err := readLinesFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	var comments []string
+
+	for _, line := range lines {
+		if strings.HasPrefix(line, "; loop") {
+			comments = append(comments, line)
+		}
+	}
+
+	expected := []string{"; loop 1 of 3", "; loop 2 of 3", "; loop 3 of 3"}
+	if !equalStringSlices(comments, expected) {
+		t.Errorf("Loop comments mismatch.\nExpected: %v\nGot: %v", expected, comments)
+	}
+}
+
+// cancelAfterContext reports cancellation once Err has been called more than a given number of times
+type cancelAfterContext struct {
+	context.Context
+
+	remaining atomic.Int64
+}
+
+func (c *cancelAfterContext) Err() error {
+	if c.remaining.Add(-1) < 0 {
+		return context.Canceled
+	}
+
+	return nil
+}
+
+// failingWriter fails every write with err
+type failingWriter struct {
+	io.WriteCloser
+
+	err error
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+func TestProcessFile_OutputRetry(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "; Iteration {{.Iteration}}")
+
+	tests := []struct {
+		name            string
+		failures        int
+		err             error
+		expectError     bool
+		expectedCreates int
+	}{
+		{name: "no failure", expectedCreates: 1},
+		{name: "transient failure succeeds on retry", failures: 1, err: syscall.EAGAIN, expectedCreates: 2},
+		{name: "stale handle succeeds on retry", failures: 2, err: syscall.ESTALE, expectedCreates: 3},
+		{name: "disk full is not retried", failures: 1, err: syscall.ENOSPC, expectError: true, expectedCreates: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "FOOTER"})
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:     2,
+				Printer:        "unit-tests",
+				CustomTemplate: customTemplate,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			creates := 0
+			processor.createOutput = func(name string) (io.WriteCloser, error) {
+				creates++
+
+				file, err := os.Create(name)
+				if err != nil {
+					return nil, err
+				}
+
+				if creates <= tt.failures {
+					return failingWriter{WriteCloser: file, err: &os.PathError{Op: "write", Path: name, Err: tt.err}}, nil
+				}
+
+				return file, nil
+			}
+
+			err = processor.ProcessFile(inputPath, outputPath)
+
+			if creates != tt.expectedCreates {
+				t.Errorf("Expected %d attempts, got %d", tt.expectedCreates, creates)
+			}
+
+			if tt.expectError {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Expected %v, got %v", tt.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+
+			output, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			expected := []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "; Iteration 1", "BODY", "END_PRINT", "; Iteration 2", "FOOTER"}
+			if !equalStringSlices(output, expected) {
+				t.Errorf("Output mismatch:\nExpected: %v\nGot: %v", expected, output)
+			}
+		})
+	}
+}
+
+func TestIsTransientIOError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{err: syscall.EAGAIN, expected: true},
+		{err: &os.PathError{Op: "write", Path: "x", Err: syscall.ETIMEDOUT}, expected: true},
+		{err: fmt.Errorf("failed to write output file: %w", syscall.EINTR), expected: true},
+		{err: syscall.ENOSPC},
+		{err: syscall.EACCES},
+		{err: errors.New("template error")},
+	}
+
+	for _, tt := range tests {
+		if got := isTransientIOError(tt.err); got != tt.expected {
+			t.Errorf("isTransientIOError(%v) = %v, want %v", tt.err, got, tt.expected)
+		}
+	}
+}
+
+func TestProcessFileWithProgress(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "; Iteration {{.Iteration}}")
+
+	tests := []struct {
+		name            string
+		chunkIterations int64
+	}{
+		{name: "single file"},
+		{name: "chunked", chunkIterations: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "FOOTER"})
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			var calls [][2]int64
+
+			processor, err := NewStreamingProcessor(ProcessingRequest{
+				Iterations:      5,
+				Printer:         "unit-tests",
+				CustomTemplate:  customTemplate,
+				ChunkIterations: tt.chunkIterations,
+				Progress: func(iteration, total int64) {
+					calls = append(calls, [2]int64{iteration, total})
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create processor: %v", err)
+			}
+
+			if tt.chunkIterations > 0 {
+				_, err = processor.ProcessFileChunked(inputPath, outputPath)
+			} else {
+				err = processor.ProcessFile(inputPath, outputPath)
+			}
+
+			if err != nil {
+				t.Fatalf("Processing failed: %v", err)
+			}
+
+			expected := [][2]int64{{1, 5}, {2, 5}, {3, 5}, {4, 5}, {5, 5}}
+			if !slices.Equal(calls, expected) {
+				t.Errorf("Expected progress %v, got %v", expected, calls)
+			}
+		})
+	}
+
+	t.Run("ProcessFileWithProgress", func(t *testing.T) {
+		t.Parallel()
+
+		tempDir := t.TempDir()
+		inputPath := filepath.Join(tempDir, "input.gcode")
+		outputPath := filepath.Join(tempDir, "output.gcode")
+
+		err := writeLinesToFile(inputPath, []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "FOOTER"})
+		if err != nil {
+			t.Fatalf("Failed to write input file: %v", err)
+		}
+
+		processor, err := NewStreamingProcessor(ProcessingRequest{
+			Iterations:     3,
+			Printer:        "unit-tests",
+			CustomTemplate: customTemplate,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create processor: %v", err)
+		}
+
+		var last, total int64
+
+		err = processor.ProcessFileWithProgress(inputPath, outputPath, func(iteration, iterations int64) {
+			if iteration != last+1 {
+				t.Errorf("Progress jumped from %d to %d", last, iteration)
+			}
+
+			last, total = iteration, iterations
+		})
+		if err != nil {
+			t.Fatalf("ProcessFileWithProgress failed: %v", err)
+		}
+
+		if last != 3 || total != 3 {
+			t.Errorf("Expected final progress 3/3, got %d/%d", last, total)
+		}
+	})
+}
+
+func TestProcessFileContext_Cancelled(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "; Iteration {{.Iteration}}")
+
+	const iterations = 100
+
+	tests := []struct {
+		name           string
+		checks         int64
+		someIterations bool
+	}{
+		{name: "cancelled before start", checks: 0},
+		{name: "cancelled mid-processing", checks: 30, someIterations: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, []string{"HEADER", "START_PRINT", "BODY", "END_PRINT", "FOOTER"})
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			ctx := &cancelAfterContext{Context: context.Background()}
+			ctx.remaining.Store(tt.checks)
+
+			err = ProcessFileContext(ctx, inputPath, outputPath, ProcessingRequest{
+				Iterations:     iterations,
+				Printer:        "unit-tests",
+				CustomTemplate: customTemplate,
+			})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("Expected context.Canceled error, got %v", err)
+			}
+
+			lines, _ := readLinesFromFile(outputPath)
+			if slices.Contains(lines, fmt.Sprintf("; Iteration %d", iterations)) {
+				t.Errorf("Expected processing to stop before the last iteration")
+			}
+
+			if tt.someIterations != slices.Contains(lines, "; Iteration 1") {
+				t.Errorf("Expected first iteration written = %v, got output %v", tt.someIterations, lines)
+			}
+		})
+	}
+}
+
+// BenchmarkStreamingProcessor_streamLinesRange compares streaming the looped body of a file with a
+// long header by seeking to the recorded offset against skipping the header line by line
+func BenchmarkStreamingProcessor_streamLinesRange(b *testing.B) {
+	customTemplate := testPrinterTemplate("", "; next")
+
+	var gcode strings.Builder
+
+	// Slicers embed thumbnails and settings before the print, often tens of thousands of lines
+	for i := range 200000 {
+		fmt.Fprintf(&gcode, "; header line %d\n", i)
+	}
+
+	gcode.WriteString("START_PRINT\n")
+
+	for i := range 1000 {
+		fmt.Fprintf(&gcode, "G1 X%d Y%d E0.1\n", i%200, i%150)
+	}
+
+	gcode.WriteString("END_PRINT\nM84\n")
+
+	inputPath := filepath.Join(b.TempDir(), "input.gcode")
+
+	err := os.WriteFile(inputPath, []byte(gcode.String()), 0644)
+	if err != nil {
+		b.Fatalf("Failed to write test content: %v", err)
+	}
+
+	processor, err := NewStreamingProcessor(ProcessingRequest{
+		Iterations:     1,
+		Printer:        "unit-tests",
+		CustomTemplate: customTemplate,
+	})
+	if err != nil {
+		b.Fatalf("Failed to create processor: %v", err)
+	}
+
+	positions, err := processor.findMarkerPositions(inputPath)
+	if err != nil {
+		b.Fatalf("Unexpected error: %v", err)
+	}
+
+	rescan := *positions
+	rescan.BodyOffset = 0
+
+	for _, bb := range []struct {
+		name      string
+		positions MarkerPositions
+	}{
+		{"seek", *positions},
+		{"rescan", rescan},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			processor.positions = bb.positions
+			writer := bufio.NewWriter(io.Discard)
+
+			for b.Loop() {
+				err := processor.streamLinesRange(inputPath, writer, positions.EndInitSectionLastLine+1, positions.EndPrintSectionFirstLine-1, false)
+				if err != nil {
+					b.Fatalf("streamLinesRange failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkStreamingProcessor_buildPositions(b *testing.B) {
+	var gcode strings.Builder
+
+	gcode.WriteString("; generated by benchmark\nM190 S60\nM104 S210\nG21\nM83\nSTART_PRINT\n")
+
+	// Every body line is followed for temperatures, extrusion, layers, timing and coordinates
+	for i := range 200000 {
+		if i%1000 == 0 {
+			fmt.Fprintf(&gcode, ";LAYER_CHANGE\nG1 Z%.1f F600\n", 0.2+float64(i/1000)*0.2)
+		}
+
+		fmt.Fprintf(&gcode, "G1 X%d.5 Y%d.25 E0.1 F1800 ; move\n", i%200, i%150)
+	}
+
+	gcode.WriteString("END_PRINT\nM84\n")
+
+	inputPath := filepath.Join(b.TempDir(), "input.gcode")
+
+	err := os.WriteFile(inputPath, []byte(gcode.String()), 0644)
+	if err != nil {
+		b.Fatalf("Failed to write test content: %v", err)
+	}
+
+	lines := strings.Count(gcode.String(), "\n")
+	processor := &StreamingProcessor{commentPrefix: ";"}
+
+	for b.Loop() {
+		_, err := processor.buildPositions(inputPath, 5, 5, int64(lines-2), int64(lines-2))
+		if err != nil {
+			b.Fatalf("buildPositions failed: %v", err)
+		}
+	}
+}
+
+func TestProcessFile_RegexMarkers(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	input := []string{
+		"; generated for Klipper",
+		"SET_GCODE_VARIABLE MACRO=START_PRINT VARIABLE=chamber VALUE=0",
+		"EXCLUDE_OBJECT_DEFINE NAME=cube",
+		"START_PRINT BED=60 EXTRUDER=210",
+		"EXCLUDE_OBJECT_START NAME=cube",
+		"G1 Z0.2 F600",
+		"G1 X40 Y40 F6000",
+		"G1 X60 Y40 E0.8 F1500",
+		"EXCLUDE_OBJECT_END NAME=cube",
+		"; EXCLUDE_OBJECT_END sent above",
+		"END_PRINT",
+	}
+
+	err := writeLinesToFile(inputPath, input)
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	processor, err := NewStreamingProcessor(ProcessingRequest{Iterations: 2, Printer: "klipper"})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	err = processor.ProcessFile(inputPath, outputPath)
+	if err != nil {
+		t.Fatalf("ProcessFile failed: %v", err)
+	}
+
+	if processor.positions.EndInitSectionLastLine != 3 || processor.positions.EndPrintSectionFirstLine != 8 {
+		t.Errorf("Expected markers at lines 3 and 8, got %d and %d",
+			processor.positions.EndInitSectionLastLine, processor.positions.EndPrintSectionFirstLine)
+	}
+
+	output, err := readLinesFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+
+	if got := strings.Count(strings.Join(output, "\n"), "G1 X60 Y40 E0.8 F1500"); got != 2 {
+		t.Errorf("Expected the body twice, got %d", got)
+	}
+
+	if got := strings.Count(strings.Join(output, "\n"), "END_PRINT"); got != 1 {
+		t.Errorf("Expected the end macro once, got %d", got)
+	}
+}
+
+func TestProcessFile_InvalidMatchMode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		markers  string
+		expected string
+	}{
+		{
+			name:     "unknown mode",
+			markers:  `MatchMode = "glob"`,
+			expected: `invalid MatchMode value "glob": must be contains, regex or unordered`,
+		},
+		{
+			name:     "invalid regex",
+			markers:  "MatchMode = \"regex\"\nEndPrintSection = ['^END_PRINT(']",
+			expected: `invalid marker regex "^END_PRINT("`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			endPrint := `EndPrintSection = ["END_PRINT"]`
+			if strings.Contains(tt.markers, "EndPrintSection") {
+				endPrint = ""
+			}
+
+			customTemplate := `
+Name = "test-match-mode"
+[Markers]
+EndInitSection = ["START_PRINT"]
+` + endPrint + `
+` + tt.markers + `
+[SearchStrategy]
+EndInitSectionStrategy = "after_first_appear"
+EndPrintSectionStrategy = "after_last_appear"
+[Template]
+Code = "; next"
+`
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+
+			err := writeLinesToFile(inputPath, []string{"START_PRINT", "G1 X10 Y10 E1", "END_PRINT"})
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, filepath.Join(tempDir, "output.gcode"), ProcessingRequest{
+				Iterations:     2,
+				Printer:        "unit-tests",
+				CustomTemplate: customTemplate,
+			})
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestProcessFile_InitMarkerAlternatives(t *testing.T) {
+	t.Parallel()
+
+	markersTemplate := func(markers, parameters string) string {
+		return `
+Name = "test-alternatives"
+[Markers]
+` + markers + `
+EndPrintSection = ["END_PRINT"]
+[SearchStrategy]
+EndInitSectionStrategy = "after_first_appear"
+EndPrintSectionStrategy = "after_last_appear"
+[Parameters]
+` + parameters + `
+[Template]
+Code = "; next"
+`
+	}
+
+	tests := []struct {
+		name       string
+		markers    string
+		parameters string
+		input      []string
+		expected   []string
+		err        string
+	}{
+		{
+			name:     "second alternative matches",
+			markers:  `EndInitSectionAlternatives = [["START_PRINT"], ["M400", "PRINT_START"]]`,
+			input:    []string{"HEADER", "PRINT_START", "M400", "PRINT_START", "G1 X10 Y10 E1", "END_PRINT", "FOOTER"},
+			expected: []string{"HEADER", "PRINT_START", "M400", "PRINT_START", "G1 X10 Y10 E1", "END_PRINT", "; next", "G1 X10 Y10 E1", "END_PRINT", "; next", "FOOTER"},
+		},
+		{
+			name:     "EndInitSection tried first",
+			markers:  "EndInitSection = [\"START_PRINT\"]\nEndInitSectionAlternatives = [[\"PRINT_START\"]]",
+			input:    []string{"PRINT_START", "G1 X1 Y1 E1", "START_PRINT", "G1 X10 Y10 E1", "END_PRINT"},
+			expected: []string{"PRINT_START", "G1 X1 Y1 E1", "START_PRINT", "G1 X10 Y10 E1", "END_PRINT", "; next", "G1 X10 Y10 E1", "END_PRINT", "; next"},
+		},
+		{
+			name:       "multi region",
+			markers:    `EndInitSectionAlternatives = [["START_PRINT"], ["PRINT_START"]]`,
+			parameters: "MultiRegion = true",
+			input:      []string{"PRINT_START", "G1 X1 Y1 E1", "END_PRINT", "PRINT_START", "G1 X2 Y2 E1", "END_PRINT"},
+			expected:   []string{"PRINT_START", "G1 X1 Y1 E1", "END_PRINT", "; next", "G1 X1 Y1 E1", "END_PRINT", "; next", "PRINT_START", "G1 X2 Y2 E1", "END_PRINT", "; next", "G1 X2 Y2 E1", "END_PRINT", "; next"},
+		},
+		{
+			name:    "no alternative matches",
+			markers: `EndInitSectionAlternatives = [["START_PRINT"], ["PRINT_START"]]`,
+			input:   []string{"G28", "G1 X10 Y10 E1", "END_PRINT"},
+			err:     `["START_PRINT"]`,
+		},
+		{
+			name:    "empty alternative",
+			markers: `EndInitSectionAlternatives = [["START_PRINT"], []]`,
+			input:   []string{"START_PRINT", "G1 X10 Y10 E1", "END_PRINT"},
+			err:     "EndInitSectionAlternatives set 2 cannot be empty",
+		},
+		{
+			name:    "alternative conflicting with end marker",
+			markers: `EndInitSectionAlternatives = [["START_PRINT"], ["END_PRINT_START"]]`,
+			input:   []string{"START_PRINT", "G1 X10 Y10 E1", "END_PRINT"},
+			err:     "EndInitSection marker line 'END_PRINT_START' contains EndPrintSection marker 'END_PRINT'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, tt.input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+				Iterations:     2,
+				Printer:        "unit-tests",
+				CustomTemplate: markersTemplate(tt.markers, tt.parameters),
+			})
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Expected error containing %q, got %v", tt.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+
+			output, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			if !equalStringSlices(output, tt.expected) {
+				t.Errorf("Output mismatch:\nExpected: %v\nGot: %v", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestProcessFile_EndMarkerLastLine(t *testing.T) {
+	t.Parallel()
+
+	multilineTemplate := `
+Name = "test-end-marker-last-line"
+[Markers]
+EndInitSection = ["START_PRINT"]
+EndPrintSection = ["M400", "END_PRINT"]
+[SearchStrategy]
+EndInitSectionStrategy = "after_first_appear"
+EndPrintSectionStrategy = "after_last_appear"
+[Template]
+Code = "; next"
+`
+
+	tests := []struct {
+		name           string
+		input          string
+		customTemplate string
+		expected       string
+	}{
+		{
+			name:     "trailing newline",
+			input:    "HEADER\nSTART_PRINT\nBODY\nEND_PRINT\n",
+			expected: "HEADER\nSTART_PRINT\nBODY\nEND_PRINT\n; Generated code - Iteration 1\n; Generated code - End iteration 1\nBODY\nEND_PRINT\n; Generated code - Iteration 2\n; Generated code - End iteration 2\n",
+		},
+		{
+			name:     "no trailing newline",
+			input:    "HEADER\nSTART_PRINT\nBODY\nEND_PRINT",
+			expected: "HEADER\nSTART_PRINT\nBODY\nEND_PRINT\n; Generated code - Iteration 1\n; Generated code - End iteration 1\nBODY\nEND_PRINT\n; Generated code - Iteration 2\n; Generated code - End iteration 2\n",
+		},
+		{
+			name:     "no trailing newline with CRLF",
+			input:    "HEADER\r\nSTART_PRINT\r\nBODY\r\nEND_PRINT",
+			expected: "HEADER\r\nSTART_PRINT\r\nBODY\r\nEND_PRINT\r\n; Generated code - Iteration 1\r\n; Generated code - End iteration 1\r\nBODY\r\nEND_PRINT\r\n; Generated code - Iteration 2\r\n; Generated code - End iteration 2\r\n",
+		},
+		{
+			name:           "multiline marker without trailing newline",
+			input:          "HEADER\nSTART_PRINT\nBODY\nM400\nEND_PRINT",
+			customTemplate: multilineTemplate,
+			expected:       "HEADER\nSTART_PRINT\nBODY\nM400\nEND_PRINT\n; next\nBODY\nM400\nEND_PRINT\n; next\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := os.WriteFile(inputPath, []byte(tt.input), 0644)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			config := ProcessingRequest{
+				Iterations:     2,
+				Printer:        "unit-tests",
+				CustomTemplate: tt.customTemplate,
+			}
+
+			err = ProcessFile(inputPath, outputPath, config)
+			if err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+
+			output, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+
+			if string(output) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, output)
+			}
+
+			var streamed bytes.Buffer
+
+			_, err = ProcessStreamContext(context.Background(), inputPath, &streamed, config)
+			if err != nil {
+				t.Fatalf("ProcessStreamContext failed: %v", err)
+			}
+
+			if streamed.String() != tt.expected {
+				t.Errorf("Streamed output mismatch.\nExpected: %q\nGot: %q", tt.expected, streamed.String())
+			}
+		})
+	}
+}
+
+func TestProcessFile_BodyLineRange(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("", "; next")
+
+	input := []string{"G28", "G1 Z5", "G1 X10 Y10 E1", "G1 X20 Y20 E1", "M84"}
+
+	tests := []struct {
+		name       string
+		start, end int64
+		expected   []string
+		wantErr    string
+	}{
+		{
+			name:     "middle lines",
+			start:    3,
+			end:      4,
+			expected: []string{"G28", "G1 Z5", "G1 X10 Y10 E1", "G1 X20 Y20 E1", "; next", "G1 X10 Y10 E1", "G1 X20 Y20 E1", "; next", "M84"},
+		},
+		{
+			name:     "whole file",
+			start:    1,
+			end:      5,
+			expected: []string{"G28", "G1 Z5", "G1 X10 Y10 E1", "G1 X20 Y20 E1", "M84", "; next", "G28", "G1 Z5", "G1 X10 Y10 E1", "G1 X20 Y20 E1", "M84", "; next"},
+		},
+		{
+			name:    "end past the file",
+			start:   3,
+			end:     6,
+			wantErr: "invalid body_end_line value 6: the file has only 5 lines",
+		},
+		{
+			name:    "end before start",
+			start:   4,
+			end:     3,
+			wantErr: "invalid body_end_line value 3: must not be before body_start_line 4",
+		},
+		{
+			name:    "start without end",
+			start:   3,
+			wantErr: "invalid body_end_line value 0: must be a positive line number set together with body_start_line",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, input)
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+				Iterations:     2,
+				Printer:        "unit-tests",
+				CustomTemplate: customTemplate,
+				BodyStartLine:  tt.start,
+				BodyEndLine:    tt.end,
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+
+			output, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			if !equalStringSlices(output, tt.expected) {
+				t.Errorf("Expected output %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestProcessFile_CustomTemplateHint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		customTemplate string
+		expected       string
+	}{
+		{
+			name:           "unterminated multi-line string",
+			customTemplate: "Name = \"broken\"\n[Template]\nCode = \"\"\"\nG28\n",
+			expected:       `likely cause: the """ string opened on line 3 is never closed`,
+		},
+		{
+			name:           "mixed indentation",
+			customTemplate: "Name = \"broken\"\n[Template]\n \tCode = \"G28\n",
+			expected:       "likely cause: line 3 mixes tabs and spaces in its indentation",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, []string{"G28", "START_PRINT", "G1 X10 Y10 E1", "END_PRINT"})
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{Iterations: 2, Printer: "unit-tests", CustomTemplate: tt.customTemplate})
+			if err == nil || !strings.Contains(err.Error(), "failed to parse custom template TOML") || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected parse error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestProcessFile_IterationZ(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		parameters string
+		expected   []string
+		wantErr    string
+	}{
+		{
+			name:       "up by default",
+			parameters: "ZReference = 10\nZStepPerIteration = 2",
+			expected:   []string{"; iteration Z=10", "; iteration Z=12", "; iteration Z=14", "; iteration Z=16"},
+		},
+		{
+			name:       "down stops at the floor",
+			parameters: "ZDirection = \"down\"\nZReference = 10\nZStepPerIteration = 2\nZFloor = 5",
+			expected:   []string{"; iteration Z=10", "; iteration Z=8", "; iteration Z=6", "; iteration Z=5"},
+		},
+		{
+			name:       "down from the last print Z",
+			parameters: "ZDirection = \"down\"\nZStepPerIteration = 1\nZFloor = 1.5",
+			expected:   []string{"; iteration Z=3", "; iteration Z=2", "; iteration Z=1.5", "; iteration Z=1.5"},
+		},
+		{
+			name:       "invalid direction",
+			parameters: "ZDirection = \"sideways\"",
+			wantErr:    `invalid ZDirection value "sideways": must be up or down`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, []string{"START_PRINT", "G1 Z0.2", "G1 X10 Y10 E1", "G1 Z3", "G1 X50 Y50 E1", "END_PRINT"})
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{
+				Iterations:     4,
+				Printer:        "unit-tests",
+				CustomTemplate: testPrinterTemplate(tt.parameters, "; iteration Z={{.IterationZ}}"),
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+
+			lines, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			var heights []string
+
+			for _, line := range lines {
+				if strings.HasPrefix(line, "; iteration Z=") {
+					heights = append(heights, line)
+				}
+			}
+
+			if !equalStringSlices(heights, tt.expected) {
+				t.Errorf("Expected heights %v, got %v", tt.expected, heights)
+			}
+		})
+	}
+}
+
+func TestProcessFile_G92MoveCoordinates(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		parameters string
+		expected   string
+	}{
+		{name: "current frame by default", expected: "G1 X-5 Y10 ; park"},
+		{name: "frame before G92 when enabled", parameters: "ApplyG92Offsets = true", expected: "G1 X105 Y130 ; park"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, "input.gcode")
+			outputPath := filepath.Join(tempDir, "output.gcode")
+
+			err := writeLinesToFile(inputPath, []string{"G1 Z0.2", "START_PRINT", "G1 X100 Y100 E0.1", "G1 X110 Y120 E0.1", "G92 X0 Y0", "G1 X-5 Y10 E0.1", "END_PRINT"})
+			if err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			err = ProcessFile(inputPath, outputPath, ProcessingRequest{Iterations: 1, Printer: "unit-tests", CustomTemplate: testPrinterTemplate(tt.parameters, "G1 X{{.Positions.LastPrintX}} Y{{.Positions.LastPrintY}} ; park")})
+			if err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+
+			lines, err := readLinesFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			var moves []string
+
+			for _, line := range lines {
+				if strings.HasSuffix(line, "; park") {
+					moves = append(moves, line)
+				}
+			}
+
+			if !equalStringSlices(moves, []string{tt.expected}) {
+				t.Errorf("Expected park move %q, got %v", tt.expected, moves)
+			}
+		})
+	}
+}
+
+func TestProcessFile_MultiRegionOutputSize(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("MultiRegion = true", "; next")
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"START_PRINT", "BODY_A", "END_PRINT", "START_PRINT", "BODY_B", "END_PRINT"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	// Each region alone fits the limit, both together don't
+	iterations := MaxOutputSize / int64(len("BODY_A\nEND_PRINT\n"))
+
+	err = ProcessFile(inputPath, outputPath, ProcessingRequest{Iterations: iterations, Printer: "unit-tests", CustomTemplate: customTemplate})
+
+	expected := fmt.Sprintf("of a %d byte body exceed the output limit", 2*len("BODY_A\nEND_PRINT\n"))
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error containing %q, got %v", expected, err)
+	}
+}
+
+func TestProcessFile_MultiRegionCanceled(t *testing.T) {
+	t.Parallel()
+
+	customTemplate := testPrinterTemplate("MultiRegion = true", "; next")
+
+	inputPath := filepath.Join(t.TempDir(), "input.gcode")
+
+	err := writeLinesToFile(inputPath, []string{"START_PRINT", "BODY_A", "END_PRINT"})
+	if err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	processor, err := NewStreamingProcessor(ProcessingRequest{Iterations: 2, Printer: "unit-tests", CustomTemplate: customTemplate})
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	processor.ctx = ctx
+
+	_, err = processor.findRegions(inputPath)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancellation to be kept in the region search error, got %v", err)
+	}
+}
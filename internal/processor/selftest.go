@@ -0,0 +1,117 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SelfTestIterations is how often SelfTest loops the generated sample
+const SelfTestIterations = 3
+
+// SelfTestCheck is one property of the self-test output and whether it holds
+type SelfTestCheck struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+// SelfTest loops a sample generated by GenerateSample SelfTestIterations times with the embedded
+// printer definition and checks the structure of the output, e.g. to validate a new profile without
+// the web UI. The error is only set when the test couldn't run, failed checks are reported in the
+// result.
+func SelfTest(printerName string) ([]SelfTestCheck, error) {
+	sample, err := GenerateSample(printerName)
+	if err != nil {
+		return nil, err
+	}
+
+	tempDir, err := os.MkdirTemp("", "printloop-selftest-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create self-test directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath := filepath.Join(tempDir, "sample.gcode")
+	outputPath := filepath.Join(tempDir, "output.gcode")
+
+	err = os.WriteFile(inputPath, sample, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write self-test sample: %w", err)
+	}
+
+	processor, err := NewStreamingProcessor(ProcessingRequest{Iterations: SelfTestIterations, Printer: printerName})
+	if err != nil {
+		return nil, err
+	}
+
+	err = processor.ProcessFile(inputPath, outputPath)
+	if err != nil {
+		return []SelfTestCheck{{Name: "process", Detail: err.Error()}}, nil
+	}
+
+	output, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read self-test output: %w", err)
+	}
+
+	checks := []SelfTestCheck{{Name: "process", Passed: true}}
+	checks = append(checks, verifySelfTest(splitSelfTestLines(sample), splitSelfTestLines(output), processor.positions, SelfTestIterations)...)
+
+	warnings := processor.Warnings()
+	checks = append(checks, SelfTestCheck{Name: "warnings", Passed: len(warnings) == 0, Detail: strings.Join(warnings, "; ")})
+
+	return checks, nil
+}
+
+// verifySelfTest checks that output keeps the header and footer of sample and repeats its body
+// iterations times, positions being the sections found in sample
+func verifySelfTest(sample, output []string, positions MarkerPositions, iterations int64) []SelfTestCheck {
+	header := sample[:positions.EndInitSectionLastLine+1]
+	body := sample[positions.EndInitSectionLastLine+1 : positions.EndPrintSectionFirstLine]
+	footer := sample[positions.EndPrintSectionLastLine+1:]
+
+	headerCheck := SelfTestCheck{Name: "header", Passed: len(output) >= len(header) && slices.Equal(output[:len(header)], header)}
+	if !headerCheck.Passed {
+		headerCheck.Detail = fmt.Sprintf("output doesn't start with the %d header lines of the sample", len(header))
+	}
+
+	bodyCheck := SelfTestCheck{Name: "body", Passed: countBlock(output, body) == iterations}
+	if !bodyCheck.Passed {
+		bodyCheck.Detail = fmt.Sprintf("body found %d times, expected %d", countBlock(output, body), iterations)
+	}
+
+	footerCheck := SelfTestCheck{Name: "footer", Passed: len(output) >= len(footer) && slices.Equal(output[len(output)-len(footer):], footer)}
+	if !footerCheck.Passed {
+		footerCheck.Detail = fmt.Sprintf("output doesn't end with the %d footer lines of the sample", len(footer))
+	}
+
+	return []SelfTestCheck{headerCheck, bodyCheck, footerCheck}
+}
+
+// countBlock returns how often block appears in lines as consecutive lines, without overlaps
+func countBlock(lines, block []string) int64 {
+	if len(block) == 0 {
+		return 0
+	}
+
+	var count int64
+
+	for i := 0; i+len(block) <= len(lines); {
+		if slices.Equal(lines[i:i+len(block)], block) {
+			count++
+			i += len(block)
+		} else {
+			i++
+		}
+	}
+
+	return count
+}
+
+// splitSelfTestLines splits data into lines without the final empty line
+func splitSelfTestLines(data []byte) []string {
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	t.Parallel()
+
+	for _, printer := range []string{"a1", "a1-mini", "klipper"} {
+		t.Run(printer, func(t *testing.T) {
+			t.Parallel()
+
+			checks, err := SelfTest(printer)
+			if err != nil {
+				t.Fatalf("Self-test failed to run: %v", err)
+			}
+
+			if len(checks) != 5 {
+				t.Errorf("Expected 5 checks, got %v", checks)
+			}
+
+			for _, check := range checks {
+				if !check.Passed {
+					t.Errorf("Check %s failed: %s", check.Name, check.Detail)
+				}
+			}
+		})
+	}
+}
+
+func TestSelfTest_UnknownPrinter(t *testing.T) {
+	t.Parallel()
+
+	_, err := SelfTest("nonexistent")
+	if err == nil {
+		t.Error("Expected error for unknown printer")
+	}
+}
+
+func TestVerifySelfTest(t *testing.T) {
+	t.Parallel()
+
+	sample := []string{"G28", "START_PRINT", "G1 X10 E1", "G1 X20 E1", "END_PRINT", "M84"}
+	positions := MarkerPositions{EndInitSectionFirstLine: 1, EndInitSectionLastLine: 1, EndPrintSectionFirstLine: 4, EndPrintSectionLastLine: 4}
+
+	tests := []struct {
+		name   string
+		output []string
+		failed []string
+	}{
+		{
+			name:   "looped",
+			output: []string{"G28", "START_PRINT", "G1 X10 E1", "G1 X20 E1", "END_PRINT", "; next", "G1 X10 E1", "G1 X20 E1", "END_PRINT", "M84"},
+		},
+		{
+			name:   "body missing",
+			output: []string{"G28", "START_PRINT", "G1 X10 E1", "G1 X20 E1", "END_PRINT", "M84"},
+			failed: []string{"body"},
+		},
+		{
+			name:   "truncated",
+			output: []string{"G28", "START_PRINT", "G1 X10 E1", "G1 X20 E1", "END_PRINT", "; next", "G1 X10 E1", "G1 X20 E1"},
+			failed: []string{"footer"},
+		},
+		{
+			name:   "header changed",
+			output: []string{"G28 X", "START_PRINT", "G1 X10 E1", "G1 X20 E1", "END_PRINT", "; next", "G1 X10 E1", "G1 X20 E1", "END_PRINT", "M84"},
+			failed: []string{"header"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var failed []string
+
+			for _, check := range verifySelfTest(sample, tt.output, positions, 2) {
+				if !check.Passed {
+					failed = append(failed, check.Name)
+				}
+			}
+
+			if !equalStringSlices(failed, tt.failed) {
+				t.Errorf("Expected failed checks %v, got %v", tt.failed, failed)
+			}
+		})
+	}
+}
@@ -2,21 +2,30 @@ package strategy
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 )
 
 // AfterFirstAppearStrategy finds the first appearance of markers
-type AfterFirstAppearStrategy struct{}
+type AfterFirstAppearStrategy struct {
+	Mode          MatchMode // How marker lines are compared with file lines
+	CommentPrefix string    // Start of comment lines allowed between marker lines, ";" when empty
+}
+
+func (s *AfterFirstAppearStrategy) FindInitSectionPosition(ctx context.Context, filePath string, markers []string) (int64, int64, error) {
+	matcher, err := NewMatcher(s.Mode, s.CommentPrefix, markers)
+	if err != nil {
+		return 0, 0, err
+	}
 
-func (s *AfterFirstAppearStrategy) FindInitSectionPosition(filePath string, markers []string) (int64, int64, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return 0, 0, err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(contextReader{ctx: ctx, reader: file})
 	lineNum := int64(0)
 
 	// Sliding window for multiline marker detection
@@ -33,24 +42,34 @@ func (s *AfterFirstAppearStrategy) FindInitSectionPosition(filePath string, mark
 		}
 
 		// Try to find start marker pattern in current window
-		if matchPos := findStartMarkerInWindow(window, markers, lineNum-int64(len(window))+1); matchPos != nil {
+		if matchPos := findStartMarkerInWindow(window, matcher, lineNum-int64(len(window))+1); matchPos != nil {
 			return matchPos.begin, matchPos.end, nil
 		}
 
 		lineNum++
 	}
 
-	return 0, 0, fmt.Errorf("start marker not found: %v", markers)
+	err = scanner.Err()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return 0, 0, fmt.Errorf("start marker not found in %s: %q", searchedLines(-1, lineNum), markers)
 }
 
-func (s *AfterFirstAppearStrategy) FindPrintSectionPosition(filePath string, markers []string, searchFromLine int64) (int64, int64, error) {
+func (s *AfterFirstAppearStrategy) FindPrintSectionPosition(ctx context.Context, filePath string, markers []string, searchFromLine int64) (int64, int64, error) {
+	matcher, err := NewMatcher(s.Mode, s.CommentPrefix, markers)
+	if err != nil {
+		return 0, 0, err
+	}
+
 	file, err := os.Open(filePath)
 	if err != nil {
 		return 0, 0, err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(contextReader{ctx: ctx, reader: file})
 	lineNum := int64(0)
 
 	// Skip to the search start position
@@ -75,12 +94,17 @@ func (s *AfterFirstAppearStrategy) FindPrintSectionPosition(filePath string, mar
 		currentWindowStart := lineNum - int64(len(window)) + 1
 
 		// Try to find marker pattern in current window
-		if matchPos := findStartMarkerInWindow(window, markers, currentWindowStart); matchPos != nil {
+		if matchPos := findStartMarkerInWindow(window, matcher, currentWindowStart); matchPos != nil {
 			return matchPos.begin, matchPos.end, nil
 		}
 
 		lineNum++
 	}
 
-	return 0, 0, fmt.Errorf("end marker not found after line %d: %v", searchFromLine, markers)
+	err = scanner.Err()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return 0, 0, fmt.Errorf("end marker not found in %s: %q", searchedLines(searchFromLine, lineNum), markers)
 }
@@ -1,6 +1,7 @@
 package strategy
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -295,7 +296,7 @@ func TestAfterFirstAppearStrategy(t *testing.T) {
 			strategy := &AfterFirstAppearStrategy{}
 
 			// Test FindInitSectionPosition
-			initFirst, initLast, initErr := strategy.FindInitSectionPosition(testFile, tt.initMarkers)
+			initFirst, initLast, initErr := strategy.FindInitSectionPosition(context.Background(), testFile, tt.initMarkers)
 
 			if tt.expectInitError {
 				if initErr == nil {
@@ -317,7 +318,7 @@ func TestAfterFirstAppearStrategy(t *testing.T) {
 
 			// Test FindPrintSectionPosition
 			if !tt.expectInitError && !tt.expectPrintError {
-				printFirst, printLast, printErr := strategy.FindPrintSectionPosition(testFile, tt.printMarkers, tt.searchFromLine)
+				printFirst, printLast, printErr := strategy.FindPrintSectionPosition(context.Background(), testFile, tt.printMarkers, tt.searchFromLine)
 				if printErr != nil {
 					t.Errorf("Unexpected print error: %v", printErr)
 				} else {
@@ -330,7 +331,7 @@ func TestAfterFirstAppearStrategy(t *testing.T) {
 					}
 				}
 			} else if tt.expectPrintError {
-				_, _, printErr := strategy.FindPrintSectionPosition(testFile, tt.printMarkers, tt.searchFromLine)
+				_, _, printErr := strategy.FindPrintSectionPosition(context.Background(), testFile, tt.printMarkers, tt.searchFromLine)
 				if printErr == nil {
 					t.Errorf("Expected print error but got none")
 				}
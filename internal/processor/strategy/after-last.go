@@ -2,15 +2,23 @@ package strategy
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
-	"strings"
 )
 
 // AfterLastAppearStrategy finds the last appearance of markers
-type AfterLastAppearStrategy struct{}
+type AfterLastAppearStrategy struct {
+	Mode          MatchMode // How marker lines are compared with file lines
+	CommentPrefix string    // Start of comment lines allowed between marker lines, ";" when empty
+}
+
+func (s *AfterLastAppearStrategy) FindInitSectionPosition(ctx context.Context, filePath string, markers []string) (int64, int64, error) {
+	matcher, err := NewMatcher(s.Mode, s.CommentPrefix, markers)
+	if err != nil {
+		return 0, 0, err
+	}
 
-func (s *AfterLastAppearStrategy) FindInitSectionPosition(filePath string, markers []string) (int64, int64, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return 0, 0, err
@@ -20,7 +28,7 @@ func (s *AfterLastAppearStrategy) FindInitSectionPosition(filePath string, marke
 	// Read all lines into memory for easier processing
 	var lines []string
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(contextReader{ctx: ctx, reader: file})
 	for scanner.Scan() {
 		lines = append(lines, scanner.Text())
 	}
@@ -35,9 +43,8 @@ func (s *AfterLastAppearStrategy) FindInitSectionPosition(filePath string, marke
 
 	if len(markers) == 1 {
 		// Single line marker - find last occurrence
-		marker := strings.TrimSpace(markers[0])
 		for i, line := range lines {
-			if strings.Contains(strings.TrimSpace(line), marker) {
+			if matcher.Matches(line, 0) {
 				lastFoundBegin = int64(i)
 				lastFoundEnd = int64(i)
 			}
@@ -45,7 +52,7 @@ func (s *AfterLastAppearStrategy) FindInitSectionPosition(filePath string, marke
 	} else {
 		// Multiline marker - scan from each position and try to match the pattern
 		for startPos := 0; startPos <= len(lines)-len(markers); startPos++ {
-			if match := s.tryMatchMultilinePattern(lines, startPos, markers); match != nil {
+			if match := s.tryMatchMultilinePattern(lines, startPos, matcher); match != nil {
 				lastFoundBegin = match.begin
 				lastFoundEnd = match.end
 			}
@@ -53,13 +60,18 @@ func (s *AfterLastAppearStrategy) FindInitSectionPosition(filePath string, marke
 	}
 
 	if lastFoundBegin == -1 {
-		return 0, 0, fmt.Errorf("start marker not found: %v", markers)
+		return 0, 0, fmt.Errorf("start marker not found in %s: %q", searchedLines(-1, int64(len(lines))), markers)
 	}
 
 	return lastFoundBegin, lastFoundEnd, nil
 }
 
-func (s *AfterLastAppearStrategy) FindPrintSectionPosition(filePath string, markers []string, searchFromLine int64) (int64, int64, error) {
+func (s *AfterLastAppearStrategy) FindPrintSectionPosition(ctx context.Context, filePath string, markers []string, searchFromLine int64) (int64, int64, error) {
+	matcher, err := NewMatcher(s.Mode, s.CommentPrefix, markers)
+	if err != nil {
+		return 0, 0, err
+	}
+
 	file, err := os.Open(filePath)
 	if err != nil {
 		return 0, 0, err
@@ -69,7 +81,7 @@ func (s *AfterLastAppearStrategy) FindPrintSectionPosition(filePath string, mark
 	// Read all lines into memory for easier processing
 	var lines []string
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(contextReader{ctx: ctx, reader: file})
 	for scanner.Scan() {
 		lines = append(lines, scanner.Text())
 	}
@@ -84,9 +96,8 @@ func (s *AfterLastAppearStrategy) FindPrintSectionPosition(filePath string, mark
 
 	if len(markers) == 1 {
 		// Single line marker - find last occurrence after searchFromLine
-		marker := strings.TrimSpace(markers[0])
 		for i := int(searchFromLine) + 1; i < len(lines); i++ {
-			if strings.Contains(strings.TrimSpace(lines[i]), marker) {
+			if matcher.Matches(lines[i], 0) {
 				lastFoundBegin = int64(i)
 				lastFoundEnd = int64(i)
 			}
@@ -94,7 +105,7 @@ func (s *AfterLastAppearStrategy) FindPrintSectionPosition(filePath string, mark
 	} else {
 		// Multiline marker - scan from searchFromLine+1 and try to match the pattern
 		for startPos := int(searchFromLine) + 1; startPos <= len(lines)-len(markers); startPos++ {
-			if match := s.tryMatchMultilinePattern(lines, startPos, markers); match != nil {
+			if match := s.tryMatchMultilinePattern(lines, startPos, matcher); match != nil {
 				lastFoundBegin = match.begin
 				lastFoundEnd = match.end
 			}
@@ -102,39 +113,21 @@ func (s *AfterLastAppearStrategy) FindPrintSectionPosition(filePath string, mark
 	}
 
 	if lastFoundBegin == -1 {
-		return 0, 0, fmt.Errorf("end marker not found after line %d: %v", searchFromLine, markers)
+		return 0, 0, fmt.Errorf("end marker not found in %s: %q", searchedLines(searchFromLine, int64(len(lines))), markers)
 	}
 
 	return lastFoundBegin, lastFoundEnd, nil
 }
 
 // tryMatchMultilinePattern attempts to match multiline pattern starting from given position
-func (s *AfterLastAppearStrategy) tryMatchMultilinePattern(lines []string, startPos int, markers []string) *startMarkerMatch {
-	linePos := startPos
-	markerIdx := 0
-
-	for markerIdx < len(markers) && linePos < len(lines) {
-		cleanLine := strings.TrimSpace(lines[linePos])
-		cleanMarker := strings.TrimSpace(markers[markerIdx])
-
-		if strings.Contains(cleanLine, cleanMarker) {
-			markerIdx++
-			linePos++
-		} else if cleanLine == "" || strings.HasPrefix(cleanLine, ";") {
-			// Skip empty or comment lines
-			linePos++
-		} else {
-			// This line doesn't match and isn't skippable
-			return nil
-		}
+func (s *AfterLastAppearStrategy) tryMatchMultilinePattern(lines []string, startPos int, matcher *Matcher) *startMarkerMatch {
+	_, last, ok := matchMultiline(lines, startPos, matcher)
+	if !ok {
+		return nil
 	}
 
-	if markerIdx == len(markers) {
-		return &startMarkerMatch{
-			begin: int64(startPos),
-			end:   int64(linePos - 1),
-		}
+	return &startMarkerMatch{
+		begin: int64(startPos),
+		end:   int64(last),
 	}
-
-	return nil
 }
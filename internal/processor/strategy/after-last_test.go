@@ -1,6 +1,7 @@
 package strategy
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -274,7 +275,7 @@ func TestAfterLastAppearStrategy(t *testing.T) {
 			strategy := &AfterLastAppearStrategy{}
 
 			// Test FindInitSectionPosition
-			initFirst, initLast, initErr := strategy.FindInitSectionPosition(testFile, tt.initMarkers)
+			initFirst, initLast, initErr := strategy.FindInitSectionPosition(context.Background(), testFile, tt.initMarkers)
 
 			if tt.expectInitError {
 				if initErr == nil {
@@ -296,7 +297,7 @@ func TestAfterLastAppearStrategy(t *testing.T) {
 
 			// Test FindPrintSectionPosition
 			if !tt.expectInitError && !tt.expectPrintError {
-				printFirst, printLast, printErr := strategy.FindPrintSectionPosition(testFile, tt.printMarkers, tt.searchFromLine)
+				printFirst, printLast, printErr := strategy.FindPrintSectionPosition(context.Background(), testFile, tt.printMarkers, tt.searchFromLine)
 				if printErr != nil {
 					t.Errorf("Unexpected print error: %v", printErr)
 				} else {
@@ -309,7 +310,7 @@ func TestAfterLastAppearStrategy(t *testing.T) {
 					}
 				}
 			} else if tt.expectPrintError {
-				_, _, printErr := strategy.FindPrintSectionPosition(testFile, tt.printMarkers, tt.searchFromLine)
+				_, _, printErr := strategy.FindPrintSectionPosition(context.Background(), testFile, tt.printMarkers, tt.searchFromLine)
 				if printErr == nil {
 					t.Errorf("Expected print error but got none")
 				}
@@ -2,21 +2,30 @@ package strategy
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 )
 
 // BeforeCommandStrategy finds markers that appear before specific commands
-type BeforeCommandStrategy struct{}
+type BeforeCommandStrategy struct {
+	Mode          MatchMode // How marker lines are compared with file lines
+	CommentPrefix string    // Start of comment lines allowed between marker lines, ";" when empty
+}
+
+func (s *BeforeCommandStrategy) FindInitSectionPosition(ctx context.Context, filePath string, markers []string) (int64, int64, error) {
+	matcher, err := NewMatcher(s.Mode, s.CommentPrefix, markers)
+	if err != nil {
+		return 0, 0, err
+	}
 
-func (s *BeforeCommandStrategy) FindInitSectionPosition(filePath string, markers []string) (int64, int64, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return 0, 0, err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(contextReader{ctx: ctx, reader: file})
 	lineNum := int64(0)
 
 	// Sliding window for multiline marker detection
@@ -33,24 +42,34 @@ func (s *BeforeCommandStrategy) FindInitSectionPosition(filePath string, markers
 		}
 
 		// Try to find start marker pattern in current window
-		if matchPos := findStartMarkerInWindow(window, markers, lineNum-int64(len(window))+1); matchPos != nil {
+		if matchPos := findStartMarkerInWindow(window, matcher, lineNum-int64(len(window))+1); matchPos != nil {
 			return matchPos.begin, matchPos.end, nil
 		}
 
 		lineNum++
 	}
 
-	return 0, 0, fmt.Errorf("start marker not found before commands: %v", markers)
+	err = scanner.Err()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return 0, 0, fmt.Errorf("start marker not found before commands in %s: %q", searchedLines(-1, lineNum), markers)
 }
 
-func (s *BeforeCommandStrategy) FindPrintSectionPosition(filePath string, markers []string, searchFromLine int64) (int64, int64, error) {
+func (s *BeforeCommandStrategy) FindPrintSectionPosition(ctx context.Context, filePath string, markers []string, searchFromLine int64) (int64, int64, error) {
+	matcher, err := NewMatcher(s.Mode, s.CommentPrefix, markers)
+	if err != nil {
+		return 0, 0, err
+	}
+
 	file, err := os.Open(filePath)
 	if err != nil {
 		return 0, 0, err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(contextReader{ctx: ctx, reader: file})
 	lineNum := int64(0)
 
 	// Skip to the search start position
@@ -75,12 +94,17 @@ func (s *BeforeCommandStrategy) FindPrintSectionPosition(filePath string, marker
 		currentWindowStart := lineNum - int64(len(window)) + 1
 
 		// Try to find marker pattern in current window
-		if matchPos := findStartMarkerInWindow(window, markers, currentWindowStart); matchPos != nil {
+		if matchPos := findStartMarkerInWindow(window, matcher, currentWindowStart); matchPos != nil {
 			return matchPos.begin, matchPos.end, nil
 		}
 
 		lineNum++
 	}
 
-	return 0, 0, fmt.Errorf("end marker not found before commands after line %d: %v", searchFromLine, markers)
+	err = scanner.Err()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return 0, 0, fmt.Errorf("end marker not found before commands in %s: %q", searchedLines(searchFromLine, lineNum), markers)
 }
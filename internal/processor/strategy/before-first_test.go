@@ -1,6 +1,7 @@
 package strategy
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -315,7 +316,7 @@ func TestBeforeCommandStrategy(t *testing.T) {
 			strategy := &BeforeCommandStrategy{}
 
 			// Test FindInitSectionPosition
-			initFirst, initLast, initErr := strategy.FindInitSectionPosition(testFile, tt.initMarkers)
+			initFirst, initLast, initErr := strategy.FindInitSectionPosition(context.Background(), testFile, tt.initMarkers)
 
 			if tt.expectInitError {
 				if initErr == nil {
@@ -337,7 +338,7 @@ func TestBeforeCommandStrategy(t *testing.T) {
 
 			// Test FindPrintSectionPosition
 			if !tt.expectInitError && !tt.expectPrintError {
-				printFirst, printLast, printErr := strategy.FindPrintSectionPosition(testFile, tt.printMarkers, tt.searchFromLine)
+				printFirst, printLast, printErr := strategy.FindPrintSectionPosition(context.Background(), testFile, tt.printMarkers, tt.searchFromLine)
 				if printErr != nil {
 					t.Errorf("Unexpected print error: %v", printErr)
 				} else {
@@ -350,7 +351,7 @@ func TestBeforeCommandStrategy(t *testing.T) {
 					}
 				}
 			} else if tt.expectPrintError {
-				_, _, printErr := strategy.FindPrintSectionPosition(testFile, tt.printMarkers, tt.searchFromLine)
+				_, _, printErr := strategy.FindPrintSectionPosition(context.Background(), testFile, tt.printMarkers, tt.searchFromLine)
 				if printErr == nil {
 					t.Errorf("Expected print error but got none")
 				}
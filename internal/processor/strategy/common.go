@@ -1,6 +1,147 @@
 package strategy
 
-import "strings"
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// MatchMode selects how marker lines are compared with G-code lines
+type MatchMode string
+
+const (
+	MatchContains MatchMode = "contains" // The trimmed line contains the trimmed marker, the default
+	MatchRegex    MatchMode = "regex"    // The trimmed marker is a regular expression matched against the trimmed line
+	// Like MatchContains, but the lines of a multiline marker may appear in any order, e.g. for slicers
+	// reordering setup commands. They still form one block of as many lines, apart from empty and
+	// comment lines.
+	MatchUnordered MatchMode = "unordered"
+)
+
+// Matcher compares G-code lines with the lines of one marker
+type Matcher struct {
+	markers   []string         // Trimmed marker lines
+	patterns  []*regexp.Regexp // Compiled marker lines in MatchRegex mode, nil otherwise
+	unordered bool             // Marker lines match in any order, MatchUnordered
+	comment   string           // Start of the comment lines skipped between marker lines
+}
+
+// NewMatcher prepares markers for matching in mode, compiling them in MatchRegex mode. An empty mode
+// is MatchContains, an empty commentPrefix ";".
+func NewMatcher(mode MatchMode, commentPrefix string, markers []string) (*Matcher, error) {
+	if commentPrefix == "" {
+		commentPrefix = ";"
+	}
+
+	m := &Matcher{markers: make([]string, len(markers)), comment: commentPrefix}
+
+	for i, marker := range markers {
+		m.markers[i] = strings.TrimSpace(marker)
+	}
+
+	switch mode {
+	case "", MatchContains:
+		return m, nil
+	case MatchUnordered:
+		m.unordered = true
+		return m, nil
+	case MatchRegex:
+		m.patterns = make([]*regexp.Regexp, len(m.markers))
+
+		for i, marker := range m.markers {
+			pattern, err := regexp.Compile(marker)
+			if err != nil {
+				return nil, fmt.Errorf("invalid marker regex %q: %w", marker, err)
+			}
+
+			m.patterns[i] = pattern
+		}
+
+		return m, nil
+	default:
+		return nil, fmt.Errorf("invalid MatchMode value %q: must be %s, %s or %s", mode, MatchContains, MatchRegex, MatchUnordered)
+	}
+}
+
+// Len returns the number of marker lines
+func (m *Matcher) Len() int {
+	return len(m.markers)
+}
+
+// Matches reports whether line matches marker line i
+func (m *Matcher) Matches(line string, i int) bool {
+	cleanLine := strings.TrimSpace(line)
+
+	if m.patterns != nil {
+		return m.patterns[i].MatchString(cleanLine)
+	}
+
+	return strings.Contains(cleanLine, m.markers[i])
+}
+
+// skippable reports whether a trimmed line that matches no marker line may appear between marker
+// lines, i.e. it is empty or a comment
+func (m *Matcher) skippable(cleanLine string) bool {
+	return cleanLine == "" || strings.HasPrefix(cleanLine, m.comment)
+}
+
+// nextMatch returns the marker line that line matches after matched marker lines were found, -1 when
+// it matches none. In order that is marker line matched, unordered any marker line not in used.
+func (m *Matcher) nextMatch(line string, matched int, used []bool) int {
+	if !m.unordered {
+		if m.Matches(line, matched) {
+			return matched
+		}
+
+		return -1
+	}
+
+	for i := range m.markers {
+		if !used[i] && m.Matches(line, i) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// matchMultiline matches all marker lines from lines[start] on, skipping empty and comment lines. It
+// returns the indexes of the first and last marker lines, ok is false when another line comes first.
+func matchMultiline(lines []string, start int, matcher *Matcher) (int, int, bool) {
+	var used []bool
+	if matcher.unordered {
+		used = make([]bool, matcher.Len())
+	}
+
+	first, last := -1, -1
+	matched := 0
+
+	for i := start; i < len(lines) && matched < matcher.Len(); i++ {
+		cleanLine := strings.TrimSpace(lines[i])
+
+		if k := matcher.nextMatch(cleanLine, matched, used); k >= 0 {
+			if used != nil {
+				used[k] = true
+			}
+
+			if first == -1 {
+				first = i
+			}
+
+			last = i
+			matched++
+		} else if !matcher.skippable(cleanLine) {
+			// This line doesn't match and isn't skippable
+			return 0, 0, false
+		}
+	}
+
+	return first, last, matched == matcher.Len()
+}
 
 type startMarkerMatch struct {
 	begin int64
@@ -8,11 +149,11 @@ type startMarkerMatch struct {
 }
 
 // findStartMarkerInWindow searches for start marker pattern in the sliding window
-func findStartMarkerInWindow(window []string, markers []string, windowStartLine int64) *startMarkerMatch {
-	if len(markers) == 1 {
+func findStartMarkerInWindow(window []string, matcher *Matcher, windowStartLine int64) *startMarkerMatch {
+	if matcher.Len() == 1 {
 		// Single line marker
 		for i, line := range window {
-			if strings.Contains(strings.TrimSpace(line), strings.TrimSpace(markers[0])) {
+			if matcher.Matches(line, 0) {
 				pos := windowStartLine + int64(i)
 				return &startMarkerMatch{begin: pos, end: pos}
 			}
@@ -23,7 +164,7 @@ func findStartMarkerInWindow(window []string, markers []string, windowStartLine
 
 	// Multiline marker search
 	for startIdx := range window {
-		if match := tryMatchMultilineStart(window, startIdx, windowStartLine, markers); match != nil {
+		if match := tryMatchMultilineStart(window, startIdx, windowStartLine, matcher); match != nil {
 			return match
 		}
 	}
@@ -32,37 +173,106 @@ func findStartMarkerInWindow(window []string, markers []string, windowStartLine
 }
 
 // tryMatchMultilineStart attempts to match multiline start marker from given position
-func tryMatchMultilineStart(window []string, startIdx int, windowStartLine int64, markers []string) *startMarkerMatch {
-	windowIdx := startIdx
-	markerIdx := 0
-	firstMarkerLine := int64(-1)
-	lastMarkerLine := int64(-1)
-
-	for markerIdx < len(markers) && windowIdx < len(window) {
-		cleanLine := strings.TrimSpace(window[windowIdx])
-		cleanMarker := strings.TrimSpace(markers[markerIdx])
-
-		if strings.Contains(cleanLine, cleanMarker) {
-			currentLine := windowStartLine + int64(windowIdx)
-			if firstMarkerLine == -1 {
-				firstMarkerLine = currentLine
+func tryMatchMultilineStart(window []string, startIdx int, windowStartLine int64, matcher *Matcher) *startMarkerMatch {
+	first, last, ok := matchMultiline(window, startIdx, matcher)
+	if !ok {
+		return nil
+	}
+
+	return &startMarkerMatch{begin: windowStartLine + int64(first), end: windowStartLine + int64(last)}
+}
+
+// searchedLines describes the 1-based line range a search after the 0-based searchFromLine covered in
+// a file of totalLines lines, for not found errors
+func searchedLines(searchFromLine, totalLines int64) string {
+	return fmt.Sprintf("lines %d-%d", searchFromLine+2, totalLines)
+}
+
+// PartialMatch is the longest run of leading marker lines found where a complete marker was not
+type PartialMatch struct {
+	Matched int   // Number of leading marker lines matched, 0 when not even the first one was found
+	Line    int64 // Line of the first matched marker line (0-based)
+}
+
+// FindPartialMatch returns the longest partial match of a multiline marker after searchFromLine,
+// allowing empty and comment lines between marker lines like the strategies do. The earliest of
+// equally long matches is returned.
+func FindPartialMatch(ctx context.Context, filePath string, markers []string, mode MatchMode, commentPrefix string, searchFromLine int64) (PartialMatch, error) {
+	matcher, err := NewMatcher(mode, commentPrefix, markers)
+	if err != nil {
+		return PartialMatch{}, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return PartialMatch{}, err
+	}
+	defer file.Close()
+
+	var lines []string
+
+	scanner := bufio.NewScanner(contextReader{ctx: ctx, reader: file})
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return PartialMatch{}, err
+	}
+
+	var best PartialMatch
+
+	for startPos := int(searchFromLine) + 1; startPos < len(lines) && len(markers) > 0; startPos++ {
+		var used []bool
+		if matcher.unordered {
+			used = make([]bool, matcher.Len())
+		}
+
+		first := matcher.nextMatch(lines[startPos], 0, used)
+		if first < 0 {
+			continue
+		}
+
+		if used != nil {
+			used[first] = true
+		}
+
+		matched := 1
+
+		for linePos := startPos + 1; linePos < len(lines) && matched < len(markers); linePos++ {
+			cleanLine := strings.TrimSpace(lines[linePos])
+
+			if k := matcher.nextMatch(cleanLine, matched, used); k >= 0 {
+				if used != nil {
+					used[k] = true
+				}
+
+				matched++
+			} else if !matcher.skippable(cleanLine) {
+				break
 			}
+		}
 
-			lastMarkerLine = currentLine
-			markerIdx++
-			windowIdx++
-		} else if cleanLine == "" || strings.HasPrefix(cleanLine, ";") {
-			// Skip empty or comment lines
-			windowIdx++
-		} else {
-			// This line doesn't match and isn't skippable
-			return nil
+		if matched > best.Matched {
+			best = PartialMatch{Matched: matched, Line: int64(startPos)}
 		}
 	}
 
-	if markerIdx == len(markers) {
-		return &startMarkerMatch{begin: firstMarkerLine, end: lastMarkerLine}
+	return best, nil
+}
+
+// contextReader fails reads once ctx is done so that scans over large files can be cancelled
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	err := r.ctx.Err()
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	return r.reader.Read(p)
 }
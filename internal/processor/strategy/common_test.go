@@ -0,0 +1,357 @@
+package strategy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStrategies_CancelledContext(t *testing.T) {
+	t.Parallel()
+
+	testFile := filepath.Join(t.TempDir(), "test.gcode")
+
+	err := os.WriteFile(testFile, []byte("HEADER\nSTART\nBODY\nEND\nFOOTER\n"), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	strategies := map[string]interface {
+		FindInitSectionPosition(ctx context.Context, filePath string, markers []string) (int64, int64, error)
+		FindPrintSectionPosition(ctx context.Context, filePath string, markers []string, searchFromLine int64) (int64, int64, error)
+	}{
+		"after_first_appear":  &AfterFirstAppearStrategy{},
+		"after_last_appear":   &AfterLastAppearStrategy{},
+		"before_first_appear": &BeforeCommandStrategy{},
+	}
+
+	for name, strategy := range strategies {
+		_, _, err := strategy.FindInitSectionPosition(ctx, testFile, []string{"START"})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: FindInitSectionPosition error = %v, want context.Canceled", name, err)
+		}
+
+		_, _, err = strategy.FindPrintSectionPosition(ctx, testFile, []string{"END"}, 1)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: FindPrintSectionPosition error = %v, want context.Canceled", name, err)
+		}
+	}
+}
+
+func TestStrategies_NotFoundRange(t *testing.T) {
+	t.Parallel()
+
+	testFile := filepath.Join(t.TempDir(), "test.gcode")
+
+	err := os.WriteFile(testFile, []byte("HEADER\nSTART\nBODY\nEND\nFOOTER\n"), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	for name, strategy := range map[string]interface {
+		FindInitSectionPosition(ctx context.Context, filePath string, markers []string) (int64, int64, error)
+		FindPrintSectionPosition(ctx context.Context, filePath string, markers []string, searchFromLine int64) (int64, int64, error)
+	}{
+		"after_first_appear":  &AfterFirstAppearStrategy{},
+		"after_last_appear":   &AfterLastAppearStrategy{},
+		"before_first_appear": &BeforeCommandStrategy{},
+	} {
+		_, _, err := strategy.FindInitSectionPosition(context.Background(), testFile, []string{"MISSING"})
+		if err == nil || !strings.Contains(err.Error(), `in lines 1-5: ["MISSING"]`) {
+			t.Errorf("%s: FindInitSectionPosition error = %v, want the searched range and markers", name, err)
+		}
+
+		_, _, err = strategy.FindPrintSectionPosition(context.Background(), testFile, []string{"MISSING"}, 1)
+		if err == nil || !strings.Contains(err.Error(), `in lines 3-5: ["MISSING"]`) {
+			t.Errorf("%s: FindPrintSectionPosition error = %v, want the searched range and markers", name, err)
+		}
+	}
+}
+
+func TestFindPartialMatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		content        string
+		markers        []string
+		searchFromLine int64
+		expected       PartialMatch
+	}{
+		{
+			name:           "two of three with comment in between",
+			content:        "HEADER\nM400\n; pause\nM1002\nG1 X10\nFOOTER\n",
+			markers:        []string{"M400", "M1002", "M625"},
+			searchFromLine: -1,
+			expected:       PartialMatch{Matched: 2, Line: 1},
+		},
+		{
+			name:           "longest of several",
+			content:        "M400\nG1 X1\nM400\nM1002\nG1 X2\n",
+			markers:        []string{"M400", "M1002", "M625"},
+			searchFromLine: -1,
+			expected:       PartialMatch{Matched: 2, Line: 2},
+		},
+		{
+			name:           "before search start",
+			content:        "M400\nM1002\nG1 X1\nM400\nG1 X2\n",
+			markers:        []string{"M400", "M1002", "M625"},
+			searchFromLine: 1,
+			expected:       PartialMatch{Matched: 1, Line: 3},
+		},
+		{
+			name:           "first line missing",
+			content:        "M1002\nM625\n",
+			markers:        []string{"M400", "M1002", "M625"},
+			searchFromLine: -1,
+			expected:       PartialMatch{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			testFile := filepath.Join(t.TempDir(), "test.gcode")
+
+			err := os.WriteFile(testFile, []byte(tt.content), 0o644)
+			if err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			partial, err := FindPartialMatch(context.Background(), testFile, tt.markers, MatchContains, "", tt.searchFromLine)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if partial != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, partial)
+			}
+		})
+	}
+}
+
+func TestNewMatcher(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		mode     MatchMode
+		marker   string
+		line     string
+		expected bool
+	}{
+		{name: "contains default", mode: "", marker: "END_PRINT", line: "SET_GCODE_VARIABLE MACRO=END_PRINT", expected: true},
+		{name: "contains trims", mode: MatchContains, marker: " M625 ", line: "  M625", expected: true},
+		{name: "regex", mode: MatchRegex, marker: `M62[45]`, line: "M625 ; end", expected: true},
+		{name: "regex anchored start", mode: MatchRegex, marker: `^END_PRINT\b`, line: "SET_GCODE_VARIABLE MACRO=END_PRINT", expected: false},
+		{name: "regex anchored start trims line", mode: MatchRegex, marker: `^END_PRINT\b`, line: "  END_PRINT", expected: true},
+		{name: "regex word boundary", mode: MatchRegex, marker: `^END_PRINT\b`, line: "END_PRINT_COOLDOWN", expected: false},
+		{name: "regex anchored both ends", mode: MatchRegex, marker: `^M400$`, line: "M400 S1", expected: false},
+		{name: "regex alternation", mode: MatchRegex, marker: `^(PRINT_START|START_PRINT)\b`, line: "START_PRINT BED=60", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			matcher, err := NewMatcher(tt.mode, "", []string{tt.marker})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got := matcher.Matches(tt.line, 0); got != tt.expected {
+				t.Errorf("Matches(%q) with %s marker %q = %v, want %v", tt.line, tt.mode, tt.marker, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewMatcher_Invalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewMatcher(MatchRegex, "", []string{"M400", "(unclosed"})
+	if err == nil || !strings.Contains(err.Error(), `invalid marker regex "(unclosed"`) {
+		t.Errorf("Expected invalid regex error, got %v", err)
+	}
+
+	_, err = NewMatcher("glob", "", []string{"M400"})
+	if err == nil || !strings.Contains(err.Error(), `invalid MatchMode value "glob"`) {
+		t.Errorf("Expected invalid mode error, got %v", err)
+	}
+}
+
+func TestStrategies_RegexMarkers(t *testing.T) {
+	t.Parallel()
+
+	testFile := filepath.Join(t.TempDir(), "test.gcode")
+
+	content := "SET_GCODE_VARIABLE MACRO=END_PRINT VARIABLE=park VALUE=1\n" + // 0
+		"; START_PRINT is called below\n" + // 1
+		"START_PRINT BED=60 EXTRUDER=210\n" + // 2
+		"G1 X10 Y10 E1\n" + // 3
+		"M400\n" + // 4
+		"; layer end\n" + // 5
+		"SET_PRINT_STATS_INFO CURRENT_LAYER=2\n" + // 6
+		"G1 X20 Y20 E1\n" + // 7
+		"END_PRINT\n" + // 8
+		"M84\n" // 9
+
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		initMarkers   []string
+		printMarkers  []string
+		expectedInit  [2]int64
+		expectedPrint [2]int64
+	}{
+		{
+			name:          "anchored single line",
+			initMarkers:   []string{`^START_PRINT\b`},
+			printMarkers:  []string{`^END_PRINT\b`},
+			expectedInit:  [2]int64{2, 2},
+			expectedPrint: [2]int64{8, 8},
+		},
+		{
+			name:          "anchored multiline",
+			initMarkers:   []string{`^START_PRINT\b`},
+			printMarkers:  []string{`^M400$`, `^SET_PRINT_STATS_INFO CURRENT_LAYER=\d+$`},
+			expectedInit:  [2]int64{2, 2},
+			expectedPrint: [2]int64{4, 6},
+		},
+	}
+
+	for _, tt := range tests {
+		for name, strategy := range map[string]interface {
+			FindInitSectionPosition(ctx context.Context, filePath string, markers []string) (int64, int64, error)
+			FindPrintSectionPosition(ctx context.Context, filePath string, markers []string, searchFromLine int64) (int64, int64, error)
+		}{
+			"after_first_appear":  &AfterFirstAppearStrategy{Mode: MatchRegex},
+			"after_last_appear":   &AfterLastAppearStrategy{Mode: MatchRegex},
+			"before_first_appear": &BeforeCommandStrategy{Mode: MatchRegex},
+		} {
+			begin, end, err := strategy.FindInitSectionPosition(context.Background(), testFile, tt.initMarkers)
+			if err != nil || [2]int64{begin, end} != tt.expectedInit {
+				t.Errorf("%s/%s: FindInitSectionPosition = %d, %d, %v, want %v", tt.name, name, begin, end, err, tt.expectedInit)
+			}
+
+			begin, end, err = strategy.FindPrintSectionPosition(context.Background(), testFile, tt.printMarkers, 2)
+			if err != nil || [2]int64{begin, end} != tt.expectedPrint {
+				t.Errorf("%s/%s: FindPrintSectionPosition = %d, %d, %v, want %v", tt.name, name, begin, end, err, tt.expectedPrint)
+			}
+		}
+	}
+
+	// Unanchored, the first mention of the macro matches like in contains mode
+	begin, _, err := (&AfterFirstAppearStrategy{Mode: MatchRegex}).FindInitSectionPosition(context.Background(), testFile, []string{`START_PRINT`})
+	if err != nil || begin != 1 {
+		t.Errorf("Unanchored FindInitSectionPosition = %d, %v, want 1", begin, err)
+	}
+
+	_, _, err = (&AfterLastAppearStrategy{Mode: MatchRegex}).FindInitSectionPosition(context.Background(), testFile, []string{`(`})
+	if err == nil || !strings.Contains(err.Error(), "invalid marker regex") {
+		t.Errorf("Expected invalid regex error, got %v", err)
+	}
+}
+
+func TestStrategies_UnorderedMarkers(t *testing.T) {
+	t.Parallel()
+
+	type finder interface {
+		FindInitSectionPosition(ctx context.Context, filePath string, markers []string) (int64, int64, error)
+		FindPrintSectionPosition(ctx context.Context, filePath string, markers []string, searchFromLine int64) (int64, int64, error)
+	}
+
+	testFile := filepath.Join(t.TempDir(), "test.gcode")
+
+	content := "HEADER\n" + // 0
+		"M140 S60\n" + // 1
+		"; setup\n" + // 2
+		"M104 S200\n" + // 3
+		"G28\n" + // 4
+		"G1 X10 Y10 E1\n" + // 5
+		"M400\n" + // 6
+		"END\n" + // 7
+		"M84\n" // 8
+
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		initMarkers   []string
+		printMarkers  []string
+		expectedInit  [2]int64
+		expectedPrint [2]int64
+		found         bool
+	}{
+		{
+			name:          "reordered lines",
+			initMarkers:   []string{"G28", "M104 S200", "M140 S60"},
+			printMarkers:  []string{"END", "M400"},
+			expectedInit:  [2]int64{1, 4},
+			expectedPrint: [2]int64{6, 7},
+			found:         true,
+		},
+		{
+			name:         "other command between marker lines",
+			initMarkers:  []string{"G28", "M140 S60"},
+			printMarkers: []string{"M84", "M400"},
+		},
+	}
+
+	for _, tt := range tests {
+		for name, newStrategy := range map[string]func(MatchMode) finder{
+			"after_first_appear": func(mode MatchMode) finder {
+				return &AfterFirstAppearStrategy{Mode: mode}
+			},
+			"after_last_appear": func(mode MatchMode) finder {
+				return &AfterLastAppearStrategy{Mode: mode}
+			},
+			"before_first_appear": func(mode MatchMode) finder {
+				return &BeforeCommandStrategy{Mode: mode}
+			},
+		} {
+			unordered := newStrategy(MatchUnordered)
+
+			begin, end, err := unordered.FindInitSectionPosition(context.Background(), testFile, tt.initMarkers)
+			if tt.found && (err != nil || [2]int64{begin, end} != tt.expectedInit) {
+				t.Errorf("%s/%s: FindInitSectionPosition = %d, %d, %v, want %v", tt.name, name, begin, end, err, tt.expectedInit)
+			} else if !tt.found && err == nil {
+				t.Errorf("%s/%s: FindInitSectionPosition = %d, %d, want not found", tt.name, name, begin, end)
+			}
+
+			begin, end, err = unordered.FindPrintSectionPosition(context.Background(), testFile, tt.printMarkers, 4)
+			if tt.found && (err != nil || [2]int64{begin, end} != tt.expectedPrint) {
+				t.Errorf("%s/%s: FindPrintSectionPosition = %d, %d, %v, want %v", tt.name, name, begin, end, err, tt.expectedPrint)
+			} else if !tt.found && err == nil {
+				t.Errorf("%s/%s: FindPrintSectionPosition = %d, %d, want not found", tt.name, name, begin, end)
+			}
+
+			// The default mode keeps the marker line order
+			ordered := newStrategy(MatchContains)
+
+			_, _, err = ordered.FindInitSectionPosition(context.Background(), testFile, tt.initMarkers)
+			if err == nil {
+				t.Errorf("%s/%s: ordered FindInitSectionPosition found reordered marker lines", tt.name, name)
+			}
+
+			_, _, err = ordered.FindPrintSectionPosition(context.Background(), testFile, tt.printMarkers, 4)
+			if err == nil {
+				t.Errorf("%s/%s: ordered FindPrintSectionPosition found reordered marker lines", tt.name, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SweepOldFiles removes the regular files in dirs last modified before cutoff and returns how many
+// were removed
+func SweepOldFiles(dirs []string, cutoff time.Time) (int, error) {
+	var (
+		removed int
+		errs    []error
+	)
+
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				// Removed by its request in the meantime
+				if !errors.Is(err, os.ErrNotExist) {
+					errs = append(errs, err)
+				}
+
+				continue
+			}
+
+			if !info.ModTime().Before(cutoff) {
+				continue
+			}
+
+			err = os.Remove(filepath.Join(dir, entry.Name()))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+				continue
+			}
+
+			removed++
+		}
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+// StartSweeper removes files older than ttl from dirs every interval until ctx is done
+func StartSweeper(ctx context.Context, dirs []string, ttl, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				removed, err := SweepOldFiles(dirs, now.Add(-ttl))
+				if err != nil {
+					slog.Warn("Failed to sweep old files", "err", err)
+				}
+
+				if removed > 0 {
+					slog.Info("Swept old files", "removed", removed, "ttl", ttl)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,46 @@
+package webserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSweepOldFiles(t *testing.T) {
+	uploads := filepath.Join(t.TempDir(), "uploads")
+	results := filepath.Join(t.TempDir(), "results")
+
+	now := time.Now()
+
+	write := func(path string, age time.Duration) {
+		require.NoError(t, os.WriteFile(path, []byte("G1 X1"), 0644))
+		require.NoError(t, os.Chtimes(path, now.Add(-age), now.Add(-age)))
+	}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(uploads, "nested"), 0755))
+	require.NoError(t, os.MkdirAll(results, 0755))
+
+	write(filepath.Join(uploads, "orphan.gcode"), 2*time.Hour)
+	write(filepath.Join(uploads, "in-flight.gcode"), time.Minute)
+	write(filepath.Join(results, "orphan.gcode"), 90*time.Minute)
+	write(filepath.Join(results, "orphan.gcode.manifest.json"), 3*time.Hour)
+	write(filepath.Join(results, "fresh.gcode"), 0)
+
+	removed, err := SweepOldFiles([]string{uploads, results}, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+
+	assert.NoFileExists(t, filepath.Join(uploads, "orphan.gcode"))
+	assert.NoFileExists(t, filepath.Join(results, "orphan.gcode"))
+	assert.NoFileExists(t, filepath.Join(results, "orphan.gcode.manifest.json"))
+	assert.FileExists(t, filepath.Join(uploads, "in-flight.gcode"))
+	assert.FileExists(t, filepath.Join(results, "fresh.gcode"))
+	assert.DirExists(t, filepath.Join(uploads, "nested"))
+
+	_, err = SweepOldFiles([]string{filepath.Join(t.TempDir(), "missing")}, now)
+	assert.Error(t, err)
+}
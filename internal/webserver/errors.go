@@ -17,6 +17,8 @@ const (
 	ErrorTypeConfiguration  ErrorType = "configuration"
 	ErrorTypeFileIO         ErrorType = "file_io"
 	ErrorTypeUpload         ErrorType = "upload"
+	ErrorTypeRateLimit      ErrorType = "rate_limit"
+	ErrorTypeTimeout        ErrorType = "timeout"
 	ErrorTypeInternal       ErrorType = "internal"
 )
 
@@ -50,20 +52,114 @@ func CategorizeErrorWithLang(err error, lang string) ErrorResponse {
 	errMsg := err.Error()
 	errMsgLower := strings.ToLower(errMsg)
 
+	// Throttled clients
+	if strings.Contains(errMsgLower, "too many requests") {
+		return ErrorResponse{
+			Type:        ErrorTypeRateLimit,
+			Code:        "rate_limited",
+			Title:       GetTranslation(lang, "error_rate_limited_title"),
+			Description: GetTranslation(lang, "error_rate_limited_description"),
+			Details:     errMsg,
+			Suggestions: []string{
+				GetTranslation(lang, "error_rate_limited_suggestion_wait"),
+			},
+		}
+	}
+
+	// Processing stopped by deadline or client disconnect
+	if strings.Contains(errMsgLower, "processing aborted") {
+		return ErrorResponse{
+			Type:        ErrorTypeTimeout,
+			Code:        "processing_timeout",
+			Title:       GetTranslation(lang, "error_processing_timeout_title"),
+			Description: GetTranslation(lang, "error_processing_timeout_description"),
+			Details:     errMsg,
+			Suggestions: []string{
+				GetTranslation(lang, "error_processing_timeout_suggestion_iterations"),
+				GetTranslation(lang, "error_processing_timeout_suggestion_markers"),
+			},
+		}
+	}
+
+	// Re-uploaded output, checked before markers as the details mention the end marker
+	if strings.Contains(errMsgLower, "already be looped") {
+		return ErrorResponse{
+			Type:        ErrorTypeValidation,
+			Code:        "already_looped",
+			Title:       GetTranslation(lang, "error_already_looped_title"),
+			Description: GetTranslation(lang, "error_already_looped_description"),
+			Details:     errMsg,
+			Suggestions: []string{
+				GetTranslation(lang, "error_already_looped_suggestion_original"),
+				GetTranslation(lang, "error_already_looped_suggestion_force"),
+			},
+		}
+	}
+
+	// Uploads without content or G-code, checked before file errors as the details mention the file
+	if strings.Contains(errMsgLower, "uploaded file is empty") {
+		return ErrorResponse{
+			Type:        ErrorTypeValidation,
+			Code:        "empty_file",
+			Title:       GetTranslation(lang, "error_empty_file_title"),
+			Description: GetTranslation(lang, "error_empty_file_description"),
+			Details:     errMsg,
+			Suggestions: []string{
+				GetTranslation(lang, "error_empty_file_suggestion_export"),
+			},
+		}
+	}
+
+	if strings.Contains(errMsgLower, "unsupported file extension") {
+		return ErrorResponse{
+			Type:        ErrorTypeValidation,
+			Code:        "unsupported_extension",
+			Title:       GetTranslation(lang, "error_unsupported_extension_title"),
+			Description: GetTranslation(lang, "error_unsupported_extension_description"),
+			Details:     errMsg,
+			Suggestions: []string{
+				GetTranslation(lang, "error_not_gcode_suggestion_export"),
+			},
+		}
+	}
+
+	if strings.Contains(errMsgLower, "does not look like g-code") {
+		return ErrorResponse{
+			Type:        ErrorTypeValidation,
+			Code:        "not_gcode",
+			Title:       GetTranslation(lang, "error_not_gcode_title"),
+			Description: GetTranslation(lang, "error_not_gcode_description"),
+			Details:     errMsg,
+			Suggestions: []string{
+				GetTranslation(lang, "error_not_gcode_suggestion_export"),
+			},
+		}
+	}
+
 	// Template-related errors
 	if strings.Contains(errMsgLower, "template") || strings.Contains(errMsgLower, "parse") {
 		if strings.Contains(errMsgLower, "custom template") {
+			var suggestions []string
+
+			// The processor names the likely cause of a TOML error when it recognizes one
+			switch {
+			case strings.Contains(errMsgLower, "is never closed"):
+				suggestions = append(suggestions, GetTranslation(lang, "error_custom_template_suggestion_unterminated"))
+			case strings.Contains(errMsgLower, "mixes tabs and spaces"):
+				suggestions = append(suggestions, GetTranslation(lang, "error_custom_template_suggestion_indentation"))
+			}
+
 			return ErrorResponse{
 				Type:        ErrorTypeTemplate,
 				Code:        "custom_template_error",
 				Title:       GetTranslation(lang, "error_custom_template_title"),
 				Description: GetTranslation(lang, "error_custom_template_description"),
 				Details:     errMsg,
-				Suggestions: []string{
+				Suggestions: append(suggestions,
 					GetTranslation(lang, "error_custom_template_suggestion_syntax"),
 					GetTranslation(lang, "error_custom_template_suggestion_sections"),
 					GetTranslation(lang, "error_custom_template_suggestion_variables"),
-				},
+				),
 			}
 		}
 
@@ -80,6 +176,63 @@ func CategorizeErrorWithLang(err error, lang string) ErrorResponse {
 		}
 	}
 
+	// Markers found in the wrong order, checked before missing markers as the details mention markers
+	if strings.Contains(errMsgLower, "end marker found before init marker") {
+		return ErrorResponse{
+			Type:        ErrorTypeFileProcessing,
+			Code:        "marker_order",
+			Title:       GetTranslation(lang, "error_marker_order_title"),
+			Description: GetTranslation(lang, "error_marker_order_description"),
+			Details:     errMsg,
+			Suggestions: []string{
+				GetTranslation(lang, "error_marker_order_suggestion_strategies"),
+				GetTranslation(lang, "error_marker_not_found_suggestion_profile"),
+			},
+		}
+	}
+
+	if strings.Contains(errMsgLower, "markers overlap") {
+		return ErrorResponse{
+			Type:        ErrorTypeFileProcessing,
+			Code:        "marker_overlap",
+			Title:       GetTranslation(lang, "error_marker_overlap_title"),
+			Description: GetTranslation(lang, "error_marker_overlap_description"),
+			Details:     errMsg,
+			Suggestions: []string{
+				GetTranslation(lang, "error_marker_order_suggestion_strategies"),
+				GetTranslation(lang, "error_marker_overlap_suggestion_distinct"),
+			},
+		}
+	}
+
+	if strings.Contains(errMsgLower, "end marker found suspiciously early") {
+		return ErrorResponse{
+			Type:        ErrorTypeFileProcessing,
+			Code:        "print_section_early",
+			Title:       GetTranslation(lang, "error_print_section_early_title"),
+			Description: GetTranslation(lang, "error_print_section_early_description"),
+			Details:     errMsg,
+			Suggestions: []string{
+				GetTranslation(lang, "error_print_section_early_suggestion_complete"),
+				GetTranslation(lang, "error_marker_order_suggestion_strategies"),
+			},
+		}
+	}
+
+	if strings.Contains(errMsgLower, "iteration body has only") {
+		return ErrorResponse{
+			Type:        ErrorTypeFileProcessing,
+			Code:        "body_too_short",
+			Title:       GetTranslation(lang, "error_body_too_short_title"),
+			Description: GetTranslation(lang, "error_body_too_short_description"),
+			Details:     errMsg,
+			Suggestions: []string{
+				GetTranslation(lang, "error_body_too_short_suggestion_markers"),
+				GetTranslation(lang, "error_marker_order_suggestion_strategies"),
+			},
+		}
+	}
+
 	// File processing errors
 	if strings.Contains(errMsgLower, "marker") || strings.Contains(errMsgLower, "position") {
 		return ErrorResponse{
@@ -142,8 +295,10 @@ func CategorizeErrorWithLang(err error, lang string) ErrorResponse {
 		}
 	}
 
-	// Validation errors
-	if strings.Contains(errMsgLower, "iteration") || strings.Contains(errMsgLower, "positive") {
+	// Validation errors, including "invalid <field> value ..." from form parsing and malformed JSON bodies
+	isInvalidFormValue := strings.HasPrefix(errMsgLower, "invalid ") && strings.Contains(errMsgLower, " value ")
+	isInvalidBody := strings.HasPrefix(errMsgLower, "invalid request body")
+	if strings.Contains(errMsgLower, "iteration") || strings.Contains(errMsgLower, "positive") || isInvalidFormValue || isInvalidBody {
 		return ErrorResponse{
 			Type:        ErrorTypeValidation,
 			Code:        "invalid_parameters",
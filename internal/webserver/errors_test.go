@@ -0,0 +1,144 @@
+package webserver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCategorizeError(t *testing.T) {
+	err := LoadTranslations()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		err          error
+		expectedType ErrorType
+		expectedCode string
+	}{
+		{
+			name:         "nil error",
+			err:          nil,
+			expectedType: ErrorTypeInternal,
+			expectedCode: "unknown_error",
+		},
+		{
+			name:         "output size limit exceeded",
+			err:          errors.New("too many iterations: 9223372036854775807 iterations of a 15 byte body exceed the output limit of 2147483648 bytes"),
+			expectedType: ErrorTypeValidation,
+			expectedCode: "invalid_parameters",
+		},
+		{
+			name:         "processing timeout",
+			err:          errors.New("processing aborted: context deadline exceeded"),
+			expectedType: ErrorTypeTimeout,
+			expectedCode: "processing_timeout",
+		},
+		{
+			name:         "invalid form value",
+			err:          errors.New("invalid line_ending value cr: must be lf or crlf"),
+			expectedType: ErrorTypeValidation,
+			expectedCode: "invalid_parameters",
+		},
+		{
+			name:         "unknown printer with suggestion",
+			err:          errors.New(`failed to load printer definition: printer "a1-mni" not found, did you mean a1-mini?`),
+			expectedType: ErrorTypeConfiguration,
+			expectedCode: "printer_not_found",
+		},
+		{
+			name:         "already looped",
+			err:          errors.New("file appears to already be looped: the body is repeated before a second end marker, upload the original file or set force"),
+			expectedType: ErrorTypeValidation,
+			expectedCode: "already_looped",
+		},
+		{
+			name:         "unsupported extension",
+			err:          checkUploadExtension("model.stl"),
+			expectedType: ErrorTypeValidation,
+			expectedCode: "unsupported_extension",
+		},
+		{
+			name:         "not gcode",
+			err:          errNotGCode,
+			expectedType: ErrorTypeValidation,
+			expectedCode: "not_gcode",
+		},
+		{
+			name:         "template output limit",
+			err:          errors.New("failed to execute template: template output exceeds 1048576 bytes"),
+			expectedType: ErrorTypeTemplate,
+			expectedCode: "template_parsing_error",
+		},
+		{
+			name:         "missing end marker",
+			err:          errors.New(`print section: end marker not found in lines 3-10: ["END_PRINT"]`),
+			expectedType: ErrorTypeFileProcessing,
+			expectedCode: "marker_not_found",
+		},
+		{
+			name:         "end marker before init marker",
+			err:          errors.New("end marker found before init marker: end marker at line 1 precedes the init marker at line 3 and none follows it, check EndInitSectionStrategy after_last_appear and EndPrintSectionStrategy after_last_appear"),
+			expectedType: ErrorTypeFileProcessing,
+			expectedCode: "marker_order",
+		},
+		{
+			name:         "overlapping markers",
+			err:          errors.New("markers overlap: init marker ends at line 5, at or after the end marker at line 4, check EndInitSectionStrategy after_first_appear and EndPrintSectionStrategy after_last_appear"),
+			expectedType: ErrorTypeFileProcessing,
+			expectedCode: "marker_overlap",
+		},
+		{
+			name:         "end marker too early",
+			err:          errors.New("end marker found suspiciously early at line 4 of 20 (20% of the file, expected at least 50%), the file may be partial or corrupt"),
+			expectedType: ErrorTypeFileProcessing,
+			expectedCode: "print_section_early",
+		},
+		{
+			name:         "body too short",
+			err:          errors.New("iteration body has only 1 lines (expected at least 10), check that the start and end markers match the print section"),
+			expectedType: ErrorTypeFileProcessing,
+			expectedCode: "body_too_short",
+		},
+		{
+			name:         "empty file",
+			err:          errEmptyUpload,
+			expectedType: ErrorTypeValidation,
+			expectedCode: "empty_file",
+		},
+		{
+			name:         "invalid request body",
+			err:          errors.New("invalid request body: unexpected EOF"),
+			expectedType: ErrorTypeValidation,
+			expectedCode: "invalid_parameters",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := CategorizeError(tt.err)
+
+			assert.Equal(t, tt.expectedType, resp.Type)
+			assert.Equal(t, tt.expectedCode, resp.Code)
+		})
+	}
+}
+
+func TestCategorizeError_CustomTemplateHint(t *testing.T) {
+	err := LoadTranslations()
+	require.NoError(t, err)
+
+	resp := CategorizeErrorWithLang(errors.New(`failed to parse custom template TOML: toml: line 4 (last key "Template.Code"): unexpected EOF; expected '"""'; likely cause: the """ string opened on line 3 is never closed`), "en")
+
+	assert.Equal(t, "custom_template_error", resp.Code)
+	require.NotEmpty(t, resp.Suggestions)
+	assert.Equal(t, GetTranslation("en", "error_custom_template_suggestion_unterminated"), resp.Suggestions[0])
+
+	resp = CategorizeErrorWithLang(errors.New("failed to parse custom template TOML: toml: line 3: strings cannot contain newlines; likely cause: line 3 mixes tabs and spaces in its indentation"), "en")
+
+	assert.Equal(t, "custom_template_error", resp.Code)
+	require.NotEmpty(t, resp.Suggestions)
+	assert.Equal(t, GetTranslation("en", "error_custom_template_suggestion_indentation"), resp.Suggestions[0])
+}
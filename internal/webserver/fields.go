@@ -0,0 +1,72 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Upload form bounds and defaults, shared by receiveRequest validation and FieldsHandler
+const (
+	MinIterations          = 2
+	MaxIterations          = 10000
+	DefaultIterations      = 100
+	MinWaitBedCooldownTemp = 40
+	DefaultWaitBedCooldown = 40
+	MinWaitMin             = 0
+	DefaultWaitMin         = 0
+	MinExtraExtrude        = 0.0
+	DefaultExtraExtrude    = 0.2
+)
+
+// FieldDescriptor describes an accepted upload form field for the frontend
+type FieldDescriptor struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Default  any      `json:"default,omitempty"`
+}
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+// FieldDescriptors returns the descriptors of all upload form fields
+func FieldDescriptors() []FieldDescriptor {
+	return []FieldDescriptor{
+		{Name: "file", Type: "file", Required: true},
+		{Name: "printer", Type: "string", Required: true},
+		{Name: "iterations", Type: "integer", Required: true, Min: bound(MinIterations), Max: bound(MaxIterations), Default: DefaultIterations},
+		{Name: "waitBedCooldownTemp", Type: "integer", Min: bound(MinWaitBedCooldownTemp), Default: DefaultWaitBedCooldown},
+		{Name: "wait_min", Type: "integer", Min: bound(MinWaitMin), Default: DefaultWaitMin},
+		{Name: "extra_extrude", Type: "number", Min: bound(MinExtraExtrude), Default: DefaultExtraExtrude},
+		{Name: "chunk_iterations", Type: "integer", Min: bound(0)},
+		{Name: "chunk_size_mb", Type: "integer", Min: bound(0)},
+		{Name: "mesh_reload_every", Type: "integer", Min: bound(0)},
+		{Name: "body_start_line", Type: "integer", Min: bound(1)},
+		{Name: "body_end_line", Type: "integer", Min: bound(1)},
+		{Name: "custom_template", Type: "string"},
+		{Name: "test_print_pause", Type: "boolean"},
+		{Name: "manifest", Type: "boolean"},
+		{Name: "strip_slicer_config", Type: "boolean"},
+		{Name: "reverse_iteration_numbering", Type: "boolean"},
+		{Name: "line_ending", Type: "string"},
+		{Name: "comment_style", Type: "string"},
+		{Name: "init_strategy", Type: "string"},
+		{Name: "print_strategy", Type: "string"},
+		{Name: "force", Type: "boolean"},
+		{Name: "job_id", Type: "string"},
+	}
+}
+
+// FieldsHandler serves the upload form field descriptors as JSON
+func FieldsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(FieldDescriptors())
+}
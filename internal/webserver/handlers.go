@@ -1,7 +1,15 @@
 package webserver
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
@@ -12,14 +20,28 @@ import (
 	"os"
 	"path"
 	"printloop/internal/processor"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 //go:embed www/*
 var wwwFiles embed.FS
 
+// ProcessingTimeout bounds how long UploadHandler may spend processing one file (0 = no limit)
+var ProcessingTimeout = 5 * time.Minute
+
+// Directories of the uploaded files and of the processing results, both must exist
+var (
+	UploadDir  = "files/uploads"
+	ResultsDir = "files/results"
+)
+
+// Version is the server build version, set at build time with -ldflags "-X printloop/internal/webserver.Version=..."
+var Version = "dev"
+
 // TemplateData holds data for template rendering
 type TemplateData struct {
 	Lang string
@@ -80,6 +102,16 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 	// Determine language for error messages
 	lang := GetLanguageFromRequest(r)
 
+	// ?format=zip sends the output together with its manifest, chunked output is always a zip
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "zip" {
+		err := fmt.Errorf("invalid format value %v: must be zip", format)
+		log.Error("Failed to receive request", "error", err)
+		WriteErrorResponseWithLang(w, err, http.StatusBadRequest, lang)
+
+		return
+	}
+
 	req, err := receiveRequest(w, r)
 	if err != nil {
 		log.Error("Failed to receive request", "error", err)
@@ -88,20 +120,120 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	inFileName := path.Join("files/uploads", req.FileName)
-	outFileName := path.Join("files/results", req.FileName)
+	jobID, err := receiveJobID(r)
+	if err != nil {
+		log.Error("Failed to receive request", "error", err)
+		WriteErrorResponseWithLang(w, err, http.StatusBadRequest, lang)
+
+		return
+	}
+
+	if jobID != "" {
+		// Watchers of /progress?job=<job_id> follow the streamed iterations
+		jobs.update(jobID, 0, req.Iterations)
+		defer jobs.finish(jobID)
+
+		req.Progress = func(iteration, total int64) {
+			jobs.update(jobID, iteration, total)
+		}
+
+		w.Header().Set("X-Printloop-Job", jobID)
+	}
+
+	inFileName := path.Join(UploadDir, req.FileName)
+	outFileName := path.Join(ResultsDir, req.FileName)
 
 	defer os.Remove(inFileName)
 	defer os.Remove(outFileName)
 
-	err = processor.ProcessFile(inFileName, outFileName, req)
+	// Processing stops when the client disconnects or the timeout passes
+	ctx := r.Context()
+
+	if ProcessingTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, ProcessingTimeout)
+		defer cancel()
+	}
+
+	if req.ChunkIterations > 0 || req.ChunkSizeMB > 0 {
+		chunkPaths, warnings, err := processor.ProcessFileChunkedContext(ctx, inFileName, outFileName, req)
+		for _, chunkPath := range chunkPaths {
+			defer os.Remove(chunkPath)
+		}
+
+		if err != nil {
+			log.Error("Request processing failed", "error", err)
+			WriteErrorResponseWithLang(w, err, processingErrorStatus(err), lang)
+
+			return
+		}
+
+		setWarningsHeader(w, warnings)
+
+		err = sendZipResponse(w, req, chunkPaths)
+		if err != nil {
+			log.Error("Failed to send response", "error", err)
+			WriteErrorResponseWithLang(w, err, http.StatusInternalServerError, lang)
+
+			return
+		}
+
+		log.Info("Request processed", "filename", req.FileName, "chunks", len(chunkPaths))
+
+		return
+	}
+
+	if format == "zip" {
+		req.WriteManifest = true
+
+		defer os.Remove(outFileName + processor.ManifestSuffix)
+	}
+
+	stats, err := processor.ProcessFileWithStatsContext(ctx, inFileName, outFileName, req)
 	if err != nil {
 		log.Error("Request processing failed", "error", err)
-		WriteErrorResponseWithLang(w, err, http.StatusInternalServerError, lang)
+		WriteErrorResponseWithLang(w, err, processingErrorStatus(err), lang)
 
 		return
 	}
 
+	setWarningsHeader(w, stats.Warnings)
+	setLineStatsHeaders(w, stats.Lines)
+
+	if format == "zip" {
+		err = sendZipEntries(w, req, []zipEntry{
+			{path: outFileName, name: req.FileName},
+			{path: outFileName + processor.ManifestSuffix, name: strings.TrimSuffix(req.FileName, path.Ext(req.FileName)) + processor.ManifestSuffix},
+		})
+		if err != nil {
+			log.Error("Failed to send response", "error", err)
+			WriteErrorResponseWithLang(w, err, http.StatusInternalServerError, lang)
+
+			return
+		}
+
+		log.Info("Request processed", "filename", req.FileName, "format", format, "output_bytes", stats.OutputBytes)
+
+		return
+	}
+
+	if req.WriteManifest {
+		// The manifest outlives the request until it is fetched via ManifestHandler
+		w.Header().Set("X-Printloop-Manifest", req.FileName)
+	}
+
+	w.Header().Set("X-Printloop-Output-Bytes", strconv.FormatInt(stats.OutputBytes, 10))
+	w.Header().Set("X-Printloop-Duration-Ms", strconv.FormatInt(stats.Duration.Milliseconds(), 10))
+
+	// Only the first lines outlive the request, under an unguessable id for PreviewHandler
+	previewID, err := writePreview(outFileName)
+	if err != nil {
+		log.Warn("Failed to write preview", "error", err)
+	} else {
+		w.Header().Set("X-Printloop-Preview", previewID)
+	}
+
 	err = sendResponse(w, req)
 	if err != nil {
 		log.Error("Failed to send response", "error", err)
@@ -110,14 +242,66 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Info("Request processed", "filename", req.FileName)
+	log.Info("Request processed", "filename", req.FileName,
+		"input_bytes", stats.InputBytes,
+		"output_bytes", stats.OutputBytes,
+		"iterations", stats.Iterations,
+		"init_marker_line", stats.EndInitSectionLastLine,
+		"print_marker_line", stats.EndPrintSectionFirstLine,
+		"duration_ms", stats.Duration.Milliseconds())
+}
+
+// setWarningsHeader reports the processing warnings as a JSON array in the X-Printloop-Warnings header
+func setWarningsHeader(w http.ResponseWriter, warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(warnings)
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("X-Printloop-Warnings", string(data))
+}
+
+// setLineStatsHeaders reports the input and projected output line counts, to sanity-check the result
+// before printing it
+func setLineStatsHeaders(w http.ResponseWriter, lines processor.LineStats) {
+	w.Header().Set("X-Printloop-Original-Lines", strconv.FormatInt(lines.OriginalLines, 10))
+	w.Header().Set("X-Printloop-Body-Lines", strconv.FormatInt(lines.BodyLines, 10))
+	w.Header().Set("X-Printloop-Generated-Lines", strconv.FormatInt(lines.GeneratedLines, 10))
+	w.Header().Set("X-Printloop-Projected-Lines", strconv.FormatInt(lines.ProjectedLines, 10))
+}
+
+// processingErrorStatus returns the HTTP status reported for a failed processing run
+func processingErrorStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusServiceUnavailable
+	}
+
+	if errors.Is(err, processor.ErrAlreadyLooped) {
+		return http.StatusUnprocessableEntity
+	}
+
+	return http.StatusInternalServerError
+}
+
+// setResultHeaders describes the processed result for scripted consumers that only save the body
+func setResultHeaders(w http.ResponseWriter, req processor.ProcessingRequest) {
+	w.Header().Set("X-Printloop-Iterations", strconv.FormatInt(req.Iterations, 10))
+
+	if req.Printer != "" {
+		w.Header().Set("X-Printloop-Printer", req.Printer)
+	}
 }
 
 func sendResponse(w http.ResponseWriter, req processor.ProcessingRequest) error {
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", req.FileName))
 	w.Header().Set("Content-Type", "application/octet-stream")
+	setResultHeaders(w, req)
 
-	fileName := path.Join("files/results", req.FileName)
+	fileName := path.Join(ResultsDir, req.FileName)
 
 	file, err := os.Open(fileName)
 	if err != nil {
@@ -125,6 +309,21 @@ func sendResponse(w http.ResponseWriter, req processor.ProcessingRequest) error
 	}
 	defer file.Close()
 
+	// Hash in a first pass so the checksum header precedes the body, streaming to keep memory flat
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return fmt.Errorf("failed to hash result file %s: %w", fileName, err)
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("failed to rewind result file %s: %w", fileName, err)
+	}
+
+	w.Header().Set("X-Content-SHA256", hex.EncodeToString(hash.Sum(nil)))
+
 	_, err = io.Copy(w, file)
 	if err != nil {
 		return fmt.Errorf("failed writing response: %w", err)
@@ -133,6 +332,66 @@ func sendResponse(w http.ResponseWriter, req processor.ProcessingRequest) error
 	return nil
 }
 
+// zipEntry is a file sent in a zip response under name
+type zipEntry struct {
+	path string
+	name string
+}
+
+// sendZipResponse sends the given files as a zip archive named after the request file
+func sendZipResponse(w http.ResponseWriter, req processor.ProcessingRequest, filePaths []string) error {
+	entries := make([]zipEntry, 0, len(filePaths))
+	for _, filePath := range filePaths {
+		entries = append(entries, zipEntry{path: filePath, name: path.Base(filePath)})
+	}
+
+	return sendZipEntries(w, req, entries)
+}
+
+// sendZipEntries streams the entries as a zip archive named after the request file
+func sendZipEntries(w http.ResponseWriter, req processor.ProcessingRequest, entries []zipEntry) error {
+	zipName := strings.TrimSuffix(req.FileName, path.Ext(req.FileName)) + ".zip"
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", zipName))
+	w.Header().Set("Content-Type", "application/zip")
+	setResultHeaders(w, req)
+
+	zipWriter := zip.NewWriter(w)
+
+	for _, entry := range entries {
+		err := addFileToZip(zipWriter, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := zipWriter.Close()
+	if err != nil {
+		return fmt.Errorf("failed writing zip: %w", err)
+	}
+
+	return nil
+}
+
+func addFileToZip(zipWriter *zip.Writer, zipFile zipEntry) error {
+	file, err := os.Open(zipFile.path)
+	if err != nil {
+		return fmt.Errorf("failed to open result file %s: %w", zipFile.path, err)
+	}
+	defer file.Close()
+
+	entry, err := zipWriter.Create(zipFile.name)
+	if err != nil {
+		return fmt.Errorf("failed writing zip entry: %w", err)
+	}
+
+	_, err = io.Copy(entry, file)
+	if err != nil {
+		return fmt.Errorf("failed writing zip entry: %w", err)
+	}
+
+	return nil
+}
+
 func receiveRequest(w http.ResponseWriter, r *http.Request) (processor.ProcessingRequest, error) {
 	var req processor.ProcessingRequest
 
@@ -140,44 +399,93 @@ func receiveRequest(w http.ResponseWriter, r *http.Request) (processor.Processin
 
 	r.Body = http.MaxBytesReader(w, r.Body, maxFileSize)
 
-	err := r.ParseMultipartForm(1024 * 1024) // receive up to 1MB of form data
+	// The file is written to disk while the form is read, and removed again unless the request is accepted
+	upload, err := parseMultipartStream(r)
 	if err != nil {
 		return req, fmt.Errorf("form parsing error: %w", err)
 	}
 
+	accepted := false
+
+	defer func() {
+		if !accepted {
+			removeUpload(upload)
+		}
+	}()
+
 	iterationsS := r.FormValue("iterations")
 
 	req.Iterations, err = strconv.ParseInt(iterationsS, 10, 64)
 
-	if err != nil || req.Iterations < 2 || req.Iterations > 10000 {
-		return req, fmt.Errorf("invalid iterations value %v: must be between 2 and 10000", iterationsS)
+	if err != nil || req.Iterations < MinIterations || req.Iterations > MaxIterations {
+		return req, fmt.Errorf("invalid iterations value %v: must be between %d and %d", iterationsS, MinIterations, MaxIterations)
 	}
 
 	waitBedCooldownTempS := r.FormValue("waitBedCooldownTemp")
+	if waitBedCooldownTempS == "" {
+		// Older clients send the bed cooldown temperature as wait_temp
+		waitBedCooldownTempS = r.FormValue("wait_temp")
+	}
 
 	req.WaitBedCooldownTemp, err = strconv.ParseInt(waitBedCooldownTempS, 10, 64)
 	if (err != nil || req.WaitBedCooldownTemp < 0) && waitBedCooldownTempS != "" {
-		return req, fmt.Errorf("invalid wait_temp value %v: %w", waitBedCooldownTempS, err)
+		return req, fmt.Errorf("invalid waitBedCooldownTemp value %v: %w", waitBedCooldownTempS, err)
 	}
 
-	if req.WaitBedCooldownTemp < 40 && waitBedCooldownTempS != "" {
-		return req, errors.New("bed cooldown temperature must be at least 40°C - Bambulab printers ignore lower values")
+	if req.WaitBedCooldownTemp < MinWaitBedCooldownTemp && waitBedCooldownTempS != "" {
+		return req, fmt.Errorf("bed cooldown temperature must be at least %d°C - Bambulab printers ignore lower values", MinWaitBedCooldownTemp)
 	}
 
 	waitMinS := r.FormValue("wait_min")
 
 	req.WaitMin, err = strconv.ParseInt(waitMinS, 10, 64)
-	if (err != nil || req.WaitMin < 0) && waitMinS != "" {
+	if (err != nil || req.WaitMin < MinWaitMin) && waitMinS != "" {
 		return req, fmt.Errorf("invalid wait_min value %v: %w", waitMinS, err)
 	}
 
 	extraExtrudeS := r.FormValue("extra_extrude")
 
 	req.ExtraExtrude, err = strconv.ParseFloat(extraExtrudeS, 64)
-	if (err != nil || req.ExtraExtrude < 0) && extraExtrudeS != "" {
+	if (err != nil || req.ExtraExtrude < MinExtraExtrude) && extraExtrudeS != "" {
 		return req, fmt.Errorf("invalid extra_extrude value %v: %w", waitMinS, err)
 	}
 
+	chunkIterationsS := r.FormValue("chunk_iterations")
+
+	req.ChunkIterations, err = strconv.ParseInt(chunkIterationsS, 10, 64)
+	if (err != nil || req.ChunkIterations < 0) && chunkIterationsS != "" {
+		return req, fmt.Errorf("invalid chunk_iterations value %v: must be a non-negative integer", chunkIterationsS)
+	}
+
+	chunkSizeMBS := r.FormValue("chunk_size_mb")
+
+	req.ChunkSizeMB, err = strconv.ParseInt(chunkSizeMBS, 10, 64)
+	if (err != nil || req.ChunkSizeMB < 0) && chunkSizeMBS != "" {
+		return req, fmt.Errorf("invalid chunk_size_mb value %v: must be a non-negative integer", chunkSizeMBS)
+	}
+
+	meshReloadEveryS := r.FormValue("mesh_reload_every")
+
+	req.MeshReloadEvery, err = strconv.ParseInt(meshReloadEveryS, 10, 64)
+	if (err != nil || req.MeshReloadEvery < 0) && meshReloadEveryS != "" {
+		return req, fmt.Errorf("invalid mesh_reload_every value %v: must be a non-negative integer", meshReloadEveryS)
+	}
+
+	// Explicit body line numbers replace marker detection, the processor checks them against the file
+	bodyStartLineS := r.FormValue("body_start_line")
+
+	req.BodyStartLine, err = strconv.ParseInt(bodyStartLineS, 10, 64)
+	if (err != nil || req.BodyStartLine < 1) && bodyStartLineS != "" {
+		return req, fmt.Errorf("invalid body_start_line value %v: must be a positive integer", bodyStartLineS)
+	}
+
+	bodyEndLineS := r.FormValue("body_end_line")
+
+	req.BodyEndLine, err = strconv.ParseInt(bodyEndLineS, 10, 64)
+	if (err != nil || req.BodyEndLine < 1) && bodyEndLineS != "" {
+		return req, fmt.Errorf("invalid body_end_line value %v: must be a positive integer", bodyEndLineS)
+	}
+
 	req.Printer = r.FormValue("printer")
 
 	// Handle custom template if provided
@@ -189,31 +497,232 @@ func receiveRequest(w http.ResponseWriter, r *http.Request) (processor.Processin
 	// Handle test print with pause option
 	req.TestPrintWithPause = r.FormValue("test_print_pause") == "true"
 
-	file, header, err := r.FormFile("file")
+	// Handle manifest sidecar option
+	req.WriteManifest = r.FormValue("manifest") == "true"
+
+	// Handle slicer config block stripping option
+	req.StripSlicerConfig = r.FormValue("strip_slicer_config") == "true"
+
+	// Handle reversed iteration numbering debug option
+	req.ReverseIterationNumbering = r.FormValue("reverse_iteration_numbering") == "true"
+
+	// Handle output line ending option, empty keeps the uploaded file's
+	req.LineEnding = r.FormValue("line_ending")
+	if req.LineEnding != "" && req.LineEnding != "lf" && req.LineEnding != "crlf" {
+		return req, fmt.Errorf("invalid line_ending value %v: must be lf or crlf", req.LineEnding)
+	}
+
+	// Handle iteration comment style option
+	req.CommentStyle = r.FormValue("comment_style")
+	if req.CommentStyle != "" && req.CommentStyle != "semicolon" && req.CommentStyle != "parentheses" {
+		return req, fmt.Errorf("invalid comment_style value %v: must be semicolon or parentheses", req.CommentStyle)
+	}
+
+	// Handle search strategy overrides, empty keeps the printer's
+	req.InitStrategy = r.FormValue("init_strategy")
+	if req.InitStrategy != "" {
+		_, err = processor.CreateSearchStrategy(req.InitStrategy)
+		if err != nil {
+			return req, fmt.Errorf("invalid init_strategy value %v: %w", req.InitStrategy, err)
+		}
+	}
+
+	req.PrintStrategy = r.FormValue("print_strategy")
+	if req.PrintStrategy != "" {
+		_, err = processor.CreateSearchStrategy(req.PrintStrategy)
+		if err != nil {
+			return req, fmt.Errorf("invalid print_strategy value %v: %w", req.PrintStrategy, err)
+		}
+	}
+
+	// Handle processing of files that look already looped
+	req.Force = r.FormValue("force") == "true"
+
+	if upload == nil {
+		return req, fmt.Errorf("file retrieval error: %w", http.ErrMissingFile)
+	}
+
+	if upload.err != nil {
+		return req, upload.err
+	}
+
+	req.FileName = upload.fileName
+
+	// Reject text that passes as an upload but isn't G-code before processing it
+	file, err := os.Open(path.Join(UploadDir, req.FileName))
 	if err != nil {
-		return req, fmt.Errorf("file retrieval error: %w", err)
+		return req, fmt.Errorf("file reading error: %w", err)
 	}
 	defer file.Close()
 
-	timestamp := time.Now().Unix()
-	req.FileName = fmt.Sprintf("%d_%s", timestamp, header.Filename)
-	filepath := path.Join("files/uploads", req.FileName)
-
-	dst, err := os.Create(filepath)
+	info, err := file.Stat()
 	if err != nil {
-		return req, fmt.Errorf("file creation failed: %w", err)
+		return req, fmt.Errorf("file reading error: %w", err)
 	}
-	defer dst.Close()
 
-	_, err = io.Copy(dst, file)
+	if info.Size() == 0 {
+		return req, errEmptyUpload
+	}
+
+	isGCode, err := looksLikeGCode(file, uploadCommentPrefix(req))
 	if err != nil {
-		_ = os.Remove(filepath)
-		return req, fmt.Errorf("file saving error: %w", err)
+		return req, fmt.Errorf("file reading error: %w", err)
+	}
+
+	if !isGCode {
+		return req, errNotGCode
 	}
 
+	accepted = true
+
 	return req, nil
 }
 
+// resultFileName returns the file query parameter, naming a file in ResultsDir, and whether it is a
+// plain file name
+func resultFileName(r *http.Request) (string, bool) {
+	fileName := r.URL.Query().Get("file")
+	if fileName == "" || fileName != path.Base(fileName) || strings.Contains(fileName, "..") {
+		return "", false
+	}
+
+	return fileName, true
+}
+
+// Bounds of the lines query parameter of PreviewHandler
+const (
+	defaultPreviewLines = 50
+	maxPreviewLines     = 1000
+)
+
+// previewSuffix names the preview files in ResultsDir, left for the sweeper to remove
+const previewSuffix = ".preview"
+
+var previewIDRegex = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// writePreview copies the first maxPreviewLines lines of a result into ResultsDir under a random
+// 128-bit id and returns the id
+func writePreview(resultPath string) (string, error) {
+	var raw [16]byte
+
+	_, err := rand.Read(raw[:])
+	if err != nil {
+		return "", err
+	}
+
+	id := hex.EncodeToString(raw[:])
+
+	result, err := os.Open(resultPath)
+	if err != nil {
+		return "", err
+	}
+	defer result.Close()
+
+	preview, err := os.Create(path.Join(ResultsDir, id+previewSuffix))
+	if err != nil {
+		return "", err
+	}
+	defer preview.Close()
+
+	reader := bufio.NewReader(result)
+
+	for range maxPreviewLines {
+		line, err := reader.ReadBytes('\n')
+
+		_, werr := preview.Write(line)
+		if werr != nil {
+			return "", werr
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return id, preview.Close()
+}
+
+// PreviewHandler streams the first lines of a processed file, 50 or as many as the lines query
+// parameter asks for up to 1000, to check the start of the output. The id query parameter is the
+// X-Printloop-Preview header of the upload response
+func PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if !previewIDRegex.MatchString(id) {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return
+	}
+
+	lines := defaultPreviewLines
+
+	if linesS := r.URL.Query().Get("lines"); linesS != "" {
+		var err error
+
+		lines, err = strconv.Atoi(linesS)
+		if err != nil || lines < 1 {
+			http.Error(w, "Invalid lines parameter", http.StatusBadRequest)
+			return
+		}
+
+		lines = min(lines, maxPreviewLines)
+	}
+
+	file, err := os.Open(path.Join(ResultsDir, id+previewSuffix))
+	if err != nil {
+		http.Error(w, "Preview not found", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	reader := bufio.NewReader(file)
+
+	for range lines {
+		line, err := reader.ReadBytes('\n')
+		_, _ = w.Write(line)
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ManifestHandler serves the manifest of a processed file once and removes it
+func ManifestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fileName, ok := resultFileName(r)
+	if !ok {
+		http.Error(w, "Invalid file parameter", http.StatusBadRequest)
+		return
+	}
+
+	manifestPath := path.Join(ResultsDir, fileName+processor.ManifestSuffix)
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		http.Error(w, "Manifest not found", http.StatusNotFound)
+		return
+	}
+
+	_ = os.Remove(manifestPath)
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
 func TemplateHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -230,6 +739,22 @@ func TemplateHandler(w http.ResponseWriter, r *http.Request) {
 	printerName = strings.ReplaceAll(printerName, " ", "-")
 	printerName = strings.ToLower(printerName)
 
+	w.Header().Add("Vary", "Accept")
+
+	// Editors working with structured data get the parsed definition instead of the TOML text
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		def, err := processor.LoadPrinterDefinition(printerName)
+		if err != nil {
+			http.Error(w, "Printer not found: "+err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(def)
+
+		return
+	}
+
 	data, err := processor.LoadPrinterDefinitionRaw(printerName)
 	if err != nil {
 		http.Error(w, "Printer not found: "+err.Error(), http.StatusNotFound)
@@ -240,6 +765,205 @@ func TemplateHandler(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(data)
 }
 
+// templateBlockRequest is the JSON body of TemplateBlockHandler, named like the upload form fields
+type templateBlockRequest struct {
+	Printer             string                    `json:"printer"`
+	CustomTemplate      string                    `json:"custom_template"`
+	Iterations          int64                     `json:"iterations"`
+	WaitBedCooldownTemp int64                     `json:"waitBedCooldownTemp"`
+	WaitMin             int64                     `json:"wait_min"`
+	ExtraExtrude        float64                   `json:"extra_extrude"`
+	TestPrintWithPause  bool                      `json:"test_print_pause"`
+	Positions           processor.MarkerPositions `json:"positions"`
+}
+
+// TemplateBlockHandler renders only the generated block of iteration 1 for the posted request values
+// and positions, without any G-code file, for authoring templates
+func TemplateBlockHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lang := GetLanguageFromRequest(r)
+
+	var body templateBlockRequest
+
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024*1024)).Decode(&body)
+	if err != nil {
+		WriteErrorResponseWithLang(w, fmt.Errorf("invalid request body: %w", err), http.StatusBadRequest, lang)
+		return
+	}
+
+	block, err := processor.RenderGeneratedBlock(body.processingRequest(), body.Positions)
+	if err != nil {
+		WriteErrorResponseWithLang(w, err, http.StatusBadRequest, lang)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(block))
+}
+
+// processingRequest returns the request values of the body, at least one iteration
+func (body templateBlockRequest) processingRequest() processor.ProcessingRequest {
+	return processor.ProcessingRequest{
+		Printer:             body.Printer,
+		CustomTemplate:      strings.TrimSpace(body.CustomTemplate),
+		Iterations:          max(body.Iterations, 1),
+		WaitBedCooldownTemp: body.WaitBedCooldownTemp,
+		WaitMin:             body.WaitMin,
+		ExtraExtrude:        body.ExtraExtrude,
+		TestPrintWithPause:  body.TestPrintWithPause,
+	}
+}
+
+// EstimateHandler returns a rough estimate of the time looping adds to a print as JSON, for the
+// request values and positions posted like to TemplateBlockHandler. It counts moves and dwells and
+// is no substitute for the slicer's estimate.
+func EstimateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lang := GetLanguageFromRequest(r)
+
+	var body templateBlockRequest
+
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024*1024)).Decode(&body)
+	if err != nil {
+		WriteErrorResponseWithLang(w, fmt.Errorf("invalid request body: %w", err), http.StatusBadRequest, lang)
+		return
+	}
+
+	estimate, err := processor.EstimateLoopTime(body.Positions, body.processingRequest())
+	if err != nil {
+		WriteErrorResponseWithLang(w, err, http.StatusBadRequest, lang)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(estimate)
+}
+
+// ImportHandler converts the firmware config in the request body, in the format given by the format
+// query parameter (klipper by default), into printer definition TOML to use as a custom template
+func ImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lang := GetLanguageFromRequest(r)
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "klipper"
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1024*1024))
+	if err != nil {
+		WriteErrorResponseWithLang(w, fmt.Errorf("invalid request body: %w", err), http.StatusBadRequest, lang)
+		return
+	}
+
+	def, err := processor.ImportConfig(format, data)
+	if err != nil {
+		WriteErrorResponseWithLang(w, err, http.StatusBadRequest, lang)
+		return
+	}
+
+	definition, err := processor.MarshalPrinterDefinition(def)
+	if err != nil {
+		WriteErrorResponseWithLang(w, err, http.StatusInternalServerError, lang)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write(definition)
+}
+
+// PrinterSampleHandler serves the sample G-code of the printer named in the path
+func PrinterSampleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Normalize printer name (same logic as in processor)
+	printerName := strings.ReplaceAll(r.PathValue("name"), " ", "-")
+	printerName = strings.ToLower(printerName)
+
+	data, err := processor.LoadPrinterSample(printerName)
+	if err != nil {
+		http.Error(w, "Sample not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-sample.gcode\"", printerName))
+	_, _ = w.Write(data)
+}
+
+// SampleHandler returns a synthetic G-code file built from the markers of the printer given in the
+// printer query parameter, for testing the loop end-to-end
+func SampleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Normalize printer name (same logic as in processor)
+	printerName := strings.ReplaceAll(r.URL.Query().Get("printer"), " ", "-")
+	printerName = strings.ToLower(printerName)
+
+	if printerName == "" {
+		http.Error(w, "Printer parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := processor.GenerateSample(printerName)
+	if err != nil {
+		http.Error(w, "Printer not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"sample_%s.gcode\"", printerName))
+	_, _ = w.Write(data)
+}
+
+// PrinterParametersHandler returns the Parameters of a printer definition as JSON, each with the type
+// it has in the TOML file, so editors can render matching inputs
+func PrinterParametersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Normalize printer name (same logic as in processor)
+	printerName := strings.ReplaceAll(r.PathValue("name"), " ", "-")
+	printerName = strings.ToLower(printerName)
+
+	parameters, err := processor.LoadPrinterParameters(printerName)
+	if err != nil {
+		http.Error(w, "Printer not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(parameters)
+}
+
+// embeddedETag returns a strong ETag for the contents of an embedded file, which only change with a new build
+func embeddedETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// StaticFileServer serves the embedded www files. The embedded files have no modification times, so
+// responses carry an ETag of the contents for clients to revalidate with If-None-Match.
 func StaticFileServer() http.Handler {
 	subFS, err := fs.Sub(wwwFiles, "www")
 	if err != nil {
@@ -247,7 +971,28 @@ func StaticFileServer() http.Handler {
 		return http.FileServer(http.FS(wwwFiles))
 	}
 
-	return http.FileServer(http.FS(subFS))
+	fileServer := http.FileServer(http.FS(subFS))
+
+	var etags sync.Map // File name to ETag, computed on first request
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+
+		etag, found := etags.Load(name)
+		if !found {
+			data, err := fs.ReadFile(subFS, name)
+			if err == nil {
+				etag, _ = etags.LoadOrStore(name, embeddedETag(data))
+			}
+		}
+
+		// http.FileServer answers If-None-Match with 304 once the ETag header is set
+		if etag != nil {
+			w.Header().Set("ETag", etag.(string))
+		}
+
+		fileServer.ServeHTTP(w, r)
+	})
 }
 
 func FaviconHandler(filePath string) http.HandlerFunc {
@@ -267,11 +1012,77 @@ func FaviconHandler(filePath string) http.HandlerFunc {
 
 		// Set cache headers for favicons
 		w.Header().Set("Cache-Control", "public, max-age=31536000") // 1 year
+		w.Header().Set("ETag", embeddedETag(data))
 
-		_, _ = w.Write(data)
+		// ServeContent answers a matching If-None-Match with 304 Not Modified
+		http.ServeContent(w, r, path.Base(filePath), time.Time{}, bytes.NewReader(data))
 	}
 }
 
+// HealthResponse is the readiness report returned by HealthHandler
+type HealthResponse struct {
+	Status             string   `json:"status"`
+	Version            string   `json:"version"`
+	PrinterCount       int      `json:"printer_count"`
+	Printers           []string `json:"printers"`
+	TranslationsLoaded bool     `json:"translations_loaded"`
+}
+
+// HealthHandler reports readiness for load balancers, failing with 503 until translations are loaded
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	printers := processor.ListPrinters()
+
+	keys := make([]string, 0, len(printers))
+	for _, printer := range printers {
+		keys = append(keys, printer.Key)
+	}
+
+	resp := HealthResponse{
+		Status:             "ok",
+		Version:            Version,
+		PrinterCount:       len(keys),
+		Printers:           keys,
+		TranslationsLoaded: len(currentTranslations()) > 0,
+	}
+
+	statusCode := http.StatusOK
+	if !resp.TranslationsLoaded {
+		resp.Status = "unavailable"
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// PrintersHandler lists the available printer definitions for the printer dropdown
+func PrintersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(processor.ListPrinters())
+}
+
+// AllowedExtensionsHandler serves the sorted upload file extensions as a JSON array
+func AllowedExtensionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(getAllowedExtensions())
+}
+
 // HintHandler serves hint text for the UI tooltips
 func HintHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -293,13 +1104,32 @@ func HintHandler(w http.ResponseWriter, r *http.Request) {
 	hintText := GetTranslation(lang, hintKey)
 	if hintText == hintKey {
 		// If translation not found, return a default message
-		if lang == "uk" {
-			hintText = "Інформація недоступна"
-		} else {
-			hintText = "Information not available"
-		}
+		hintText = GetTranslation(lang, "information_not_available")
 	}
 
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	_, _ = w.Write([]byte(hintText))
 }
+
+// hintPrefix marks the translation keys used as UI tooltips
+const hintPrefix = "hint_"
+
+// HintsHandler serves all hint texts of a language as one JSON object, so the UI loads its tooltips
+// in a single request
+func HintsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hints := make(Translation)
+
+	for key, text := range GetTranslations(GetLanguageFromRequest(r)) {
+		if strings.HasPrefix(key, hintPrefix) {
+			hints[key] = text
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(hints)
+}
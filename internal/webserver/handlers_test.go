@@ -2,13 +2,20 @@
 package webserver
 
 import (
+	"archive/zip"
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
+	"path/filepath"
 	"printloop/internal/processor"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -153,6 +160,71 @@ func TestUploadHandler(t *testing.T) {
 				assert.Contains(t, w.Body.String(), "invalid_parameters")
 			},
 		},
+		{
+			name: "negative chunk iterations",
+			setupRequest: func(t *testing.T) *http.Request {
+				t.Helper()
+
+				return createUploadRequestWithParams(t, map[string]string{
+					"iterations":       "5",
+					"chunk_iterations": "-1",
+				})
+			},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				t.Helper()
+				assert.Contains(t, w.Body.String(), "invalid_parameters")
+			},
+		},
+		{
+			name: "zero body start line",
+			setupRequest: func(t *testing.T) *http.Request {
+				t.Helper()
+
+				return createUploadRequestWithParams(t, map[string]string{
+					"iterations":      "5",
+					"body_start_line": "0",
+					"body_end_line":   "2",
+				})
+			},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				t.Helper()
+				assert.Contains(t, w.Body.String(), "invalid_parameters")
+			},
+		},
+		{
+			name: "invalid comment style",
+			setupRequest: func(t *testing.T) *http.Request {
+				t.Helper()
+
+				return createUploadRequestWithParams(t, map[string]string{
+					"iterations":    "5",
+					"comment_style": "hash",
+				})
+			},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				t.Helper()
+				assert.Contains(t, w.Body.String(), "invalid_parameters")
+			},
+		},
+		{
+			name: "invalid line ending",
+			setupRequest: func(t *testing.T) *http.Request {
+				t.Helper()
+
+				return createUploadRequestWithParams(t, map[string]string{
+					"iterations":  "5",
+					"line_ending": "cr",
+				})
+			},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				t.Helper()
+				assert.Contains(t, w.Body.String(), "invalid_parameters")
+			},
+		},
 		{
 			name: "large file within limit",
 			setupRequest: func(t *testing.T) *http.Request {
@@ -166,7 +238,7 @@ func TestUploadHandler(t *testing.T) {
 				part, err := writer.CreateFormFile("file", "large.txt")
 				require.NoError(t, err)
 				// Write a moderately large file (1KB)
-				largeContent := strings.Repeat("test data line\n", 64)
+				largeContent := strings.Repeat("G1 X1 ; test data line\n", 64)
 				_, _ = part.Write([]byte(largeContent))
 				_ = writer.Close()
 
@@ -232,6 +304,30 @@ func TestSendResponse(t *testing.T) {
 				assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
 				assert.Contains(t, w.Header().Get("Content-Disposition"), req.FileName)
 				assert.Equal(t, "test content", w.Body.String())
+				// sha256sum of "test content"
+				assert.Equal(t, "6ae8a75555209fd6c44157c0aed8016e763ff435a19cf186f76863140143ff72", w.Header().Get("X-Content-SHA256"))
+			},
+		},
+		{
+			name: "metadata headers",
+			setupFile: func(t *testing.T) processor.ProcessingRequest {
+				t.Helper()
+
+				err := os.MkdirAll("files/results", 0755)
+				require.NoError(t, err)
+				t.Cleanup(func() { os.RemoveAll("files") })
+
+				fileName := "metadata_file.txt"
+				err = os.WriteFile(path.Join("files/results", fileName), []byte("content"), 0644)
+				require.NoError(t, err)
+
+				return processor.ProcessingRequest{FileName: fileName, Iterations: 25, Printer: "a1-mini"}
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder, _ processor.ProcessingRequest) {
+				t.Helper()
+				assert.Equal(t, "25", w.Header().Get("X-Printloop-Iterations"))
+				assert.Equal(t, "a1-mini", w.Header().Get("X-Printloop-Printer"))
 			},
 		},
 		{
@@ -267,6 +363,9 @@ func TestSendResponse(t *testing.T) {
 			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder, _ processor.ProcessingRequest) {
 				t.Helper()
 				assert.Empty(t, w.Body.String())
+				assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", w.Header().Get("X-Content-SHA256"))
+				assert.Equal(t, "0", w.Header().Get("X-Printloop-Iterations"))
+				assert.Empty(t, w.Header().Get("X-Printloop-Printer"))
 			},
 		},
 		{
@@ -316,6 +415,168 @@ func TestSendResponse(t *testing.T) {
 	}
 }
 
+func TestSendZipResponse(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	chunkPaths := []string{
+		filepath.Join(tempDir, "model.part001.gcode"),
+		filepath.Join(tempDir, "model.part002.gcode"),
+	}
+
+	for i, chunkPath := range chunkPaths {
+		err := os.WriteFile(chunkPath, []byte(fmt.Sprintf("chunk %d", i+1)), 0644)
+		require.NoError(t, err)
+	}
+
+	w := httptest.NewRecorder()
+
+	err := sendZipResponse(w, processor.ProcessingRequest{FileName: "model.gcode"}, chunkPaths)
+	require.NoError(t, err)
+
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "model.zip")
+
+	zipReader, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	require.Len(t, zipReader.File, 2)
+
+	for i, file := range zipReader.File {
+		assert.Equal(t, path.Base(chunkPaths[i]), file.Name)
+
+		entry, err := file.Open()
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(entry)
+		require.NoError(t, err)
+		entry.Close()
+
+		assert.Equal(t, fmt.Sprintf("chunk %d", i+1), string(content))
+	}
+}
+
+func TestUploadHandler_Preview(t *testing.T) {
+	uploadDir, resultsDir := UploadDir, ResultsDir
+	t.Cleanup(func() { UploadDir, ResultsDir = uploadDir, resultsDir })
+
+	UploadDir = path.Join(t.TempDir(), "uploads")
+	ResultsDir = path.Join(t.TempDir(), "results")
+
+	require.NoError(t, os.MkdirAll(UploadDir, 0755))
+	require.NoError(t, os.MkdirAll(ResultsDir, 0755))
+
+	var buf bytes.Buffer
+
+	writer := multipart.NewWriter(&buf)
+	_ = writer.WriteField("iterations", "2")
+	_ = writer.WriteField("printer", "unit-tests")
+
+	part, err := writer.CreateFormFile("file", "model.gcode")
+	require.NoError(t, err)
+
+	_, _ = part.Write([]byte(plainGCode))
+	_ = writer.Close()
+
+	r := httptest.NewRequest("POST", "/upload", &buf)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	UploadHandler(w, r)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	id := w.Header().Get("X-Printloop-Preview")
+	require.Regexp(t, `^[0-9a-f]{32}$`, id)
+
+	output := w.Body.String()
+
+	// The result is removed once sent, only the preview stays
+	_, err = os.Stat(path.Join(ResultsDir, "model.gcode"))
+	assert.True(t, os.IsNotExist(err))
+
+	entries, err := os.ReadDir(ResultsDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, id+previewSuffix, entries[0].Name())
+
+	w = httptest.NewRecorder()
+	PreviewHandler(w, httptest.NewRequest("GET", "/preview?id="+id+"&lines=3", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	lines := strings.SplitAfter(output, "\n")
+	assert.Equal(t, strings.Join(lines[:3], ""), w.Body.String())
+}
+
+func TestUploadHandler_ZipFormat(t *testing.T) {
+	uploadDir, resultsDir := UploadDir, ResultsDir
+	t.Cleanup(func() { UploadDir, ResultsDir = uploadDir, resultsDir })
+
+	UploadDir = path.Join(t.TempDir(), "uploads")
+	ResultsDir = path.Join(t.TempDir(), "results")
+
+	require.NoError(t, os.MkdirAll(UploadDir, 0755))
+	require.NoError(t, os.MkdirAll(ResultsDir, 0755))
+
+	var buf bytes.Buffer
+
+	writer := multipart.NewWriter(&buf)
+	_ = writer.WriteField("iterations", "2")
+	_ = writer.WriteField("printer", "unit-tests")
+
+	part, err := writer.CreateFormFile("file", "model.gcode")
+	require.NoError(t, err)
+
+	_, _ = part.Write([]byte(plainGCode))
+	_ = writer.Close()
+
+	r := httptest.NewRequest("POST", "/upload?format=zip", &buf)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	UploadHandler(w, r)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename="\d+_model\.zip"$`, w.Header().Get("Content-Disposition"))
+
+	zipReader, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	require.Len(t, zipReader.File, 2)
+
+	contents := make([]string, len(zipReader.File))
+
+	for i, file := range zipReader.File {
+		entry, err := file.Open()
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(entry)
+		require.NoError(t, err)
+		entry.Close()
+
+		contents[i] = string(content)
+	}
+
+	assert.Regexp(t, `^\d+_model\.gcode$`, zipReader.File[0].Name)
+	assert.Contains(t, contents[0], "START_PRINT")
+
+	assert.Equal(t, strings.TrimSuffix(zipReader.File[0].Name, ".gcode")+processor.ManifestSuffix, zipReader.File[1].Name)
+
+	var manifest map[string]any
+
+	require.NoError(t, json.Unmarshal([]byte(contents[1]), &manifest))
+	assert.EqualValues(t, 2, manifest["iterations"])
+
+	// Neither the output nor its manifest outlive the request
+	entries, err := os.ReadDir(ResultsDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	r = httptest.NewRequest("POST", "/upload?format=tar", nil)
+	w = httptest.NewRecorder()
+	UploadHandler(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid format value tar")
+}
+
 func TestReceiveRequest(t *testing.T) {
 	t.Parallel()
 	setupTestDirs := func(t *testing.T) {
@@ -488,6 +749,64 @@ func TestReceiveRequest(t *testing.T) {
 				assert.Empty(t, req.Printer)
 			},
 		},
+		{
+			name: "bed cooldown temperature from waitBedCooldownTemp",
+			setupRequest: func(t *testing.T) *http.Request {
+				t.Helper()
+
+				return createUploadRequestWithParams(t, map[string]string{
+					"iterations":          "5",
+					"waitBedCooldownTemp": "45",
+				})
+			},
+			validateReq: func(t *testing.T, req processor.ProcessingRequest) {
+				t.Helper()
+				assert.Equal(t, int64(45), req.WaitBedCooldownTemp)
+			},
+		},
+		{
+			name: "bed cooldown temperature from legacy wait_temp",
+			setupRequest: func(t *testing.T) *http.Request {
+				t.Helper()
+
+				return createUploadRequestWithParams(t, map[string]string{
+					"iterations": "5",
+					"wait_temp":  "50",
+				})
+			},
+			validateReq: func(t *testing.T, req processor.ProcessingRequest) {
+				t.Helper()
+				assert.Equal(t, int64(50), req.WaitBedCooldownTemp)
+			},
+		},
+		{
+			name: "waitBedCooldownTemp takes precedence over wait_temp",
+			setupRequest: func(t *testing.T) *http.Request {
+				t.Helper()
+
+				return createUploadRequestWithParams(t, map[string]string{
+					"iterations":          "5",
+					"waitBedCooldownTemp": "45",
+					"wait_temp":           "50",
+				})
+			},
+			validateReq: func(t *testing.T, req processor.ProcessingRequest) {
+				t.Helper()
+				assert.Equal(t, int64(45), req.WaitBedCooldownTemp)
+			},
+		},
+		{
+			name: "invalid legacy wait_temp",
+			setupRequest: func(t *testing.T) *http.Request {
+				t.Helper()
+
+				return createUploadRequestWithParams(t, map[string]string{
+					"iterations": "5",
+					"wait_temp":  "-1",
+				})
+			},
+			expectedError: true,
+		},
 		{
 			name: "custom template with whitespace",
 			setupRequest: func(t *testing.T) *http.Request {
@@ -528,7 +847,7 @@ func TestReceiveRequest(t *testing.T) {
 				part, err := writer.CreateFormFile("file", "test file with spaces & symbols.gcode")
 				require.NoError(t, err)
 
-				_, _ = part.Write([]byte("test content"))
+				_, _ = part.Write([]byte("G1 X10 ; test content"))
 				_ = writer.Close()
 
 				req := httptest.NewRequest("POST", "/upload", &buf)
@@ -621,6 +940,19 @@ func TestTemplateHandler(t *testing.T) {
 				assert.Contains(t, w.Body.String(), "Printer not found")
 			},
 		},
+		{
+			name:           "parameters are served as written",
+			method:         "GET",
+			queryParams:    "?printer=a1-mini",
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				t.Helper()
+
+				lines := strings.Split(w.Body.String(), "\n")
+				assert.Contains(t, lines, "PushY = 0")
+				assert.Contains(t, lines, "MoveDownBeforePush = 50.0")
+			},
+		},
 		{
 			name:           "printer name with spaces",
 			method:         "GET",
@@ -661,6 +993,63 @@ func TestTemplateHandler(t *testing.T) {
 	}
 }
 
+func TestTemplateHandler_Accept(t *testing.T) {
+	t.Parallel()
+
+	t.Run("toml by default", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/template?printer=a1-mini", nil)
+		req.Header.Set("Accept", "text/plain")
+		w := httptest.NewRecorder()
+
+		TemplateHandler(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "Accept", w.Header().Get("Vary"))
+		assert.Contains(t, w.Body.String(), "[Template]")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/template?printer=a1-mini", nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+
+		TemplateHandler(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.Equal(t, "Accept", w.Header().Get("Vary"))
+
+		var def processor.PrinterDefinition
+
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &def))
+
+		expected, err := processor.LoadPrinterDefinition("a1-mini")
+		require.NoError(t, err)
+		assert.Equal(t, expected.Name, def.Name)
+		assert.Equal(t, expected.Markers.EndInitSection, def.Markers.EndInitSection)
+		assert.Equal(t, expected.Template.Code, def.Template.Code)
+		assert.Equal(t, expected.Parameters["PushY"], def.Parameters["PushY"])
+	})
+
+	t.Run("json for unknown printer", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/template?printer=nonexistent_printer", nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+
+		TemplateHandler(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "Printer not found")
+	})
+}
+
 // Test the StaticFileServer function
 func TestStaticFileServer(t *testing.T) {
 	t.Parallel()
@@ -681,6 +1070,69 @@ func TestStaticFileServer(t *testing.T) {
 	assert.True(t, w.Code >= 200 && w.Code < 600, "Handler should return a valid HTTP status code")
 }
 
+func TestFaviconHandler_ETag(t *testing.T) {
+	t.Parallel()
+
+	handler := FaviconHandler("www/favicon-32x32.png")
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/favicon-32x32.png", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=31536000", w.Header().Get("Cache-Control"))
+
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.NotZero(t, w.Body.Len())
+
+	req := httptest.NewRequest("GET", "/favicon-32x32.png", nil)
+	req.Header.Set("If-None-Match", etag)
+
+	w = httptest.NewRecorder()
+	handler(w, req)
+
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Zero(t, w.Body.Len())
+
+	req = httptest.NewRequest("GET", "/favicon-32x32.png", nil)
+	req.Header.Set("If-None-Match", `"stale"`)
+
+	w = httptest.NewRecorder()
+	handler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestStaticFileServer_ETag(t *testing.T) {
+	t.Parallel()
+
+	handler := StaticFileServer()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/style.css", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	req := httptest.NewRequest("GET", "/style.css", nil)
+	req.Header.Set("If-None-Match", etag)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// Other files have their own tag
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/script.js", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
 // Helper functions
 
 func createValidUploadRequest(t *testing.T) *http.Request {
@@ -711,7 +1163,7 @@ func createUploadRequestWithParams(t *testing.T, params map[string]string) *http
 		part, err := writer.CreateFormFile("file", "test.txt")
 		require.NoError(t, err)
 
-		_, _ = part.Write([]byte("test file content"))
+		_, _ = part.Write([]byte("G1 X10 Y10 ; test file content"))
 	}
 
 	_ = writer.Close()
@@ -721,3 +1173,549 @@ func createUploadRequestWithParams(t *testing.T, params map[string]string) *http
 
 	return req
 }
+
+func TestManifestHandler(t *testing.T) {
+	err := os.MkdirAll("files/results", 0755)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll("files") })
+
+	err = os.WriteFile(path.Join("files/results", "123_part.gcode"+processor.ManifestSuffix), []byte(`{"iterations":2}`), 0644)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "existing manifest", query: "?file=123_part.gcode", expectedStatus: http.StatusOK, expectedBody: `{"iterations":2}`},
+		{name: "manifest is removed after download", query: "?file=123_part.gcode", expectedStatus: http.StatusNotFound},
+		{name: "missing file parameter", query: "", expectedStatus: http.StatusBadRequest},
+		{name: "path traversal", query: "?file=../uploads/x", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/manifest"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			ManifestHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedBody != "" {
+				assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestPreviewHandler(t *testing.T) {
+	err := os.MkdirAll("files/results", 0755)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll("files") })
+
+	var content strings.Builder
+	for i := range maxPreviewLines + 200 {
+		fmt.Fprintf(&content, "G1 X%d Y%d\r\n", i, i)
+	}
+
+	err = os.WriteFile(path.Join("files/results", "part.gcode"), []byte(content.String()), 0644)
+	require.NoError(t, err)
+
+	err = os.WriteFile(path.Join("files/results", "short.gcode"), []byte("G28\nM84"), 0644)
+	require.NoError(t, err)
+
+	part, err := writePreview(path.Join("files/results", "part.gcode"))
+	require.NoError(t, err)
+
+	short, err := writePreview(path.Join("files/results", "short.gcode"))
+	require.NoError(t, err)
+	assert.NotEqual(t, part, short)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedLines  int
+	}{
+		{name: "default lines", query: "?id=" + part, expectedStatus: http.StatusOK, expectedLines: 50},
+		{name: "50 lines", query: "?id=" + part + "&lines=50", expectedStatus: http.StatusOK, expectedLines: 50},
+		{name: "fewer lines", query: "?id=" + part + "&lines=3", expectedStatus: http.StatusOK, expectedLines: 3},
+		{name: "above the maximum", query: "?id=" + part + "&lines=5000", expectedStatus: http.StatusOK, expectedLines: maxPreviewLines},
+		{name: "more than the file", query: "?id=" + short, expectedStatus: http.StatusOK, expectedLines: 2},
+		{name: "invalid lines", query: "?id=" + part + "&lines=0", expectedStatus: http.StatusBadRequest},
+		{name: "missing preview", query: "?id=" + strings.Repeat("0", 32), expectedStatus: http.StatusNotFound},
+		{name: "result file name", query: "?id=part.gcode", expectedStatus: http.StatusBadRequest},
+		{name: "path traversal", query: "?id=../uploads/x", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			PreviewHandler(w, httptest.NewRequest("GET", "/preview"+tt.query, nil))
+
+			require.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedLines > 0 {
+				assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+
+				lines := strings.SplitAfter(w.Body.String(), "\n")
+				if lines[len(lines)-1] == "" {
+					lines = lines[:len(lines)-1]
+				}
+
+				assert.Len(t, lines, tt.expectedLines)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	PreviewHandler(w, httptest.NewRequest("GET", "/preview?id="+part+"&lines=2", nil))
+	assert.Equal(t, "G1 X0 Y0\r\nG1 X1 Y1\r\n", w.Body.String())
+}
+
+func TestHealthHandler(t *testing.T) {
+	t.Run("not ready without translations", func(t *testing.T) {
+		saved := currentTranslations()
+		setTranslations(nil)
+
+		t.Cleanup(func() { setTranslations(saved) })
+
+		w := httptest.NewRecorder()
+		HealthHandler(w, httptest.NewRequest("GET", "/healthz", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Contains(t, w.Body.String(), `"translations_loaded":false`)
+	})
+
+	t.Run("ready with printers listed", func(t *testing.T) {
+		err := LoadTranslations()
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		HealthHandler(w, httptest.NewRequest("GET", "/healthz", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var resp HealthResponse
+
+		err = json.Unmarshal(w.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		assert.Equal(t, "ok", resp.Status)
+		assert.True(t, resp.TranslationsLoaded)
+		assert.NotEmpty(t, resp.Printers)
+		assert.Contains(t, resp.Printers, "a1")
+		assert.Equal(t, len(resp.Printers), resp.PrinterCount)
+	})
+}
+
+func TestPrintersHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	PrintersHandler(w, httptest.NewRequest("GET", "/printers", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var printers []processor.PrinterInfo
+
+	err := json.Unmarshal(w.Body.Bytes(), &printers)
+	require.NoError(t, err)
+	assert.Contains(t, printers, processor.PrinterInfo{Key: "a1", Name: "A1"})
+
+	w = httptest.NewRecorder()
+	PrintersHandler(w, httptest.NewRequest("POST", "/printers", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestAllowedExtensionsHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	AllowedExtensionsHandler(w, httptest.NewRequest("GET", "/allowed-extensions", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var extensions []string
+
+	err := json.Unmarshal(w.Body.Bytes(), &extensions)
+	require.NoError(t, err)
+
+	assert.Contains(t, extensions, ".gcode")
+	assert.Len(t, extensions, len(AllowedFileExtensions))
+	assert.True(t, slices.IsSorted(extensions), "extensions not sorted: %v", extensions)
+
+	w = httptest.NewRecorder()
+	AllowedExtensionsHandler(w, httptest.NewRequest("POST", "/allowed-extensions", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestHintsHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	HintsHandler(w, httptest.NewRequest("GET", "/hints?lang=uk", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var hints map[string]string
+
+	err := json.Unmarshal(w.Body.Bytes(), &hints)
+	require.NoError(t, err)
+
+	assert.Equal(t, GetTranslation("uk", "hint_iterations"), hints["hint_iterations"])
+	assert.Contains(t, hints, "hint_wait_bed_cooldown")
+	assert.NotContains(t, hints, "select_printer")
+
+	for key := range hints {
+		assert.True(t, strings.HasPrefix(key, "hint_"), "unexpected key %q", key)
+	}
+
+	w = httptest.NewRecorder()
+	HintsHandler(w, httptest.NewRequest("POST", "/hints", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestHintHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		expected string
+	}{
+		{name: "known key", target: "/hint?key=hint_iterations&lang=uk", expected: GetTranslation("uk", "hint_iterations")},
+		{name: "unknown key in English", target: "/hint?key=hint_missing&lang=en", expected: "Information not available"},
+		{name: "unknown key in Ukrainian", target: "/hint?key=hint_missing&lang=uk", expected: "Інформація недоступна"},
+		{name: "unknown key in unsupported language", target: "/hint?key=hint_missing&lang=de", expected: "Information not available"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			HintHandler(w, httptest.NewRequest("GET", tt.target, nil))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expected, w.Body.String())
+		})
+	}
+}
+
+func TestPrinterSampleHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /printers/{name}/sample", PrinterSampleHandler)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/printers/A1%20Mini/sample", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "a1-mini-sample.gcode")
+	assert.Contains(t, w.Body.String(), "M624")
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/printers/nonexistent/sample", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "Sample not found")
+}
+
+func TestPrinterParametersHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /printers/{name}/parameters", PrinterParametersHandler)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/printers/A1%20Mini/parameters", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var parameters map[string]processor.PrinterParameter
+
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &parameters))
+	assert.Equal(t, processor.PrinterParameter{Type: "integer", Value: float64(0)}, parameters["PushY"])
+	assert.Equal(t, processor.PrinterParameter{Type: "float", Value: 179.99}, parameters["BackY"])
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/printers/nonexistent/parameters", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSampleHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	SampleHandler(w, httptest.NewRequest("GET", "/sample?printer=A1%20Mini", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), `filename="sample_a1-mini.gcode"`)
+	assert.Contains(t, w.Body.String(), "M624\n")
+	assert.Contains(t, w.Body.String(), "M625\n")
+
+	w = httptest.NewRecorder()
+	SampleHandler(w, httptest.NewRequest("GET", "/sample?printer=nonexistent", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	SampleHandler(w, httptest.NewRequest("GET", "/sample", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	SampleHandler(w, httptest.NewRequest("POST", "/sample?printer=a1", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestTemplateBlockHandler(t *testing.T) {
+	customTemplate := `
+Name = "block"
+[Markers]
+EndInitSection = ["START_PRINT"]
+EndPrintSection = ["END_PRINT"]
+[SearchStrategy]
+EndInitSectionStrategy = "after_first_appear"
+EndPrintSectionStrategy = "after_last_appear"
+[Template]
+Code = """G1 X{{.Positions.FirstPrintX}} Y{{.Positions.FirstPrintY}}
+G1 E{{.Request.ExtraExtrude}}"""
+`
+
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:   "renders block",
+			method: "POST",
+			body: mustJSON(t, map[string]any{
+				"printer":         "unit-tests",
+				"custom_template": customTemplate,
+				"extra_extrude":   0.5,
+				"positions":       map[string]any{"FirstPrintX": 10.5, "FirstPrintY": 20},
+			}),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "G1 X10.5 Y20\nG1 E0.5\n",
+		},
+		{
+			name:           "invalid JSON",
+			method:         "POST",
+			body:           "{",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid_parameters",
+		},
+		{
+			name:           "unknown printer",
+			method:         "POST",
+			body:           `{"printer": "nonexistent"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "printer_not_found",
+		},
+		{
+			name:           "method not allowed",
+			method:         "GET",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			TemplateBlockHandler(w, httptest.NewRequest(tt.method, "/template/block", strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+			} else if tt.expectedBody != "" {
+				assert.Contains(t, w.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestEstimateHandler(t *testing.T) {
+	customTemplate := `
+Name = "estimate"
+[Markers]
+EndInitSection = ["START_PRINT"]
+EndPrintSection = ["END_PRINT"]
+[SearchStrategy]
+EndInitSectionStrategy = "after_first_appear"
+EndPrintSectionStrategy = "after_last_appear"
+[Template]
+Code = """G4 S{{.Request.WaitMin}}"""
+`
+
+	t.Run("estimates", func(t *testing.T) {
+		body := mustJSON(t, map[string]any{
+			"printer":         "unit-tests",
+			"custom_template": customTemplate,
+			"iterations":      4,
+			"wait_min":        30,
+			"positions":       map[string]any{"BodyMoves": 200, "BodyDwellSeconds": 5},
+		})
+
+		w := httptest.NewRecorder()
+		EstimateHandler(w, httptest.NewRequest(http.MethodPost, "/estimate", strings.NewReader(body)))
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var estimate processor.LoopEstimate
+
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &estimate))
+		assert.InDelta(t, 15, estimate.BodySeconds, 1e-9)
+		assert.InDelta(t, 30, estimate.GeneratedSeconds, 1e-9)
+		assert.InDelta(t, 3*15+4*30, estimate.AddedSeconds, 1e-9)
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		EstimateHandler(w, httptest.NewRequest(http.MethodPost, "/estimate", strings.NewReader("{")))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid_parameters")
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		EstimateHandler(w, httptest.NewRequest(http.MethodGet, "/estimate", nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func TestImportHandler(t *testing.T) {
+	config := "[printer]\nkinematics: cartesian\n\n[stepper_y]\nposition_max: 220\n\n[exclude_object]\n\n[gcode_macro PRINT_START]\ngcode:\n    G28\n"
+
+	w := httptest.NewRecorder()
+	ImportHandler(w, httptest.NewRequest("POST", "/import?format=klipper", strings.NewReader(config)))
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `Name = "Klipper cartesian"`)
+	assert.Contains(t, w.Body.String(), "Y = 220.0")
+	assert.Contains(t, w.Body.String(), `(?i)^PRINT_START\\b`)
+
+	w = httptest.NewRecorder()
+	ImportHandler(w, httptest.NewRequest("POST", "/import", strings.NewReader("[stepper_y]\nposition_max: 220\n")))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "missing [printer] section")
+
+	w = httptest.NewRecorder()
+	ImportHandler(w, httptest.NewRequest("POST", "/import?format=marlin", strings.NewReader(config)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	ImportHandler(w, httptest.NewRequest("GET", "/import", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestFieldsHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	FieldsHandler(w, httptest.NewRequest("GET", "/fields", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var fields []FieldDescriptor
+
+	err := json.Unmarshal(w.Body.Bytes(), &fields)
+	require.NoError(t, err)
+
+	byName := make(map[string]FieldDescriptor)
+	for _, field := range fields {
+		byName[field.Name] = field
+	}
+
+	iterations := byName["iterations"]
+	require.NotNil(t, iterations.Min)
+	require.NotNil(t, iterations.Max)
+	assert.Equal(t, "integer", iterations.Type)
+	assert.True(t, iterations.Required)
+
+	bedTemp := byName["waitBedCooldownTemp"]
+	require.NotNil(t, bedTemp.Min)
+
+	extraExtrude := byName["extra_extrude"]
+	assert.Equal(t, "number", extraExtrude.Type)
+
+	// The advertised bounds must match what receiveRequest actually accepts
+	boundaries := []struct {
+		params        map[string]string
+		expectedError bool
+	}{
+		{params: map[string]string{"iterations": strconv.Itoa(int(*iterations.Min))}},
+		{params: map[string]string{"iterations": strconv.Itoa(int(*iterations.Min) - 1)}, expectedError: true},
+		{params: map[string]string{"iterations": strconv.Itoa(int(*iterations.Max))}},
+		{params: map[string]string{"iterations": strconv.Itoa(int(*iterations.Max) + 1)}, expectedError: true},
+		{params: map[string]string{"iterations": "5", "waitBedCooldownTemp": strconv.Itoa(int(*bedTemp.Min))}},
+		{params: map[string]string{"iterations": "5", "waitBedCooldownTemp": strconv.Itoa(int(*bedTemp.Min) - 1)}, expectedError: true},
+		{params: map[string]string{"iterations": "5", "extra_extrude": strconv.FormatFloat(*extraExtrude.Min, 'f', -1, 64)}},
+		{params: map[string]string{"iterations": "5", "extra_extrude": strconv.FormatFloat(*extraExtrude.Min-0.1, 'f', -1, 64)}, expectedError: true},
+	}
+
+	err = os.MkdirAll("files/uploads", 0755)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll("files") })
+
+	for _, b := range boundaries {
+		_, err := receiveRequest(httptest.NewRecorder(), createUploadRequestWithParams(t, b.params))
+		if b.expectedError {
+			assert.Error(t, err, "params %v", b.params)
+		} else {
+			assert.NoError(t, err, "params %v", b.params)
+		}
+	}
+}
+
+func TestDataDirs(t *testing.T) {
+	uploadDir, resultsDir := UploadDir, ResultsDir
+	t.Cleanup(func() { UploadDir, ResultsDir = uploadDir, resultsDir })
+
+	UploadDir = path.Join(t.TempDir(), "uploads")
+	ResultsDir = path.Join(t.TempDir(), "results")
+
+	require.NoError(t, os.MkdirAll(UploadDir, 0755))
+	require.NoError(t, os.MkdirAll(ResultsDir, 0755))
+
+	req, err := receiveRequest(httptest.NewRecorder(), createValidUploadRequest(t))
+	require.NoError(t, err)
+	assert.FileExists(t, path.Join(UploadDir, req.FileName))
+
+	var buf bytes.Buffer
+
+	writer := multipart.NewWriter(&buf)
+	_ = writer.WriteField("iterations", "2")
+	_ = writer.WriteField("printer", "unit-tests")
+	_ = writer.WriteField("manifest", "true")
+
+	part, err := writer.CreateFormFile("file", "model.gcode")
+	require.NoError(t, err)
+
+	_, _ = part.Write([]byte(plainGCode))
+	_ = writer.Close()
+
+	r := httptest.NewRequest("POST", "/upload", &buf)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	UploadHandler(w, r)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	manifest := w.Header().Get("X-Printloop-Manifest")
+	require.NotEmpty(t, manifest)
+	assert.FileExists(t, path.Join(ResultsDir, manifest+processor.ManifestSuffix))
+	assert.NoDirExists(t, "files")
+
+	w = httptest.NewRecorder()
+	ManifestHandler(w, httptest.NewRequest("GET", "/manifest?file="+manifest, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
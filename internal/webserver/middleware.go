@@ -2,27 +2,94 @@ package webserver
 
 import (
 	"compress/gzip"
+	"errors"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/zstd"
 )
 
 type compressResponseWriter struct {
 	http.ResponseWriter
 
-	writer io.Writer
+	writer      io.Writer
+	wroteHeader bool
+}
+
+// WriteHeader drops a Content-Length set by the handler, it is the uncompressed size
+func (w *compressResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+
+	w.wroteHeader = true
+
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
 }
 
 func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
 	return w.writer.Write(b)
 }
 
+// Flush pushes the data buffered by the compressor to the client, needed for streamed responses
+func (w *compressResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if flusher, ok := w.writer.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// compressionLevel is the Brotli, zstd and gzip level used for a value of the compress query parameter
+type compressionLevel struct {
+	brotli int
+	zstd   zstd.EncoderLevel
+	gzip   int
+}
+
+// compressionLevels maps the compress query parameter to compression levels. Unknown values get the
+// default, "none" disables compression.
+var compressionLevels = map[string]compressionLevel{
+	"":     {brotli: brotli.DefaultCompression, zstd: zstd.SpeedBetterCompression, gzip: gzip.DefaultCompression},
+	"fast": {brotli: brotli.BestSpeed, zstd: zstd.SpeedFastest, gzip: gzip.BestSpeed},
+	"best": {brotli: brotli.BestCompression, zstd: zstd.SpeedBestCompression, gzip: gzip.BestCompression},
+}
+
+// CompressionMiddleware compresses responses with Brotli, zstd or gzip, preferred in that order, as
+// accepted by the client, at the level chosen with the compress query parameter (fast, best or none)
 func CompressionMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		choice := r.URL.Query().Get("compress")
+		if choice == "none" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		level, ok := compressionLevels[choice]
+		if !ok {
+			level = compressionLevels[""]
+		}
+
+		// Shared caches must keep the encodings apart
+		w.Header().Add("Vary", "Accept-Encoding")
+
 		// Check Accept-Encoding header
 		acceptEncoding := r.Header.Get("Accept-Encoding")
 
@@ -31,11 +98,20 @@ func CompressionMiddleware(next http.Handler) http.Handler {
 			encoding string
 		)
 
-		if strings.Contains(acceptEncoding, "zstd") {
+		if strings.Contains(acceptEncoding, "br") {
+			w.Header().Set("Content-Encoding", "br")
+
+			br := brotli.NewWriterLevel(w, level.brotli)
+
+			defer br.Close()
+
+			writer = br
+			encoding = "br"
+		} else if strings.Contains(acceptEncoding, "zstd") {
 			w.Header().Set("Content-Encoding", "zstd")
 
 			encoder, _ := zstd.NewWriter(w,
-				zstd.WithEncoderLevel(zstd.SpeedBetterCompression),
+				zstd.WithEncoderLevel(level.zstd),
 				zstd.WithWindowSize(1<<23))
 
 			defer encoder.Close()
@@ -45,7 +121,7 @@ func CompressionMiddleware(next http.Handler) http.Handler {
 		} else if strings.Contains(acceptEncoding, "gzip") {
 			w.Header().Set("Content-Encoding", "gzip")
 
-			gz := gzip.NewWriter(w)
+			gz, _ := gzip.NewWriterLevel(w, level.gzip)
 
 			defer gz.Close()
 
@@ -56,6 +132,11 @@ func CompressionMiddleware(next http.Handler) http.Handler {
 		if encoding != "" {
 			cw := &compressResponseWriter{ResponseWriter: w, writer: writer}
 			next.ServeHTTP(cw, r)
+
+			// The deferred Close writes the compressed trailer, after the headers
+			if !cw.wroteHeader {
+				cw.WriteHeader(http.StatusOK)
+			}
 		} else {
 			next.ServeHTTP(w, r)
 		}
@@ -83,3 +164,105 @@ func LogPageRef(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RateLimitPerMinute is the number of requests a client may make per minute through
+// RateLimitMiddleware, with bursts of up to the same number
+var RateLimitPerMinute = 10
+
+// RateLimitTrustForwardedFor keys clients by the first X-Forwarded-For address instead of the
+// connection address. Enable it only behind a proxy that sets the header.
+var RateLimitTrustForwardedFor = false
+
+// tokenBucket holds the remaining requests of one client
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter tracks a token bucket per client key
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+// allow takes a token from the bucket of key, refilling it at perMinute tokens per minute
+func (l *rateLimiter) allow(key string, perMinute int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	capacity := float64(perMinute)
+	refillPerSecond := capacity / 60
+
+	// Buckets idle for a minute are full again and can be forgotten
+	if now.Sub(l.lastPrune) > time.Minute {
+		for k, bucket := range l.buckets {
+			if now.Sub(bucket.last) > time.Minute {
+				delete(l.buckets, k)
+			}
+		}
+
+		l.lastPrune = now
+	}
+
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: capacity, last: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = min(capacity, bucket.tokens+now.Sub(bucket.last).Seconds()*refillPerSecond)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+
+	bucket.tokens--
+
+	return true
+}
+
+// clientKey identifies the client of a request for rate limiting
+func clientKey(r *http.Request) string {
+	if RateLimitTrustForwardedFor {
+		forwarded := r.Header.Get("X-Forwarded-For")
+		if forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// RateLimitMiddleware rejects requests with 429 once a client exceeds RateLimitPerMinute.
+// A RateLimitPerMinute of zero or less disables limiting.
+func RateLimitMiddleware(next http.Handler) http.Handler {
+	limiter := &rateLimiter{buckets: make(map[string]*tokenBucket)}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		perMinute := RateLimitPerMinute
+		if perMinute <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := clientKey(r)
+
+		if !limiter.allow(key, perMinute, time.Now()) {
+			slog.Warn("Rate limit exceeded", "client", key, "url", r.URL.Path)
+			// One token is refilled every 60/perMinute seconds
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, 60/perMinute)))
+			WriteErrorResponseWithLang(w, errors.New("too many requests, please slow down"), http.StatusTooManyRequests, GetLanguageFromRequest(r))
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
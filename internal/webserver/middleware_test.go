@@ -0,0 +1,225 @@
+package webserver
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionMiddleware(t *testing.T) {
+	payload := strings.Repeat("G1 X10 Y10 E0.5\n", 1000)
+
+	handler := CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, payload)
+	}))
+
+	tests := []struct {
+		name             string
+		target           string
+		acceptEncoding   string
+		expectedEncoding string
+	}{
+		{name: "brotli preferred", target: "/upload", acceptEncoding: "gzip, deflate, br, zstd", expectedEncoding: "br"},
+		{name: "brotli fast", target: "/upload?compress=fast", acceptEncoding: "br", expectedEncoding: "br"},
+		{name: "brotli best", target: "/upload?compress=best", acceptEncoding: "br", expectedEncoding: "br"},
+		{name: "zstd over gzip", target: "/upload", acceptEncoding: "gzip, zstd", expectedEncoding: "zstd"},
+		{name: "gzip by default", target: "/upload", acceptEncoding: "gzip", expectedEncoding: "gzip"},
+		{name: "zstd fast", target: "/upload?compress=fast", acceptEncoding: "zstd", expectedEncoding: "zstd"},
+		{name: "gzip best", target: "/upload?compress=best", acceptEncoding: "gzip", expectedEncoding: "gzip"},
+		{name: "unknown level uses default", target: "/upload?compress=max", acceptEncoding: "gzip", expectedEncoding: "gzip"},
+		{name: "none", target: "/upload?compress=none", acceptEncoding: "gzip, zstd, br", expectedEncoding: ""},
+		{name: "not accepted", target: "/upload", acceptEncoding: "", expectedEncoding: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedEncoding, w.Header().Get("Content-Encoding"))
+
+			var body io.Reader = w.Body
+
+			switch tt.expectedEncoding {
+			case "br":
+				body = brotli.NewReader(w.Body)
+			case "zstd":
+				decoder, err := zstd.NewReader(w.Body)
+				require.NoError(t, err)
+
+				defer decoder.Close()
+
+				body = decoder
+			case "gzip":
+				gz, err := gzip.NewReader(w.Body)
+				require.NoError(t, err)
+
+				body = gz
+			}
+
+			data, err := io.ReadAll(body)
+			require.NoError(t, err)
+			assert.Equal(t, payload, string(data))
+		})
+	}
+}
+
+func TestCompressionMiddleware_Headers(t *testing.T) {
+	payload := strings.Repeat("G1 X10 Y10 E0.5\n", 1000)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+	}{
+		{
+			name: "content length with explicit status",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, payload)
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name: "content length with implicit status",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+				_, _ = io.WriteString(w, payload)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "error status",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				http.Error(w, payload, http.StatusBadRequest)
+			},
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/upload", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+
+			w := httptest.NewRecorder()
+			CompressionMiddleware(tt.handler).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+			assert.Empty(t, w.Header().Get("Content-Length"))
+
+			gz, err := gzip.NewReader(w.Body)
+			require.NoError(t, err)
+
+			data, err := io.ReadAll(gz)
+			require.NoError(t, err)
+			// http.Error appends a newline
+			assert.True(t, strings.HasPrefix(string(data), payload), "body should decode to the payload")
+		})
+	}
+
+	// Uncompressed responses still depend on Accept-Encoding
+	w := httptest.NewRecorder()
+	CompressionMiddleware(tests[0].handler).ServeHTTP(w, httptest.NewRequest("GET", "/upload", nil))
+
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, strconv.Itoa(len(payload)), w.Header().Get("Content-Length"))
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	require.NoError(t, LoadTranslations())
+
+	savedLimit, savedTrust := RateLimitPerMinute, RateLimitTrustForwardedFor
+	t.Cleanup(func() { RateLimitPerMinute, RateLimitTrustForwardedFor = savedLimit, savedTrust })
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	send := func(handler http.Handler, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/upload", nil)
+		req.RemoteAddr = remoteAddr
+
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		return w
+	}
+
+	t.Run("requests over the limit get 429", func(t *testing.T) {
+		RateLimitPerMinute, RateLimitTrustForwardedFor = 3, false
+		handler := RateLimitMiddleware(ok)
+
+		for range 3 {
+			assert.Equal(t, http.StatusOK, send(handler, "192.0.2.1:1000", "").Code)
+		}
+
+		w := send(handler, "192.0.2.1:1001", "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.Equal(t, "20", w.Header().Get("Retry-After"))
+		assert.Contains(t, w.Body.String(), "rate_limited")
+
+		// Other clients keep their own budget
+		assert.Equal(t, http.StatusOK, send(handler, "192.0.2.2:1000", "").Code)
+	})
+
+	t.Run("forwarded for is ignored unless trusted", func(t *testing.T) {
+		RateLimitPerMinute, RateLimitTrustForwardedFor = 1, false
+		handler := RateLimitMiddleware(ok)
+
+		assert.Equal(t, http.StatusOK, send(handler, "192.0.2.1:1000", "198.51.100.1").Code)
+		assert.Equal(t, http.StatusTooManyRequests, send(handler, "192.0.2.1:1000", "198.51.100.2").Code)
+	})
+
+	t.Run("forwarded for keys clients when trusted", func(t *testing.T) {
+		RateLimitPerMinute, RateLimitTrustForwardedFor = 1, true
+		handler := RateLimitMiddleware(ok)
+
+		assert.Equal(t, http.StatusOK, send(handler, "192.0.2.1:1000", "198.51.100.1, 10.0.0.1").Code)
+		assert.Equal(t, http.StatusOK, send(handler, "192.0.2.1:1000", "198.51.100.2").Code)
+		assert.Equal(t, http.StatusTooManyRequests, send(handler, "192.0.2.1:1000", "198.51.100.1").Code)
+	})
+
+	t.Run("zero limit disables limiting", func(t *testing.T) {
+		RateLimitPerMinute, RateLimitTrustForwardedFor = 0, false
+		handler := RateLimitMiddleware(ok)
+
+		for range 20 {
+			assert.Equal(t, http.StatusOK, send(handler, "192.0.2.1:1000", "").Code)
+		}
+	})
+}
+
+func TestRateLimiter_Refill(t *testing.T) {
+	limiter := &rateLimiter{buckets: make(map[string]*tokenBucket)}
+	start := time.Now()
+
+	assert.True(t, limiter.allow("client", 2, start))
+	assert.True(t, limiter.allow("client", 2, start))
+	assert.False(t, limiter.allow("client", 2, start))
+
+	// Two per minute refills one token every 30 seconds
+	assert.False(t, limiter.allow("client", 2, start.Add(29*time.Second)))
+	assert.True(t, limiter.allow("client", 2, start.Add(31*time.Second)))
+}
@@ -0,0 +1,174 @@
+package webserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"printloop/internal/processor"
+)
+
+// ndjsonLine is one output line of NDJSONUploadHandler
+type ndjsonLine struct {
+	Line string `json:"line"`
+}
+
+// ndjsonWarning follows the output lines of NDJSONUploadHandler for every processing warning
+type ndjsonWarning struct {
+	Warning string `json:"warning"`
+}
+
+// ndjsonError ends the stream of NDJSONUploadHandler when processing fails after output was sent
+type ndjsonError struct {
+	Error string `json:"error"`
+}
+
+// ndjsonWriter encodes the complete lines written to it as ndjsonLine objects and flushes them to
+// the client after every write
+type ndjsonWriter struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	encoder    *json.Encoder
+	partial    []byte // Start of a line whose terminator was not written yet
+	written    bool   // Whether anything was sent, after which errors can no longer change the status
+}
+
+func newNDJSONWriter(w http.ResponseWriter) *ndjsonWriter {
+	return &ndjsonWriter{
+		w:          w,
+		controller: http.NewResponseController(w),
+		encoder:    json.NewEncoder(w),
+	}
+}
+
+func (n *ndjsonWriter) Write(p []byte) (int, error) {
+	n.partial = append(n.partial, p...)
+
+	for {
+		line, rest, found := bytes.Cut(n.partial, []byte("\n"))
+		if !found {
+			break
+		}
+
+		err := n.encode(ndjsonLine{Line: string(bytes.TrimSuffix(line, []byte("\r")))})
+		if err != nil {
+			return 0, err
+		}
+
+		n.partial = rest
+	}
+
+	// Keep the unterminated rest in a buffer of its own, the caller may reuse p
+	n.partial = bytes.Clone(n.partial)
+
+	return len(p), n.flush()
+}
+
+// Close sends a final line that was not terminated
+func (n *ndjsonWriter) Close() error {
+	if len(n.partial) == 0 {
+		return nil
+	}
+
+	err := n.encode(ndjsonLine{Line: string(n.partial)})
+	if err != nil {
+		return err
+	}
+
+	n.partial = nil
+
+	return n.flush()
+}
+
+// warnings sends a ndjsonWarning object per warning
+func (n *ndjsonWriter) warnings(warnings []string) error {
+	for _, warning := range warnings {
+		err := n.encode(ndjsonWarning{Warning: warning})
+		if err != nil {
+			return err
+		}
+	}
+
+	return n.flush()
+}
+
+func (n *ndjsonWriter) encode(value any) error {
+	if !n.written {
+		n.w.Header().Set("Content-Type", "application/x-ndjson")
+		n.w.Header().Set("Cache-Control", "no-cache")
+		n.written = true
+	}
+
+	return n.encoder.Encode(value)
+}
+
+func (n *ndjsonWriter) flush() error {
+	if !n.written {
+		return nil
+	}
+
+	return n.controller.Flush()
+}
+
+// NDJSONUploadHandler processes an upload like UploadHandler but streams the result as it is produced,
+// one {"line": "..."} JSON object per G-code line, followed by a {"warning": "..."} object per processing
+// warning. Errors before the first line get the usual error response; later ones end the stream with an
+// {"error": "..."} object.
+func NDJSONUploadHandler(w http.ResponseWriter, r *http.Request) {
+	log := slog.With("handler", "NDJSONUploadHandler")
+	log.Info("Received upload request", "remote_addr", r.RemoteAddr)
+
+	// Determine language for error messages
+	lang := GetLanguageFromRequest(r)
+
+	req, err := receiveRequest(w, r)
+	if err != nil {
+		log.Error("Failed to receive request", "error", err)
+		WriteErrorResponseWithLang(w, err, http.StatusBadRequest, lang)
+
+		return
+	}
+
+	inFileName := path.Join(UploadDir, req.FileName)
+	defer os.Remove(inFileName)
+
+	// Processing stops when the client disconnects or the timeout passes
+	ctx := r.Context()
+
+	if ProcessingTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, ProcessingTimeout)
+		defer cancel()
+	}
+
+	writer := newNDJSONWriter(w)
+
+	warnings, err := processor.ProcessStreamContext(ctx, inFileName, writer, req)
+	if err == nil {
+		err = writer.Close()
+	}
+
+	if err == nil {
+		err = writer.warnings(warnings)
+	}
+
+	if err != nil {
+		log.Error("Request processing failed", "error", err)
+
+		if !writer.written {
+			WriteErrorResponseWithLang(w, err, processingErrorStatus(err), lang)
+			return
+		}
+
+		_ = writer.encode(ndjsonError{Error: err.Error()})
+		_ = writer.flush()
+
+		return
+	}
+
+	log.Info("Request processed", "filename", req.FileName)
+}
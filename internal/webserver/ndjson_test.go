@@ -0,0 +1,89 @@
+package webserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNDJSONWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	writer := newNDJSONWriter(w)
+
+	for _, chunk := range []string{"G1 X1", "\nG1 Y2\r\n\n", "M84"} {
+		n, err := writer.Write([]byte(chunk))
+		require.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+
+	require.NoError(t, writer.Close())
+
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"line":"G1 X1"}`+"\n"+`{"line":"G1 Y2"}`+"\n"+`{"line":""}`+"\n"+`{"line":"M84"}`+"\n", w.Body.String())
+	assert.True(t, w.Flushed)
+}
+
+func TestNDJSONUploadHandler(t *testing.T) {
+	err := os.MkdirAll("files/uploads", 0755)
+	require.NoError(t, err)
+	err = os.MkdirAll("files/results", 0755)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll("files") })
+
+	upload := func(handler http.HandlerFunc, iterations string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+
+		writer := multipart.NewWriter(&buf)
+		_ = writer.WriteField("iterations", iterations)
+		_ = writer.WriteField("printer", "unit-tests")
+
+		part, err := writer.CreateFormFile("file", "model.gcode")
+		require.NoError(t, err)
+
+		_, _ = part.Write([]byte(plainGCode))
+		_ = writer.Close()
+
+		req := httptest.NewRequest("POST", "/upload/ndjson", &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		w := httptest.NewRecorder()
+		handler(w, req)
+
+		return w
+	}
+
+	expected := upload(UploadHandler, "3")
+	require.Equal(t, http.StatusOK, expected.Code, expected.Body.String())
+
+	w := upload(NDJSONUploadHandler, "3")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	var reconstructed strings.Builder
+
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var line map[string]string
+
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		require.Contains(t, line, "line")
+		reconstructed.WriteString(line["line"] + "\n")
+	}
+
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, expected.Body.String(), reconstructed.String())
+
+	invalid := upload(NDJSONUploadHandler, "0")
+	assert.Equal(t, http.StatusBadRequest, invalid.Code)
+	assert.Equal(t, "application/json", invalid.Header().Get("Content-Type"))
+	assert.Contains(t, invalid.Body.String(), "invalid_parameters")
+}
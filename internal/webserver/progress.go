@@ -0,0 +1,213 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// ProgressRetention is how long the progress of a job is kept after its last update
+var ProgressRetention = 10 * time.Minute
+
+// MaxProgressEntries bounds the number of jobs whose progress is kept, the job expiring first makes
+// room for a new one
+var MaxProgressEntries = 1000
+
+// jobIDPattern restricts client chosen job IDs to short URL-safe strings
+var jobIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// jobProgress is the state of a job as sent to ProgressHandler clients
+type jobProgress struct {
+	Iteration int64 `json:"iteration"`
+	Total     int64 `json:"total"`
+	Done      bool  `json:"done"`
+}
+
+// progressEntry holds the progress of one job. updated is closed and replaced on every change.
+type progressEntry struct {
+	progress jobProgress
+	updated  chan struct{}
+	expires  time.Time
+}
+
+// progressTracker keeps the progress of running jobs by job ID. Only the jobs add entries, watching
+// an unknown job waits for entries to be added.
+type progressTracker struct {
+	mu      sync.Mutex
+	entries map[string]*progressEntry
+	added   chan struct{} // Closed and replaced when an entry is added
+}
+
+var jobs = newProgressTracker()
+
+func newProgressTracker() *progressTracker {
+	return &progressTracker{entries: make(map[string]*progressEntry), added: make(chan struct{})}
+}
+
+// remove forgets the entry of id and wakes up its watchers. Callers hold mu.
+func (t *progressTracker) remove(id string) {
+	close(t.entries[id].updated)
+	delete(t.entries, id)
+}
+
+// removeExpired forgets the entries not updated within ProgressRetention. Callers hold mu.
+func (t *progressTracker) removeExpired(now time.Time) {
+	for id, e := range t.entries {
+		if now.After(e.expires) {
+			t.remove(id)
+		}
+	}
+}
+
+// add creates the entry of id, removing the entry expiring first when MaxProgressEntries are kept.
+// Callers hold mu.
+func (t *progressTracker) add(id string) *progressEntry {
+	if len(t.entries) >= MaxProgressEntries {
+		var first string
+
+		for k, e := range t.entries {
+			if first == "" || e.expires.Before(t.entries[first].expires) {
+				first = k
+			}
+		}
+
+		t.remove(first)
+	}
+
+	e := &progressEntry{updated: make(chan struct{})}
+	t.entries[id] = e
+
+	close(t.added)
+	t.added = make(chan struct{})
+
+	return e
+}
+
+// change applies fn to the progress of id, adding the entry when create is set, and wakes up its
+// watchers. Jobs without an entry are left alone otherwise.
+func (t *progressTracker) change(id string, create bool, fn func(*jobProgress)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.removeExpired(now)
+
+	e, exists := t.entries[id]
+	if !exists {
+		if !create {
+			return
+		}
+
+		e = t.add(id)
+	}
+
+	e.expires = now.Add(ProgressRetention)
+	fn(&e.progress)
+
+	close(e.updated)
+	e.updated = make(chan struct{})
+}
+
+// update records that iteration of total iterations of id were streamed
+func (t *progressTracker) update(id string, iteration, total int64) {
+	t.change(id, true, func(progress *jobProgress) {
+		*progress = jobProgress{Iteration: iteration, Total: total}
+	})
+}
+
+// finish marks id as done, keeping its last progress
+func (t *progressTracker) finish(id string) {
+	t.change(id, false, func(progress *jobProgress) {
+		progress.Done = true
+	})
+}
+
+// watch returns the current progress of id and a channel closed on its next change. An unknown job
+// has no progress yet and its channel is closed once any entry is added. Watching neither adds an
+// entry nor extends its expiry.
+func (t *progressTracker) watch(id string) (jobProgress, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.removeExpired(time.Now())
+
+	e, exists := t.entries[id]
+	if !exists {
+		return jobProgress{}, t.added
+	}
+
+	return e.progress, e.updated
+}
+
+// receiveJobID returns the optional job_id form field used to report progress of the upload
+func receiveJobID(r *http.Request) (string, error) {
+	jobID := r.FormValue("job_id")
+	if jobID != "" && !jobIDPattern.MatchString(jobID) {
+		return "", fmt.Errorf("invalid job_id value %v: must be 1 to 64 letters, digits, '-' or '_'", jobID)
+	}
+
+	return jobID, nil
+}
+
+// ProgressHandler streams the progress of the upload with the job_id given as the job query
+// parameter as Server-Sent Events until the job is done. The job may be watched before its
+// upload starts.
+func ProgressHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobID := r.URL.Query().Get("job")
+	if !jobIDPattern.MatchString(jobID) {
+		http.Error(w, "Missing or invalid job parameter", http.StatusBadRequest)
+		return
+	}
+
+	controller := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	var (
+		sent     jobProgress
+		sentOnce bool
+	)
+
+	for {
+		progress, updated := jobs.watch(jobID)
+
+		// Other jobs being added wake up watchers of an unknown job without a change to send
+		if !sentOnce || progress != sent {
+			data, err := json.Marshal(progress)
+			if err != nil {
+				return
+			}
+
+			_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+			if err != nil {
+				return
+			}
+
+			err = controller.Flush()
+			if err != nil {
+				return
+			}
+
+			sent, sentOnce = progress, true
+		}
+
+		if progress.Done {
+			return
+		}
+
+		select {
+		case <-updated:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package webserver
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressTracker(t *testing.T) {
+	tracker := newProgressTracker()
+
+	progress, updated := tracker.watch("job")
+	assert.Equal(t, jobProgress{}, progress)
+
+	tracker.update("job", 1, 3)
+
+	select {
+	case <-updated:
+	default:
+		t.Fatal("Expected watch channel to be closed on update")
+	}
+
+	progress, _ = tracker.watch("job")
+	assert.Equal(t, jobProgress{Iteration: 1, Total: 3}, progress)
+
+	tracker.finish("job")
+
+	progress, _ = tracker.watch("job")
+	assert.Equal(t, jobProgress{Iteration: 1, Total: 3, Done: true}, progress)
+
+	// A new upload with the same ID starts over
+	tracker.update("job", 0, 5)
+
+	progress, _ = tracker.watch("job")
+	assert.Equal(t, jobProgress{Total: 5}, progress)
+}
+
+func TestProgressTracker_Expiry(t *testing.T) {
+	tracker := newProgressTracker()
+
+	tracker.update("old", 1, 1)
+	_, updated := tracker.watch("old")
+
+	tracker.mu.Lock()
+	tracker.removeExpired(time.Now().Add(2 * ProgressRetention))
+	_, exists := tracker.entries["old"]
+	tracker.mu.Unlock()
+
+	assert.False(t, exists)
+
+	select {
+	case <-updated:
+	default:
+		t.Fatal("Expected watchers of an expired job to be woken up")
+	}
+}
+
+func TestProgressTracker_WatchUnknown(t *testing.T) {
+	tracker := newProgressTracker()
+
+	progress, added := tracker.watch("unknown")
+	assert.Equal(t, jobProgress{}, progress)
+	assert.Empty(t, tracker.entries, "watch added an entry")
+
+	// Watching a known job keeps its expiry
+	tracker.update("job", 1, 2)
+
+	select {
+	case <-added:
+	default:
+		t.Fatal("Expected watchers of unknown jobs to be woken up when a job is added")
+	}
+
+	expires := tracker.entries["job"].expires
+
+	time.Sleep(time.Millisecond)
+	tracker.watch("job")
+
+	assert.Equal(t, expires, tracker.entries["job"].expires)
+
+	// Finishing a job that was never updated doesn't add it
+	tracker.finish("unknown")
+	assert.NotContains(t, tracker.entries, "unknown")
+}
+
+func TestProgressTracker_MaxEntries(t *testing.T) {
+	maxEntries := MaxProgressEntries
+	t.Cleanup(func() { MaxProgressEntries = maxEntries })
+
+	MaxProgressEntries = 2
+
+	tracker := newProgressTracker()
+
+	tracker.update("first", 1, 1)
+	time.Sleep(time.Millisecond)
+	tracker.update("second", 1, 1)
+	time.Sleep(time.Millisecond)
+	tracker.update("third", 1, 1)
+
+	assert.Len(t, tracker.entries, 2)
+	assert.NotContains(t, tracker.entries, "first", "the entry expiring first was kept")
+}
+
+func TestProgressHandler(t *testing.T) {
+	t.Run("invalid job", func(t *testing.T) {
+		for _, query := range []string{"", "?job=", "?job=bad%20id"} {
+			w := httptest.NewRecorder()
+			ProgressHandler(w, httptest.NewRequest("GET", "/progress"+query, nil))
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ProgressHandler(w, httptest.NewRequest("POST", "/progress?job=abc", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+
+	t.Run("streams until done", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		finished := make(chan struct{})
+
+		go func() {
+			defer close(finished)
+			ProgressHandler(w, httptest.NewRequest("GET", "/progress?job=test-stream", nil))
+		}()
+
+		// Updates before the handler subscribed are coalesced into the current state
+		jobs.update("test-stream", 1, 2)
+		jobs.update("test-stream", 2, 2)
+		jobs.finish("test-stream")
+
+		select {
+		case <-finished:
+		case <-time.After(5 * time.Second):
+			t.Fatal("ProgressHandler did not return after the job finished")
+		}
+
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+
+		events := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+		assert.Equal(t, `data: {"iteration":2,"total":2,"done":true}`, events[len(events)-1])
+	})
+}
+
+func TestUploadHandler_JobProgress(t *testing.T) {
+	err := os.MkdirAll("files/uploads", 0755)
+	require.NoError(t, err)
+	err = os.MkdirAll("files/results", 0755)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll("files") })
+
+	upload := func(jobID string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+
+		writer := multipart.NewWriter(&buf)
+		_ = writer.WriteField("iterations", "3")
+		_ = writer.WriteField("printer", "unit-tests")
+		_ = writer.WriteField("job_id", jobID)
+
+		part, err := writer.CreateFormFile("file", "model.gcode")
+		require.NoError(t, err)
+
+		_, _ = part.Write([]byte(plainGCode))
+		_ = writer.Close()
+
+		req := httptest.NewRequest("POST", "/upload", &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		w := httptest.NewRecorder()
+		UploadHandler(w, req)
+
+		return w
+	}
+
+	w := upload("upload-job")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "upload-job", w.Header().Get("X-Printloop-Job"))
+
+	progress, _ := jobs.watch("upload-job")
+	assert.Equal(t, jobProgress{Iteration: 3, Total: 3, Done: true}, progress)
+
+	w = upload("not a valid id")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_parameters")
+}
@@ -3,8 +3,12 @@ package webserver
 import (
 	"embed"
 	"encoding/json"
+	"fmt"
+	"io/fs"
 	"net/http"
+	"path"
 	"strings"
+	"sync"
 )
 
 //go:embed translations/*.json
@@ -16,43 +20,89 @@ type Translation map[string]string
 // Translations holds all loaded translations
 type Translations map[string]Translation
 
-var translations Translations
+// translations is replaced as a whole on every load and never modified afterwards, so readers
+// only need the lock to fetch the current map
+var (
+	translationsMu sync.RWMutex
+	translations   Translations
+)
 
-// LoadTranslations loads all translation files
-func LoadTranslations() error {
-	translations = make(Translations)
+// fallbackLanguage is used when a request names no supported language. English is always loaded and
+// remains the fallback for keys missing in it.
+var fallbackLanguage = "en"
 
-	// Load English translations
-	enData, err := translationFiles.ReadFile("translations/en.json")
-	if err != nil {
-		return err
+// SetDefaultLanguage makes lang the language of requests without a supported lang parameter or
+// Accept-Language entry. Translations must be loaded first.
+func SetDefaultLanguage(lang string) error {
+	if !isValidLanguage(lang) {
+		return fmt.Errorf("unsupported default language %q", lang)
 	}
 
-	var enTrans Translation
+	fallbackLanguage = lang
+
+	return nil
+}
+
+// currentTranslations returns the most recently loaded translations
+func currentTranslations() Translations {
+	translationsMu.RLock()
+	defer translationsMu.RUnlock()
+
+	return translations
+}
+
+// setTranslations publishes a fully loaded set of translations
+func setTranslations(loaded Translations) {
+	translationsMu.Lock()
+	defer translationsMu.Unlock()
 
-	err = json.Unmarshal(enData, &enTrans)
+	translations = loaded
+}
+
+// LoadTranslations loads all translation files. It is safe to call while requests are being
+// served; readers keep seeing the previous translations until loading has finished.
+func LoadTranslations() error {
+	loaded, err := loadTranslations(translationFiles, "translations")
 	if err != nil {
 		return err
 	}
 
-	translations["en"] = enTrans
+	setTranslations(loaded)
 
-	// Load Ukrainian translations
-	ukData, err := translationFiles.ReadFile("translations/uk.json")
+	return nil
+}
+
+// loadTranslations reads every <lang>.json file in dir, keyed by lang, so a new locale only needs its
+// file. English is required as the final fallback.
+func loadTranslations(fsys fs.FS, dir string) (Translations, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var ukTrans Translation
+	loaded := make(Translations)
 
-	err = json.Unmarshal(ukData, &ukTrans)
-	if err != nil {
-		return err
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		var trans Translation
+
+		err = json.Unmarshal(data, &trans)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+
+		loaded[strings.TrimSuffix(path.Base(file), ".json")] = trans
 	}
 
-	translations["uk"] = ukTrans
+	if _, exists := loaded["en"]; !exists {
+		return nil, fmt.Errorf("missing English translations %s", path.Join(dir, "en.json"))
+	}
 
-	return nil
+	return loaded, nil
 }
 
 // GetLanguageFromRequest determines the language from URL param or Accept-Language header
@@ -72,9 +122,15 @@ func GetLanguageFromRequest(r *http.Request) string {
 		for lang := range strings.SplitSeq(acceptLang, ",") {
 			// Remove quality values and extra parameters
 			lang = strings.TrimSpace(strings.Split(lang, ";")[0])
+
+			// A locale loaded for the full tag, e.g. pt-BR, wins over its main language
+			if isValidLanguage(lang) {
+				return lang
+			}
+
 			// Extract main language code
 			lang = strings.Split(lang, "-")[0]
-			if lang == "ru" {
+			if lang == "ru" && !isValidLanguage(lang) {
 				return "uk"
 			}
 
@@ -84,27 +140,69 @@ func GetLanguageFromRequest(r *http.Request) string {
 		}
 	}
 
-	// Default to English
-	return "en"
+	return fallbackLanguage
 }
 
 // isValidLanguage checks if the language is supported
 func isValidLanguage(lang string) bool {
-	_, exists := translations[lang]
+	_, exists := currentTranslations()[lang]
 	return exists
 }
 
-// GetTranslation returns the translation for a given key and language
-func GetTranslation(lang, key string) string {
-	if trans, exists := translations[lang]; exists {
-		if text, exists := trans[key]; exists {
-			return text
+// fallbackKey names the locale a translation file falls back to for missing keys, e.g. "pt" in
+// pt-BR.json. Without it a regional locale falls back to its main language.
+const fallbackKey = "_fallback"
+
+// fallbackChain returns the locales searched for a key of lang, most specific first: lang, the locales
+// its fallbacks lead to, the default language and finally English. English always comes last, and a
+// chain that reaches English skips the default language, so keys missing in English stay untranslated.
+func fallbackChain(translations Translations, lang string) []string {
+	var chain []string
+
+	seen := map[string]bool{"en": true}
+	add := func(locale string) {
+		if _, loaded := translations[locale]; loaded && !seen[locale] {
+			chain = append(chain, locale)
+			seen[locale] = true
+		}
+	}
+
+	locale := lang
+	for locale != "" && !seen[locale] {
+		add(locale)
+
+		next := translations[locale][fallbackKey]
+		if next == "" {
+			if i := strings.LastIndex(locale, "-"); i > 0 {
+				next = locale[:i]
+			}
+		}
+
+		// Unloaded links are skipped, the chain continues with their own parent
+		if _, loaded := translations[locale]; !loaded {
+			seen[locale] = true
 		}
+
+		locale = next
+	}
+
+	if locale != "en" {
+		add(fallbackLanguage)
 	}
 
-	// Fallback to English
-	if trans, exists := translations["en"]; exists {
-		if text, exists := trans[key]; exists {
+	if _, loaded := translations["en"]; loaded {
+		chain = append(chain, "en")
+	}
+
+	return chain
+}
+
+// GetTranslation returns the translation for a given key and language
+func GetTranslation(lang, key string) string {
+	translations := currentTranslations()
+
+	for _, locale := range fallbackChain(translations, lang) {
+		if text, exists := translations[locale][key]; exists {
 			return text
 		}
 	}
@@ -113,17 +211,21 @@ func GetTranslation(lang, key string) string {
 	return key
 }
 
-// GetTranslations returns all translations for a given language
+// GetTranslations returns all translations for a given language, keys missing in it filled in along
+// its fallback chain
 func GetTranslations(lang string) Translation {
-	if trans, exists := translations[lang]; exists {
-		return trans
-	}
+	translations := currentTranslations()
+	chain := fallbackChain(translations, lang)
 
-	// Fallback to English
-	if trans, exists := translations["en"]; exists {
-		return trans
+	merged := make(Translation)
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		for key, text := range translations[chain[i]] {
+			merged[key] = text
+		}
 	}
 
-	// Return empty translation if nothing found
-	return make(Translation)
+	delete(merged, fallbackKey)
+
+	return merged
 }
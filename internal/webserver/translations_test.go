@@ -0,0 +1,174 @@
+// file: internal/webserver/translations_test.go
+package webserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTranslations_ConcurrentReads(t *testing.T) {
+	require.NoError(t, LoadTranslations())
+
+	const readers = 8
+
+	var wg sync.WaitGroup
+
+	done := make(chan struct{})
+
+	for range readers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				assert.NotEmpty(t, GetTranslations("uk"))
+				assert.True(t, isValidLanguage("en"))
+				_ = GetTranslation("uk", "select_printer")
+			}
+		}()
+	}
+
+	for range 50 {
+		assert.NoError(t, LoadTranslations())
+	}
+
+	close(done)
+	wg.Wait()
+}
+
+func TestSetDefaultLanguage(t *testing.T) {
+	require.NoError(t, LoadTranslations())
+	t.Cleanup(func() { fallbackLanguage = "en" })
+
+	require.NoError(t, SetDefaultLanguage("uk"))
+	assert.Error(t, SetDefaultLanguage("de"))
+
+	request := func(acceptLanguage string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		if acceptLanguage != "" {
+			r.Header.Set("Accept-Language", acceptLanguage)
+		}
+
+		return r
+	}
+
+	assert.Equal(t, "uk", GetLanguageFromRequest(request("")))
+	assert.Equal(t, "uk", GetLanguageFromRequest(request("de-DE,fr;q=0.8")))
+	assert.Equal(t, "en", GetLanguageFromRequest(request("en-US")))
+	assert.Equal(t, "en", GetLanguageFromRequest(httptest.NewRequest("GET", "/?lang=en", nil)))
+
+	assert.Equal(t, GetTranslations("uk"), GetTranslations("de"))
+	assert.Equal(t, GetTranslation("uk", "select_printer"), GetTranslation("de", "select_printer"))
+	assert.NotEqual(t, GetTranslation("en", "select_printer"), GetTranslation("de", "select_printer"))
+}
+
+func TestLoadTranslations_Dynamic(t *testing.T) {
+	t.Cleanup(func() { require.NoError(t, LoadTranslations()) })
+
+	fsys := fstest.MapFS{
+		"translations/en.json":    {Data: []byte(`{"select_printer": "Select printer"}`)},
+		"translations/uk.json":    {Data: []byte(`{"select_printer": "Оберіть принтер"}`)},
+		"translations/de.json":    {Data: []byte(`{"select_printer": "Drucker auswählen"}`)},
+		"translations/pt-BR.json": {Data: []byte(`{"select_printer": "Selecione a impressora"}`)},
+		"translations/README.md":  {Data: []byte(`not a locale`)},
+	}
+
+	loaded, err := loadTranslations(fsys, "translations")
+	require.NoError(t, err)
+	assert.Len(t, loaded, 4)
+
+	setTranslations(loaded)
+
+	request := func(acceptLanguage string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", acceptLanguage)
+
+		return r
+	}
+
+	assert.Equal(t, "de", GetLanguageFromRequest(request("de-DE,de;q=0.9,en;q=0.8")))
+	assert.Equal(t, "pt-BR", GetLanguageFromRequest(request("pt-BR,pt;q=0.9")))
+	assert.Equal(t, "en", GetLanguageFromRequest(request("fr-FR,fr;q=0.9")))
+	assert.Equal(t, "uk", GetLanguageFromRequest(request("ru-RU")))
+	assert.Equal(t, "de", GetLanguageFromRequest(httptest.NewRequest("GET", "/?lang=de", nil)))
+	assert.Equal(t, "Drucker auswählen", GetTranslation("de", "select_printer"))
+}
+
+func TestLoadTranslations_Invalid(t *testing.T) {
+	_, err := loadTranslations(fstest.MapFS{
+		"translations/uk.json": {Data: []byte(`{}`)},
+	}, "translations")
+	assert.ErrorContains(t, err, "missing English translations")
+
+	_, err = loadTranslations(fstest.MapFS{
+		"translations/en.json": {Data: []byte(`{}`)},
+		"translations/de.json": {Data: []byte(`{"unterminated`)},
+	}, "translations")
+	assert.ErrorContains(t, err, "translations/de.json")
+}
+
+func TestGetTranslation_FallbackChain(t *testing.T) {
+	t.Cleanup(func() {
+		fallbackLanguage = "en"
+		require.NoError(t, LoadTranslations())
+	})
+
+	fsys := fstest.MapFS{
+		"translations/en.json":    {Data: []byte(`{"select_printer": "Select printer", "upload": "Upload", "iterations": "Iterations", "help": "Help"}`)},
+		"translations/uk.json":    {Data: []byte(`{"select_printer": "Оберіть принтер", "upload": "Завантажити", "iterations": "Ітерації"}`)},
+		"translations/pt.json":    {Data: []byte(`{"select_printer": "Selecione a impressora", "upload": "Enviar"}`)},
+		"translations/pt-BR.json": {Data: []byte(`{"upload": "Carregar"}`)},
+		"translations/ca.json":    {Data: []byte(`{"_fallback": "es", "upload": "Pujar"}`)},
+		"translations/es.json":    {Data: []byte(`{"select_printer": "Seleccione la impresora"}`)},
+		"translations/xx.json":    {Data: []byte(`{"_fallback": "xx"}`)},
+	}
+
+	loaded, err := loadTranslations(fsys, "translations")
+	require.NoError(t, err)
+
+	setTranslations(loaded)
+
+	assert.Equal(t, []string{"pt-BR", "pt", "en"}, fallbackChain(loaded, "pt-BR"))
+	assert.Equal(t, []string{"pt", "en"}, fallbackChain(loaded, "pt-PT"))
+	assert.Equal(t, []string{"ca", "es", "en"}, fallbackChain(loaded, "ca"))
+	assert.Equal(t, []string{"xx", "en"}, fallbackChain(loaded, "xx"))
+	assert.Equal(t, []string{"en"}, fallbackChain(loaded, "fr"))
+
+	assert.Equal(t, "Carregar", GetTranslation("pt-BR", "upload"))
+	assert.Equal(t, "Selecione a impressora", GetTranslation("pt-BR", "select_printer"))
+	assert.Equal(t, "Help", GetTranslation("pt-BR", "help"))
+	assert.Equal(t, "Seleccione la impresora", GetTranslation("ca", "select_printer"))
+	assert.Equal(t, "missing_key", GetTranslation("pt-BR", "missing_key"))
+
+	assert.Equal(t, Translation{
+		"select_printer": "Selecione a impressora",
+		"upload":         "Carregar",
+		"iterations":     "Iterations",
+		"help":           "Help",
+	}, GetTranslations("pt-BR"))
+	assert.NotContains(t, GetTranslations("ca"), fallbackKey)
+
+	// The default language sits between the chain and English
+	fallbackLanguage = "uk"
+
+	assert.Equal(t, []string{"pt-BR", "pt", "uk", "en"}, fallbackChain(loaded, "pt-BR"))
+	assert.Equal(t, "Ітерації", GetTranslation("pt-BR", "iterations"))
+	assert.Equal(t, "Help", GetTranslation("pt-BR", "help"))
+
+	// English never falls back to the default language
+	assert.Equal(t, []string{"en"}, fallbackChain(loaded, "en"))
+	assert.Equal(t, "missing_key", GetTranslation("en", "missing_key"))
+}
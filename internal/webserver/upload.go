@@ -0,0 +1,333 @@
+package webserver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"printloop/internal/processor"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// MaxDecompressedUploadSize bounds the size of a decompressed .gz/.zst upload
+var MaxDecompressedUploadSize int64 = 1 << 30
+
+// AllowedFileExtensions are the upload extensions offered by the file picker and accepted by
+// saveUploadPart: G-code, plain or compressed as decompressUpload reads it, and text files whose
+// content passes looksLikeGCode
+var AllowedFileExtensions = map[string]bool{
+	".gcode": true,
+	".gz":    true,
+	".txt":   true,
+	".zst":   true,
+}
+
+// checkUploadExtension rejects file names whose extension is not in AllowedFileExtensions, compared
+// case-insensitively
+func checkUploadExtension(fileName string) error {
+	extension := strings.ToLower(path.Ext(fileName))
+	if !AllowedFileExtensions[extension] {
+		return fmt.Errorf("unsupported file extension %q: must be one of %s", extension, strings.Join(getAllowedExtensions(), ", "))
+	}
+
+	return nil
+}
+
+// getAllowedExtensions returns the keys of AllowedFileExtensions, sorted
+func getAllowedExtensions() []string {
+	return slices.Sorted(maps.Keys(AllowedFileExtensions))
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompressUpload returns a reader of the uploaded G-code and its file name. Files named *.gz or
+// *.zst are checked for the matching magic bytes, decompressed and returned without the suffix;
+// other files are returned unchanged. The returned close function releases the decompressor.
+func decompressUpload(file io.Reader, fileName string) (io.Reader, string, func(), error) {
+	noop := func() {}
+
+	baseName, isGzip := strings.CutSuffix(fileName, ".gz")
+	if !isGzip {
+		var isZstd bool
+
+		baseName, isZstd = strings.CutSuffix(fileName, ".zst")
+		if !isZstd {
+			return file, fileName, noop, nil
+		}
+	}
+
+	buffered := bufio.NewReader(file)
+
+	magic, err := buffered.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, "", noop, fmt.Errorf("failed to read compressed upload: %w", err)
+	}
+
+	var (
+		reader  io.Reader
+		closeFn = noop
+	)
+
+	switch {
+	case isGzip && bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, "", noop, fmt.Errorf("invalid gzip upload: %w", err)
+		}
+
+		reader = gz
+		closeFn = func() { _ = gz.Close() }
+	case !isGzip && bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, "", noop, fmt.Errorf("invalid zstd upload: %w", err)
+		}
+
+		reader = decoder
+		closeFn = decoder.Close
+	default:
+		return nil, "", noop, fmt.Errorf("compressed upload %s does not start with the expected magic bytes", fileName)
+	}
+
+	return &limitedDecompressReader{reader: reader, remaining: MaxDecompressedUploadSize}, baseName, closeFn, nil
+}
+
+// limitedDecompressReader fails once more than remaining bytes were decompressed
+type limitedDecompressReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *limitedDecompressReader) Read(p []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, fmt.Errorf("decompressed upload exceeds %d bytes", MaxDecompressedUploadSize)
+	}
+
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+
+	if r.remaining < 0 {
+		return n, fmt.Errorf("decompressed upload exceeds %d bytes", MaxDecompressedUploadSize)
+	}
+
+	return n, err
+}
+
+// gcodeSniffLines is how many command lines, comments and blank lines not counted, of an upload are
+// searched for a G-code command
+const gcodeSniffLines = 100
+
+// errEmptyUpload rejects uploads without content, also compressed ones that decompress to nothing
+var errEmptyUpload = errors.New("uploaded file is empty")
+
+// errNotGCode rejects uploads that pass as text but contain no G-code, e.g. a README renamed to .gcode
+var errNotGCode = fmt.Errorf("uploaded file does not look like G-code: no G, M or T command in the first %d lines", gcodeSniffLines)
+
+// looksLikeGCode reports whether one of the first gcodeSniffLines command lines of r starts with a
+// G, M or T command. Slicer headers and thumbnails are comments, starting with commentPrefix, and
+// don't count towards the limit.
+func looksLikeGCode(r io.Reader, commentPrefix string) (bool, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	commands := 0
+
+	for scanner.Scan() && commands < gcodeSniffLines {
+		line, _, _ := strings.Cut(scanner.Text(), commentPrefix)
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		commands++
+
+		if isGCodeCommand(line) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// uploadCommentPrefix returns the comment prefix of the printer req is processed with, ";" when req
+// doesn't make a processor, processing reports why
+func uploadCommentPrefix(req processor.ProcessingRequest) string {
+	p, err := processor.NewStreamingProcessor(req)
+	if err != nil {
+		return ";"
+	}
+
+	return p.CommentPrefix()
+}
+
+// isGCodeCommand reports whether line starts with a G, M or T word, like G1, M104 or T0, optionally
+// after an N line number
+func isGCodeCommand(line string) bool {
+	if line[0] == 'N' || line[0] == 'n' {
+		_, rest, found := strings.Cut(line, " ")
+		if !found {
+			return false
+		}
+
+		line = strings.TrimSpace(rest)
+	}
+
+	if len(line) < 2 || !strings.ContainsRune("GgMmTt", rune(line[0])) {
+		return false
+	}
+
+	return line[1] >= '0' && line[1] <= '9'
+}
+
+// maxFormValuesSize bounds the form fields other than the file, like http.Request.ParseMultipartForm
+const maxFormValuesSize = 10 << 20
+
+// streamedUpload is the file part of an upload form, saved to UploadDir while the form was read
+type streamedUpload struct {
+	fileName string // Name of the saved file in UploadDir
+	err      error  // Problem with the file itself, reported once the other fields are validated
+}
+
+// bodyErrorReader records the last error of reading the request body, telling a broken upload apart
+// from a file that fails to decompress
+type bodyErrorReader struct {
+	io.ReadCloser
+	err error
+}
+
+func (r *bodyErrorReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.err = err
+	}
+
+	return n, err
+}
+
+// parseMultipartStream reads the multipart form of r part by part into r.Form and r.PostForm, like
+// r.ParseMultipartForm, but saves the first file part named "file" while reading instead of buffering
+// it. The returned upload is nil when the form has no file.
+func parseMultipartStream(r *http.Request) (*streamedUpload, error) {
+	body := &bodyErrorReader{ReadCloser: r.Body}
+	r.Body = body
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	var upload *streamedUpload
+
+	values := make(url.Values)
+	valuesSize := int64(0)
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			removeUpload(upload)
+			return nil, err
+		}
+
+		name := part.FormName()
+
+		if part.FileName() != "" {
+			if name == "file" && upload == nil {
+				upload = saveUploadPart(part)
+				if body.err != nil {
+					removeUpload(upload)
+					return nil, body.err
+				}
+			}
+
+			continue
+		}
+
+		var value strings.Builder
+
+		n, err := io.Copy(&value, io.LimitReader(part, maxFormValuesSize-valuesSize+1))
+		if err != nil {
+			removeUpload(upload)
+			return nil, err
+		}
+
+		valuesSize += n
+		if valuesSize > maxFormValuesSize {
+			removeUpload(upload)
+			return nil, multipart.ErrMessageTooLarge
+		}
+
+		values.Add(name, value.String())
+	}
+
+	// Query parameters come first, as with ParseMultipartForm
+	r.Form = r.URL.Query()
+	r.PostForm = values
+
+	for name, value := range values {
+		r.Form[name] = append(r.Form[name], value...)
+	}
+
+	return upload, nil
+}
+
+// saveUploadPart decompresses and saves an uploaded file part to UploadDir
+func saveUploadPart(part *multipart.Part) *streamedUpload {
+	err := checkUploadExtension(part.FileName())
+	if err != nil {
+		return &streamedUpload{err: err}
+	}
+
+	content, fileName, closeContent, err := decompressUpload(part, part.FileName())
+	if err != nil {
+		return &streamedUpload{err: err}
+	}
+	defer closeContent()
+
+	upload := &streamedUpload{fileName: fmt.Sprintf("%d_%s", time.Now().Unix(), fileName)}
+	filePath := path.Join(UploadDir, upload.fileName)
+
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return &streamedUpload{err: fmt.Errorf("file creation failed: %w", err)}
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, content)
+	if err != nil {
+		_ = os.Remove(filePath)
+		return &streamedUpload{err: fmt.Errorf("file saving error: %w", err)}
+	}
+
+	return upload
+}
+
+// removeUpload removes the saved file of upload, if any
+func removeUpload(upload *streamedUpload) {
+	if upload != nil && upload.err == nil {
+		_ = os.Remove(path.Join(UploadDir, upload.fileName))
+	}
+}
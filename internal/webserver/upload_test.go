@@ -0,0 +1,643 @@
+package webserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const plainGCode = "HEADER\nSTART_PRINT\nG1 X10 Y10 E1\nEND_PRINT\nFOOTER\n"
+
+func gzipBytes(t *testing.T, data string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, data string) []byte {
+	t.Helper()
+
+	encoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+
+	defer encoder.Close()
+
+	return encoder.EncodeAll([]byte(data), nil)
+}
+
+func TestDecompressUpload(t *testing.T) {
+	tests := []struct {
+		name             string
+		fileName         string
+		content          []byte
+		expectedFileName string
+		expectedContent  string
+		expectError      bool
+	}{
+		{
+			name:             "plain file unchanged",
+			fileName:         "model.gcode",
+			content:          []byte(plainGCode),
+			expectedFileName: "model.gcode",
+			expectedContent:  plainGCode,
+		},
+		{
+			name:             "gzip",
+			fileName:         "model.gcode.gz",
+			content:          gzipBytes(t, plainGCode),
+			expectedFileName: "model.gcode",
+			expectedContent:  plainGCode,
+		},
+		{
+			name:             "zstd",
+			fileName:         "model.gcode.zst",
+			content:          zstdBytes(t, plainGCode),
+			expectedFileName: "model.gcode",
+			expectedContent:  plainGCode,
+		},
+		{
+			name:        "gz suffix without gzip magic",
+			fileName:    "model.gcode.gz",
+			content:     []byte(plainGCode),
+			expectError: true,
+		},
+		{
+			name:        "zst suffix with gzip content",
+			fileName:    "model.gcode.zst",
+			content:     gzipBytes(t, plainGCode),
+			expectError: true,
+		},
+		{
+			name:        "empty gz file",
+			fileName:    "model.gcode.gz",
+			content:     nil,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, fileName, closeFn, err := decompressUpload(bytes.NewReader(tt.content), tt.fileName)
+			defer closeFn()
+
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedFileName, fileName)
+
+			content, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedContent, string(content))
+		})
+	}
+}
+
+func TestDecompressUpload_SizeLimit(t *testing.T) {
+	saved := MaxDecompressedUploadSize
+	MaxDecompressedUploadSize = 10
+
+	t.Cleanup(func() { MaxDecompressedUploadSize = saved })
+
+	reader, _, closeFn, err := decompressUpload(bytes.NewReader(gzipBytes(t, plainGCode)), "model.gcode.gz")
+	require.NoError(t, err)
+
+	defer closeFn()
+
+	_, err = io.ReadAll(reader)
+	assert.ErrorContains(t, err, "exceeds 10 bytes")
+}
+
+func TestUploadHandler_CompressedUpload(t *testing.T) {
+	err := os.MkdirAll("files/uploads", 0755)
+	require.NoError(t, err)
+	err = os.MkdirAll("files/results", 0755)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll("files") })
+
+	upload := func(fileName string, content []byte) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+
+		writer := multipart.NewWriter(&buf)
+		_ = writer.WriteField("iterations", "2")
+		_ = writer.WriteField("printer", "unit-tests")
+
+		part, err := writer.CreateFormFile("file", fileName)
+		require.NoError(t, err)
+
+		_, _ = part.Write(content)
+		_ = writer.Close()
+
+		req := httptest.NewRequest("POST", "/upload", &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		w := httptest.NewRecorder()
+		UploadHandler(w, req)
+
+		return w
+	}
+
+	plain := upload("model.gcode", []byte(plainGCode))
+	require.Equal(t, http.StatusOK, plain.Code, plain.Body.String())
+	assert.Equal(t, strconv.Itoa(plain.Body.Len()), plain.Header().Get("X-Printloop-Output-Bytes"))
+
+	for fileName, content := range map[string][]byte{
+		"model.gcode.gz":  gzipBytes(t, plainGCode),
+		"model.gcode.zst": zstdBytes(t, plainGCode),
+	} {
+		t.Run(fileName, func(t *testing.T) {
+			compressed := upload(fileName, content)
+			require.Equal(t, http.StatusOK, compressed.Code, compressed.Body.String())
+
+			assert.Equal(t, plain.Body.String(), compressed.Body.String())
+			assert.Contains(t, compressed.Header().Get("Content-Disposition"), "_model.gcode\"")
+		})
+	}
+}
+
+func TestUploadHandler_ProcessingTimeout(t *testing.T) {
+	err := os.MkdirAll("files/uploads", 0755)
+	require.NoError(t, err)
+	err = os.MkdirAll("files/results", 0755)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll("files") })
+
+	saved := ProcessingTimeout
+	ProcessingTimeout = time.Nanosecond
+
+	t.Cleanup(func() { ProcessingTimeout = saved })
+
+	var buf bytes.Buffer
+
+	writer := multipart.NewWriter(&buf)
+	_ = writer.WriteField("iterations", "2")
+	_ = writer.WriteField("printer", "unit-tests")
+
+	part, err := writer.CreateFormFile("file", "model.gcode")
+	require.NoError(t, err)
+
+	_, _ = part.Write([]byte(plainGCode))
+	_ = writer.Close()
+
+	req := httptest.NewRequest("POST", "/upload", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	UploadHandler(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "processing_timeout")
+}
+
+func TestUploadHandler_StrategyOverride(t *testing.T) {
+	err := os.MkdirAll("files/uploads", 0755)
+	require.NoError(t, err)
+	err = os.MkdirAll("files/results", 0755)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll("files") })
+
+	// Two end markers: the printer's after_last_appear loops both parts, after_first_appear only the first
+	const gcode = "HEADER\nSTART_PRINT\nG1 X10 Y10 E1\nEND_PRINT\nG1 X20 Y20 E1\nEND_PRINT\nFOOTER\n"
+
+	upload := func(fields map[string]string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+
+		writer := multipart.NewWriter(&buf)
+		_ = writer.WriteField("iterations", "2")
+		_ = writer.WriteField("printer", "unit-tests")
+
+		for key, value := range fields {
+			_ = writer.WriteField(key, value)
+		}
+
+		part, err := writer.CreateFormFile("file", "model.gcode")
+		require.NoError(t, err)
+
+		_, _ = part.Write([]byte(gcode))
+		_ = writer.Close()
+
+		req := httptest.NewRequest("POST", "/upload", &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		w := httptest.NewRecorder()
+		UploadHandler(w, req)
+
+		return w
+	}
+
+	printerDefault := upload(nil)
+	require.Equal(t, http.StatusOK, printerDefault.Code, printerDefault.Body.String())
+	assert.Equal(t, 2, strings.Count(printerDefault.Body.String(), "G1 X20 Y20 E1"))
+
+	overridden := upload(map[string]string{"print_strategy": "after_first_appear"})
+	require.Equal(t, http.StatusOK, overridden.Code, overridden.Body.String())
+	assert.Equal(t, 1, strings.Count(overridden.Body.String(), "G1 X20 Y20 E1"))
+	assert.Equal(t, 2, strings.Count(overridden.Body.String(), "G1 X10 Y10 E1"))
+
+	for _, field := range []string{"init_strategy", "print_strategy"} {
+		invalid := upload(map[string]string{field: "after_second_appear"})
+		assert.Equal(t, http.StatusBadRequest, invalid.Code, field)
+		assert.Contains(t, invalid.Body.String(), "invalid_parameters", field)
+	}
+}
+
+func TestUploadHandler_AlreadyLooped(t *testing.T) {
+	err := os.MkdirAll("files/uploads", 0755)
+	require.NoError(t, err)
+	err = os.MkdirAll("files/results", 0755)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll("files") })
+
+	upload := func(content string, force bool) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+
+		writer := multipart.NewWriter(&buf)
+		_ = writer.WriteField("iterations", "2")
+		_ = writer.WriteField("printer", "unit-tests")
+		_ = writer.WriteField("force", strconv.FormatBool(force))
+
+		part, err := writer.CreateFormFile("file", "model.gcode")
+		require.NoError(t, err)
+
+		_, _ = part.Write([]byte(content))
+		_ = writer.Close()
+
+		req := httptest.NewRequest("POST", "/upload", &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		w := httptest.NewRecorder()
+		UploadHandler(w, req)
+
+		return w
+	}
+
+	looped := upload(plainGCode, false)
+	require.Equal(t, http.StatusOK, looped.Code, looped.Body.String())
+
+	again := upload(looped.Body.String(), false)
+	assert.Equal(t, http.StatusUnprocessableEntity, again.Code)
+	assert.Contains(t, again.Body.String(), "already_looped")
+
+	forced := upload(looped.Body.String(), true)
+	assert.Equal(t, http.StatusOK, forced.Code, forced.Body.String())
+}
+
+func TestUploadHandler_Warnings(t *testing.T) {
+	err := os.MkdirAll("files/uploads", 0755)
+	require.NoError(t, err)
+	err = os.MkdirAll("files/results", 0755)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll("files") })
+
+	// END_PRINT is at 60% of plainGCode
+	template := func(parameters, code string) string {
+		return `
+Name = "test-warnings"
+[Markers]
+EndInitSection = ["START_PRINT"]
+EndPrintSection = ["END_PRINT"]
+[SearchStrategy]
+EndInitSectionStrategy = "after_first_appear"
+EndPrintSectionStrategy = "after_last_appear"
+[Parameters]
+` + parameters + `
+[Template]
+Code = "` + code + `"
+`
+	}
+
+	upload := func(handler http.HandlerFunc, parameters, code string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+
+		writer := multipart.NewWriter(&buf)
+		_ = writer.WriteField("iterations", "2")
+		_ = writer.WriteField("printer", "unit-tests")
+		_ = writer.WriteField("custom_template", template(parameters, code))
+
+		part, err := writer.CreateFormFile("file", "model.gcode")
+		require.NoError(t, err)
+
+		_, _ = part.Write([]byte(plainGCode))
+		_ = writer.Close()
+
+		req := httptest.NewRequest("POST", "/upload", &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		w := httptest.NewRecorder()
+		handler(w, req)
+
+		return w
+	}
+
+	tests := []struct {
+		name       string
+		parameters string
+		code       string
+		warning    string
+		strictCode string // Error code with the strict parameters set, empty without a strict mode
+	}{
+		{
+			name:       "early end marker",
+			parameters: "MinPrintSectionFraction = 0.9",
+			code:       "; Iteration {{.Iteration}}",
+			warning:    "end marker found suspiciously early at line 4 of 5",
+			strictCode: "print_section_early",
+		},
+		{
+			name:       "short body",
+			parameters: "MinBodyLines = 3",
+			code:       "; Iteration {{.Iteration}}",
+			warning:    "iteration body has only 1 lines (expected at least 3)",
+			strictCode: "body_too_short",
+		},
+		{
+			name:       "lint finding",
+			parameters: "LintGeneratedCode = true",
+			code:       "G1",
+			warning:    "generated code for iteration 1, line 1: G1 without axes or feedrate does nothing",
+		},
+		{
+			name:    "nothing generated",
+			code:    " ",
+			warning: "template produced no generated code for any iteration",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := upload(UploadHandler, tt.parameters, tt.code)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			var warnings []string
+
+			require.NoError(t, json.Unmarshal([]byte(w.Header().Get("X-Printloop-Warnings")), &warnings))
+			require.Len(t, warnings, 1)
+			assert.Contains(t, warnings[0], tt.warning)
+
+			w = upload(NDJSONUploadHandler, tt.parameters, tt.code)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+			assert.JSONEq(t, mustJSON(t, map[string]string{"warning": warnings[0]}), lines[len(lines)-1])
+
+			if tt.strictCode == "" {
+				return
+			}
+
+			strict := upload(UploadHandler, tt.parameters+"\nStrictPrintSectionPosition = true\nStrictBodyLines = true", tt.code)
+			assert.Equal(t, http.StatusInternalServerError, strict.Code)
+			assert.Contains(t, strict.Body.String(), tt.strictCode)
+			assert.Empty(t, strict.Header().Get("X-Printloop-Warnings"))
+		})
+	}
+}
+
+func TestUploadHandler_LineStats(t *testing.T) {
+	err := os.MkdirAll("files/uploads", 0755)
+	require.NoError(t, err)
+	err = os.MkdirAll("files/results", 0755)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll("files") })
+
+	const multiRegionTemplate = `
+Name = "test-line-stats"
+[Markers]
+EndInitSection = ["START_PRINT"]
+EndPrintSection = ["END_PRINT"]
+[SearchStrategy]
+EndInitSectionStrategy = "after_first_appear"
+EndPrintSectionStrategy = "after_last_appear"
+[Parameters]
+MultiRegion = true
+[Template]
+Code = "; next"
+`
+
+	var buf bytes.Buffer
+
+	writer := multipart.NewWriter(&buf)
+	_ = writer.WriteField("iterations", "3")
+	_ = writer.WriteField("printer", "unit-tests")
+	_ = writer.WriteField("custom_template", multiRegionTemplate)
+
+	part, err := writer.CreateFormFile("file", "model.gcode")
+	require.NoError(t, err)
+
+	_, _ = part.Write([]byte(plainGCode + "START_PRINT\nG1 X20 Y20 E1\nG1 X30 Y30 E1\nEND_PRINT\n"))
+	_ = writer.Close()
+
+	req := httptest.NewRequest("POST", "/upload", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	UploadHandler(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// The body and generated lines add up over both regions
+	assert.Equal(t, "9", w.Header().Get("X-Printloop-Original-Lines"))
+	assert.Equal(t, "3", w.Header().Get("X-Printloop-Body-Lines"))
+	assert.Equal(t, "2", w.Header().Get("X-Printloop-Generated-Lines"))
+	assert.Equal(t, strconv.Itoa(strings.Count(w.Body.String(), "\n")), w.Header().Get("X-Printloop-Projected-Lines"))
+}
+
+func TestLooksLikeGCode(t *testing.T) {
+	t.Parallel()
+
+	thumbnail := "; thumbnail begin 32x32 1024\n" + strings.Repeat("; iVBORw0KGgoAAAANSUhEUgAAACAAAAAgCAYAAABzenr0AAAAAXNSR0IArs4c6QAAAARnQU1BAACx\n", 500) + "; thumbnail end\n"
+
+	tests := []struct {
+		name          string
+		content       string
+		commentPrefix string
+		expected      bool
+	}{
+		{name: "slicer output", content: "; generated by OrcaSlicer\n\nM104 S210\nG28\nG1 X10 Y10 E1\n", expected: true},
+		{name: "commands after thumbnail", content: thumbnail + "G90\n", expected: true},
+		{name: "line numbers and lower case", content: "N10 g1 x10\n", expected: true},
+		{name: "tool change", content: "T0\n", expected: true},
+		{name: "markers around a move", content: plainGCode, expected: true},
+		{name: "prose", content: "Lorem ipsum dolor sit amet.\nGreat print, 10/10!\nMy notes about the model\n", expected: false},
+		{name: "comments only", content: "; just a comment\n;G1 X10\n", expected: false},
+		{name: "empty", content: "", expected: false},
+		{name: "command too late", content: strings.Repeat("word\n", gcodeSniffLines) + "G1 X10\n", expected: false},
+		{name: "hash comments skipped", content: strings.Repeat("# thumbnail data\n", gcodeSniffLines) + "G90 # absolute\n", commentPrefix: "#", expected: true},
+		{name: "hash comments counted with semicolon prefix", content: strings.Repeat("# thumbnail data\n", gcodeSniffLines) + "G90\n", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			commentPrefix := tt.commentPrefix
+			if commentPrefix == "" {
+				commentPrefix = ";"
+			}
+
+			got, err := looksLikeGCode(strings.NewReader(tt.content), commentPrefix)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestUploadHandler_NotGCode(t *testing.T) {
+	err := os.MkdirAll("files/uploads", 0755)
+	require.NoError(t, err)
+	err = os.MkdirAll("files/results", 0755)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll("files") })
+
+	upload := func(fileName, content string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+
+		writer := multipart.NewWriter(&buf)
+		_ = writer.WriteField("iterations", "2")
+		_ = writer.WriteField("printer", "unit-tests")
+
+		part, err := writer.CreateFormFile("file", fileName)
+		require.NoError(t, err)
+
+		_, _ = part.Write([]byte(content))
+		_ = writer.Close()
+
+		req := httptest.NewRequest("POST", "/upload", &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		w := httptest.NewRecorder()
+		UploadHandler(w, req)
+
+		return w
+	}
+
+	prose := upload("notes.txt", "These are my printing notes.\nThe first layer was too squished.\n")
+	assert.Equal(t, http.StatusBadRequest, prose.Code)
+	assert.Contains(t, prose.Body.String(), "not_gcode")
+
+	entries, err := os.ReadDir("files/uploads")
+	require.NoError(t, err)
+	assert.Empty(t, entries, "rejected upload not removed")
+
+	empty := upload("model.gcode", "")
+	assert.Equal(t, http.StatusBadRequest, empty.Code)
+	assert.Contains(t, empty.Body.String(), "empty_file")
+	assert.Contains(t, empty.Body.String(), "uploaded file is empty")
+
+	var compressed bytes.Buffer
+
+	gz := gzip.NewWriter(&compressed)
+	require.NoError(t, gz.Close())
+
+	emptyCompressed := upload("model.gcode.gz", compressed.String())
+	assert.Equal(t, http.StatusBadRequest, emptyCompressed.Code)
+	assert.Contains(t, emptyCompressed.Body.String(), "empty_file")
+
+	entries, err = os.ReadDir("files/uploads")
+	require.NoError(t, err)
+	assert.Empty(t, entries, "empty upload not removed")
+
+	gcode := upload("model.gcode", "; generated by OrcaSlicer\nM104 S210\n"+plainGCode)
+	assert.Equal(t, http.StatusOK, gcode.Code, gcode.Body.String())
+
+	text := upload("model.TXT", plainGCode)
+	assert.Equal(t, http.StatusOK, text.Code, text.Body.String())
+
+	model := upload("model.stl", plainGCode)
+	assert.Equal(t, http.StatusBadRequest, model.Code)
+	assert.Contains(t, model.Body.String(), "unsupported_extension")
+
+	entries, err = os.ReadDir("files/uploads")
+	require.NoError(t, err)
+	assert.Empty(t, entries, "upload with unsupported extension saved")
+}
+
+func TestReceiveRequest_StreamsLargeUpload(t *testing.T) {
+	uploadDir := UploadDir
+	t.Cleanup(func() { UploadDir = uploadDir })
+
+	UploadDir = t.TempDir()
+
+	const size = 16 << 20
+
+	line := []byte("G1 X10.000 Y10.000 E0.12345 ; streamed upload line\n")
+	hash := sha256.New()
+
+	body, bodyWriter := io.Pipe()
+	writer := multipart.NewWriter(bodyWriter)
+
+	go func() {
+		part, err := writer.CreateFormFile("file", "large.gcode")
+		if err != nil {
+			bodyWriter.CloseWithError(err)
+			return
+		}
+
+		for written := 0; written < size; written += len(line) {
+			_, _ = hash.Write(line)
+
+			_, err = part.Write(line)
+			if err != nil {
+				bodyWriter.CloseWithError(err)
+				return
+			}
+		}
+
+		// Browsers send the fields in form order, here after the file
+		_ = writer.WriteField("iterations", "2")
+		_ = writer.WriteField("printer", "unit-tests")
+		bodyWriter.CloseWithError(writer.Close())
+	}()
+
+	r := httptest.NewRequest("POST", "/upload", body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+
+	var before, after runtime.MemStats
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	req, err := receiveRequest(httptest.NewRecorder(), r)
+
+	runtime.ReadMemStats(&after)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(2), req.Iterations)
+	assert.Equal(t, "unit-tests", req.Printer)
+
+	allocated := after.TotalAlloc - before.TotalAlloc
+	t.Logf("allocated %d bytes for a %d byte upload", allocated, size)
+	assert.Less(t, allocated, uint64(size/16), "upload buffered in memory")
+
+	saved, err := os.Open(filepath.Join(UploadDir, req.FileName))
+	require.NoError(t, err)
+	defer saved.Close()
+
+	savedHash := sha256.New()
+	_, err = io.Copy(savedHash, saved)
+	require.NoError(t, err)
+	assert.Equal(t, hash.Sum(nil), savedHash.Sum(nil), "saved upload differs")
+}
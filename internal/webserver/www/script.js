@@ -31,9 +31,16 @@ function initializeApp() {
         customSubmitBtn.addEventListener('click', handleCustomFormSubmit);
     }
 
+    // Prefill the printer's default values when one is selected
+    const printerSelect = document.getElementById('printer');
+    if (printerSelect) {
+        loadPrinterDefaults(printerSelect);
+    }
+
     // File input change handling
     if (fileInput) {
         fileInput.addEventListener('change', handleFileSelect);
+        loadAllowedExtensions(fileInput);
     }
 
     // Drag and drop functionality
@@ -74,6 +81,57 @@ function initializeApp() {
     initializeHintSystem();
 }
 
+// Offer the extensions the server accepts in the file picker, keeping the page's list if loading fails
+function loadAllowedExtensions(fileInput) {
+    fetch('./allowed-extensions')
+        .then(response => response.ok ? response.json() : null)
+        .then(extensions => {
+            if (Array.isArray(extensions) && extensions.length > 0) {
+                fileInput.setAttribute('accept', extensions.join(','));
+            }
+        })
+        .catch(error => console.error('Allowed extensions error:', error));
+}
+
+// Fill iterations and wait values with the defaults of the selected printer's profile, if it has any
+function loadPrinterDefaults(printerSelect) {
+    fetch('./printers')
+        .then(response => response.ok ? response.json() : null)
+        .then(printers => {
+            if (!Array.isArray(printers)) {
+                return;
+            }
+
+            printerSelect.addEventListener('change', function() {
+                const key = this.value.replace(/ /g, '-').toLowerCase();
+                const printer = printers.find(p => p.key === key);
+                if (!printer) {
+                    return;
+                }
+
+                if (printer.default_iterations) {
+                    document.getElementById('iterations').value = printer.default_iterations;
+                }
+                prefillOptionalValue('wait_min_checkbox', 'wait_min', printer.default_wait_min);
+                prefillOptionalValue('waitBedCooldownTempCheckbox', 'waitBedCooldownTemp', printer.default_wait_bed_cooldown_temp);
+            });
+        })
+        .catch(error => console.error('Printers error:', error));
+}
+
+// Set an optional input and enable its checkbox when value is given
+function prefillOptionalValue(checkboxId, inputId, value) {
+    const checkbox = document.getElementById(checkboxId);
+    const input = document.getElementById(inputId);
+    if (!value || !checkbox || !input) {
+        return;
+    }
+
+    input.value = value;
+    checkbox.checked = true;
+    checkbox.dispatchEvent(new Event('change'));
+}
+
 function setupSelectValidation() {
     const selectInputs = document.querySelectorAll('.form-select');
 
@@ -658,6 +716,12 @@ function initializeHintSystem() {
     let showTimeout = null;
     let hideTimeout = null;
 
+    // Load all hints of the page language at once, showHint falls back to fetching single keys
+    const currentLang = document.documentElement.lang || 'en';
+    const hintsLoaded = fetch(`./hints?lang=${encodeURIComponent(currentLang)}`)
+        .then(response => response.ok ? response.json() : {})
+        .catch(() => ({}));
+
     // Add click and hover handlers to hint icons
     hintIcons.forEach(icon => {
         const hintKey = icon.getAttribute('data-hint');
@@ -740,16 +804,19 @@ function initializeHintSystem() {
     function showHint(hintKey) {
         clearAllTimeouts();
         
-        // Get current language from page's lang attribute, which matches server-side language detection
-        const currentLang = document.documentElement.lang || 'en';
-        
-        // Fetch the hint content
-        fetch(`./hint?key=${encodeURIComponent(hintKey)}&lang=${encodeURIComponent(currentLang)}`)
-            .then(response => {
-                if (!response.ok) {
-                    throw new Error(`Failed to load hint: ${response.status}`);
+        // Use the preloaded hint, or fetch it if it's missing
+        hintsLoaded
+            .then(hints => {
+                if (hints[hintKey]) {
+                    return hints[hintKey];
                 }
-                return response.text();
+                return fetch(`./hint?key=${encodeURIComponent(hintKey)}&lang=${encodeURIComponent(currentLang)}`)
+                    .then(response => {
+                        if (!response.ok) {
+                            throw new Error(`Failed to load hint: ${response.status}`);
+                        }
+                        return response.text();
+                    });
             })
             .then(hintText => {
                 if (hintPopupBody) {
@@ -1,49 +1,106 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"path"
+	"printloop/internal/processor"
 	"printloop/internal/webserver"
 	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
+	selfTest := flag.String("selftest", "", "loop a generated sample with the named embedded printer, check the output and exit")
+	addrFlag := flag.String("addr", "", "listen address, host or host:port (env PRINTLOOP_ADDR)")
+	portFlag := flag.String("port", "", "listen port, overrides the port of -addr (env PRINTLOOP_PORT, default 8080)")
+	flag.Parse()
+
+	setFlags := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	if *selfTest != "" {
+		os.Exit(runSelfTest(*selfTest))
+	}
+
 	initLogger()
 
+	addr, err := listenAddress(listenFlags(*addrFlag, *portFlag, setFlags, os.Getenv))
+	if err != nil {
+		slog.Error("Invalid listen address", "err", err)
+		os.Exit(2)
+	}
+
 	// Initialize translations
-	err := webserver.LoadTranslations()
+	err = webserver.LoadTranslations()
 	if err != nil {
 		slog.Error("Failed to load translations:", "err", err)
 		return
 	}
 
-	err = os.MkdirAll("files", 0755)
-	if err != nil {
-		slog.Error("Failed to create files directory:", "err", err)
-		return
+	if lang := os.Getenv("PRINTLOOP_DEFAULT_LANG"); lang != "" {
+		err = webserver.SetDefaultLanguage(lang)
+		if err != nil {
+			slog.Warn("Keeping English as default language", "err", err)
+		}
+	}
+
+	// Uploads and results live below the data root, e.g. a mounted volume
+	if dataDir := os.Getenv("PRINTLOOP_DATA_DIR"); dataDir != "" {
+		webserver.UploadDir = path.Join(dataDir, "uploads")
+		webserver.ResultsDir = path.Join(dataDir, "results")
+	}
+
+	// Printer definitions added or replaced without rebuilding
+	if profilesDir := os.Getenv("PRINTLOOP_PROFILES_DIR"); profilesDir != "" {
+		processor.ProfilesDir = profilesDir
 	}
 
-	err = os.MkdirAll("files/uploads", 0755)
+	err = os.MkdirAll(webserver.UploadDir, 0755)
 	if err != nil {
-		slog.Error("Failed to create files/uploads directory:", "err", err)
+		slog.Error("Failed to create uploads directory:", "dir", webserver.UploadDir, "err", err)
 		return
 	}
 
-	err = os.MkdirAll("files/results", 0755)
+	err = os.MkdirAll(webserver.ResultsDir, 0755)
 	if err != nil {
-		slog.Error("Failed to create files/results directory:", "err", err)
+		slog.Error("Failed to create results directory:", "dir", webserver.ResultsDir, "err", err)
 		return
 	}
 
+	// Remove files left behind by requests that never finished, e.g. after a crash
+	cleanupTTL := durationFromEnv("PRINTLOOP_CLEANUP_TTL", time.Hour)
+	cleanupInterval := durationFromEnv("PRINTLOOP_CLEANUP_INTERVAL", 10*time.Minute)
+	webserver.StartSweeper(context.Background(), []string{webserver.UploadDir, webserver.ResultsDir}, cleanupTTL, cleanupInterval)
+
 	mux := http.NewServeMux()
 
 	// Setup routes
 	mux.HandleFunc("/", webserver.HomeHandler)
-	mux.HandleFunc("POST /upload", webserver.UploadHandler)
+	mux.Handle("POST /upload", webserver.RateLimitMiddleware(http.HandlerFunc(webserver.UploadHandler)))
+	mux.Handle("POST /upload/ndjson", webserver.RateLimitMiddleware(http.HandlerFunc(webserver.NDJSONUploadHandler)))
 	mux.HandleFunc("/template", webserver.TemplateHandler)
+	mux.HandleFunc("POST /template/block", webserver.TemplateBlockHandler)
+	mux.HandleFunc("POST /estimate", webserver.EstimateHandler)
+	mux.HandleFunc("POST /import", webserver.ImportHandler)
 	mux.HandleFunc("/hint", webserver.HintHandler)
+	mux.HandleFunc("/hints", webserver.HintsHandler)
+	mux.HandleFunc("/manifest", webserver.ManifestHandler)
+	mux.HandleFunc("/preview", webserver.PreviewHandler)
+	mux.HandleFunc("/healthz", webserver.HealthHandler)
+	mux.HandleFunc("/fields", webserver.FieldsHandler)
+	mux.HandleFunc("/printers", webserver.PrintersHandler)
+	mux.HandleFunc("/allowed-extensions", webserver.AllowedExtensionsHandler)
+	mux.HandleFunc("GET /printers/{name}/sample", webserver.PrinterSampleHandler)
+	mux.HandleFunc("GET /printers/{name}/parameters", webserver.PrinterParametersHandler)
+	mux.HandleFunc("GET /sample", webserver.SampleHandler)
+	mux.HandleFunc("/progress", webserver.ProgressHandler)
 	// Serve static files from embedded FS
 	mux.Handle("/www/", http.StripPrefix("/www/", webserver.StaticFileServer()))
 	// Favicon routes - serve from embedded www directory
@@ -57,16 +114,118 @@ func main() {
 	handler := webserver.CompressionMiddleware(mux)
 	handler = webserver.LogPageRef(handler)
 
-	slog.Info("Server started on port :8080")
-	slog.Info("Open http://localhost:8080 in your browser")
+	_, port, _ := net.SplitHostPort(addr)
+	slog.Info("Server started", "addr", addr)
+	slog.Info("Open http://localhost:" + port + " in your browser")
 
-	err = http.ListenAndServe(":8080", handler)
+	err = http.ListenAndServe(addr, handler)
 	if err != nil {
 		slog.Error("Server startup error", "err", err)
 		return
 	}
 }
 
+// runSelfTest runs processor.SelfTest for printer, prints a line per check and returns the exit code
+func runSelfTest(printer string) int {
+	checks, err := processor.SelfTest(printer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "self-test for %s could not run: %v\n", printer, err)
+		return 2
+	}
+
+	failed := 0
+
+	for _, check := range checks {
+		status := "PASS"
+		if !check.Passed {
+			status = "FAIL"
+			failed++
+		}
+
+		if check.Detail != "" {
+			fmt.Printf("%s %s: %s\n", status, check.Name, check.Detail)
+		} else {
+			fmt.Printf("%s %s\n", status, check.Name)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("self-test for %s: %d of %d checks failed\n", printer, failed, len(checks))
+		return 1
+	}
+
+	fmt.Printf("self-test for %s: all %d checks passed, %d iterations\n", printer, len(checks), processor.SelfTestIterations)
+
+	return 0
+}
+
+// defaultPort is the listen port when neither -port nor -addr sets one
+const defaultPort = "8080"
+
+// listenAddress combines addr, a host or host:port, and port into the address to listen on. port
+// overrides the port of addr, without either the server listens on defaultPort.
+func listenAddress(addr, port string) (string, error) {
+	host := addr
+
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		host = h
+
+		if port == "" {
+			port = p
+		}
+	} else if strings.HasPrefix(addr, "[") && strings.HasSuffix(addr, "]") {
+		// A bracketed IPv6 host without a port, JoinHostPort adds the brackets again
+		host = addr[1 : len(addr)-1]
+	}
+
+	if port == "" {
+		port = defaultPort
+	}
+
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 1 || number > 65535 {
+		return "", fmt.Errorf("invalid port %q: must be between 1 and 65535", port)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// listenFlags returns the -addr and -port values, falling back to PRINTLOOP_ADDR and PRINTLOOP_PORT
+// for the flags not in set, the names of those given on the command line. The port from the
+// environment only applies when addr has no port of its own.
+func listenFlags(addr, port string, set map[string]bool, getenv func(string) string) (string, string) {
+	if !set["addr"] {
+		addr = getenv("PRINTLOOP_ADDR")
+	}
+
+	if !set["port"] {
+		port = ""
+
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			port = getenv("PRINTLOOP_PORT")
+		}
+	}
+
+	return addr, port
+}
+
+// durationFromEnv returns the positive duration in the environment variable name, like "30m", or
+// fallback when it is unset or invalid
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		slog.Warn("Ignoring invalid duration", "name", name, "value", value, "default", fallback)
+		return fallback
+	}
+
+	return duration
+}
+
 func initLogger() {
 	const useJSON = true
 
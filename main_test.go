@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestListenAddress(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		addr     string
+		port     string
+		expected string
+		wantErr  bool
+	}{
+		{name: "defaults", expected: ":8080"},
+		{name: "port only", port: "9000", expected: ":9000"},
+		{name: "host only", addr: "127.0.0.1", expected: "127.0.0.1:8080"},
+		{name: "host and port", addr: "0.0.0.0:3000", expected: "0.0.0.0:3000"},
+		{name: "port overrides addr", addr: "0.0.0.0:3000", port: "4000", expected: "0.0.0.0:4000"},
+		{name: "empty host with port", addr: ":3000", expected: ":3000"},
+		{name: "ipv6 host", addr: "::1", port: "9000", expected: "[::1]:9000"},
+		{name: "bracketed ipv6 host", addr: "[::1]", expected: "[::1]:8080"},
+		{name: "bracketed ipv6 host and port", addr: "[::1]:3000", expected: "[::1]:3000"},
+		{name: "port zero", port: "0", wantErr: true},
+		{name: "port too large", port: "65536", wantErr: true},
+		{name: "port not a number", addr: "localhost:http", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := listenAddress(tt.addr, tt.port)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %q", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got != tt.expected {
+				t.Errorf("listenAddress(%q, %q) = %q, want %q", tt.addr, tt.port, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestListenFlags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		expected string
+	}{
+		{name: "defaults", expected: ":8080"},
+		{name: "env only", env: map[string]string{"PRINTLOOP_ADDR": "127.0.0.1", "PRINTLOOP_PORT": "9001"}, expected: "127.0.0.1:9001"},
+		{name: "flag addr port beats env port", args: []string{"-addr", "host:9000"}, env: map[string]string{"PRINTLOOP_PORT": "8081"}, expected: "host:9000"},
+		{name: "flag addr beats env addr", args: []string{"-addr", "host"}, env: map[string]string{"PRINTLOOP_ADDR": "other:7000", "PRINTLOOP_PORT": "8081"}, expected: "host:8081"},
+		{name: "env addr port beats env port", env: map[string]string{"PRINTLOOP_ADDR": "host:7000", "PRINTLOOP_PORT": "8081"}, expected: "host:7000"},
+		{name: "flag port beats addr port", args: []string{"-addr", "host:9000", "-port", "9100"}, env: map[string]string{"PRINTLOOP_PORT": "8081"}, expected: "host:9100"},
+		{name: "flag port beats env port", args: []string{"-port", "9100"}, env: map[string]string{"PRINTLOOP_ADDR": "host:7000", "PRINTLOOP_PORT": "8081"}, expected: "host:9100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			flags := flag.NewFlagSet("printloop", flag.ContinueOnError)
+			addr := flags.String("addr", "", "")
+			port := flags.String("port", "", "")
+
+			err := flags.Parse(tt.args)
+			if err != nil {
+				t.Fatalf("Failed to parse flags: %v", err)
+			}
+
+			set := map[string]bool{}
+			flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+			got, err := listenAddress(listenFlags(*addr, *port, set, func(name string) string { return tt.env[name] }))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got != tt.expected {
+				t.Errorf("Expected %q for %v with %v, got %q", tt.expected, tt.args, tt.env, got)
+			}
+		})
+	}
+}